@@ -0,0 +1,148 @@
+// Command admin runs maintenance tasks against the app's database.
+//
+//	admin remap-todos -from 203.0.113.7 -to someone@example.com
+//	admin remap-todos -file remaps.csv -dry-run
+//
+// remap-todos moves todos between owners. Before accounts, todos were owned by the
+// address they were created from; this hands them to the accounts they belong to.
+// The file holds one "from,to" pair per line, and lines starting with # are skipped.
+// All pairs are applied in one transaction, so either every one moves or none does.
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	_ "time/tzdata"
+
+	"github.com/goku-m/starter/internal/authz"
+	"github.com/goku-m/starter/internal/config"
+	"github.com/goku-m/starter/internal/logger"
+	"github.com/goku-m/starter/internal/repository"
+	"github.com/goku-m/starter/internal/server"
+	"github.com/goku-m/starter/internal/service"
+)
+
+const usage = `usage: admin <command> [flags]
+
+commands:
+  remap-todos   move todos from one owner to another, e.g. from an IP address to an account
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "remap-todos":
+		err = remapTodos(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func remapTodos(args []string) error {
+	flags := flag.NewFlagSet("remap-todos", flag.ExitOnError)
+	from := flags.String("from", "", "owner to move todos from, such as an IP address")
+	to := flags.String("to", "", "user id or account email to move them to")
+	file := flags.String("file", "", "CSV of from,to pairs to apply together")
+	dryRun := flags.Bool("dry-run", false, "report what would move without moving it")
+	flags.Parse(args)
+
+	var remaps []service.TodoOwnerRemap
+	switch {
+	case *file != "" && (*from != "" || *to != ""):
+		return errors.New("use either -file or -from and -to")
+	case *file != "":
+		var err error
+		if remaps, err = readRemaps(*file); err != nil {
+			return err
+		}
+	case *from != "" && *to != "":
+		remaps = []service.TodoOwnerRemap{{From: *from, To: *to}}
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	log := logger.NewLoggerWithService(cfg.Observability)
+
+	srv, err := server.NewCommand(cfg, &log)
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+
+	repos := repository.NewRepositories(srv)
+	claims := service.NewTodoClaimService(srv, repos.Todo, repos.User)
+
+	ctx := authz.WithPrincipal(context.Background(), authz.System)
+	if err := claims.RemapTodoOwners(ctx, remaps, *dryRun); err != nil {
+		return err
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "FROM\tTO\tTODOS")
+	total := 0
+	for _, remap := range remaps {
+		fmt.Fprintf(out, "%s\t%s\t%d\n", remap.From, remap.To, remap.Todos)
+		total += remap.Todos
+	}
+	out.Flush()
+
+	if *dryRun {
+		fmt.Printf("dry run: %d todos would move\n", total)
+	} else {
+		fmt.Printf("%d todos moved\n", total)
+	}
+	return nil
+}
+
+func readRemaps(path string) ([]service.TodoOwnerRemap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	var remaps []service.TodoOwnerRemap
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		remaps = append(remaps, service.TodoOwnerRemap{From: record[0], To: record[1]})
+	}
+
+	if len(remaps) == 0 {
+		return nil, fmt.Errorf("%s has no remaps", path)
+	}
+	return remaps, nil
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/signal"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/goku-m/starter/internal/config"
 	"github.com/goku-m/starter/internal/database"
@@ -50,6 +51,11 @@ func main() {
 	}
 	handlers := handler.NewHandlers(srv, services)
 
+	// Only now that services have registered their task handlers
+	if err := srv.Job.Start(); err != nil {
+		log.Fatal().Err(err).Msg("failed to start job server")
+	}
+
 	// Initialize router
 	r := router.NewRouter(srv, handlers)
 
@@ -58,6 +64,11 @@ func main() {
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 
+	// Fan out change events from every instance to this instance's open streams
+	go services.Realtime.Run(ctx)
+	// Relay committed outbox events to their sinks
+	go services.Outbox.Run(ctx)
+
 	// Start server
 	go func() {
 		if err = srv.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -0,0 +1,108 @@
+// Package authz decides what a caller may do. Roles map to sets of permissions, and
+// checks run against the Principal carried on the context, so handlers, services,
+// jobs and CLIs all enforce the same rules.
+package authz
+
+import (
+	"context"
+	"slices"
+
+	"github.com/goku-m/starter/internal/errs"
+)
+
+const (
+	TodosRead      = "todos:read"
+	TodosWrite     = "todos:write"
+	TodosDelete    = "todos:delete"
+	WebhooksManage = "webhooks:manage"
+	UsersManage    = "users:manage"
+)
+
+const (
+	RoleViewer = "viewer"
+	RoleMember = "member"
+	RoleAdmin  = "admin"
+	// DefaultRole is given to accounts, and tokens without a role claim
+	DefaultRole = RoleMember
+)
+
+var rolePermissions = map[string][]string{
+	RoleViewer: {TodosRead},
+	RoleMember: {TodosRead, TodosWrite, TodosDelete, WebhooksManage},
+	RoleAdmin:  {TodosRead, TodosWrite, TodosDelete, WebhooksManage, UsersManage},
+}
+
+// Roles lists the roles an account can be given
+var Roles = []string{RoleViewer, RoleMember, RoleAdmin}
+
+// Principal is who is acting and what they may do
+type Principal struct {
+	UserID      string
+	Role        string
+	Permissions []string
+}
+
+// System acts for jobs and maintenance commands, with every permission
+var System = Principal{
+	UserID:      "system",
+	Role:        "system",
+	Permissions: rolePermissions[RoleAdmin],
+}
+
+// Permissions returns what role grants plus any permissions granted directly, such as
+// by a token claim. An empty role is DefaultRole; an unknown role grants nothing.
+func Permissions(role string, granted ...string) []string {
+	if role == "" {
+		role = DefaultRole
+	}
+
+	permissions := slices.Concat(rolePermissions[role], granted)
+	slices.Sort(permissions)
+	return slices.Compact(permissions)
+}
+
+// Restrict keeps only the permissions that are also in allowed
+func Restrict(permissions, allowed []string) []string {
+	kept := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		if slices.Contains(allowed, p) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func (p Principal) Can(permission string) bool {
+	return slices.Contains(p.Permissions, permission)
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// Require fails with a 403 naming the permission unless the context's principal has it
+func Require(ctx context.Context, permission string) error {
+	if p, ok := PrincipalFrom(ctx); ok && p.Can(permission) {
+		return nil
+	}
+	return Forbidden(permission)
+}
+
+// Forbidden is the 403 for a missing permission
+func Forbidden(permission string) *errs.HTTPError {
+	err := errs.NewForbiddenError("Missing permission: "+permission, true)
+	err.Permission = permission
+	return err
+}
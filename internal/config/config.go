@@ -18,6 +18,7 @@ type Config struct {
 	Auth          AuthConfig           `koanf:"auth" validate:"required"`
 	Redis         RedisConfig          `koanf:"redis" validate:"required"`
 	Integration   IntegrationConfig    `koanf:"integration" validate:"required"`
+	Webhook       WebhookConfig        `koanf:"webhook"`
 	Observability *ObservabilityConfig `koanf:"observability"`
 }
 
@@ -31,6 +32,19 @@ type ServerConfig struct {
 	WriteTimeout       int      `koanf:"write_timeout" validate:"required"`
 	IdleTimeout        int      `koanf:"idle_timeout" validate:"required"`
 	CORSAllowedOrigins []string `koanf:"cors_allowed_origins" `
+	// Reverse proxies, as CIDRs, whose X-Forwarded-For is believed. Without any the
+	// client address is the connection's peer, since anyone can send the header.
+	TrustedProxies []string `koanf:"trusted_proxies" validate:"dive,cidr"`
+	// Base URL for links sent out of band, such as emails; defaults to http://localhost:<port>
+	PublicURL string `koanf:"public_url"`
+}
+
+// BaseURL is where the app is reached from outside, without a trailing slash
+func (c *ServerConfig) BaseURL() string {
+	if c.PublicURL == "" {
+		return "http://localhost:" + c.Port
+	}
+	return strings.TrimSuffix(c.PublicURL, "/")
 }
 
 type DatabaseConfig struct {
@@ -44,6 +58,14 @@ type DatabaseConfig struct {
 	MaxIdleConns    int    `koanf:"max_idle_conns" validate:"required"`
 	ConnMaxLifetime int    `koanf:"conn_max_lifetime" validate:"required"`
 	ConnMaxIdleTime int    `koanf:"conn_max_idle_time" validate:"required"`
+	// Read replicas as host or host:port; they share the primary's credentials
+	ReplicaHosts []string `koanf:"replica_hosts"`
+	// Seconds a replica may lag before reads fail over to the primary
+	ReplicaMaxLag int `koanf:"replica_max_lag"`
+	// Seconds a user's reads stay on the primary after they write. The pins are kept
+	// in Redis when it is configured, so they hold across instances; without Redis
+	// each instance only pins the reads it serves itself.
+	ReadYourWritesWindow int `koanf:"read_your_writes_window"`
 }
 type RedisConfig struct {
 	Address string `koanf:"address"  ` //validate:"required"
@@ -53,8 +75,53 @@ type IntegrationConfig struct {
 	ResendAPIKey string `koanf:"resend_api_key" ` //validate:"required"
 }
 
+type WebhookConfig struct {
+	// Lets endpoints resolve to loopback and private addresses, for trying webhooks
+	// against a receiver on the same machine. Never enable it in production: users
+	// could reach internal services through their endpoints.
+	AllowPrivateTargets bool `koanf:"allow_private_targets"`
+}
+
 type AuthConfig struct {
-	SecretKey string `koanf:"secret_key" ` //validate:"required"
+	// Keys the HMACs behind CSRF tokens, sign-in links, and the two-factor, OIDC and
+	// todo claim cookies; anyone who knows it can forge them all. Use 32 or more random
+	// characters, such as the output of openssl rand -hex 32.
+	SecretKey string `koanf:"secret_key" validate:"required,min=32"`
+	// JWKS that bearer and cookie JWTs from an external identity provider are verified
+	// against. When empty, only built-in account sessions are accepted.
+	JWKSURL string `koanf:"jwks_url"`
+	// Seconds between JWKS refreshes; unknown key ids refetch sooner
+	JWKSRefreshInterval int    `koanf:"jwks_refresh_interval"`
+	JWTIssuer           string `koanf:"jwt_issuer"`
+	JWTAudience         string `koanf:"jwt_audience"`
+	// Claims holding the user's role and permissions; default "role" and "permissions"
+	JWTRoleClaim        string `koanf:"jwt_role_claim"`
+	JWTPermissionsClaim string `koanf:"jwt_permissions_claim"`
+	// Cookie carrying the identity provider's JWT for browser requests; defaults to "__session"
+	JWTCookie string `koanf:"jwt_cookie"`
+	// Where built-in account sessions live: "postgres" (default) or "redis"
+	SessionStore string `koanf:"session_store"`
+	// Seconds a session stays valid without activity; defaults to 14 days
+	SessionTTL int `koanf:"session_ttl"`
+	// OpenID Connect provider for "Log in with ..." (Keycloak, Google Workspace, Dex).
+	// Disabled unless the issuer and client id are set. The redirect URI to register
+	// with the provider is <public_url>/auth/oidc/callback.
+	OIDCIssuer       string   `koanf:"oidc_issuer"`
+	OIDCClientID     string   `koanf:"oidc_client_id"`
+	OIDCClientSecret string   `koanf:"oidc_client_secret"`
+	OIDCScopes       []string `koanf:"oidc_scopes"`
+	// Shown on the login button; defaults to "SSO"
+	OIDCProviderName string `koanf:"oidc_provider_name"`
+	// Whether a verified email from the provider may sign into an existing account with
+	// that email. Only enable for providers that own the email domains they vouch for.
+	OIDCTrustEmail bool `koanf:"oidc_trust_email"`
+	// Names the account in authenticator apps; defaults to "GO-BP"
+	TOTPIssuer string `koanf:"totp_issuer"`
+}
+
+// OIDCEnabled reports whether OIDC login is configured
+func (c *AuthConfig) OIDCEnabled() bool {
+	return c.OIDCIssuer != "" && c.OIDCClientID != ""
 }
 
 func LoadConfig() (*Config, error) {
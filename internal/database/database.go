@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/url"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/goku-m/starter/internal/config"
@@ -20,6 +21,13 @@ import (
 type Database struct {
 	Pool *pgxpool.Pool
 	log  *zerolog.Logger
+
+	replicas     []*replica
+	next         atomic.Uint64
+	maxLag       time.Duration
+	pins         PinStore
+	pinWindow    time.Duration
+	stopReplicas context.CancelFunc
 }
 
 // multiTracer allows chaining multiple tracers
@@ -52,9 +60,43 @@ func (mt *multiTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data p
 
 const DatabasePingTimeout = 10
 
-func New(cfg *config.Config, logger *zerolog.Logger) (*Database, error) {
+// New connects the primary and any replicas. pins keeps read-your-writes pins; nil
+// holds them in this process, which only works while there is a single instance.
+func New(cfg *config.Config, logger *zerolog.Logger, pins PinStore) (*Database, error) {
+	if pins == nil {
+		pins = NewMemoryPinStore()
+	}
+
 	hostPort := net.JoinHostPort(cfg.Database.Host, strconv.Itoa(cfg.Database.Port))
 
+	pool, err := newPool(cfg, hostPort, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	database := &Database{
+		Pool: pool,
+		log:  logger,
+		pins: pins,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DatabasePingTimeout*time.Second)
+	defer cancel()
+	if err = pool.Ping(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	logger.Info().Msg("connected to the database")
+
+	if err := database.connectReplicas(cfg); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return database, nil
+}
+
+func newPool(cfg *config.Config, hostPort string, logger *zerolog.Logger) (*pgxpool.Pool, error) {
 	// URL-encode the password
 	encodedPassword := url.QueryEscape(cfg.Database.Password)
 	dsn := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=%s",
@@ -96,24 +138,12 @@ func New(cfg *config.Config, logger *zerolog.Logger) (*Database, error) {
 		return nil, fmt.Errorf("failed to create pgx pool: %w", err)
 	}
 
-	database := &Database{
-		Pool: pool,
-		log:  logger,
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), DatabasePingTimeout*time.Second)
-	defer cancel()
-	if err = pool.Ping(ctx); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
-	}
-
-	logger.Info().Msg("connected to the database")
-
-	return database, nil
+	return pool, nil
 }
 
 func (db *Database) Close() error {
 	db.log.Info().Msg("closing database connection pool")
+	db.closeReplicas()
 	db.Pool.Close()
 	return nil
 }
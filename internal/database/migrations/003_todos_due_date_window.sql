@@ -0,0 +1,3 @@
+-- Composite index for fetching a user's todos within a due date window (calendar/agenda)
+CREATE INDEX idx_todos_user_due_date ON todos(user_id, due_date)
+    WHERE due_date IS NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE todos
+    ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX idx_todos_tags ON todos USING GIN (tags);
@@ -0,0 +1,5 @@
+ALTER TABLE todos
+    ADD COLUMN snoozed_until TIMESTAMPTZ;
+
+CREATE INDEX idx_todos_user_snoozed_until ON todos(user_id, snoozed_until)
+    WHERE snoozed_until IS NOT NULL;
@@ -0,0 +1,12 @@
+-- Append-only log of per-user change events, used to stream and resume real-time updates
+CREATE TABLE events (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    user_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    data JSONB NOT NULL
+);
+
+CREATE INDEX idx_events_user_id_id ON events(user_id, id);
+CREATE INDEX idx_events_created_at ON events(created_at);
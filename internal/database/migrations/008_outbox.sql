@@ -0,0 +1,26 @@
+-- Domain events written in the same transaction as the change that caused them,
+-- relayed to sinks by the outbox worker
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    aggregate_type TEXT NOT NULL,
+    aggregate_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ,
+    published_at TIMESTAMPTZ,
+    dead_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_outbox_pending ON outbox(id)
+WHERE
+    published_at IS NULL
+    AND dead_at IS NULL;
+
+CREATE INDEX idx_outbox_published_at ON outbox(published_at)
+WHERE
+    published_at IS NOT NULL;
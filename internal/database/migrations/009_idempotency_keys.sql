@@ -0,0 +1,18 @@
+-- Responses to mutating API requests, replayed when a client retries with the same Idempotency-Key
+CREATE TABLE idempotency_keys (
+    user_id TEXT NOT NULL,
+    key TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ,
+
+    fingerprint TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'in_flight',
+    response_status INT,
+    response_headers JSONB,
+    response_body BYTEA,
+
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
@@ -0,0 +1,36 @@
+-- Archives of everything stored for a user, built by a background job and downloaded through an emailed link
+CREATE TABLE data_exports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    user_id TEXT NOT NULL,
+    email TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    archive BYTEA,
+    token_hash TEXT,
+    expires_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    error TEXT
+);
+
+CREATE INDEX idx_data_exports_user_id ON data_exports(user_id);
+CREATE INDEX idx_data_exports_expires_at ON data_exports(expires_at) WHERE archive IS NOT NULL;
+
+CREATE TRIGGER set_updated_at_data_exports
+    BEFORE UPDATE ON data_exports
+    FOR EACH ROW
+    EXECUTE FUNCTION trigger_set_updated_at();
+
+-- Proof that an erasure ran. The subject is only named by a keyed hash, so the record
+-- itself holds no personal data.
+CREATE TABLE erasure_audit (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    subject_hash TEXT NOT NULL,
+    request_id TEXT,
+    deleted_rows JSONB NOT NULL
+);
+
+CREATE INDEX idx_erasure_audit_subject_hash ON erasure_audit(subject_hash);
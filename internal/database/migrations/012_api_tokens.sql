@@ -0,0 +1,23 @@
+-- Personal API tokens for scripts and CI. Only the SHA-256 of the token is kept; the
+-- plain value is shown once when the token is created.
+CREATE TABLE api_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    -- The first characters of the token, so users can tell their tokens apart
+    token_prefix TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
+
+CREATE TRIGGER set_updated_at_api_tokens
+    BEFORE UPDATE ON api_tokens
+    FOR EACH ROW
+    EXECUTE FUNCTION trigger_set_updated_at();
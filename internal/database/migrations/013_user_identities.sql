@@ -0,0 +1,24 @@
+-- Accounts created through an OpenID provider have no password
+ALTER TABLE users ALTER COLUMN password_hash DROP NOT NULL;
+
+-- Links between accounts and the OpenID provider identities that can sign into them
+CREATE TABLE user_identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    -- As last reported by the provider, for display only
+    email TEXT,
+
+    UNIQUE (issuer, subject)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+CREATE TRIGGER set_updated_at_user_identities
+    BEFORE UPDATE ON user_identities
+    FOR EACH ROW
+    EXECUTE FUNCTION trigger_set_updated_at();
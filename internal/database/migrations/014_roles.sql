@@ -0,0 +1,5 @@
+-- Roles map to permissions in code (internal/authz), so adding a role needs no migration
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'member';
+
+-- Sessions keep the role they were started with; changing a role ends the user's sessions
+ALTER TABLE sessions ADD COLUMN role TEXT NOT NULL DEFAULT 'member';
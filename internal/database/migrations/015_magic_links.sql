@@ -0,0 +1,20 @@
+-- Emailed sign-in links. Only a keyed hash of the token is kept, and a link is spent
+-- by setting used_at, so each one signs in once.
+CREATE TABLE magic_links (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+-- Rate limiting counts a user's recent links
+CREATE INDEX idx_magic_links_user_id_created_at ON magic_links(user_id, created_at);
+
+CREATE TRIGGER set_updated_at_magic_links
+    BEFORE UPDATE ON magic_links
+    FOR EACH ROW
+    EXECUTE FUNCTION trigger_set_updated_at();
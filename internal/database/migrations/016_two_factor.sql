@@ -0,0 +1,28 @@
+-- TOTP two-factor authentication. totp_secret is set when enrollment starts and
+-- totp_enabled_at once the user proves their app has it; totp_last_step stops a code
+-- being used twice.
+ALTER TABLE users
+    ADD COLUMN totp_secret TEXT,
+    ADD COLUMN totp_enabled_at TIMESTAMPTZ,
+    ADD COLUMN totp_last_step BIGINT,
+    -- Failed second-factor attempts, so codes can't be guessed through repeated tries
+    ADD COLUMN totp_failures INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN totp_failed_at TIMESTAMPTZ;
+
+-- One-time recovery codes, stored hashed; a code is spent by setting used_at
+CREATE TABLE user_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMPTZ,
+
+    UNIQUE (user_id, code_hash)
+);
+
+CREATE TRIGGER set_updated_at_user_recovery_codes
+    BEFORE UPDATE ON user_recovery_codes
+    FOR EACH ROW
+    EXECUTE FUNCTION trigger_set_updated_at();
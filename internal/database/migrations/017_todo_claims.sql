@@ -0,0 +1,5 @@
+-- Before accounts, todos were owned by the address they were created from, so older
+-- rows have an IP in todos.user_id. Each account is offered those of its address
+-- once, at its first login; todo_claim_offered_at records that it was.
+ALTER TABLE users
+    ADD COLUMN todo_claim_offered_at TIMESTAMPTZ;
@@ -0,0 +1,7 @@
+-- What the creator of a token could do when it was created. A token never does more,
+-- even when its owner has no account row to read a current role from, as with users
+-- signed in through an external identity provider. Tokens from before this column
+-- are NULL: they follow their account's role, or get viewer access without one.
+ALTER TABLE api_tokens
+    ADD COLUMN owner_role TEXT,
+    ADD COLUMN owner_permissions TEXT[];
@@ -0,0 +1,7 @@
+-- The outbox message a delivery was dispatched for. The relay dispatches messages
+-- itself and may do so again after a crash, so each endpoint gets one delivery per
+-- message. Test pings and older deliveries have none.
+ALTER TABLE webhook_deliveries ADD COLUMN outbox_id BIGINT;
+
+CREATE UNIQUE INDEX idx_webhook_deliveries_webhook_id_outbox_id ON webhook_deliveries(webhook_id, outbox_id)
+    WHERE outbox_id IS NOT NULL;
@@ -0,0 +1,11 @@
+-- Failed password logins, counted per email and per client IP so passwords can't be
+-- guessed through repeated tries. Emails are stored hashed, and unknown ones are
+-- counted too, so a lockout doesn't reveal which accounts exist.
+CREATE TABLE login_failures (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    failed_at TIMESTAMPTZ NOT NULL
+);
+
+-- Counts whose window has passed are swept by failed_at
+CREATE INDEX idx_login_failures_failed_at ON login_failures(failed_at);
@@ -0,0 +1,6 @@
+-- The relay skips messages queued behind a backing-off message of the same aggregate,
+-- looking the earlier ones up by aggregate
+CREATE INDEX idx_outbox_pending_aggregate ON outbox(aggregate_type, aggregate_id, id)
+WHERE
+    published_at IS NULL
+    AND dead_at IS NULL;
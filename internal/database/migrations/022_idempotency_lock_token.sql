@@ -0,0 +1,4 @@
+-- Identifies the request holding an in-flight key, so a request whose lock lapsed and
+-- was taken over can't overwrite or release the new holder's record
+ALTER TABLE idempotency_keys
+ADD COLUMN lock_token UUID;
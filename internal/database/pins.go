@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// PinStore remembers which readers must read from the primary, and until when
+type PinStore interface {
+	Pin(ctx context.Context, userID string, ttl time.Duration) error
+	Pinned(ctx context.Context, userID string) (bool, error)
+}
+
+// MemoryPinStore holds pins in this process, so a write only pins the reader's
+// requests served by the same instance
+type MemoryPinStore struct {
+	pins sync.Map
+
+	// Now can be replaced to expire pins against a fixed time
+	Now func() time.Time
+}
+
+func NewMemoryPinStore() *MemoryPinStore {
+	return &MemoryPinStore{Now: time.Now}
+}
+
+func (s *MemoryPinStore) Pin(_ context.Context, userID string, ttl time.Duration) error {
+	s.pins.Store(userID, s.Now().Add(ttl))
+	return nil
+}
+
+func (s *MemoryPinStore) Pinned(_ context.Context, userID string) (bool, error) {
+	value, ok := s.pins.Load(userID)
+	if !ok {
+		return false, nil
+	}
+
+	if s.Now().Before(value.(time.Time)) {
+		return true, nil
+	}
+
+	s.pins.CompareAndDelete(userID, value)
+	return false, nil
+}
+
+// expire drops the pins of readers who haven't read since theirs ran out
+func (s *MemoryPinStore) expire() {
+	now := s.Now()
+	s.pins.Range(func(key, value any) bool {
+		if now.After(value.(time.Time)) {
+			s.pins.CompareAndDelete(key, value)
+		}
+		return true
+	})
+}
+
+// RedisPinStore keeps pins in Redis, shared by every instance, so a write pins the
+// reader's next requests wherever they land
+type RedisPinStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisPinStore(client *redis.Client, prefix string) *RedisPinStore {
+	return &RedisPinStore{client: client, prefix: prefix}
+}
+
+func (s *RedisPinStore) Pin(ctx context.Context, userID string, ttl time.Duration) error {
+	return s.client.Set(ctx, s.prefix+userID, 1, ttl).Err()
+}
+
+func (s *RedisPinStore) Pinned(ctx context.Context, userID string) (bool, error) {
+	n, err := s.client.Exists(ctx, s.prefix+userID).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
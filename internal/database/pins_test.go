@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryPinStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+	store := NewMemoryPinStore()
+	store.Now = func() time.Time { return now }
+
+	require.NoError(t, store.Pin(ctx, "user-1", 5*time.Second))
+
+	pinned, err := store.Pinned(ctx, "user-1")
+	require.NoError(t, err)
+	assert.True(t, pinned)
+
+	pinned, err = store.Pinned(ctx, "user-2")
+	require.NoError(t, err)
+	assert.False(t, pinned, "pins are per reader")
+
+	now = now.Add(5 * time.Second)
+	pinned, err = store.Pinned(ctx, "user-1")
+	require.NoError(t, err)
+	assert.False(t, pinned, "pins run out after the window")
+}
+
+func TestMemoryPinStoreExpire(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+	store := NewMemoryPinStore()
+	store.Now = func() time.Time { return now }
+
+	require.NoError(t, store.Pin(ctx, "user-1", time.Second))
+	require.NoError(t, store.Pin(ctx, "user-2", time.Minute))
+
+	now = now.Add(2 * time.Second)
+	store.expire()
+
+	_, ok := store.pins.Load("user-1")
+	assert.False(t, ok)
+	_, ok = store.pins.Load("user-2")
+	assert.True(t, ok)
+}
+
+type failingPinStore struct{}
+
+func (failingPinStore) Pin(context.Context, string, time.Duration) error {
+	return errors.New("unreachable")
+}
+
+func (failingPinStore) Pinned(context.Context, string) (bool, error) {
+	return false, errors.New("unreachable")
+}
+
+func TestPinnedFailsOverToPrimary(t *testing.T) {
+	logger := zerolog.Nop()
+	db := &Database{log: &logger, pins: failingPinStore{}}
+
+	assert.True(t, db.pinned(context.Background(), "user-1"), "an unreachable store pins to the primary")
+	assert.False(t, db.pinned(context.Background(), ""), "anonymous reads are never pinned")
+}
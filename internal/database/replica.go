@@ -0,0 +1,188 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/goku-m/starter/internal/config"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	DefaultReplicaMaxLag        = 10 * time.Second
+	DefaultReadYourWritesWindow = 5 * time.Second
+	replicaCheckInterval        = 5 * time.Second
+	replicaCheckTimeout         = 2 * time.Second
+)
+
+type replica struct {
+	host    string
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+}
+
+type readerKey struct{}
+
+// ContextWithReader identifies who is reading, so their reads can be pinned to the
+// primary right after they write
+func ContextWithReader(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, readerKey{}, userID)
+}
+
+func readerFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(readerKey{}).(string)
+	return userID
+}
+
+// connectReplicas opens a pool per configured replica. Replicas start unhealthy and
+// only receive reads once a health check has passed.
+func (db *Database) connectReplicas(cfg *config.Config) error {
+	db.maxLag = time.Duration(cfg.Database.ReplicaMaxLag) * time.Second
+	if db.maxLag <= 0 {
+		db.maxLag = DefaultReplicaMaxLag
+	}
+	db.pinWindow = time.Duration(cfg.Database.ReadYourWritesWindow) * time.Second
+	if db.pinWindow <= 0 {
+		db.pinWindow = DefaultReadYourWritesWindow
+	}
+
+	if len(cfg.Database.ReplicaHosts) == 0 {
+		return nil
+	}
+
+	for _, host := range cfg.Database.ReplicaHosts {
+		hostPort := host
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			hostPort = net.JoinHostPort(host, strconv.Itoa(cfg.Database.Port))
+		}
+
+		pool, err := newPool(cfg, hostPort, db.log)
+		if err != nil {
+			db.closeReplicas()
+			return fmt.Errorf("failed to create replica pool for host=%s: %w", host, err)
+		}
+
+		db.replicas = append(db.replicas, &replica{host: host, pool: pool})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	db.stopReplicas = cancel
+
+	db.checkReplicas(ctx)
+	go db.monitorReplicas(ctx)
+
+	return nil
+}
+
+func (db *Database) closeReplicas() {
+	if db.stopReplicas != nil {
+		db.stopReplicas()
+	}
+	for _, r := range db.replicas {
+		r.pool.Close()
+	}
+}
+
+func (db *Database) monitorReplicas(ctx context.Context) {
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			db.checkReplicas(ctx)
+			if pins, ok := db.pins.(*MemoryPinStore); ok {
+				pins.expire()
+			}
+		}
+	}
+}
+
+// checkReplicas marks a replica healthy when it answers and has replayed the primary's
+// WAL recently enough. An idle primary produces no new WAL, so a replica that has
+// caught up with everything it received also counts as current.
+func (db *Database) checkReplicas(ctx context.Context) {
+	stmt := `
+		SELECT
+			CASE
+				WHEN pg_last_wal_receive_lsn()=pg_last_wal_replay_lsn() THEN 0
+				ELSE COALESCE(EXTRACT(EPOCH FROM NOW()-pg_last_xact_replay_timestamp()), 0)
+			END
+	`
+
+	for _, r := range db.replicas {
+		checkCtx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+
+		var lagSeconds float64
+		err := r.pool.QueryRow(checkCtx, stmt).Scan(&lagSeconds)
+		cancel()
+
+		lag := time.Duration(lagSeconds * float64(time.Second))
+		healthy := err == nil && lag <= db.maxLag
+
+		if r.healthy.Swap(healthy) != healthy {
+			event := db.log.Info()
+			if !healthy {
+				event = db.log.Warn().Err(err).Dur("lag", lag)
+			}
+			event.Str("replica", r.host).Bool("healthy", healthy).Msg("database replica health changed")
+		}
+	}
+}
+
+// Reader returns where a read-only query should run: the transaction carried by ctx,
+// the primary while the reader is pinned after a write, or otherwise the next healthy
+// replica. With no healthy replica, reads fail over to the primary.
+func (db *Database) Reader(ctx context.Context) Querier {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+
+	if len(db.replicas) == 0 || db.pinned(ctx, readerFromContext(ctx)) {
+		return db.Pool
+	}
+
+	start := db.next.Add(1)
+	for i := range uint64(len(db.replicas)) {
+		r := db.replicas[(start+i)%uint64(len(db.replicas))]
+		if r.healthy.Load() {
+			return r.pool
+		}
+	}
+
+	return db.Pool
+}
+
+// MarkWritten pins the reader carried by ctx to the primary for the read-your-writes
+// window, so a replica that has not caught up yet cannot hide their write
+func (db *Database) MarkWritten(ctx context.Context) {
+	userID := readerFromContext(ctx)
+	if userID == "" || len(db.replicas) == 0 {
+		return
+	}
+
+	if err := db.pins.Pin(ctx, userID, db.pinWindow); err != nil {
+		db.log.Warn().Err(err).Msg("failed to pin reader to the primary")
+	}
+}
+
+// pinned reports whether userID's reads must go to the primary. When the pin store
+// can't be reached, they do, since reading a stale replica is the worse outcome.
+func (db *Database) pinned(ctx context.Context, userID string) bool {
+	if userID == "" {
+		return false
+	}
+
+	pinned, err := db.pins.Pinned(ctx, userID)
+	if err != nil {
+		db.log.Warn().Err(err).Msg("failed to check read-your-writes pin")
+		return true
+	}
+	return pinned
+}
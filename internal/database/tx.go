@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Querier is implemented by both *pgxpool.Pool and pgx.Tx, so repositories can run
+// the same statements inside or outside a transaction. Begin on a pgx.Tx opens a
+// savepoint.
+type Querier interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+type txKey struct{}
+
+// ContextWithTx returns a context that makes repositories use tx
+func ContextWithTx(ctx context.Context, tx pgx.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// TxFromContext returns the transaction carried by ctx, if any
+func TxFromContext(ctx context.Context) (pgx.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(pgx.Tx)
+	return tx, ok
+}
+
+// Querier returns the transaction carried by ctx, or the pool when there is none
+func (db *Database) Querier(ctx context.Context) Querier {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return db.Pool
+}
+
+// InTx runs fn with a context carrying a transaction. When ctx already carries one,
+// fn runs in a savepoint of it, so a failure only undoes fn's own writes and the
+// outer transaction decides whether anything is committed.
+func (db *Database) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return db.InTxWith(ctx, pgx.TxOptions{}, fn)
+}
+
+// InTxWith is InTx with options for a new transaction, such as its isolation level.
+// A savepoint runs in the transaction it is part of, so opts only apply when ctx
+// carries none.
+func (db *Database) InTxWith(ctx context.Context, opts pgx.TxOptions, fn func(ctx context.Context) error) error {
+	var tx pgx.Tx
+	var err error
+	if outer, ok := TxFromContext(ctx); ok {
+		tx, err = outer.Begin(ctx)
+	} else {
+		tx, err = db.Pool.BeginTx(ctx, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(ContextWithTx(ctx, tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	db.MarkWritten(ctx)
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goku-m/starter/internal/database"
+	testutil "github.com/goku-m/starter/internal/testing"
+)
+
+func setupTxTest(t *testing.T) (*database.Database, func()) {
+	t.Helper()
+
+	testDB, srv, cleanup := testutil.SetupTest(t)
+	_, err := testDB.Pool.Exec(context.Background(), `CREATE TABLE tx_test (id INT PRIMARY KEY)`)
+	require.NoError(t, err)
+
+	return srv.DB, cleanup
+}
+
+func txTestIDs(t *testing.T, db *database.Database) []int {
+	t.Helper()
+
+	rows, err := db.Pool.Query(context.Background(), `SELECT id FROM tx_test ORDER BY id`)
+	require.NoError(t, err)
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	require.NoError(t, err)
+	return ids
+}
+
+func TestInTxSavepointRollsBackAlone(t *testing.T) {
+	db, cleanup := setupTxTest(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	errInner := errors.New("inner failed")
+
+	err := db.InTx(ctx, func(ctx context.Context) error {
+		if _, err := db.Querier(ctx).Exec(ctx, `INSERT INTO tx_test (id) VALUES (1)`); err != nil {
+			return err
+		}
+
+		// A closure that fails after writing
+		err := db.InTx(ctx, func(ctx context.Context) error {
+			if _, err := db.Querier(ctx).Exec(ctx, `INSERT INTO tx_test (id) VALUES (2)`); err != nil {
+				return err
+			}
+			return errInner
+		})
+		assert.ErrorIs(t, err, errInner)
+
+		// A statement that fails, which would abort a transaction without the savepoint
+		err = db.InTx(ctx, func(ctx context.Context) error {
+			_, err := db.Querier(ctx).Exec(ctx, `INSERT INTO tx_test (id) VALUES (1)`)
+			return err
+		})
+		assert.Error(t, err)
+
+		// The outer transaction is still usable
+		_, err = db.Querier(ctx).Exec(ctx, `INSERT INTO tx_test (id) VALUES (3)`)
+		return err
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{1, 3}, txTestIDs(t, db))
+}
+
+func TestInTxOuterRollbackUndoesSavepoint(t *testing.T) {
+	db, cleanup := setupTxTest(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	errOuter := errors.New("outer failed")
+
+	err := db.InTx(ctx, func(ctx context.Context) error {
+		err := db.InTx(ctx, func(ctx context.Context) error {
+			_, err := db.Querier(ctx).Exec(ctx, `INSERT INTO tx_test (id) VALUES (1)`)
+			return err
+		})
+		require.NoError(t, err)
+		return errOuter
+	})
+	require.ErrorIs(t, err, errOuter)
+
+	assert.Empty(t, txTestIDs(t, db))
+}
+
+func TestInTxWithIsolationLevel(t *testing.T) {
+	db, cleanup := setupTxTest(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	isolation := func(ctx context.Context) string {
+		var level string
+		require.NoError(t, db.Querier(ctx).QueryRow(ctx, `SHOW transaction_isolation`).Scan(&level))
+		return level
+	}
+
+	err := db.InTx(ctx, func(ctx context.Context) error {
+		assert.Equal(t, "read committed", isolation(ctx))
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = db.InTxWith(ctx, pgx.TxOptions{IsoLevel: pgx.Serializable}, func(ctx context.Context) error {
+		assert.Equal(t, "serializable", isolation(ctx))
+
+		// A savepoint keeps the level of the transaction it is part of
+		return db.InTxWith(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted}, func(ctx context.Context) error {
+			assert.Equal(t, "serializable", isolation(ctx))
+			return nil
+		})
+	})
+	require.NoError(t, err)
+}
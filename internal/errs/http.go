@@ -30,6 +30,8 @@ type HTTPError struct {
 	Errors []FieldError `json:"errors"`
 	// action to be taken
 	Action *Action `json:"action"`
+	// permission the caller lacked, for 403s
+	Permission string `json:"permission,omitempty"`
 }
 
 func (e *HTTPError) Error() string {
@@ -44,12 +46,13 @@ func (e *HTTPError) Is(target error) bool {
 
 func (e *HTTPError) WithMessage(message string) *HTTPError {
 	return &HTTPError{
-		Code:     e.Code,
-		Message:  message,
-		Status:   e.Status,
-		Override: e.Override,
-		Errors:   e.Errors,
-		Action:   e.Action,
+		Code:       e.Code,
+		Message:    message,
+		Status:     e.Status,
+		Override:   e.Override,
+		Errors:     e.Errors,
+		Action:     e.Action,
+		Permission: e.Permission,
 	}
 }
 
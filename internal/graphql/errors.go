@@ -0,0 +1,65 @@
+package graphql
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/lib/dataloader"
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/sqlerr"
+	"github.com/labstack/echo/v4"
+)
+
+// Error carries an errs.HTTPError through the executor so clients see the same codes as
+// the REST API under "extensions"
+type Error struct {
+	*errs.HTTPError
+}
+
+func (e *Error) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{
+		"code":   e.Code,
+		"status": e.Status,
+	}
+	if len(e.Errors) > 0 {
+		extensions["errors"] = e.Errors
+	}
+	if e.Permission != "" {
+		extensions["permission"] = e.Permission
+	}
+
+	return extensions
+}
+
+// wrapError maps resolver errors the same way the global error handler does
+func wrapError(c echo.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, dataloader.ErrNotFound) {
+		code := "TODO_NOT_FOUND"
+		return &Error{errs.NewNotFoundError("todo not found", false, &code)}
+	}
+
+	var httpErr *errs.HTTPError
+	if !errors.As(err, &httpErr) {
+		errors.As(sqlerr.HandleError(err), &httpErr)
+	}
+
+	if httpErr.Status >= http.StatusInternalServerError {
+		logger := middleware.GetLogger(c)
+		logger.Error().Stack().Err(err).Msg("graphql resolver failed")
+	}
+
+	return &Error{httpErr}
+}
+
+func newLimitError(code, message string) *Error {
+	return &Error{&errs.HTTPError{
+		Code:    code,
+		Message: message,
+		Status:  http.StatusBadRequest,
+	}}
+}
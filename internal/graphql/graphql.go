@@ -0,0 +1,68 @@
+package graphql
+
+import (
+	gql "github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/labstack/echo/v4"
+
+	"github.com/goku-m/starter/internal/service"
+)
+
+// Request is a standard GraphQL-over-HTTP request body
+type Request struct {
+	Query         string                 `json:"query" query:"query"`
+	OperationName string                 `json:"operationName" query:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Executor runs GraphQL requests against the todo domain
+type Executor struct {
+	schema      gql.Schema
+	todoService *service.TodoService
+}
+
+func NewExecutor(todoService *service.TodoService) (*Executor, error) {
+	schema, err := newSchema(&resolver{todoService: todoService})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Executor{
+		schema:      schema,
+		todoService: todoService,
+	}, nil
+}
+
+// Execute parses, validates and limits the request before running it. The second
+// return value reports whether the request was rejected before execution.
+func (e *Executor) Execute(c echo.Context, req *Request) (*gql.Result, bool) {
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{
+			Body: []byte(req.Query),
+			Name: "GraphQL request",
+		}),
+	})
+	if err != nil {
+		return &gql.Result{Errors: gqlerrors.FormatErrors(err)}, true
+	}
+
+	if result := gql.ValidateDocument(&e.schema, doc, nil); !result.IsValid {
+		return &gql.Result{Errors: result.Errors}, true
+	}
+
+	if err := checkLimits(doc, req.OperationName, req.Variables); err != nil {
+		return &gql.Result{Errors: []gqlerrors.FormattedError{
+			{Message: err.Error(), Extensions: err.Extensions()},
+		}}, true
+	}
+
+	return gql.Execute(gql.ExecuteParams{
+		Schema:        e.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       withRequestContext(c, e.todoService),
+	}), false
+}
@@ -0,0 +1,131 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+const (
+	MaxDepth      = 6
+	MaxComplexity = 500
+
+	// defaultListSize is assumed for list fields queried without an explicit limit
+	defaultListSize = 20
+)
+
+// listFields maps fields returning many items to the argument that bounds them
+var listFields = map[string]string{
+	"todos": "limit",
+}
+
+// limiter measures the selected operation, following fragments, before anything executes
+type limiter struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+// checkLimits rejects operations that nest deeper than MaxDepth or whose estimated cost
+// exceeds MaxComplexity. Each field costs one, and list fields multiply the cost of
+// their selections by the number of items they may return.
+func checkLimits(doc *ast.Document, operationName string, variables map[string]interface{}) *Error {
+	l := &limiter{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+	}
+
+	var operation *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			l.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				operation = def
+			}
+		}
+	}
+	if operation == nil {
+		return nil
+	}
+
+	depth, complexity := l.measure(operation.SelectionSet, 1, map[string]bool{})
+	if depth > MaxDepth {
+		return newLimitError("QUERY_TOO_DEEP", fmt.Sprintf("query depth %d exceeds the maximum of %d", depth, MaxDepth))
+	}
+	if complexity > MaxComplexity {
+		return newLimitError("QUERY_TOO_COMPLEX", fmt.Sprintf("query complexity %d exceeds the maximum of %d", complexity, MaxComplexity))
+	}
+
+	return nil
+}
+
+// measure returns the deepest field level and the total cost of a selection set
+func (l *limiter) measure(set *ast.SelectionSet, level int, visiting map[string]bool) (int, int) {
+	if set == nil {
+		return level - 1, 0
+	}
+
+	maxDepth, total := level, 0
+	for _, selection := range set.Selections {
+		var depth, cost int
+
+		switch selection := selection.(type) {
+		case *ast.Field:
+			childDepth, childCost := l.measure(selection.SelectionSet, level+1, visiting)
+			depth = max(level, childDepth)
+			cost = 1 + childCost*l.multiplier(selection)
+		case *ast.InlineFragment:
+			depth, cost = l.measure(selection.SelectionSet, level, visiting)
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, ok := l.fragments[name]
+			// Cycles are rejected by validation; the guard only keeps this walk finite
+			if !ok || visiting[name] {
+				continue
+			}
+			visiting[name] = true
+			depth, cost = l.measure(fragment.SelectionSet, level, visiting)
+			delete(visiting, name)
+		}
+
+		maxDepth = max(maxDepth, depth)
+		total += cost
+	}
+
+	return maxDepth, total
+}
+
+func (l *limiter) multiplier(field *ast.Field) int {
+	argName, ok := listFields[field.Name.Value]
+	if !ok {
+		return 1
+	}
+
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != argName {
+			continue
+		}
+
+		switch value := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(value.Value); err == nil && n > 0 {
+				return n
+			}
+		case *ast.Variable:
+			switch n := l.variables[value.Name.Value].(type) {
+			case float64:
+				if n > 0 {
+					return int(n)
+				}
+			case int:
+				if n > 0 {
+					return n
+				}
+			}
+		}
+	}
+
+	return defaultListSize
+}
@@ -0,0 +1,69 @@
+package graphql
+
+import (
+	"context"
+
+	"github.com/goku-m/starter/internal/lib/dataloader"
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/model/todo"
+	"github.com/goku-m/starter/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type contextKey struct{}
+
+// requestContext is what every resolver of one request shares
+type requestContext struct {
+	echo    echo.Context
+	userID  string
+	loaders *loaders
+}
+
+// loaders batch lookups made by sibling fields, e.g. several aliased todo(id:) queries
+type loaders struct {
+	todoByID *dataloader.Loader[uuid.UUID, *todo.Todo]
+	stats    *dataloader.Loader[string, *todo.TodoStats]
+}
+
+func newLoaders(c echo.Context, todoService *service.TodoService, userID string) *loaders {
+	return &loaders{
+		todoByID: dataloader.New(func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*todo.Todo, error) {
+			items, err := todoService.GetTodosByIDs(c, userID, ids)
+			if err != nil {
+				return nil, err
+			}
+
+			result := make(map[uuid.UUID]*todo.Todo, len(items))
+			for i := range items {
+				result[items[i].ID] = &items[i].Todo
+			}
+			return result, nil
+		}),
+		stats: dataloader.New(func(ctx context.Context, userIDs []string) (map[string]*todo.TodoStats, error) {
+			result := make(map[string]*todo.TodoStats, len(userIDs))
+			for _, id := range userIDs {
+				stats, err := todoService.GetTodoStats(c, id)
+				if err != nil {
+					return nil, err
+				}
+				result[id] = stats
+			}
+			return result, nil
+		}),
+	}
+}
+
+func withRequestContext(c echo.Context, todoService *service.TodoService) context.Context {
+	userID := middleware.GetUserID(c)
+
+	return context.WithValue(c.Request().Context(), contextKey{}, &requestContext{
+		echo:    c,
+		userID:  userID,
+		loaders: newLoaders(c, todoService, userID),
+	})
+}
+
+func fromContext(ctx context.Context) *requestContext {
+	return ctx.Value(contextKey{}).(*requestContext)
+}
@@ -0,0 +1,252 @@
+package graphql
+
+import (
+	"time"
+
+	gql "github.com/graphql-go/graphql"
+
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/model/todo"
+	"github.com/goku-m/starter/internal/service"
+	"github.com/goku-m/starter/internal/validation"
+	"github.com/google/uuid"
+)
+
+type resolver struct {
+	todoService *service.TodoService
+}
+
+func (r *resolver) todo(p gql.ResolveParams) (interface{}, error) {
+	rc := fromContext(p.Context)
+
+	id, err := parseID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+
+	// Returning a thunk lets sibling todo(id:) fields share one query
+	thunk := rc.loaders.todoByID.Load(p.Context, id)
+	return func() (interface{}, error) {
+		item, err := thunk()
+		if err != nil {
+			return nil, wrapError(rc.echo, err)
+		}
+		return item, nil
+	}, nil
+}
+
+func (r *resolver) todos(p gql.ResolveParams) (interface{}, error) {
+	rc := fromContext(p.Context)
+
+	query := &todo.GetTodosQuery{
+		Page:      intArg(p.Args, "page"),
+		Limit:     intArg(p.Args, "limit"),
+		Sort:      stringArg(p.Args, "sort"),
+		Order:     stringArg(p.Args, "order"),
+		Search:    stringArg(p.Args, "search"),
+		Overdue:   boolArg(p.Args, "overdue"),
+		Completed: boolArg(p.Args, "completed"),
+		Snoozed:   boolArg(p.Args, "snoozed"),
+	}
+	if status, ok := p.Args["status"].(todo.Status); ok {
+		query.Status = &status
+	}
+	if priority, ok := p.Args["priority"].(todo.Priority); ok {
+		query.Priority = &priority
+	}
+
+	if err := validation.Validate(query); err != nil {
+		return nil, wrapError(rc.echo, err)
+	}
+
+	result, err := r.todoService.GetTodos(rc.echo, rc.userID, query)
+	if err != nil {
+		return nil, wrapError(rc.echo, err)
+	}
+
+	items := make([]*todo.Todo, len(result.Data))
+	for i := range result.Data {
+		items[i] = &result.Data[i].Todo
+	}
+
+	return map[string]interface{}{
+		"items":      items,
+		"page":       result.Page,
+		"limit":      result.Limit,
+		"total":      result.Total,
+		"totalPages": result.TotalPages,
+	}, nil
+}
+
+func (r *resolver) stats(p gql.ResolveParams) (interface{}, error) {
+	rc := fromContext(p.Context)
+
+	thunk := rc.loaders.stats.Load(p.Context, rc.userID)
+	return func() (interface{}, error) {
+		stats, err := thunk()
+		if err != nil {
+			return nil, wrapError(rc.echo, err)
+		}
+		return stats, nil
+	}, nil
+}
+
+func (r *resolver) createTodo(p gql.ResolveParams) (interface{}, error) {
+	rc := fromContext(p.Context)
+	input, _ := p.Args["input"].(map[string]interface{})
+
+	payload := &todo.CreateTodoPayload{
+		Title:       *stringArg(input, "title"),
+		Description: stringArg(input, "description"),
+		DueDate:     timeArg(input, "dueDate"),
+	}
+	if priority, ok := input["priority"].(todo.Priority); ok {
+		payload.Priority = &priority
+	}
+	if tags, ok := input["tags"].([]interface{}); ok {
+		payload.Tags = make([]string, 0, len(tags))
+		for _, tag := range tags {
+			payload.Tags = append(payload.Tags, tag.(string))
+		}
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return nil, wrapError(rc.echo, err)
+	}
+
+	item, err := r.todoService.CreateTodo(rc.echo, rc.userID, payload)
+	if err != nil {
+		return nil, wrapError(rc.echo, err)
+	}
+
+	return item, nil
+}
+
+func (r *resolver) updateTodo(p gql.ResolveParams) (interface{}, error) {
+	rc := fromContext(p.Context)
+	input, _ := p.Args["input"].(map[string]interface{})
+
+	id, err := parseID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &todo.UpdateTodoPayload{
+		ID:          id,
+		Title:       stringArg(input, "title"),
+		Description: stringArg(input, "description"),
+	}
+	if status, ok := input["status"].(todo.Status); ok {
+		payload.Status = &status
+	}
+	if priority, ok := input["priority"].(todo.Priority); ok {
+		payload.Priority = &priority
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return nil, wrapError(rc.echo, err)
+	}
+
+	item, err := r.todoService.UpdateTodo(rc.echo, rc.userID, payload)
+	if err != nil {
+		return nil, wrapError(rc.echo, err)
+	}
+
+	return item, nil
+}
+
+func (r *resolver) deleteTodo(p gql.ResolveParams) (interface{}, error) {
+	rc := fromContext(p.Context)
+
+	id, err := parseID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.todoService.DeleteTodo(rc.echo, rc.userID, id); err != nil {
+		return nil, wrapError(rc.echo, err)
+	}
+
+	return true, nil
+}
+
+func (r *resolver) snoozeTodo(p gql.ResolveParams) (interface{}, error) {
+	rc := fromContext(p.Context)
+
+	id, err := parseID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &todo.SnoozeTodoPayload{ID: id}
+	if until := timeArg(p.Args, "until"); until != nil {
+		payload.Until = *until
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return nil, wrapError(rc.echo, err)
+	}
+
+	item, err := r.todoService.SnoozeTodo(rc.echo, rc.userID, payload.ID, payload.Until)
+	if err != nil {
+		return nil, wrapError(rc.echo, err)
+	}
+
+	return item, nil
+}
+
+func (r *resolver) unsnoozeTodo(p gql.ResolveParams) (interface{}, error) {
+	rc := fromContext(p.Context)
+
+	id, err := parseID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := r.todoService.UnsnoozeTodo(rc.echo, rc.userID, id)
+	if err != nil {
+		return nil, wrapError(rc.echo, err)
+	}
+
+	return item, nil
+}
+
+func parseID(value interface{}) (uuid.UUID, error) {
+	raw, _ := value.(string)
+
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		code := "INVALID_ID"
+		return uuid.Nil, &Error{errs.NewBadRequestError("id must be a valid UUID", false, &code, nil, nil)}
+	}
+
+	return id, nil
+}
+
+func stringArg(args map[string]interface{}, name string) *string {
+	if value, ok := args[name].(string); ok {
+		return &value
+	}
+	return nil
+}
+
+func intArg(args map[string]interface{}, name string) *int {
+	if value, ok := args[name].(int); ok {
+		return &value
+	}
+	return nil
+}
+
+func boolArg(args map[string]interface{}, name string) *bool {
+	if value, ok := args[name].(bool); ok {
+		return &value
+	}
+	return nil
+}
+
+func timeArg(args map[string]interface{}, name string) *time.Time {
+	if value, ok := args[name].(time.Time); ok {
+		return &value
+	}
+	return nil
+}
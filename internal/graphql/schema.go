@@ -0,0 +1,185 @@
+package graphql
+
+import (
+	gql "github.com/graphql-go/graphql"
+
+	"github.com/goku-m/starter/internal/model/todo"
+)
+
+var todoStatusEnum = gql.NewEnum(gql.EnumConfig{
+	Name: "TodoStatus",
+	Values: gql.EnumValueConfigMap{
+		"draft":     &gql.EnumValueConfig{Value: todo.StatusDraft},
+		"active":    &gql.EnumValueConfig{Value: todo.StatusActive},
+		"completed": &gql.EnumValueConfig{Value: todo.StatusCompleted},
+		"archived":  &gql.EnumValueConfig{Value: todo.StatusArchived},
+	},
+})
+
+var todoPriorityEnum = gql.NewEnum(gql.EnumConfig{
+	Name: "TodoPriority",
+	Values: gql.EnumValueConfigMap{
+		"low":    &gql.EnumValueConfig{Value: todo.PriorityLow},
+		"medium": &gql.EnumValueConfig{Value: todo.PriorityMedium},
+		"high":   &gql.EnumValueConfig{Value: todo.PriorityHigh},
+	},
+})
+
+// todoField exposes a single field of the todo being resolved
+func todoField(typ gql.Output, get func(t *todo.Todo) interface{}) *gql.Field {
+	return &gql.Field{
+		Type: typ,
+		Resolve: func(p gql.ResolveParams) (interface{}, error) {
+			return get(p.Source.(*todo.Todo)), nil
+		},
+	}
+}
+
+var todoType = gql.NewObject(gql.ObjectConfig{
+	Name: "Todo",
+	Fields: gql.Fields{
+		"id":           todoField(gql.NewNonNull(gql.ID), func(t *todo.Todo) interface{} { return t.ID.String() }),
+		"createdAt":    todoField(gql.NewNonNull(gql.DateTime), func(t *todo.Todo) interface{} { return t.CreatedAt }),
+		"updatedAt":    todoField(gql.NewNonNull(gql.DateTime), func(t *todo.Todo) interface{} { return t.UpdatedAt }),
+		"title":        todoField(gql.NewNonNull(gql.String), func(t *todo.Todo) interface{} { return t.Title }),
+		"description":  todoField(gql.String, func(t *todo.Todo) interface{} { return t.Description }),
+		"status":       todoField(gql.NewNonNull(todoStatusEnum), func(t *todo.Todo) interface{} { return t.Status }),
+		"priority":     todoField(gql.NewNonNull(todoPriorityEnum), func(t *todo.Todo) interface{} { return t.Priority }),
+		"dueDate":      todoField(gql.DateTime, func(t *todo.Todo) interface{} { return t.DueDate }),
+		"completedAt":  todoField(gql.DateTime, func(t *todo.Todo) interface{} { return t.CompletedAt }),
+		"sortOrder":    todoField(gql.NewNonNull(gql.Int), func(t *todo.Todo) interface{} { return t.SortOrder }),
+		"tags":         todoField(gql.NewNonNull(gql.NewList(gql.NewNonNull(gql.String))), func(t *todo.Todo) interface{} { return t.Tags }),
+		"snoozedUntil": todoField(gql.DateTime, func(t *todo.Todo) interface{} { return t.SnoozedUntil }),
+		"overdue":      todoField(gql.NewNonNull(gql.Boolean), func(t *todo.Todo) interface{} { return t.IsOverdue() }),
+		"snoozed":      todoField(gql.NewNonNull(gql.Boolean), func(t *todo.Todo) interface{} { return t.IsSnoozed() }),
+	},
+})
+
+var todoStatsType = gql.NewObject(gql.ObjectConfig{
+	Name: "TodoStats",
+	Fields: gql.Fields{
+		"total":     &gql.Field{Type: gql.NewNonNull(gql.Int)},
+		"draft":     &gql.Field{Type: gql.NewNonNull(gql.Int)},
+		"active":    &gql.Field{Type: gql.NewNonNull(gql.Int)},
+		"completed": &gql.Field{Type: gql.NewNonNull(gql.Int)},
+		"archived":  &gql.Field{Type: gql.NewNonNull(gql.Int)},
+		"overdue":   &gql.Field{Type: gql.NewNonNull(gql.Int)},
+		"snoozed":   &gql.Field{Type: gql.NewNonNull(gql.Int)},
+	},
+})
+
+var todoPageType = gql.NewObject(gql.ObjectConfig{
+	Name: "TodoPage",
+	Fields: gql.Fields{
+		"items":      &gql.Field{Type: gql.NewNonNull(gql.NewList(gql.NewNonNull(todoType)))},
+		"page":       &gql.Field{Type: gql.NewNonNull(gql.Int)},
+		"limit":      &gql.Field{Type: gql.NewNonNull(gql.Int)},
+		"total":      &gql.Field{Type: gql.NewNonNull(gql.Int)},
+		"totalPages": &gql.Field{Type: gql.NewNonNull(gql.Int)},
+	},
+})
+
+var createTodoInput = gql.NewInputObject(gql.InputObjectConfig{
+	Name: "CreateTodoInput",
+	Fields: gql.InputObjectConfigFieldMap{
+		"title":       &gql.InputObjectFieldConfig{Type: gql.NewNonNull(gql.String)},
+		"description": &gql.InputObjectFieldConfig{Type: gql.String},
+		"priority":    &gql.InputObjectFieldConfig{Type: todoPriorityEnum},
+		"dueDate":     &gql.InputObjectFieldConfig{Type: gql.DateTime},
+		"tags":        &gql.InputObjectFieldConfig{Type: gql.NewList(gql.NewNonNull(gql.String))},
+	},
+})
+
+var updateTodoInput = gql.NewInputObject(gql.InputObjectConfig{
+	Name: "UpdateTodoInput",
+	Fields: gql.InputObjectConfigFieldMap{
+		"title":       &gql.InputObjectFieldConfig{Type: gql.String},
+		"description": &gql.InputObjectFieldConfig{Type: gql.String},
+		"status":      &gql.InputObjectFieldConfig{Type: todoStatusEnum},
+		"priority":    &gql.InputObjectFieldConfig{Type: todoPriorityEnum},
+	},
+})
+
+// todosArgs mirror the filters of GET /api/todos
+var todosArgs = gql.FieldConfigArgument{
+	"page":      &gql.ArgumentConfig{Type: gql.Int},
+	"limit":     &gql.ArgumentConfig{Type: gql.Int},
+	"sort":      &gql.ArgumentConfig{Type: gql.String},
+	"order":     &gql.ArgumentConfig{Type: gql.String},
+	"search":    &gql.ArgumentConfig{Type: gql.String},
+	"status":    &gql.ArgumentConfig{Type: todoStatusEnum},
+	"priority":  &gql.ArgumentConfig{Type: todoPriorityEnum},
+	"overdue":   &gql.ArgumentConfig{Type: gql.Boolean},
+	"completed": &gql.ArgumentConfig{Type: gql.Boolean},
+	"snoozed":   &gql.ArgumentConfig{Type: gql.Boolean},
+}
+
+func newSchema(r *resolver) (gql.Schema, error) {
+	idArg := gql.FieldConfigArgument{
+		"id": &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+	}
+
+	query := gql.NewObject(gql.ObjectConfig{
+		Name: "Query",
+		Fields: gql.Fields{
+			"todo": &gql.Field{
+				Type:    todoType,
+				Args:    idArg,
+				Resolve: r.todo,
+			},
+			"todos": &gql.Field{
+				Type:    gql.NewNonNull(todoPageType),
+				Args:    todosArgs,
+				Resolve: r.todos,
+			},
+			"stats": &gql.Field{
+				Type:    gql.NewNonNull(todoStatsType),
+				Resolve: r.stats,
+			},
+		},
+	})
+
+	mutation := gql.NewObject(gql.ObjectConfig{
+		Name: "Mutation",
+		Fields: gql.Fields{
+			"createTodo": &gql.Field{
+				Type: gql.NewNonNull(todoType),
+				Args: gql.FieldConfigArgument{
+					"input": &gql.ArgumentConfig{Type: gql.NewNonNull(createTodoInput)},
+				},
+				Resolve: r.createTodo,
+			},
+			"updateTodo": &gql.Field{
+				Type: gql.NewNonNull(todoType),
+				Args: gql.FieldConfigArgument{
+					"id":    &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+					"input": &gql.ArgumentConfig{Type: gql.NewNonNull(updateTodoInput)},
+				},
+				Resolve: r.updateTodo,
+			},
+			"deleteTodo": &gql.Field{
+				Type:    gql.NewNonNull(gql.Boolean),
+				Args:    idArg,
+				Resolve: r.deleteTodo,
+			},
+			"snoozeTodo": &gql.Field{
+				Type: gql.NewNonNull(todoType),
+				Args: gql.FieldConfigArgument{
+					"id":    &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+					"until": &gql.ArgumentConfig{Type: gql.NewNonNull(gql.DateTime)},
+				},
+				Resolve: r.snoozeTodo,
+			},
+			"unsnoozeTodo": &gql.Field{
+				Type:    gql.NewNonNull(todoType),
+				Args:    idArg,
+				Resolve: r.unsnoozeTodo,
+			},
+		},
+	})
+
+	return gql.NewSchema(gql.SchemaConfig{
+		Query:    query,
+		Mutation: mutation,
+	})
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/model/apitoken"
+	"github.com/goku-m/starter/internal/render"
+	"github.com/goku-m/starter/internal/server"
+	"github.com/goku-m/starter/internal/service"
+	"github.com/goku-m/starter/internal/validation"
+	"github.com/labstack/echo/v4"
+)
+
+type APITokenHandler struct {
+	Handler
+	apiTokenService *service.APITokenService
+}
+
+func NewAPITokenHandler(s *server.Server, apiTokenService *service.APITokenService) *APITokenHandler {
+	return &APITokenHandler{
+		Handler:         NewHandler(s),
+		apiTokenService: apiTokenService,
+	}
+}
+
+//PAGE HANDLERS
+
+func (h *APITokenHandler) TokensPage(c echo.Context) error {
+	return h.renderTokensPage(c, http.StatusOK, nil)
+}
+
+func (h *APITokenHandler) CreateAPIToken(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+
+	payload := &apitoken.CreateAPITokenPayload{}
+	if err := validation.BindAndValidate(c, payload); err != nil {
+		return err
+	}
+
+	created, err := h.apiTokenService.CreateAPIToken(c, userID, payload)
+	if err != nil {
+		return err
+	}
+
+	// Rendered rather than redirected: this response is the only place the token appears
+	return h.renderTokensPage(c, http.StatusCreated, created)
+}
+
+func (h *APITokenHandler) DeleteAPIToken(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+
+	payload := &apitoken.APITokenIDPayload{}
+	if err := validation.BindAndValidate(c, payload); err != nil {
+		return err
+	}
+
+	if err := h.apiTokenService.DeleteAPIToken(c, userID, payload.ID); err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/tokens")
+}
+
+func (h *APITokenHandler) renderTokensPage(c echo.Context, status int, created *apitoken.CreatedAPIToken) error {
+	userID := middleware.GetUserID(c)
+
+	items, err := h.apiTokenService.GetAPITokens(c, userID)
+	if err != nil {
+		return err
+	}
+
+	td := &render.TemplateData{
+		Data: map[string]interface{}{
+			"tokens":  items,
+			"scopes":  apitoken.Scopes,
+			"created": created,
+		},
+	}
+
+	if err := c.Render(status, "tokens", td); err != nil {
+		c.Logger().Error("TokensPage render error: ", err)
+		return err
+	}
+
+	return nil
+}
+
+//API HANDLERS
+
+func (h *APITokenHandler) GetAPITokensAPI(c echo.Context) error {
+	return Handle(
+		h.Handler,
+		func(c echo.Context, payload *apitoken.GetAPITokensPayload) ([]apitoken.APIToken, error) {
+			userID := middleware.GetUserID(c)
+			return h.apiTokenService.GetAPITokens(c, userID)
+		},
+		http.StatusOK,
+		&apitoken.GetAPITokensPayload{},
+	)(c)
+}
+
+func (h *APITokenHandler) CreateAPITokenAPI(c echo.Context) error {
+	return Handle(
+		h.Handler,
+		func(c echo.Context, payload *apitoken.CreateAPITokenPayload) (*apitoken.CreatedAPIToken, error) {
+			userID := middleware.GetUserID(c)
+			return h.apiTokenService.CreateAPIToken(c, userID, payload)
+		},
+		http.StatusCreated,
+		&apitoken.CreateAPITokenPayload{},
+	)(c)
+}
+
+func (h *APITokenHandler) DeleteAPITokenAPI(c echo.Context) error {
+	return HandleNoContent(
+		h.Handler,
+		func(c echo.Context, payload *apitoken.APITokenIDPayload) error {
+			userID := middleware.GetUserID(c)
+			return h.apiTokenService.DeleteAPIToken(c, userID, payload.ID)
+		},
+		http.StatusNoContent,
+		&apitoken.APITokenIDPayload{},
+	)(c)
+}
@@ -1,34 +1,632 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/lib/session"
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/model/user"
 	"github.com/goku-m/starter/internal/render"
 	"github.com/goku-m/starter/internal/server"
+	"github.com/goku-m/starter/internal/service"
+	"github.com/goku-m/starter/internal/validation"
 	"github.com/labstack/echo/v4"
 )
 
+const (
+	oidcFlowCookie = "starter_oidc"
+	oidcFlowMaxAge = 10 * 60
+	// Carries the two-factor challenge from the password step to the code step
+	twoFactorCookie = "starter_2fa"
+	twoFactorMaxAge = 5 * 60
+)
+
 type AuthHandler struct {
 	Handler
+	authService      *service.AuthService
+	oidcService      *service.OIDCService
+	todoClaimService *service.TodoClaimService
 }
 
-func NewAuthHandler(s *server.Server) *AuthHandler {
+func NewAuthHandler(s *server.Server, authService *service.AuthService, oidcService *service.OIDCService, todoClaimService *service.TodoClaimService) *AuthHandler {
 	return &AuthHandler{
-		Handler: NewHandler(s),
+		Handler:          NewHandler(s),
+		authService:      authService,
+		oidcService:      oidcService,
+		todoClaimService: todoClaimService,
+	}
+}
+
+//PAGE HANDLERS
+
+func (h *AuthHandler) LoginPage(c echo.Context) error {
+	if middleware.GetUserID(c) != "" {
+		return c.Redirect(http.StatusSeeOther, safeRedirect(c.QueryParam("next")))
+	}
+
+	return h.renderAuthPage(c, http.StatusOK, "login", c.QueryParam("next"), "", nil)
+}
+
+func (h *AuthHandler) SignupPage(c echo.Context) error {
+	if middleware.GetUserID(c) != "" {
+		return c.Redirect(http.StatusSeeOther, safeRedirect(c.QueryParam("next")))
+	}
+
+	return h.renderAuthPage(c, http.StatusOK, "signup", c.QueryParam("next"), "", nil)
+}
+
+func (h *AuthHandler) Login(c echo.Context) error {
+	payload := &user.LoginPayload{}
+	if err := validation.BindAndValidate(c, payload); err != nil {
+		return h.renderAuthPage(c, http.StatusBadRequest, "login", payload.Next, payload.Email, err)
+	}
+
+	result, err := h.authService.Login(c, payload)
+	if err != nil {
+		return h.renderAuthPage(c, http.StatusUnauthorized, "login", payload.Next, payload.Email, err)
+	}
+
+	return h.loggedIn(c, result)
+}
+
+func (h *AuthHandler) Signup(c echo.Context) error {
+	payload := &user.SignupPayload{}
+	if err := validation.BindAndValidate(c, payload); err != nil {
+		return h.renderAuthPage(c, http.StatusBadRequest, "signup", payload.Next, payload.Email, err)
+	}
+
+	account, token, err := h.authService.Signup(c, payload)
+	if err != nil {
+		return h.renderAuthPage(c, http.StatusConflict, "signup", payload.Next, payload.Email, err)
+	}
+
+	return h.sessionStarted(c, account, token, payload.Next)
+}
+
+func (h *AuthHandler) Logout(c echo.Context) error {
+	if err := h.authService.Logout(c); err != nil {
+		return err
+	}
+
+	c.SetCookie(session.ClearCookie(middleware.SecureCookies(h.server)))
+	return c.Redirect(http.StatusSeeOther, "/login")
+}
+
+func (h *AuthHandler) MagicLinkPage(c echo.Context) error {
+	if middleware.GetUserID(c) != "" {
+		return c.Redirect(http.StatusSeeOther, safeRedirect(c.QueryParam("next")))
+	}
+
+	return h.renderAuthPage(c, http.StatusOK, "magicLink", c.QueryParam("next"), "", nil)
+}
+
+func (h *AuthHandler) RequestMagicLink(c echo.Context) error {
+	payload := &user.RequestMagicLinkPayload{}
+	if err := validation.BindAndValidate(c, payload); err != nil {
+		return h.renderAuthPage(c, http.StatusBadRequest, "magicLink", payload.Next, payload.Email, err)
+	}
+
+	payload.Next = safeRedirect(payload.Next)
+	if err := h.authService.RequestMagicLink(c, payload); err != nil {
+		return h.renderAuthPage(c, http.StatusServiceUnavailable, "magicLink", payload.Next, payload.Email, err)
+	}
+
+	td := &render.TemplateData{
+		Data: map[string]interface{}{
+			"email": payload.Email,
+			"next":  payload.Next,
+		},
+	}
+
+	if err := c.Render(http.StatusOK, "magicLinkSent", td); err != nil {
+		c.Logger().Error("MagicLinkSent render error: ", err)
+		return err
+	}
+	return nil
+}
+
+// MagicLinkConfirmPage is where the emailed link lands. It only asks the user to
+// continue: mail scanners that follow links would otherwise spend them.
+func (h *AuthHandler) MagicLinkConfirmPage(c echo.Context) error {
+	payload := &user.MagicLinkPayload{}
+	if err := validation.BindAndValidate(c, payload); err != nil {
+		return h.renderAuthPage(c, http.StatusBadRequest, "magicLink", "", "", err)
+	}
+
+	td := &render.TemplateData{
+		Data: map[string]interface{}{
+			"token": payload.Token,
+			"next":  payload.Next,
+		},
+	}
+
+	if err := c.Render(http.StatusOK, "magicLinkConfirm", td); err != nil {
+		c.Logger().Error("MagicLinkConfirmPage render error: ", err)
+		return err
+	}
+	return nil
+}
+
+func (h *AuthHandler) LoginWithMagicLink(c echo.Context) error {
+	payload := &user.MagicLinkPayload{}
+	if err := validation.BindAndValidate(c, payload); err != nil {
+		return h.renderAuthPage(c, http.StatusBadRequest, "magicLink", payload.Next, "", err)
+	}
+
+	result, err := h.authService.LoginWithMagicLink(c, payload)
+	if err != nil {
+		return h.renderAuthPage(c, http.StatusBadRequest, "magicLink", payload.Next, "", err)
+	}
+
+	return h.loggedIn(c, result)
+}
+
+func (h *AuthHandler) TwoFactorPage(c echo.Context) error {
+	if _, err := c.Cookie(twoFactorCookie); err != nil {
+		return c.Redirect(http.StatusSeeOther, "/login")
+	}
+
+	return h.renderTwoFactorPage(c, http.StatusOK, nil)
+}
+
+// CompleteTwoFactor takes the code that finishes a login started with a password or link
+func (h *AuthHandler) CompleteTwoFactor(c echo.Context) error {
+	var challenge string
+	if cookie, err := c.Cookie(twoFactorCookie); err == nil {
+		challenge = cookie.Value
+	}
+
+	payload := &user.TwoFactorCodePayload{}
+	if err := validation.BindAndValidate(c, payload); err != nil {
+		return h.renderTwoFactorPage(c, http.StatusBadRequest, err)
+	}
+
+	result, err := h.authService.CompleteTwoFactor(c, challenge, payload)
+	if err != nil {
+		var httpErr *errs.HTTPError
+		if errors.As(err, &httpErr) && httpErr.Code == "TWO_FACTOR_CHALLENGE_EXPIRED" {
+			c.SetCookie(h.twoFactorCookie("", -1))
+			return h.renderAuthPage(c, http.StatusUnauthorized, "login", "", "", err)
+		}
+		return h.renderTwoFactorPage(c, http.StatusUnauthorized, err)
+	}
+
+	c.SetCookie(h.twoFactorCookie("", -1))
+	return h.loggedIn(c, result)
+}
+
+// loggedIn sets the session cookie for a finished login, or sends the browser on to
+// enter a code when the account has two-factor on
+func (h *AuthHandler) loggedIn(c echo.Context, result *service.LoginResult) error {
+	if result.Challenge != "" {
+		c.SetCookie(h.twoFactorCookie(result.Challenge, twoFactorMaxAge))
+		return c.Redirect(http.StatusSeeOther, service.TwoFactorPath)
+	}
+
+	return h.sessionStarted(c, result.User, result.SessionToken, result.Next)
+}
+
+// sessionStarted sets the cookie for a new session and, at an account's first login,
+// the offer of todos created from its address before it existed
+func (h *AuthHandler) sessionStarted(c echo.Context, account *user.User, token, next string) error {
+	c.SetCookie(session.Cookie(token, middleware.SessionTTL(h.server), middleware.SecureCookies(h.server)))
+
+	claim, err := h.todoClaimService.OfferClaim(c, account)
+	if err != nil {
+		// Signing in worked; old todos can still be moved with cmd/admin
+		middleware.GetLogger(c).Warn().Err(err).Msg("failed to offer todo claim")
+	} else if claim != "" {
+		c.SetCookie(newTodoClaimCookie(h.server, claim, todoClaimMaxAge))
+	}
+
+	return c.Redirect(http.StatusSeeOther, safeRedirect(next))
+}
+
+// OIDCLogin sends the browser to the OpenID provider to sign in
+func (h *AuthHandler) OIDCLogin(c echo.Context) error {
+	payload := &user.OIDCLoginPayload{}
+	if err := validation.BindAndValidate(c, payload); err != nil {
+		return err
+	}
+
+	if middleware.GetUserID(c) != "" {
+		return c.Redirect(http.StatusSeeOther, safeRedirect(payload.Next))
+	}
+
+	authURL, flow, err := h.oidcService.Start(c, safeRedirect(payload.Next), "")
+	if err != nil {
+		return h.renderAuthPage(c, http.StatusServiceUnavailable, "login", payload.Next, "", err)
+	}
+
+	c.SetCookie(h.oidcFlowCookie(flow, oidcFlowMaxAge))
+	return c.Redirect(http.StatusSeeOther, authURL)
+}
+
+// OIDCCallback is where the provider sends the browser back to, for logins and links
+func (h *AuthHandler) OIDCCallback(c echo.Context) error {
+	var flow string
+	if cookie, err := c.Cookie(oidcFlowCookie); err == nil {
+		flow = cookie.Value
+	}
+	// Each flow is good for one callback
+	c.SetCookie(h.oidcFlowCookie("", -1))
+
+	payload := &user.OIDCCallbackPayload{}
+	err := validation.BindAndValidate(c, payload)
+
+	var result *service.OIDCResult
+	if err == nil {
+		result, err = h.oidcService.Callback(c, payload, flow)
+	}
+	if err != nil {
+		if middleware.GetUserID(c) != "" {
+			return h.renderAccountPage(c, http.StatusUnauthorized, err, nil)
+		}
+		return h.renderAuthPage(c, http.StatusUnauthorized, "login", "", "", err)
+	}
+
+	if result.Linked {
+		return c.Redirect(http.StatusSeeOther, "/account")
+	}
+
+	return h.loggedIn(c, result.LoginResult)
+}
+
+func (h *AuthHandler) AccountPage(c echo.Context) error {
+	return h.renderAccountPage(c, http.StatusOK, nil, nil)
+}
+
+// StartTwoFactorSetup adds a pending secret, which the account page shows until a
+// code confirms it
+func (h *AuthHandler) StartTwoFactorSetup(c echo.Context) error {
+	if err := h.authService.StartTwoFactorSetup(c, middleware.GetUserID(c)); err != nil {
+		return h.renderAccountPage(c, http.StatusConflict, err, nil)
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/account")
+}
+
+// EnableTwoFactor confirms setup and shows the recovery codes, which are never shown again
+func (h *AuthHandler) EnableTwoFactor(c echo.Context) error {
+	payload := &user.TwoFactorCodePayload{}
+	if err := validation.BindAndValidate(c, payload); err != nil {
+		return h.renderAccountPage(c, http.StatusBadRequest, err, nil)
+	}
+
+	codes, err := h.authService.EnableTwoFactor(c, middleware.GetUserID(c), payload)
+	if err != nil {
+		return h.renderAccountPage(c, http.StatusBadRequest, err, nil)
 	}
+
+	return h.renderAccountPage(c, http.StatusOK, nil, codes)
+}
+
+func (h *AuthHandler) DisableTwoFactor(c echo.Context) error {
+	payload := &user.TwoFactorCodePayload{}
+	// Abandoning an unfinished setup needs no code, so an empty one is passed on
+	_ = c.Bind(payload)
+
+	if err := h.authService.DisableTwoFactor(c, middleware.GetUserID(c), payload); err != nil {
+		return h.renderAccountPage(c, http.StatusUnauthorized, err, nil)
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/account")
+}
+
+func (h *AuthHandler) RegenerateRecoveryCodes(c echo.Context) error {
+	payload := &user.TwoFactorCodePayload{}
+	if err := validation.BindAndValidate(c, payload); err != nil {
+		return h.renderAccountPage(c, http.StatusBadRequest, err, nil)
+	}
+
+	codes, err := h.authService.RegenerateRecoveryCodes(c, middleware.GetUserID(c), payload)
+	if err != nil {
+		return h.renderAccountPage(c, http.StatusUnauthorized, err, nil)
+	}
+
+	return h.renderAccountPage(c, http.StatusOK, nil, codes)
+}
+
+// ResetTwoFactorAPI turns two-factor off for another user, for admins helping someone
+// who lost their device
+func (h *AuthHandler) ResetTwoFactorAPI(c echo.Context) error {
+	return HandleNoContent(
+		h.Handler,
+		func(c echo.Context, payload *user.UserIDPayload) error {
+			return h.authService.ResetTwoFactor(c.Request().Context(), payload.ID)
+		},
+		http.StatusNoContent,
+		&user.UserIDPayload{},
+	)(c)
+}
+
+// LinkIdentity starts a provider login whose identity is added to the signed-in account
+func (h *AuthHandler) LinkIdentity(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+
+	authURL, flow, err := h.oidcService.Start(c, "/account", userID)
+	if err != nil {
+		return h.renderAccountPage(c, http.StatusServiceUnavailable, err, nil)
+	}
+
+	c.SetCookie(h.oidcFlowCookie(flow, oidcFlowMaxAge))
+	return c.Redirect(http.StatusSeeOther, authURL)
 }
 
-func (h *Handler) LoginPage(c echo.Context) error {
+func (h *AuthHandler) UnlinkIdentity(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+
+	payload := &user.IdentityIDPayload{}
+	if err := validation.BindAndValidate(c, payload); err != nil {
+		return err
+	}
+
+	if err := h.oidcService.UnlinkIdentity(c, userID, payload.ID); err != nil {
+		return h.renderAccountPage(c, http.StatusConflict, err, nil)
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/account")
+}
+
+func (h *AuthHandler) SessionsPage(c echo.Context) error {
+	return h.renderSessionsPage(c, http.StatusOK, nil)
+}
+
+func (h *AuthHandler) RevokeSession(c echo.Context) error {
+	payload := &user.SessionIDPayload{}
+	if err := validation.BindAndValidate(c, payload); err != nil {
+		return err
+	}
+
+	if err := h.authService.RevokeSession(c, middleware.GetUserID(c), payload.ID); err != nil {
+		return h.renderSessionsPage(c, http.StatusNotFound, err)
+	}
+
+	if payload.ID == middleware.GetSessionID(c) {
+		c.SetCookie(session.ClearCookie(middleware.SecureCookies(h.server)))
+		return c.Redirect(http.StatusSeeOther, "/login")
+	}
+	return c.Redirect(http.StatusSeeOther, "/account/sessions")
+}
+
+// RevokeAllSessions logs out everywhere, this browser included
+func (h *AuthHandler) RevokeAllSessions(c echo.Context) error {
+	if err := h.authService.RevokeAllSessions(c, middleware.GetUserID(c)); err != nil {
+		return err
+	}
+
+	c.SetCookie(session.ClearCookie(middleware.SecureCookies(h.server)))
+	return c.Redirect(http.StatusSeeOther, "/login")
+}
+
+func (h *AuthHandler) ChangePassword(c echo.Context) error {
+	payload := &user.ChangePasswordPayload{}
+	if err := validation.BindAndValidate(c, payload); err != nil {
+		return h.renderAccountPage(c, http.StatusBadRequest, err, nil)
+	}
+
+	token, err := h.authService.ChangePassword(c, middleware.GetUserID(c), payload)
+	if err != nil {
+		return h.renderAccountPage(c, http.StatusBadRequest, err, nil)
+	}
+
+	c.SetCookie(session.Cookie(token, middleware.SessionTTL(h.server), middleware.SecureCookies(h.server)))
+	return c.Redirect(http.StatusSeeOther, "/account/sessions")
+}
+
+func (h *AuthHandler) GetSessionsAPI(c echo.Context) error {
+	return Handle(
+		h.Handler,
+		func(c echo.Context, payload *user.GetSessionsPayload) ([]session.Active, error) {
+			return h.authService.GetSessions(c, middleware.GetUserID(c))
+		},
+		http.StatusOK,
+		&user.GetSessionsPayload{},
+	)(c)
+}
+
+func (h *AuthHandler) RevokeSessionAPI(c echo.Context) error {
+	return HandleNoContent(
+		h.Handler,
+		func(c echo.Context, payload *user.SessionIDPayload) error {
+			return h.authService.RevokeSession(c, middleware.GetUserID(c), payload.ID)
+		},
+		http.StatusNoContent,
+		&user.SessionIDPayload{},
+	)(c)
+}
+
+func (h *AuthHandler) RevokeAllSessionsAPI(c echo.Context) error {
+	return HandleNoContent(
+		h.Handler,
+		func(c echo.Context, payload *user.RevokeSessionsPayload) error {
+			return h.authService.RevokeAllSessions(c, middleware.GetUserID(c))
+		},
+		http.StatusNoContent,
+		&user.RevokeSessionsPayload{},
+	)(c)
+}
+
+func (h *AuthHandler) renderSessionsPage(c echo.Context, status int, err error) error {
+	var message string
+
+	if err != nil {
+		var httpErr *errs.HTTPError
+		if !errors.As(err, &httpErr) || !showable(httpErr) {
+			return err
+		}
+		status = httpErr.Status
+		message = httpErr.Message
+	}
+
+	sessions, err := h.authService.GetSessions(c, middleware.GetUserID(c))
+	if err != nil {
+		return err
+	}
+
+	td := &render.TemplateData{
+		Data: map[string]interface{}{
+			"sessions": sessions,
+			"error":    message,
+			"fields":   nil,
+		},
+	}
+
+	if err := c.Render(status, "sessions", td); err != nil {
+		c.Logger().Error("SessionsPage render error: ", err)
+		return err
+	}
+	return nil
+}
+
+// renderAccountPage shows the account page, with what went wrong when err is set and
+// freshly made recovery codes when there are some to show
+func (h *AuthHandler) renderAccountPage(c echo.Context, status int, err error, recoveryCodes []string) error {
+	var message string
+
+	if err != nil {
+		var httpErr *errs.HTTPError
+		if !errors.As(err, &httpErr) || !showable(httpErr) {
+			return err
+		}
+		status = httpErr.Status
+		message = httpErr.Message
+	}
+
+	account, identities, err := h.oidcService.GetAccount(c, middleware.GetUserID(c))
+	if err != nil {
+		return err
+	}
+
+	recoveryCodesLeft, err := h.authService.RecoveryCodesLeft(c, account)
+	if err != nil {
+		return err
+	}
+
+	td := &render.TemplateData{
+		Data: map[string]interface{}{
+			"account":     account,
+			"hasPassword": account.PasswordHash != nil,
+			"identities":  identities,
+			"oidcEnabled": h.oidcService.Enabled(),
+			"oidcName":    h.oidcService.ProviderName(),
+			"error":       message,
+			"fields":      nil,
+			// Two-factor: on, being set up, or off
+			"twoFactorEnabled":  account.TwoFactorEnabled(),
+			"twoFactorSetup":    h.authService.TwoFactorSetup(account),
+			"recoveryCodes":     recoveryCodes,
+			"recoveryCodesLeft": recoveryCodesLeft,
+		},
+	}
+
+	if err := c.Render(status, "account", td); err != nil {
+		c.Logger().Error("AccountPage render error: ", err)
+		return err
+	}
+	return nil
+}
+
+func (h *AuthHandler) oidcFlowCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    value,
+		Path:     "/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   middleware.SecureCookies(h.server),
+		// Lax, not Strict: the callback is a cross-site navigation from the provider
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (h *AuthHandler) renderTwoFactorPage(c echo.Context, status int, err error) error {
+	var message string
+	var fields []errs.FieldError
+
+	if err != nil {
+		var httpErr *errs.HTTPError
+		if !errors.As(err, &httpErr) || !showable(httpErr) {
+			return err
+		}
+		status = httpErr.Status
+		message = httpErr.Message
+		fields = httpErr.Errors
+	}
+
 	td := &render.TemplateData{
 		Data: map[string]interface{}{
-			"key": "",
+			"error":  message,
+			"fields": fields,
 		},
 	}
 
-	// Will look for ./views/home/index.jet
-	err := c.Render(http.StatusOK, "login", td)
+	if err := c.Render(status, "twoFactor", td); err != nil {
+		c.Logger().Error("TwoFactorPage render error: ", err)
+		return err
+	}
+	return nil
+}
+
+func (h *AuthHandler) twoFactorCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     twoFactorCookie,
+		Value:    value,
+		Path:     service.TwoFactorPath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   middleware.SecureCookies(h.server),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// renderAuthPage shows the login or signup form again with what went wrong; errors
+// that aren't the user's to fix go to the global error handler instead
+func (h *AuthHandler) renderAuthPage(c echo.Context, status int, page, next, email string, err error) error {
+	var message string
+	var fields []errs.FieldError
+
 	if err != nil {
-		c.Logger().Error("LoginPage render error: ", err)
+		var httpErr *errs.HTTPError
+		if !errors.As(err, &httpErr) || !showable(httpErr) {
+			return err
+		}
+		status = httpErr.Status
+		message = httpErr.Message
+		fields = httpErr.Errors
+	}
+
+	td := &render.TemplateData{
+		Data: map[string]interface{}{
+			"next":        next,
+			"email":       email,
+			"error":       message,
+			"fields":      fields,
+			"oidcEnabled": h.oidcService.Enabled(),
+			"oidcName":    h.oidcService.ProviderName(),
+		},
+	}
+
+	if err := c.Render(status, page, td); err != nil {
+		c.Logger().Error("AuthPage render error: ", err)
+		return err
+	}
+	return nil
+}
+
+// showable reports whether an error's message is meant for the user: client errors,
+// and server errors whose message was written for display, like a provider outage
+func showable(httpErr *errs.HTTPError) bool {
+	return httpErr.Status < http.StatusInternalServerError || httpErr.Override
+}
+
+// safeRedirect only follows same-site paths, so next can't send users elsewhere
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
 	}
-	return err
+	return next
 }
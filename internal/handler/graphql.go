@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/graphql"
+	"github.com/goku-m/starter/internal/server"
+	"github.com/goku-m/starter/internal/service"
+	"github.com/labstack/echo/v4"
+)
+
+type GraphQLHandler struct {
+	Handler
+	executor *graphql.Executor
+}
+
+func NewGraphQLHandler(s *server.Server, todoService *service.TodoService) *GraphQLHandler {
+	executor, err := graphql.NewExecutor(todoService)
+	if err != nil {
+		panic("failed to build graphql schema: " + err.Error())
+	}
+
+	return &GraphQLHandler{
+		Handler:  NewHandler(s),
+		executor: executor,
+	}
+}
+
+// Query executes a GraphQL operation. Resolver errors are reported in the response body
+// with a 200, while requests rejected before execution get a 400.
+func (h *GraphQLHandler) Query(c echo.Context) error {
+	req := &graphql.Request{}
+	if err := c.Bind(req); err != nil {
+		return errs.NewBadRequestError("invalid GraphQL request body", false, nil, nil, nil)
+	}
+
+	if strings.TrimSpace(req.Query) == "" {
+		code := "GRAPHQL_QUERY_REQUIRED"
+		return errs.NewBadRequestError("query is required", false, &code, nil, nil)
+	}
+
+	result, rejected := h.executor.Execute(c, req)
+
+	status := http.StatusOK
+	if rejected {
+		status = http.StatusBadRequest
+	}
+
+	return c.JSON(status, result)
+}
@@ -6,15 +6,25 @@ import (
 )
 
 type Handlers struct {
-	Health  *HealthHandler
-	Todo    *TodoHandler
-	Auth    *AuthHandler
+	Health   *HealthHandler
+	Todo     *TodoHandler
+	Auth     *AuthHandler
+	Webhook  *WebhookHandler
+	Realtime *RealtimeHandler
+	GraphQL  *GraphQLHandler
+	Privacy  *PrivacyHandler
+	APIToken *APITokenHandler
 }
 
 func NewHandlers(s *server.Server, services *service.Services) *Handlers {
 	return &Handlers{
-		Health:  NewHealthHandler(s),
-		Todo:    NewTodoHandler(s, services.Todo),
-		Auth:    NewAuthHandler(s),
+		Health:   NewHealthHandler(s),
+		Todo:     NewTodoHandler(s, services.Todo, services.TodoClaim),
+		Auth:     NewAuthHandler(s, services.Auth, services.OIDC, services.TodoClaim),
+		Webhook:  NewWebhookHandler(s, services.Webhook),
+		Realtime: NewRealtimeHandler(s, services.Realtime),
+		GraphQL:  NewGraphQLHandler(s, services.Todo),
+		Privacy:  NewPrivacyHandler(s, services.Privacy),
+		APIToken: NewAPITokenHandler(s, services.APIToken),
 	}
 }
@@ -85,6 +85,11 @@ func (h *HealthHandler) CheckHealth(c echo.Context) error {
 		}
 	}
 
+	// Cache hit/miss counters for this instance
+	if h.server.Cache != nil {
+		checks["cache"] = h.server.Cache.Stats()
+	}
+
 	// Set overall status
 	if !isHealthy {
 		response["status"] = "unhealthy"
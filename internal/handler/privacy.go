@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/model/privacy"
+	"github.com/goku-m/starter/internal/server"
+	"github.com/goku-m/starter/internal/service"
+	"github.com/labstack/echo/v4"
+)
+
+type PrivacyHandler struct {
+	Handler
+	privacyService *service.PrivacyService
+}
+
+func NewPrivacyHandler(s *server.Server, privacyService *service.PrivacyService) *PrivacyHandler {
+	return &PrivacyHandler{
+		Handler:        NewHandler(s),
+		privacyService: privacyService,
+	}
+}
+
+//API HANDLERS
+
+func (h *PrivacyHandler) RequestExportAPI(c echo.Context) error {
+	return Handle(
+		h.Handler,
+		func(c echo.Context, payload *privacy.RequestExportPayload) (*privacy.DataExport, error) {
+			userID := middleware.GetUserID(c)
+			return h.privacyService.RequestExport(c, userID, payload)
+		},
+		http.StatusAccepted,
+		&privacy.RequestExportPayload{},
+	)(c)
+}
+
+func (h *PrivacyHandler) DownloadExportAPI(c echo.Context) error {
+	return HandleFile(
+		h.Handler,
+		func(c echo.Context, payload *privacy.DownloadExportPayload) ([]byte, error) {
+			return h.privacyService.DownloadExport(c, payload)
+		},
+		http.StatusOK,
+		&privacy.DownloadExportPayload{},
+		"data-export.zip",
+		"application/zip",
+	)(c)
+}
+
+func (h *PrivacyHandler) EraseUserDataAPI(c echo.Context) error {
+	return Handle(
+		h.Handler,
+		func(c echo.Context, payload *privacy.ErasePayload) (*privacy.ErasureRecord, error) {
+			userID := middleware.GetUserID(c)
+			return h.privacyService.EraseUserData(c, userID)
+		},
+		http.StatusOK,
+		&privacy.ErasePayload{},
+	)(c)
+}
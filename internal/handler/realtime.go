@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/model/event"
+	"github.com/goku-m/starter/internal/server"
+	"github.com/goku-m/starter/internal/service"
+	"github.com/labstack/echo/v4"
+)
+
+const sseHeartbeatInterval = 25 * time.Second
+
+type RealtimeHandler struct {
+	Handler
+	realtimeService *service.RealtimeService
+}
+
+func NewRealtimeHandler(s *server.Server, realtimeService *service.RealtimeService) *RealtimeHandler {
+	return &RealtimeHandler{
+		Handler:         NewHandler(s),
+		realtimeService: realtimeService,
+	}
+}
+
+// StreamEvents streams the user's change events as Server-Sent Events. Clients that
+// reconnect with Last-Event-ID first receive everything they missed.
+func (h *RealtimeHandler) StreamEvents(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+
+	lastID, err := lastEventID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid Last-Event-ID")
+	}
+
+	// Subscribe before replaying so nothing published in between is lost
+	sub := h.realtimeService.Subscribe(userID)
+	defer h.realtimeService.Unsubscribe(sub)
+
+	// A fresh connection only receives live events
+	var missed []event.Event
+	if lastID > 0 {
+		missed, err = h.realtimeService.Replay(c, userID, lastID)
+		if err != nil {
+			return err
+		}
+	}
+
+	res := c.Response()
+	// The stream outlives the server write timeout
+	if err := http.NewResponseController(res).SetWriteDeadline(time.Time{}); err != nil {
+		return err
+	}
+
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(res, "retry: %d\n\n", 3000); err != nil {
+		return nil
+	}
+
+	for _, e := range missed {
+		if err := writeEvent(res, e); err != nil {
+			return nil
+		}
+		lastID = e.ID
+	}
+	res.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	ctx := c.Request().Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-sub.Events:
+			if !ok {
+				// Dropped for falling behind; the client reconnects and replays
+				return nil
+			}
+			if e.ID <= lastID {
+				continue
+			}
+			if err := writeEvent(res, e); err != nil {
+				return nil
+			}
+			lastID = e.ID
+			res.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
+
+func writeEvent(res *echo.Response, e event.Event) error {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
+
+// lastEventID reads the resume position from the header browsers send on reconnect,
+// falling back to a query parameter for the first connection of a new page.
+func lastEventID(c echo.Context) (int64, error) {
+	value := c.Request().Header.Get("Last-Event-ID")
+	if value == "" {
+		value = c.QueryParam("lastEventId")
+	}
+	if value == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseInt(value, 10, 64)
+}
@@ -2,13 +2,19 @@ package handler
 
 import (
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
+	"github.com/goku-m/starter/internal/lib/quickadd"
 	"github.com/goku-m/starter/internal/middleware"
 	"github.com/goku-m/starter/internal/model"
 	"github.com/goku-m/starter/internal/model/todo"
 	"github.com/goku-m/starter/internal/render"
+	"github.com/goku-m/starter/internal/validation"
 	"github.com/google/uuid"
 
 	"github.com/goku-m/starter/internal/server"
@@ -16,15 +22,19 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+const maxPatchSize = 64 << 10
+
 type TodoHandler struct {
 	Handler
-	todoService *service.TodoService
+	todoService      *service.TodoService
+	todoClaimService *service.TodoClaimService
 }
 
-func NewTodoHandler(s *server.Server, todoService *service.TodoService) *TodoHandler {
+func NewTodoHandler(s *server.Server, todoService *service.TodoService, todoClaimService *service.TodoClaimService) *TodoHandler {
 	return &TodoHandler{
-		Handler:     NewHandler(s),
-		todoService: todoService,
+		Handler:          NewHandler(s),
+		todoService:      todoService,
+		todoClaimService: todoClaimService,
 	}
 }
 
@@ -41,7 +51,9 @@ func (h *TodoHandler) GetTodoPage(c echo.Context) error {
 		return err
 	}
 
-	todos, err := h.todoService.GetTodos(c, query)
+	userID := middleware.GetUserID(c)
+
+	todos, err := h.todoService.GetTodos(c, userID, query)
 	if err != nil {
 		return err
 	}
@@ -54,7 +66,10 @@ func (h *TodoHandler) GetTodoPage(c echo.Context) error {
 
 	td := &render.TemplateData{
 		Data: map[string]interface{}{
-			"todos": todos.Data, // could be "" when none exist
+			"todos":   todos.Data, // could be "" when none exist
+			"snoozed": query.Snoozed != nil && *query.Snoozed,
+			// Todos from before the user had an account that they can take over
+			"claimTodos": h.pendingTodoClaim(c),
 			// or pass the whole list:
 			// "todos": todos.Data,
 		},
@@ -106,6 +121,51 @@ func (h *TodoHandler) UpdateTodoPage(c echo.Context) error {
 	return nil
 }
 
+func (h *TodoHandler) CalendarPage(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+
+	query := &todo.GetCalendarQuery{}
+	if err := validation.BindAndValidate(c, query); err != nil {
+		return err
+	}
+
+	calendar, err := h.todoService.GetCalendar(c, userID, query, resolveLocation(c, query.Timezone))
+	if err != nil {
+		return err
+	}
+
+	td := &render.TemplateData{
+		Data: map[string]interface{}{
+			"calendar": calendar,
+		},
+	}
+
+	if err := c.Render(http.StatusOK, "calendar", td); err != nil {
+		c.Logger().Error("CalendarPage render error: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// resolveLocation picks the user's timezone from the query, then the tz cookie set by the layout, falling back to UTC
+func resolveLocation(c echo.Context, tz *string) *time.Location {
+	name := ""
+	if tz != nil {
+		name = *tz
+	} else if cookie, err := c.Cookie("tz"); err == nil {
+		name, _ = url.QueryUnescape(cookie.Value)
+	}
+
+	if name != "" {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+
+	return time.UTC
+}
+
 func (h *TodoHandler) CreateTodo(c echo.Context) error {
 	userID := middleware.GetUserID(c)
 
@@ -117,12 +177,17 @@ func (h *TodoHandler) CreateTodo(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "title is required")
 	}
 
-	payload := &todo.CreateTodoPayload{
-		Title:       title,
-		Description: &description, // only if your struct uses *string
+	// Title doubles as a quick add field: "Pay rent tomorrow 9am !high #home"
+	payload, err := h.todoService.ParseTodo(c, title, resolveLocation(c, nil))
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(description) != "" {
+		payload.Description = &description
 	}
 
-	// only set priority if provided (depends on your types)
+	// an explicitly chosen priority wins over a parsed marker
 	if strings.TrimSpace(priority) != "" {
 		p := todo.Priority(priority)
 		payload.Priority = &p
@@ -196,6 +261,57 @@ func (h *TodoHandler) UpdateTodo(c echo.Context) error {
 	return c.Redirect(http.StatusSeeOther, "/")
 }
 
+func (h *TodoHandler) SnoozeTodo(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+
+	todoID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid todo id")
+	}
+
+	// "until" is either a datetime-local value or quick add text such as "tomorrow 9am"
+	untilStr := strings.TrimSpace(c.FormValue("until"))
+	if untilStr == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "until is required")
+	}
+
+	loc := resolveLocation(c, nil)
+	until, err := time.ParseInLocation("2006-01-02T15:04", untilStr, loc)
+	if err != nil {
+		parsed, parseErr := quickadd.Parse("snooze "+untilStr, time.Now().In(loc))
+		if parseErr != nil || parsed.DueDate == nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid snooze time")
+		}
+		until = *parsed.DueDate
+	}
+
+	payload := &todo.SnoozeTodoPayload{ID: todoID, Until: until}
+	if err := payload.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "snooze time must be in the future")
+	}
+
+	if _, err := h.todoService.SnoozeTodo(c, userID, payload.ID, payload.Until); err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/")
+}
+
+func (h *TodoHandler) UnsnoozeTodo(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+
+	todoID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid todo id")
+	}
+
+	if _, err := h.todoService.UnsnoozeTodo(c, userID, todoID); err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/")
+}
+
 func (h *TodoHandler) DeleteTodo(c echo.Context) error {
 	userID := middleware.GetUserID(c)
 	id := c.FormValue("id")
@@ -229,6 +345,17 @@ func (h *TodoHandler) CreateTodoAPI(c echo.Context) error {
 	)(c)
 }
 
+func (h *TodoHandler) ParseTodoAPI(c echo.Context) error {
+	return Handle(
+		h.Handler,
+		func(c echo.Context, payload *todo.ParseTodoPayload) (*todo.CreateTodoPayload, error) {
+			return h.todoService.ParseTodo(c, payload.Text, resolveLocation(c, payload.Timezone))
+		},
+		http.StatusOK,
+		&todo.ParseTodoPayload{},
+	)(c)
+}
+
 func (h *TodoHandler) GetTodoByID(c echo.Context) error {
 	return Handle(
 		h.Handler,
@@ -245,8 +372,8 @@ func (h *TodoHandler) GetTodos(c echo.Context) error {
 	return Handle(
 		h.Handler,
 		func(c echo.Context, query *todo.GetTodosQuery) (*model.PaginatedResponse[todo.PopulatedTodo], error) {
-			// userID := middleware.GetUserID(c)
-			return h.todoService.GetTodos(c, query)
+			userID := middleware.GetUserID(c)
+			return h.todoService.GetTodos(c, userID, query)
 		},
 		http.StatusOK,
 		&todo.GetTodosQuery{},
@@ -265,6 +392,66 @@ func (h *TodoHandler) UpdateTodoAPI(c echo.Context) error {
 	)(c)
 }
 
+// PatchTodoAPI accepts a merge patch or JSON patch; the body is read raw because the
+// default binder does not understand either media type
+func (h *TodoHandler) PatchTodoAPI(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+
+	payload := &todo.PatchTodoPayload{}
+	if err := (&echo.DefaultBinder{}).BindPathParams(c, payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid todo id")
+	}
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+
+	mediaType, _, err := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	patchType := todo.PatchType(mediaType)
+	if err != nil || (patchType != todo.PatchTypeMerge && patchType != todo.PatchTypeJSON) {
+		c.Response().Header().Set("Accept-Patch", string(todo.PatchTypeMerge)+", "+string(todo.PatchTypeJSON))
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "content type must be "+string(todo.PatchTypeMerge)+" or "+string(todo.PatchTypeJSON))
+	}
+
+	patch, err := io.ReadAll(io.LimitReader(c.Request().Body, maxPatchSize+1))
+	if err != nil {
+		return err
+	}
+	if len(patch) > maxPatchSize {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "patch is too large")
+	}
+
+	patchedTodo, err := h.todoService.PatchTodo(c, userID, payload.ID, patchType, patch)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, patchedTodo)
+}
+
+func (h *TodoHandler) SnoozeTodoAPI(c echo.Context) error {
+	return Handle(
+		h.Handler,
+		func(c echo.Context, payload *todo.SnoozeTodoPayload) (*todo.Todo, error) {
+			userID := middleware.GetUserID(c)
+			return h.todoService.SnoozeTodo(c, userID, payload.ID, payload.Until)
+		},
+		http.StatusOK,
+		&todo.SnoozeTodoPayload{},
+	)(c)
+}
+
+func (h *TodoHandler) UnsnoozeTodoAPI(c echo.Context) error {
+	return Handle(
+		h.Handler,
+		func(c echo.Context, payload *todo.UnsnoozeTodoPayload) (*todo.Todo, error) {
+			userID := middleware.GetUserID(c)
+			return h.todoService.UnsnoozeTodo(c, userID, payload.ID)
+		},
+		http.StatusOK,
+		&todo.UnsnoozeTodoPayload{},
+	)(c)
+}
+
 func (h *TodoHandler) DeleteTodoAPI(c echo.Context) error {
 	return HandleNoContent(
 		h.Handler,
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/server"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Carries the offer of todos created from the user's address before they had an
+	// account, from login until it is accepted or dismissed
+	todoClaimCookie = "starter_todo_claim"
+	todoClaimMaxAge = 7 * 24 * 60 * 60
+)
+
+// ClaimTodos accepts the offer shown on the todo list
+func (h *TodoHandler) ClaimTodos(c echo.Context) error {
+	var token string
+	if cookie, err := c.Cookie(todoClaimCookie); err == nil {
+		token = cookie.Value
+	}
+	// The offer is good for one answer, whatever it is
+	c.SetCookie(newTodoClaimCookie(h.server, "", -1))
+
+	if _, err := h.todoClaimService.ClaimTodos(c, middleware.GetUserID(c), token); err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/")
+}
+
+// DismissTodoClaim turns the offer down; the todos stay where they are
+func (h *TodoHandler) DismissTodoClaim(c echo.Context) error {
+	c.SetCookie(newTodoClaimCookie(h.server, "", -1))
+	return c.Redirect(http.StatusSeeOther, "/")
+}
+
+// pendingTodoClaim is how many todos the browser's offer would move, 0 without one
+func (h *TodoHandler) pendingTodoClaim(c echo.Context) int {
+	cookie, err := c.Cookie(todoClaimCookie)
+	if err != nil || cookie.Value == "" {
+		return 0
+	}
+
+	count, err := h.todoClaimService.PendingClaim(c, middleware.GetUserID(c), cookie.Value)
+	if err != nil {
+		middleware.GetLogger(c).Warn().Err(err).Msg("failed to count claimable todos")
+		return 0
+	}
+	if count == 0 {
+		c.SetCookie(newTodoClaimCookie(h.server, "", -1))
+	}
+	return count
+}
+
+func newTodoClaimCookie(s *server.Server, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     todoClaimCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   middleware.SecureCookies(s),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/model/webhook"
+	"github.com/goku-m/starter/internal/render"
+	"github.com/goku-m/starter/internal/server"
+	"github.com/goku-m/starter/internal/service"
+	"github.com/goku-m/starter/internal/validation"
+	"github.com/labstack/echo/v4"
+)
+
+type WebhookHandler struct {
+	Handler
+	webhookService *service.WebhookService
+}
+
+func NewWebhookHandler(s *server.Server, webhookService *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		Handler:        NewHandler(s),
+		webhookService: webhookService,
+	}
+}
+
+//PAGE HANDLERS
+
+func (h *WebhookHandler) WebhooksPage(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+
+	webhooks, err := h.webhookService.GetWebhooks(c, userID)
+	if err != nil {
+		return err
+	}
+
+	td := &render.TemplateData{
+		Data: map[string]interface{}{
+			"webhooks": webhooks,
+			"events":   webhook.Events,
+		},
+	}
+
+	if err := c.Render(http.StatusOK, "webhooks", td); err != nil {
+		c.Logger().Error("WebhooksPage render error: ", err)
+		return err
+	}
+
+	return nil
+}
+
+func (h *WebhookHandler) WebhookPage(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+
+	payload := &webhook.WebhookIDPayload{}
+	if err := validation.BindAndValidate(c, payload); err != nil {
+		return err
+	}
+
+	item, err := h.webhookService.GetWebhookByID(c, userID, payload.ID)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := h.webhookService.GetDeliveries(c, userID, payload.ID)
+	if err != nil {
+		return err
+	}
+
+	td := &render.TemplateData{
+		Data: map[string]interface{}{
+			"webhook":    item,
+			"deliveries": deliveries,
+		},
+	}
+
+	if err := c.Render(http.StatusOK, "webhook", td); err != nil {
+		c.Logger().Error("WebhookPage render error: ", err)
+		return err
+	}
+
+	return nil
+}
+
+func (h *WebhookHandler) CreateWebhook(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+
+	payload := &webhook.CreateWebhookPayload{}
+	if err := validation.BindAndValidate(c, payload); err != nil {
+		return err
+	}
+
+	item, err := h.webhookService.CreateWebhook(c, userID, payload)
+	if err != nil {
+		return err
+	}
+
+	// Land on the detail page so the signing secret can be copied
+	return c.Redirect(http.StatusSeeOther, "/webhooks/"+item.ID.String())
+}
+
+func (h *WebhookHandler) DeleteWebhook(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+
+	payload := &webhook.WebhookIDPayload{}
+	if err := validation.BindAndValidate(c, payload); err != nil {
+		return err
+	}
+
+	if err := h.webhookService.DeleteWebhook(c, userID, payload.ID); err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/webhooks")
+}
+
+func (h *WebhookHandler) SendTestEvent(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+
+	payload := &webhook.WebhookIDPayload{}
+	if err := validation.BindAndValidate(c, payload); err != nil {
+		return err
+	}
+
+	if _, err := h.webhookService.SendTestEvent(c, userID, payload.ID); err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/webhooks/"+payload.ID.String())
+}
+
+//API HANDLERS
+
+func (h *WebhookHandler) GetDeliveriesAPI(c echo.Context) error {
+	return Handle(
+		h.Handler,
+		func(c echo.Context, payload *webhook.WebhookIDPayload) ([]webhook.Delivery, error) {
+			userID := middleware.GetUserID(c)
+			return h.webhookService.GetDeliveries(c, userID, payload.ID)
+		},
+		http.StatusOK,
+		&webhook.WebhookIDPayload{},
+	)(c)
+}
@@ -0,0 +1,39 @@
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Prefix marks personal API tokens so they can be told apart from JWTs in an
+// Authorization header, and picked up by secret scanners when leaked
+const Prefix = "stk_"
+
+// displayLength is how much of a token is kept in the clear to label it in listings
+const displayLength = len(Prefix) + 6
+
+// New returns a random token, the hash it is stored under and its display prefix
+func New() (token, hash, display string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate api token: %w", err)
+	}
+
+	token = Prefix + base64.RawURLEncoding.EncodeToString(raw)
+	return token, Hash(token), token[:displayLength], nil
+}
+
+// Hash maps a token to the value it is looked up by
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Is reports whether a bearer credential is an API token rather than a JWT
+func Is(credential string) bool {
+	return strings.HasPrefix(credential, Prefix)
+}
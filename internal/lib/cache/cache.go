@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrMiss is returned by Store.Get for keys that are absent or expired
+var ErrMiss = errors.New("cache: miss")
+
+// Store is a byte-oriented key/value backend with expiry
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Stats are the counters since the cache was created
+type Stats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Errors uint64 `json:"errors"`
+}
+
+// generationStripes is how many invalidation counters keys share. A collision only
+// costs a skipped write, so a small fixed set does instead of one counter per key.
+const generationStripes = 256
+
+// Cache adds typed read-through loading on top of a Store. Concurrent misses for the
+// same key share one load, and TTLs are jittered so entries written together do not
+// expire together. Backend failures are logged and treated as misses, so the cache
+// can only make reads faster, never fail them.
+type Cache struct {
+	store  Store
+	logger *zerolog.Logger
+	group  singleflight.Group
+
+	// generations count invalidations, so a load that read the data before one does
+	// not put its result back afterwards. They are per process: a load racing an
+	// invalidation made by another instance can still leave a stale entry until its TTL.
+	seed        maphash.Seed
+	generations [generationStripes]atomic.Uint64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	errors atomic.Uint64
+}
+
+func New(store Store, logger *zerolog.Logger) *Cache {
+	return &Cache{store: store, logger: logger, seed: maphash.MakeSeed()}
+}
+
+// GetOrLoad returns the cached value for key, or calls load, caches its result for
+// about ttl and returns it. Load errors are returned and never cached.
+func GetOrLoad[T any](ctx context.Context, c *Cache, key string, ttl time.Duration, load func(ctx context.Context) (T, error)) (T, error) {
+	var value T
+
+	if data, err := c.store.Get(ctx, key); err == nil {
+		if err := json.Unmarshal(data, &value); err == nil {
+			c.record(ctx, "Hit", &c.hits)
+			return value, nil
+		}
+		c.fail(ctx, key, "failed to decode cached value", err)
+	} else if !errors.Is(err, ErrMiss) {
+		c.fail(ctx, key, "failed to read from cache", err)
+	}
+
+	c.record(ctx, "Miss", &c.misses)
+
+	// The shared load must not be cancelled because the first caller went away
+	result, err, _ := c.group.Do(key, func() (any, error) {
+		generation := c.generation(key).Load()
+
+		loaded, err := load(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		// The data changed while it was being read; the next miss loads it again
+		if c.generation(key).Load() != generation {
+			return loaded, nil
+		}
+
+		data, err := json.Marshal(loaded)
+		if err != nil {
+			c.fail(ctx, key, "failed to encode value for cache", err)
+			return loaded, nil
+		}
+		if err := c.store.Set(ctx, key, data, jitter(ttl)); err != nil {
+			c.fail(ctx, key, "failed to write to cache", err)
+		}
+
+		// An invalidation between the check and the write may have deleted before
+		// this wrote, so the write is undone
+		if c.generation(key).Load() != generation {
+			if err := c.store.Delete(ctx, key); err != nil {
+				c.fail(ctx, key, "failed to invalidate cache", err)
+			}
+		}
+
+		return loaded, nil
+	})
+	if err != nil {
+		return value, err
+	}
+
+	return result.(T), nil
+}
+
+// Invalidate removes keys after the data behind them changed. Failures are logged;
+// the entries then expire with their TTL.
+func (c *Cache) Invalidate(ctx context.Context, keys ...string) {
+	// Later misses must not join a load that may have read the old data, and loads
+	// already running must not cache what they read
+	for _, key := range keys {
+		c.generation(key).Add(1)
+		c.group.Forget(key)
+	}
+
+	if err := c.store.Delete(ctx, keys...); err != nil {
+		c.fail(ctx, fmt.Sprint(keys), "failed to invalidate cache", err)
+	}
+}
+
+func (c *Cache) generation(key string) *atomic.Uint64 {
+	return &c.generations[maphash.String(c.seed, key)%generationStripes]
+}
+
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Errors: c.errors.Load(),
+	}
+}
+
+func (c *Cache) record(ctx context.Context, outcome string, counter *atomic.Uint64) {
+	counter.Add(1)
+
+	if txn := newrelic.FromContext(ctx); txn != nil {
+		if app := txn.Application(); app != nil {
+			app.RecordCustomMetric("Custom/Cache/"+outcome, 1)
+		}
+	}
+}
+
+func (c *Cache) fail(ctx context.Context, key, msg string, err error) {
+	c.record(ctx, "Error", &c.errors)
+	c.logger.Warn().Err(err).Str("key", key).Msg(msg)
+}
+
+// jitter spreads expiry over ttl to ttl+10%
+func jitter(ttl time.Duration) time.Duration {
+	if spread := int64(ttl / 10); spread > 0 {
+		return ttl + time.Duration(rand.Int64N(spread))
+	}
+	return ttl
+}
@@ -0,0 +1,222 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestCache(t *testing.T) (*Cache, *MemoryStore, *clock) {
+	t.Helper()
+
+	clk := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	store.Now = clk.Now
+
+	logger := zerolog.Nop()
+	return New(store, &logger), store, clk
+}
+
+// counter returns a loader that yields 1, 2, 3... and how many times it was called
+func counter() (func(context.Context) (int, error), *atomic.Int32) {
+	var calls atomic.Int32
+	return func(context.Context) (int, error) {
+		return int(calls.Add(1)), nil
+	}, &calls
+}
+
+func TestGetOrLoad(t *testing.T) {
+	ctx := context.Background()
+	c, _, _ := newTestCache(t)
+	load, calls := counter()
+
+	v, err := GetOrLoad(ctx, c, "k", time.Minute, load)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+
+	v, err = GetOrLoad(ctx, c, "k", time.Minute, load)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v, "second read is served from the cache")
+	assert.EqualValues(t, 1, calls.Load())
+
+	assert.Equal(t, Stats{Hits: 1, Misses: 1}, c.Stats())
+}
+
+func TestGetOrLoadExpires(t *testing.T) {
+	ctx := context.Background()
+	c, _, clk := newTestCache(t)
+	load, calls := counter()
+
+	_, err := GetOrLoad(ctx, c, "k", time.Minute, load)
+	require.NoError(t, err)
+
+	// Still fresh just before the shortest jittered TTL
+	clk.Advance(time.Minute - time.Second)
+	v, err := GetOrLoad(ctx, c, "k", time.Minute, load)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+
+	// Past the longest one
+	clk.Advance(7 * time.Second)
+	v, err = GetOrLoad(ctx, c, "k", time.Minute, load)
+	require.NoError(t, err)
+	assert.Equal(t, 2, v)
+	assert.EqualValues(t, 2, calls.Load())
+}
+
+func TestGetOrLoadDoesNotCacheErrors(t *testing.T) {
+	ctx := context.Background()
+	c, _, _ := newTestCache(t)
+	errLoad := errors.New("load failed")
+
+	_, err := GetOrLoad(ctx, c, "k", time.Minute, func(context.Context) (int, error) {
+		return 0, errLoad
+	})
+	assert.ErrorIs(t, err, errLoad)
+
+	load, calls := counter()
+	v, err := GetOrLoad(ctx, c, "k", time.Minute, load)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+	assert.EqualValues(t, 1, calls.Load())
+}
+
+func TestGetOrLoadSkipsUndecodableEntries(t *testing.T) {
+	ctx := context.Background()
+	c, store, _ := newTestCache(t)
+	require.NoError(t, store.Set(ctx, "k", []byte("not json"), time.Minute))
+
+	load, _ := counter()
+	v, err := GetOrLoad(ctx, c, "k", time.Minute, load)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+	assert.EqualValues(t, 1, c.Stats().Errors)
+}
+
+func TestInvalidate(t *testing.T) {
+	ctx := context.Background()
+	c, _, _ := newTestCache(t)
+	load, _ := counter()
+
+	_, err := GetOrLoad(ctx, c, "a", time.Minute, load)
+	require.NoError(t, err)
+	_, err = GetOrLoad(ctx, c, "b", time.Minute, load)
+	require.NoError(t, err)
+
+	c.Invalidate(ctx, "a")
+
+	v, err := GetOrLoad(ctx, c, "a", time.Minute, load)
+	require.NoError(t, err)
+	assert.Equal(t, 3, v, "invalidated key is loaded again")
+
+	v, err = GetOrLoad(ctx, c, "b", time.Minute, load)
+	require.NoError(t, err)
+	assert.Equal(t, 2, v, "other keys are untouched")
+}
+
+func TestInvalidateDuringLoad(t *testing.T) {
+	ctx := context.Background()
+	c, store, _ := newTestCache(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan int)
+	go func() {
+		v, _ := GetOrLoad(ctx, c, "k", time.Minute, func(context.Context) (int, error) {
+			close(started)
+			<-release
+			return 1, nil // read before the write below
+		})
+		done <- v
+	}()
+
+	<-started
+	c.Invalidate(ctx, "k")
+	close(release)
+	assert.Equal(t, 1, <-done)
+
+	_, err := store.Get(ctx, "k")
+	assert.ErrorIs(t, err, ErrMiss, "a load that raced an invalidation must not be cached")
+
+	v, err := GetOrLoad(ctx, c, "k", time.Minute, func(context.Context) (int, error) {
+		return 2, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, v)
+
+	v, err = GetOrLoad(ctx, c, "k", time.Minute, func(context.Context) (int, error) {
+		return 3, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, v, "later loads are cached again")
+}
+
+func TestGetOrLoadStampede(t *testing.T) {
+	ctx := context.Background()
+	c, _, _ := newTestCache(t)
+
+	const callers = 20
+	var calls atomic.Int32
+	release := make(chan struct{})
+	load := func(context.Context) (int, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]int, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = GetOrLoad(ctx, c, "k", time.Minute, load)
+		}()
+	}
+
+	// Every caller has missed before the load is let go, so they all join it
+	require.Eventually(t, func() bool {
+		return c.Stats().Misses == callers
+	}, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, calls.Load())
+	for _, v := range results {
+		assert.Equal(t, 42, v)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for range 100 {
+		d := jitter(time.Minute)
+		assert.GreaterOrEqual(t, d, time.Minute)
+		assert.Less(t, d, time.Minute+6*time.Second)
+	}
+	assert.Equal(t, time.Duration(5), jitter(5))
+}
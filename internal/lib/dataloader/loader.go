@@ -0,0 +1,82 @@
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrNotFound is returned for keys the batch function did not return a value for
+var ErrNotFound = errors.New("dataloader: key not found")
+
+// BatchFunc loads every requested key in one round-trip
+type BatchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+// Thunk resolves a queued key, running the pending batch on first use
+type Thunk[V any] func() (V, error)
+
+type entry[V any] struct {
+	value V
+	err   error
+	done  bool
+}
+
+// Loader collects keys requested while a GraphQL level is being resolved and loads them
+// together once the first result is needed. Results are cached for the lifetime of the
+// loader, so it must be created per request.
+type Loader[K comparable, V any] struct {
+	batch BatchFunc[K, V]
+
+	mu      sync.Mutex
+	pending []K
+	entries map[K]*entry[V]
+}
+
+func New[K comparable, V any](batch BatchFunc[K, V]) *Loader[K, V] {
+	return &Loader[K, V]{
+		batch:   batch,
+		entries: make(map[K]*entry[V]),
+	}
+}
+
+// Load queues key for the next batch and returns a thunk for its value
+func (l *Loader[K, V]) Load(ctx context.Context, key K) Thunk[V] {
+	l.mu.Lock()
+	if _, ok := l.entries[key]; !ok {
+		l.entries[key] = &entry[V]{}
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (V, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		e := l.entries[key]
+		if !e.done {
+			l.dispatchLocked(ctx)
+		}
+
+		return e.value, e.err
+	}
+}
+
+func (l *Loader[K, V]) dispatchLocked(ctx context.Context) {
+	keys := l.pending
+	l.pending = nil
+
+	values, err := l.batch(ctx, keys)
+	for _, key := range keys {
+		e := l.entries[key]
+		e.done = true
+
+		switch value, ok := values[key]; {
+		case err != nil:
+			e.err = err
+		case !ok:
+			e.err = ErrNotFound
+		default:
+			e.value = value
+		}
+	}
+}
@@ -12,3 +12,31 @@ func (c *Client) SendWelcomeEmail(to, firstName string) error {
 		data,
 	)
 }
+
+func (c *Client) SendDataExportEmail(to, downloadURL, expiresAt string) error {
+	data := map[string]string{
+		"DownloadURL": downloadURL,
+		"ExpiresAt":   expiresAt,
+	}
+
+	return c.SendEmail(
+		to,
+		"Your GO-BP data export is ready",
+		TemplateDataExport,
+		data,
+	)
+}
+
+func (c *Client) SendMagicLinkEmail(to, loginURL, expiresIn string) error {
+	data := map[string]string{
+		"LoginURL":  loginURL,
+		"ExpiresIn": expiresIn,
+	}
+
+	return c.SendEmail(
+		to,
+		"Your GO-BP sign-in link",
+		TemplateMagicLink,
+		data,
+	)
+}
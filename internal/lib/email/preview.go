@@ -4,4 +4,12 @@ var PreviewData = map[string]map[string]string{
 	"welcome": {
 		"UserFirstName": "John",
 	},
+	"data_export": {
+		"DownloadURL": "http://localhost:8080/api/v1/me/exports/00000000-0000-0000-0000-000000000000/download?token=preview",
+		"ExpiresAt":   "January 2, 2006",
+	},
+	"magic_link": {
+		"LoginURL":  "http://localhost:8080/auth/magic?token=preview",
+		"ExpiresIn": "15 minutes",
+	},
 }
@@ -3,5 +3,7 @@ package email
 type Template string
 
 const (
-	TemplateWelcome Template = "welcome"
+	TemplateWelcome    Template = "welcome"
+	TemplateDataExport Template = "data_export"
+	TemplateMagicLink  Template = "magic_link"
 )
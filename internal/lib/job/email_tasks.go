@@ -8,7 +8,9 @@ import (
 )
 
 const (
-	TaskWelcome = "email:welcome"
+	TaskWelcome          = "email:welcome"
+	TaskMagicLink        = "email:magic_link"
+	TaskMagicLinkRequest = "email:magic_link_request"
 )
 
 type WelcomeEmailPayload struct {
@@ -30,3 +32,51 @@ func NewWelcomeEmailTask(to, firstName string) (*asynq.Task, error) {
 		asynq.Queue("default"),
 		asynq.Timeout(30*time.Second)), nil
 }
+
+// MagicLinkEmailPayload carries the plain sign-in link, which is stored nowhere else
+type MagicLinkEmailPayload struct {
+	To        string `json:"to"`
+	LoginURL  string `json:"login_url"`
+	ExpiresIn string `json:"expires_in"`
+}
+
+// NewMagicLinkEmailTask is queued as critical and retried briefly: the link expires
+// within minutes, so a late email is no use
+func NewMagicLinkEmailTask(to, loginURL, expiresIn string) (*asynq.Task, error) {
+	payload, err := json.Marshal(MagicLinkEmailPayload{
+		To:        to,
+		LoginURL:  loginURL,
+		ExpiresIn: expiresIn,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asynq.NewTask(TaskMagicLink, payload,
+		asynq.MaxRetry(2),
+		asynq.Queue("critical"),
+		asynq.Timeout(30*time.Second)), nil
+}
+
+// MagicLinkRequestPayload is a sign-in link asked for by address. The worker looks
+// the account up, so the request's response time says nothing about whether it exists.
+type MagicLinkRequestPayload struct {
+	Email string `json:"email"`
+	Next  string `json:"next"`
+}
+
+// NewMagicLinkRequestTask is queued as critical like the email it leads to
+func NewMagicLinkRequestTask(email, next string) (*asynq.Task, error) {
+	payload, err := json.Marshal(MagicLinkRequestPayload{
+		Email: email,
+		Next:  next,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asynq.NewTask(TaskMagicLinkRequest, payload,
+		asynq.MaxRetry(2),
+		asynq.Queue("critical"),
+		asynq.Timeout(30*time.Second)), nil
+}
@@ -47,3 +47,36 @@ func (j *JobService) handleWelcomeEmailTask(ctx context.Context, t *asynq.Task)
 		Msg("Successfully sent welcome email")
 	return nil
 }
+
+func (j *JobService) handleMagicLinkEmailTask(ctx context.Context, t *asynq.Task) error {
+	var p MagicLinkEmailPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("failed to unmarshal magic link email payload: %w", err)
+	}
+
+	// The link is a credential, so it stays out of the logs
+	j.logger.Info().
+		Str("type", "magic_link").
+		Str("to", p.To).
+		Msg("Processing magic link email task")
+
+	err := emailClient.SendMagicLinkEmail(
+		p.To,
+		p.LoginURL,
+		p.ExpiresIn,
+	)
+	if err != nil {
+		j.logger.Error().
+			Str("type", "magic_link").
+			Str("to", p.To).
+			Err(err).
+			Msg("Failed to send magic link email")
+		return err
+	}
+
+	j.logger.Info().
+		Str("type", "magic_link").
+		Str("to", p.To).
+		Msg("Successfully sent magic link email")
+	return nil
+}
@@ -1,6 +1,9 @@
 package job
 
 import (
+	"context"
+	"time"
+
 	"github.com/goku-m/starter/internal/config"
 	"github.com/hibiken/asynq"
 	"github.com/rs/zerolog"
@@ -9,6 +12,7 @@ import (
 type JobService struct {
 	Client *asynq.Client
 	server *asynq.Server
+	mux    *asynq.ServeMux
 	logger *zerolog.Logger
 }
 
@@ -28,29 +32,47 @@ func NewJobService(logger *zerolog.Logger, cfg *config.Config) *JobService {
 				"default":  3, // Default priority for most emails
 				"low":      1, // Lower priority for non-urgent emails
 			},
+			RetryDelayFunc: retryDelay,
 		},
 	)
 
 	return &JobService{
 		Client: client,
 		server: server,
+		mux:    asynq.NewServeMux(),
 		logger: logger,
 	}
 }
 
+// Start begins processing tasks. Every handler must be registered first: tasks of a
+// type without one fail and use up their retries.
 func (j *JobService) Start() error {
 	// Register task handlers
-	mux := asynq.NewServeMux()
-	mux.HandleFunc(TaskWelcome, j.handleWelcomeEmailTask)
+	j.mux.HandleFunc(TaskWelcome, j.handleWelcomeEmailTask)
+	j.mux.HandleFunc(TaskMagicLink, j.handleMagicLinkEmailTask)
 
 	j.logger.Info().Msg("Starting background job server")
-	if err := j.server.Start(mux); err != nil {
+	if err := j.server.Start(j.mux); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// retryDelay backs webhook deliveries off exponentially and leaves other tasks on asynq's default
+func retryDelay(n int, err error, t *asynq.Task) time.Duration {
+	if t.Type() == TaskWebhookDelivery {
+		return WebhookRetryDelay(n)
+	}
+	return asynq.DefaultRetryDelayFunc(n, err, t)
+}
+
+// RegisterHandler lets services that depend on repositories handle their own task
+// types; call it before Start
+func (j *JobService) RegisterHandler(taskType string, handler func(context.Context, *asynq.Task) error) {
+	j.mux.HandleFunc(taskType, handler)
+}
+
 func (j *JobService) Stop() {
 	j.logger.Info().Msg("Stopping background job server")
 	j.server.Shutdown()
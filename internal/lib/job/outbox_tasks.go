@@ -0,0 +1,6 @@
+package job
+
+// TaskOutboxEvent carried relayed outbox messages to the webhook dispatcher. The relay
+// now dispatches them itself so their order holds; the type is still handled so tasks
+// queued before the change are drained.
+const TaskOutboxEvent = "outbox:event"
@@ -0,0 +1,32 @@
+package job
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+const (
+	TaskExportUserData = "privacy:export"
+)
+
+type ExportUserDataPayload struct {
+	ExportID uuid.UUID `json:"export_id"`
+}
+
+func NewExportUserDataTask(exportID uuid.UUID) (*asynq.Task, error) {
+	payload, err := json.Marshal(ExportUserDataPayload{
+		ExportID: exportID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asynq.NewTask(TaskExportUserData, payload,
+		asynq.TaskID("export:"+exportID.String()),
+		asynq.MaxRetry(3),
+		asynq.Queue("low"),
+		asynq.Timeout(5*time.Minute)), nil
+}
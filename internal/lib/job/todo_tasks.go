@@ -0,0 +1,39 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+const (
+	TaskUnsnoozeTodo = "todo:unsnooze"
+)
+
+type UnsnoozeTodoPayload struct {
+	TodoID uuid.UUID `json:"todo_id"`
+	UserID string    `json:"user_id"`
+	Until  time.Time `json:"until"`
+}
+
+func NewUnsnoozeTodoTask(todoID uuid.UUID, userID string, until time.Time) (*asynq.Task, error) {
+	payload, err := json.Marshal(UnsnoozeTodoPayload{
+		TodoID: todoID,
+		UserID: userID,
+		Until:  until,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The task id makes re-enqueueing the same snooze a no-op
+	return asynq.NewTask(TaskUnsnoozeTodo, payload,
+		asynq.TaskID(fmt.Sprintf("unsnooze:%s:%d", todoID, until.Unix())),
+		asynq.ProcessAt(until),
+		asynq.MaxRetry(5),
+		asynq.Queue("default"),
+		asynq.Timeout(30*time.Second)), nil
+}
@@ -0,0 +1,45 @@
+package job
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+const (
+	TaskWebhookDelivery = "webhook:deliver"
+
+	WebhookMaxRetry       = 8
+	webhookBaseRetryDelay = 10 * time.Second
+	webhookMaxRetryDelay  = 6 * time.Hour
+)
+
+type WebhookDeliveryPayload struct {
+	DeliveryID uuid.UUID `json:"delivery_id"`
+}
+
+func NewWebhookDeliveryTask(deliveryID uuid.UUID) (*asynq.Task, error) {
+	payload, err := json.Marshal(WebhookDeliveryPayload{
+		DeliveryID: deliveryID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asynq.NewTask(TaskWebhookDelivery, payload,
+		asynq.TaskID("webhook:"+deliveryID.String()),
+		asynq.MaxRetry(WebhookMaxRetry),
+		asynq.Queue("default"),
+		asynq.Timeout(30*time.Second)), nil
+}
+
+// WebhookRetryDelay doubles the wait after each failed attempt: 10s, 20s, 40s ... capped at 6h
+func WebhookRetryDelay(retried int) time.Duration {
+	delay := webhookBaseRetryDelay << retried
+	if delay <= 0 || delay > webhookMaxRetryDelay {
+		return webhookMaxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,47 @@
+package job
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookRetryDelay(t *testing.T) {
+	tests := []struct {
+		retried int
+		want    time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 20 * time.Second},
+		{2, 40 * time.Second},
+		{5, 320 * time.Second},
+		{11, 5*time.Hour + 41*time.Minute + 20*time.Second},
+		{12, 6 * time.Hour},
+		{40, 6 * time.Hour},
+		// Large shifts overflow to zero or below and still hit the cap
+		{63, 6 * time.Hour},
+		{200, 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, WebhookRetryDelay(tt.retried), "retried=%d", tt.retried)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	task, err := NewWebhookDeliveryTask(uuid.New())
+	require.NoError(t, err)
+
+	for n := range WebhookMaxRetry {
+		assert.Equal(t, WebhookRetryDelay(n), retryDelay(n, errors.New("failed"), task))
+	}
+
+	// Other tasks keep asynq's default, which is randomised and grows far slower
+	other := asynq.NewTask(TaskWelcome, nil)
+	assert.Less(t, retryDelay(0, errors.New("failed"), other), time.Minute)
+}
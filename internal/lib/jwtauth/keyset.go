@@ -0,0 +1,183 @@
+package jwtauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrUnknownKey is returned for a key id the JWKS does not contain, even after a refetch
+var ErrUnknownKey = errors.New("jwtauth: unknown signing key")
+
+var errRefreshThrottled = errors.New("jwtauth: JWKS refreshed too recently")
+
+const (
+	defaultRefreshInterval = 15 * time.Minute
+	// Tokens naming unknown kids trigger refetches, but no more often than this, so
+	// garbage tokens or an issuer outage can't make us hammer the JWKS endpoint
+	minRefetchInterval = 10 * time.Second
+	fetchTimeout       = 10 * time.Second
+	maxJWKSBytes       = 1 << 20
+)
+
+// KeySet caches the signing keys published at a JWKS URL. Keys are refreshed every
+// RefreshInterval, and a token naming a key the cache hasn't seen refetches early,
+// so keys rotated in at the issuer are picked up without waiting for the interval.
+// If a refresh fails the previous keys keep being served.
+type KeySet struct {
+	url             string
+	client          *http.Client
+	refreshInterval time.Duration
+	logger          *zerolog.Logger
+	group           singleflight.Group
+
+	// Now can be replaced to control refresh timing
+	Now func() time.Time
+
+	mu          sync.RWMutex
+	keys        map[string]jose.JSONWebKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+func NewKeySet(url string, refreshInterval time.Duration, client *http.Client, logger *zerolog.Logger) *KeySet {
+	if refreshInterval <= 0 {
+		refreshInterval = defaultRefreshInterval
+	}
+	if client == nil {
+		client = &http.Client{Timeout: fetchTimeout}
+	}
+
+	return &KeySet{
+		url:             url,
+		client:          client,
+		refreshInterval: refreshInterval,
+		logger:          logger,
+		Now:             time.Now,
+	}
+}
+
+// Key returns the public key for kid. An empty kid matches only when the set holds
+// exactly one key.
+func (s *KeySet) Key(ctx context.Context, kid string) (*jose.JSONWebKey, error) {
+	key, found, fresh := s.lookup(kid)
+	if found && fresh {
+		return key, nil
+	}
+
+	if err := s.refresh(ctx); err != nil {
+		// A stale key is better than failing every request while the issuer is down
+		if found {
+			if !errors.Is(err, errRefreshThrottled) {
+				s.logger.Warn().Err(err).Str("jwks_url", s.url).Msg("failed to refresh JWKS, using cached keys")
+			}
+			return key, nil
+		}
+		if errors.Is(err, errRefreshThrottled) {
+			return nil, ErrUnknownKey
+		}
+		return nil, err
+	}
+
+	if key, found, _ = s.lookup(kid); !found {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+func (s *KeySet) lookup(kid string) (*jose.JSONWebKey, bool, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	fresh := s.Now().Sub(s.fetchedAt) < s.refreshInterval
+
+	if kid == "" {
+		if len(s.keys) != 1 {
+			return nil, false, fresh
+		}
+		for _, key := range s.keys {
+			return &key, true, fresh
+		}
+	}
+
+	key, ok := s.keys[kid]
+	return &key, ok, fresh
+}
+
+// refresh refetches the set. Concurrent callers share one fetch, and fetches are
+// at least minRefetchInterval apart whether or not the last one succeeded.
+func (s *KeySet) refresh(ctx context.Context) error {
+	s.mu.RLock()
+	throttled := s.Now().Sub(s.attemptedAt) < minRefetchInterval
+	s.mu.RUnlock()
+	if throttled {
+		return errRefreshThrottled
+	}
+
+	_, err, _ := s.group.Do("jwks", func() (any, error) {
+		// The fetch must not be cancelled because the first caller went away
+		keys, err := s.fetch(context.WithoutCancel(ctx))
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.attemptedAt = s.Now()
+		if err != nil {
+			return nil, err
+		}
+		s.keys = keys
+		s.fetchedAt = s.attemptedAt
+
+		s.logger.Debug().Str("jwks_url", s.url).Int("keys", len(keys)).Msg("refreshed JWKS")
+		return nil, nil
+	})
+	return err
+}
+
+func (s *KeySet) fetch(ctx context.Context) (map[string]jose.JSONWebKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build JWKS request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	var set jose.JSONWebKeySet
+	if err := json.NewDecoder(http.MaxBytesReader(nil, resp.Body, maxJWKSBytes)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]jose.JSONWebKey, len(set.Keys))
+	for _, key := range set.Keys {
+		// Only public signing keys can verify tokens; anything else is ignored
+		if (key.Use != "" && key.Use != "sig") || !key.IsPublic() || !key.Valid() {
+			continue
+		}
+		keys[key.KeyID] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("failed to fetch JWKS: no usable signing keys")
+	}
+
+	return keys, nil
+}
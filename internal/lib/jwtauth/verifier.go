@@ -0,0 +1,149 @@
+package jwtauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+)
+
+// ErrInvalidToken wraps every reason a token was rejected
+var ErrInvalidToken = errors.New("jwtauth: invalid token")
+
+// Only asymmetric algorithms: the keys come from a public JWKS, so accepting HS*
+// would let anyone who has fetched it mint tokens
+var allowedAlgorithms = []string{
+	string(jose.RS256), string(jose.RS384), string(jose.RS512),
+	string(jose.PS256), string(jose.PS384), string(jose.PS512),
+	string(jose.ES256), string(jose.ES384), string(jose.ES512),
+	string(jose.EdDSA),
+}
+
+type Options struct {
+	// Issuer and Audience are checked when set
+	Issuer   string
+	Audience string
+	// RoleClaim and PermissionsClaim name the claims mapped to the user's role and
+	// permissions; permissions may be a list or a space separated string
+	RoleClaim        string
+	PermissionsClaim string
+	// Leeway is the clock skew allowed on exp, nbf and iat
+	Leeway time.Duration
+}
+
+// Claims is what the rest of the app learns about the caller from a token
+type Claims struct {
+	Subject     string
+	Role        string
+	Permissions []string
+	ExpiresAt   time.Time
+	// Extra holds the claims beyond the registered ones, for callers that need more
+	Extra map[string]json.RawMessage
+}
+
+type Verifier struct {
+	keys *KeySet
+	opts Options
+
+	// Now can be replaced to check expiry against a fixed time
+	Now func() time.Time
+}
+
+func NewVerifier(keys *KeySet, opts Options) *Verifier {
+	if opts.RoleClaim == "" {
+		opts.RoleClaim = "role"
+	}
+	if opts.PermissionsClaim == "" {
+		opts.PermissionsClaim = "permissions"
+	}
+
+	return &Verifier{keys: keys, opts: opts, Now: time.Now}
+}
+
+// Verify checks the token's signature against the key set and its registered claims
+// against the options, and returns the mapped claims
+func (v *Verifier) Verify(ctx context.Context, raw string) (*Claims, error) {
+	token, err := jwt.ParseSigned(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if len(token.Headers) != 1 {
+		return nil, fmt.Errorf("%w: expected exactly one signature", ErrInvalidToken)
+	}
+
+	header := token.Headers[0]
+	if !slices.Contains(allowedAlgorithms, header.Algorithm) {
+		return nil, fmt.Errorf("%w: algorithm %q not allowed", ErrInvalidToken, header.Algorithm)
+	}
+
+	key, err := v.keys.Key(ctx, header.KeyID)
+	if err != nil {
+		if errors.Is(err, ErrUnknownKey) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
+		// The JWKS could not be loaded; that's our failure, not the caller's
+		return nil, err
+	}
+	if key.Algorithm != "" && key.Algorithm != header.Algorithm {
+		return nil, fmt.Errorf("%w: algorithm does not match key", ErrInvalidToken)
+	}
+
+	var (
+		registered jwt.Claims
+		custom     map[string]json.RawMessage
+	)
+	if err := token.Claims(key.Key, &registered, &custom); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if registered.Expiry == nil {
+		return nil, fmt.Errorf("%w: missing exp", ErrInvalidToken)
+	}
+	if registered.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidToken)
+	}
+
+	expected := jwt.Expected{Issuer: v.opts.Issuer, Time: v.Now()}
+	if v.opts.Audience != "" {
+		expected.Audience = jwt.Audience{v.opts.Audience}
+	}
+	if err := registered.ValidateWithLeeway(expected, v.opts.Leeway); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	claims := &Claims{
+		Subject:   registered.Subject,
+		ExpiresAt: registered.Expiry.Time(),
+		Extra:     custom,
+	}
+	if raw, ok := custom[v.opts.RoleClaim]; ok {
+		// A role that isn't a string is ignored rather than failing the login
+		_ = json.Unmarshal(raw, &claims.Role)
+	}
+	if raw, ok := custom[v.opts.PermissionsClaim]; ok {
+		claims.Permissions = parsePermissions(raw)
+	}
+
+	return claims, nil
+}
+
+// parsePermissions accepts ["a","b"] as well as the OAuth "scope" style "a b"
+func parsePermissions(raw json.RawMessage) []string {
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list
+	}
+
+	var joined string
+	if err := json.Unmarshal(raw, &joined); err == nil {
+		return strings.Fields(joined)
+	}
+
+	return nil
+}
@@ -0,0 +1,405 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com/"
+	testAudience = "starter"
+)
+
+var testNow = time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+
+// issuer serves a JWKS whose keys tests can rotate, and counts fetches
+type issuer struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu      sync.Mutex
+	keys    []jose.JSONWebKey
+	status  int
+	fetches atomic.Int32
+}
+
+func newIssuer(t *testing.T) *issuer {
+	t.Helper()
+
+	iss := &issuer{t: t, status: http.StatusOK}
+	iss.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		iss.fetches.Add(1)
+
+		iss.mu.Lock()
+		defer iss.mu.Unlock()
+
+		if iss.status != http.StatusOK {
+			w.WriteHeader(iss.status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: iss.keys})
+	}))
+	t.Cleanup(iss.server.Close)
+
+	return iss
+}
+
+// addKey publishes the public half of a new ES256 key and returns the private one
+func (iss *issuer) addKey(kid string) *ecdsa.PrivateKey {
+	iss.t.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(iss.t, err)
+
+	iss.publish(jose.JSONWebKey{Key: &priv.PublicKey, KeyID: kid, Algorithm: string(jose.ES256), Use: "sig"})
+	return priv
+}
+
+func (iss *issuer) publish(keys ...jose.JSONWebKey) {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.keys = append(iss.keys, keys...)
+}
+
+func (iss *issuer) setStatus(status int) {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.status = status
+}
+
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestVerifier(t *testing.T, iss *issuer, opts Options) (*Verifier, *testClock) {
+	t.Helper()
+
+	clock := &testClock{now: testNow}
+	logger := zerolog.Nop()
+
+	keys := NewKeySet(iss.server.URL, time.Hour, nil, &logger)
+	keys.Now = clock.Now
+
+	verifier := NewVerifier(keys, opts)
+	verifier.Now = clock.Now
+
+	return verifier, clock
+}
+
+func defaultClaims() jwt.Claims {
+	return jwt.Claims{
+		Issuer:    testIssuer,
+		Subject:   "user-1",
+		Audience:  jwt.Audience{testAudience},
+		IssuedAt:  jwt.NewNumericDate(testNow.Add(-time.Minute)),
+		NotBefore: jwt.NewNumericDate(testNow.Add(-time.Minute)),
+		Expiry:    jwt.NewNumericDate(testNow.Add(time.Hour)),
+	}
+}
+
+func sign(t *testing.T, alg jose.SignatureAlgorithm, key any, kid string, claims jwt.Claims, extra map[string]any) string {
+	t.Helper()
+
+	signingKey := jose.SigningKey{Algorithm: alg, Key: key}
+	if kid != "" {
+		signingKey.Key = jose.JSONWebKey{Key: key, KeyID: kid}
+	}
+
+	signer, err := jose.NewSigner(signingKey, (&jose.SignerOptions{}).WithType("JWT"))
+	require.NoError(t, err)
+
+	builder := jwt.Signed(signer).Claims(claims)
+	if extra != nil {
+		builder = builder.Claims(extra)
+	}
+
+	raw, err := builder.CompactSerialize()
+	require.NoError(t, err)
+	return raw
+}
+
+func TestVerify(t *testing.T) {
+	iss := newIssuer(t)
+	priv := iss.addKey("k1")
+	v, _ := newTestVerifier(t, iss, Options{Issuer: testIssuer, Audience: testAudience})
+
+	raw := sign(t, jose.ES256, priv, "k1", defaultClaims(), map[string]any{
+		"role":        "admin",
+		"permissions": []string{"todos:read", "todos:write"},
+		"tenant":      "acme",
+	})
+
+	claims, err := v.Verify(context.Background(), raw)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject)
+	assert.Equal(t, "admin", claims.Role)
+	assert.Equal(t, []string{"todos:read", "todos:write"}, claims.Permissions)
+	assert.True(t, testNow.Add(time.Hour).Equal(claims.ExpiresAt))
+	assert.JSONEq(t, `"acme"`, string(claims.Extra["tenant"]))
+}
+
+func TestVerifyCustomClaimNames(t *testing.T) {
+	iss := newIssuer(t)
+	priv := iss.addKey("k1")
+	v, _ := newTestVerifier(t, iss, Options{RoleClaim: "https://example.com/role", PermissionsClaim: "scope"})
+
+	raw := sign(t, jose.ES256, priv, "k1", defaultClaims(), map[string]any{
+		"https://example.com/role": "member",
+		"scope":                    "todos:read todos:write",
+	})
+
+	claims, err := v.Verify(context.Background(), raw)
+	require.NoError(t, err)
+	assert.Equal(t, "member", claims.Role)
+	assert.Equal(t, []string{"todos:read", "todos:write"}, claims.Permissions)
+}
+
+func TestVerifyRegisteredClaims(t *testing.T) {
+	iss := newIssuer(t)
+	priv := iss.addKey("k1")
+
+	tests := []struct {
+		name   string
+		modify func(c *jwt.Claims)
+		leeway time.Duration
+		valid  bool
+	}{
+		{"valid", func(c *jwt.Claims) {}, 0, true},
+		{"expired", func(c *jwt.Claims) { c.Expiry = jwt.NewNumericDate(testNow.Add(-time.Second)) }, 0, false},
+		{"expired within leeway", func(c *jwt.Claims) { c.Expiry = jwt.NewNumericDate(testNow.Add(-time.Second)) }, time.Minute, true},
+		{"missing exp", func(c *jwt.Claims) { c.Expiry = nil }, 0, false},
+		{"not yet valid", func(c *jwt.Claims) { c.NotBefore = jwt.NewNumericDate(testNow.Add(time.Hour)) }, 0, false},
+		{"not yet valid within leeway", func(c *jwt.Claims) { c.NotBefore = jwt.NewNumericDate(testNow.Add(30 * time.Second)) }, time.Minute, true},
+		{"wrong issuer", func(c *jwt.Claims) { c.Issuer = "https://evil.example.com/" }, 0, false},
+		{"missing issuer", func(c *jwt.Claims) { c.Issuer = "" }, 0, false},
+		{"wrong audience", func(c *jwt.Claims) { c.Audience = jwt.Audience{"other"} }, 0, false},
+		{"one of several audiences", func(c *jwt.Claims) { c.Audience = jwt.Audience{"other", testAudience} }, 0, true},
+		{"missing subject", func(c *jwt.Claims) { c.Subject = "" }, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := newTestVerifier(t, iss, Options{Issuer: testIssuer, Audience: testAudience, Leeway: tt.leeway})
+
+			claims := defaultClaims()
+			tt.modify(&claims)
+
+			_, err := v.Verify(context.Background(), sign(t, jose.ES256, priv, "k1", claims, nil))
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsDisallowedAlgorithms(t *testing.T) {
+	iss := newIssuer(t)
+	priv := iss.addKey("k1")
+	v, _ := newTestVerifier(t, iss, Options{})
+
+	t.Run("HS256", func(t *testing.T) {
+		// Signed with the public JWKS contents as the secret, as an attacker would
+		public, err := json.Marshal(jose.JSONWebKey{Key: &priv.PublicKey, KeyID: "k1"})
+		require.NoError(t, err)
+
+		_, err = v.Verify(context.Background(), sign(t, jose.HS256, public, "k1", defaultClaims(), nil))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("none", func(t *testing.T) {
+		encode := func(v any) string {
+			data, err := json.Marshal(v)
+			require.NoError(t, err)
+			return base64.RawURLEncoding.EncodeToString(data)
+		}
+		raw := encode(map[string]string{"alg": "none", "typ": "JWT", "kid": "k1"}) + "." + encode(defaultClaims()) + "."
+
+		_, err := v.Verify(context.Background(), raw)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("algorithm other than the key's", func(t *testing.T) {
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		iss.publish(jose.JSONWebKey{Key: &rsaKey.PublicKey, KeyID: "rsa", Algorithm: string(jose.RS256), Use: "sig"})
+		v, _ := newTestVerifier(t, iss, Options{})
+
+		_, err = v.Verify(context.Background(), sign(t, jose.PS256, rsaKey, "rsa", defaultClaims(), nil))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		_, err = v.Verify(context.Background(), sign(t, jose.RS256, rsaKey, "rsa", defaultClaims(), nil))
+		assert.NoError(t, err)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+
+		_, err = v.Verify(context.Background(), sign(t, jose.ES256, other, "k1", defaultClaims(), nil))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		_, err := v.Verify(context.Background(), "not.a.token")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+}
+
+func TestKeySetPicksUpRotatedKeys(t *testing.T) {
+	iss := newIssuer(t)
+	first := iss.addKey("k1")
+	v, clock := newTestVerifier(t, iss, Options{})
+	ctx := context.Background()
+
+	_, err := v.Verify(ctx, sign(t, jose.ES256, first, "k1", defaultClaims(), nil))
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, iss.fetches.Load())
+
+	// Known keys are served from the cache
+	_, err = v.Verify(ctx, sign(t, jose.ES256, first, "k1", defaultClaims(), nil))
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, iss.fetches.Load())
+
+	// A new kid refetches early, once the throttle allows
+	second := iss.addKey("k2")
+	clock.Advance(minRefetchInterval)
+	_, err = v.Verify(ctx, sign(t, jose.ES256, second, "k2", defaultClaims(), nil))
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, iss.fetches.Load())
+}
+
+func TestKeySetThrottlesRefetches(t *testing.T) {
+	iss := newIssuer(t)
+	priv := iss.addKey("k1")
+	v, clock := newTestVerifier(t, iss, Options{})
+	ctx := context.Background()
+
+	_, err := v.Verify(ctx, sign(t, jose.ES256, priv, "k1", defaultClaims(), nil))
+	require.NoError(t, err)
+
+	// Garbage kids can't make every request refetch
+	clock.Advance(minRefetchInterval)
+	for range 5 {
+		_, err := v.Verify(ctx, sign(t, jose.ES256, priv, "unknown", defaultClaims(), nil))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	}
+	assert.EqualValues(t, 2, iss.fetches.Load())
+
+	clock.Advance(minRefetchInterval)
+	_, err = v.Verify(ctx, sign(t, jose.ES256, priv, "unknown", defaultClaims(), nil))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.EqualValues(t, 3, iss.fetches.Load())
+}
+
+func TestKeySetServesCachedKeysWhileIssuerIsDown(t *testing.T) {
+	iss := newIssuer(t)
+	priv := iss.addKey("k1")
+	v, clock := newTestVerifier(t, iss, Options{})
+	ctx := context.Background()
+
+	_, err := v.Verify(ctx, sign(t, jose.ES256, priv, "k1", defaultClaims(), nil))
+	require.NoError(t, err)
+
+	iss.setStatus(http.StatusServiceUnavailable)
+	clock.Advance(2 * time.Hour)
+
+	claims := defaultClaims()
+	claims.Expiry = jwt.NewNumericDate(clock.Now().Add(time.Hour))
+	_, err = v.Verify(ctx, sign(t, jose.ES256, priv, "k1", claims, nil))
+	assert.NoError(t, err, "stale key is used when the refresh fails")
+	assert.EqualValues(t, 2, iss.fetches.Load())
+}
+
+func TestKeySetFailsWithoutKeys(t *testing.T) {
+	iss := newIssuer(t)
+	iss.setStatus(http.StatusInternalServerError)
+	v, _ := newTestVerifier(t, iss, Options{})
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	// Not the caller's fault, so not reported as an invalid token
+	_, err = v.Verify(context.Background(), sign(t, jose.ES256, priv, "k1", defaultClaims(), nil))
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestKeySetIgnoresUnusableKeys(t *testing.T) {
+	iss := newIssuer(t)
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	encryption, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	iss.publish(
+		jose.JSONWebKey{Key: &encryption.PublicKey, KeyID: "enc", Use: "enc"},
+		jose.JSONWebKey{Key: private, KeyID: "private"},
+	)
+	signing := iss.addKey("sig")
+
+	keys := NewKeySet(iss.server.URL, time.Hour, nil, &logger)
+
+	_, err = keys.Key(ctx, "enc")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	_, err = keys.Key(ctx, "private")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	key, err := keys.Key(ctx, "sig")
+	require.NoError(t, err)
+	assert.Equal(t, &signing.PublicKey, key.Key)
+}
+
+func TestKeySetEmptyKid(t *testing.T) {
+	iss := newIssuer(t)
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	only := iss.addKey("k1")
+	keys := NewKeySet(iss.server.URL, time.Hour, nil, &logger)
+
+	key, err := keys.Key(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, &only.PublicKey, key.Key, "an empty kid matches the only key")
+
+	iss.addKey("k2")
+	keys = NewKeySet(iss.server.URL, time.Hour, nil, &logger)
+
+	_, err = keys.Key(ctx, "")
+	assert.ErrorIs(t, err, ErrUnknownKey, "but is ambiguous with several")
+}
@@ -0,0 +1,291 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goku-m/starter/internal/lib/jwtauth"
+	"github.com/rs/zerolog"
+)
+
+// ErrInvalidResponse covers everything the provider or the browser sent back that
+// doesn't check out, as opposed to the provider being unreachable
+var ErrInvalidResponse = errors.New("oidc: invalid response")
+
+const (
+	requestTimeout = 10 * time.Second
+	maxBodyBytes   = 1 << 20
+	idTokenLeeway  = 30 * time.Second
+)
+
+var defaultScopes = []string{"openid", "email", "profile"}
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL must match the one registered with the provider exactly
+	RedirectURL string
+	// Scopes requested besides openid; defaults to email and profile
+	Scopes []string
+}
+
+// Metadata is the part of the discovery document the login flow needs
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Identity is who the provider says signed in
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider runs the authorization code flow with PKCE against one OpenID provider.
+// Discovery happens on first use and is retried until it succeeds, so the app starts
+// even while the provider is down.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+	logger *zerolog.Logger
+
+	// Now can be replaced to check ID token expiry against a fixed time
+	Now func() time.Time
+
+	mu       sync.Mutex
+	metadata *Metadata
+	verifier *jwtauth.Verifier
+}
+
+func NewProvider(cfg Config, client *http.Client, logger *zerolog.Logger) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+
+	return &Provider{
+		cfg:    cfg,
+		client: client,
+		logger: logger,
+		Now:    time.Now,
+	}
+}
+
+func (p *Provider) discover(ctx context.Context) (*Metadata, *jwtauth.Verifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, p.verifier, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var metadata Metadata
+	if err := p.do(req, &metadata); err != nil {
+		return nil, nil, fmt.Errorf("failed to load OIDC discovery document: %w", err)
+	}
+
+	// The document must be about the issuer we were configured with, or ID tokens
+	// could be accepted from whoever controls the document
+	if metadata.Issuer != p.cfg.Issuer {
+		return nil, nil, fmt.Errorf("OIDC discovery issuer %q does not match configured issuer %q", metadata.Issuer, p.cfg.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, nil, errors.New("OIDC discovery document is missing endpoints")
+	}
+
+	keys := jwtauth.NewKeySet(metadata.JWKSURI, 0, p.client, p.logger)
+	verifier := jwtauth.NewVerifier(keys, jwtauth.Options{
+		Issuer:   metadata.Issuer,
+		Audience: p.cfg.ClientID,
+		Leeway:   idTokenLeeway,
+	})
+	verifier.Now = func() time.Time { return p.Now() }
+
+	p.metadata = &metadata
+	p.verifier = verifier
+	return p.metadata, p.verifier, nil
+}
+
+// AuthCodeURL is where the browser is sent to sign in. state, nonce and the PKCE
+// verifier must be kept by the caller until the callback.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	metadata, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultScopes
+	}
+	if !slices.Contains(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {CodeChallenge(codeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return metadata.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+// Exchange trades the authorization code for tokens and returns the verified
+// identity from the ID token
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+	metadata, verifier, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if p.cfg.ClientSecret == "" {
+		// Public clients identify themselves in the body
+		form.Set("client_id", p.cfg.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := p.do(req, &tokens); err != nil {
+		if tokens.Error != "" {
+			return nil, fmt.Errorf("%w: token endpoint returned %s: %s", ErrInvalidResponse, tokens.Error, tokens.ErrorDescription)
+		}
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: token response has no id_token", ErrInvalidResponse)
+	}
+
+	return p.verifyIDToken(ctx, verifier, tokens.IDToken, nonce)
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, verifier *jwtauth.Verifier, raw, nonce string) (*Identity, error) {
+	claims, err := verifier.Verify(ctx, raw)
+	if err != nil {
+		if errors.Is(err, jwtauth.ErrInvalidToken) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+		}
+		return nil, err
+	}
+
+	var extra struct {
+		Nonce         string          `json:"nonce"`
+		AZP           string          `json:"azp"`
+		Email         string          `json:"email"`
+		EmailVerified json.RawMessage `json:"email_verified"`
+		Name          string          `json:"name"`
+	}
+	for name, target := range map[string]any{
+		"nonce":          &extra.Nonce,
+		"azp":            &extra.AZP,
+		"email":          &extra.Email,
+		"email_verified": &extra.EmailVerified,
+		"name":           &extra.Name,
+	} {
+		if value, ok := claims.Extra[name]; ok {
+			// Claims of an unexpected type are treated as absent
+			_ = json.Unmarshal(value, target)
+		}
+	}
+
+	// The nonce ties the token to the browser that started the flow, so a token
+	// lifted from elsewhere can't be replayed here
+	if nonce == "" || extra.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidResponse)
+	}
+	if extra.AZP != "" && extra.AZP != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: token was issued to another client", ErrInvalidResponse)
+	}
+
+	return &Identity{
+		Issuer:        p.cfg.Issuer,
+		Subject:       claims.Subject,
+		Email:         extra.Email,
+		EmailVerified: parseBool(extra.EmailVerified),
+		Name:          extra.Name,
+	}, nil
+}
+
+func (p *Provider) do(req *http.Request, out any) error {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	if err != nil {
+		return err
+	}
+
+	// Error responses are decoded too, so callers can report the provider's reason
+	decodeErr := json.Unmarshal(body, out)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, req.URL.Redacted())
+	}
+	return decodeErr
+}
+
+// parseBool accepts true as well as "true", which some providers send
+func parseBool(raw json.RawMessage) bool {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s == "true"
+	}
+
+	return false
+}
@@ -0,0 +1,436 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testClientID     = "starter"
+	testClientSecret = "s3cret"
+	testRedirectURL  = "https://app.example.com/auth/oidc/callback"
+)
+
+var testNow = time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+
+// authorization is what the mock provider remembers about a code it handed out
+type authorization struct {
+	challenge string
+	nonce     string
+}
+
+// mockProvider serves discovery, a JWKS and a token endpoint that enforces PKCE and
+// client authentication the way a real provider does
+type mockProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *ecdsa.PrivateKey
+	secret string
+
+	mu sync.Mutex
+	// issuer is what discovery advertises; the server URL unless a test changes it
+	issuer string
+	codes  map[string]authorization
+	// claims adjusts the ID token before it is signed
+	claims func(c *jwt.Claims, extra map[string]any)
+	// signingKey signs ID tokens instead of the published key when set
+	signingKey *ecdsa.PrivateKey
+	form       url.Values
+	basicAuth  bool
+}
+
+func newMockProvider(t *testing.T, secret string) *mockProvider {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	m := &mockProvider{t: t, key: key, secret: secret, codes: map[string]authorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("GET /jwks", m.jwks)
+	mux.HandleFunc("POST /token", m.token)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+
+	m.issuer = m.server.URL
+	return m
+}
+
+func (m *mockProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, Metadata{
+		Issuer:                m.issuer,
+		AuthorizationEndpoint: m.server.URL + "/authorize",
+		TokenEndpoint:         m.server.URL + "/token",
+		JWKSURI:               m.server.URL + "/jwks",
+	})
+}
+
+func (m *mockProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &m.key.PublicKey, KeyID: "k1", Algorithm: string(jose.ES256), Use: "sig"},
+	}})
+}
+
+func (m *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	m.form = r.PostForm
+	clientID, secret, hasBasic := r.BasicAuth()
+	m.basicAuth = hasBasic
+
+	// Confidential clients authenticate with basic auth, public ones name themselves
+	if m.secret != "" {
+		if !hasBasic || clientID != testClientID || secret != m.secret {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+	} else if hasBasic || r.PostForm.Get("client_id") != testClientID {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("redirect_uri") != testRedirectURL {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	// Codes are single use
+	code := r.PostForm.Get("code")
+	auth, ok := m.codes[code]
+	delete(m.codes, code)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "unknown code"})
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     m.idToken(auth.nonce),
+	})
+}
+
+func (m *mockProvider) idToken(nonce string) string {
+	claims := jwt.Claims{
+		Issuer:   m.server.URL,
+		Subject:  "user-1",
+		Audience: jwt.Audience{testClientID},
+		IssuedAt: jwt.NewNumericDate(testNow.Add(-time.Minute)),
+		Expiry:   jwt.NewNumericDate(testNow.Add(time.Hour)),
+	}
+	extra := map[string]any{
+		"nonce":          nonce,
+		"email":          "ana@example.com",
+		"email_verified": true,
+		"name":           "Ana",
+	}
+	if m.claims != nil {
+		m.claims(&claims, extra)
+	}
+
+	key := m.key
+	if m.signingKey != nil {
+		key = m.signingKey
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.ES256,
+		Key:       jose.JSONWebKey{Key: key, KeyID: "k1"},
+	}, (&jose.SignerOptions{}).WithType("JWT"))
+	require.NoError(m.t, err)
+
+	raw, err := jwt.Signed(signer).Claims(claims).Claims(extra).CompactSerialize()
+	require.NoError(m.t, err)
+	return raw
+}
+
+// authorize stands in for the user signing in at the provider: it takes the URL the
+// browser was sent to and returns the code the provider redirects back with
+func (m *mockProvider) authorize(authURL string) string {
+	m.t.Helper()
+
+	u, err := url.Parse(authURL)
+	require.NoError(m.t, err)
+	require.Equal(m.t, m.server.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+
+	query := u.Query()
+	require.Equal(m.t, "S256", query.Get("code_challenge_method"))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	code := fmt.Sprintf("code-%d", len(m.codes)+1)
+	m.codes[code] = authorization{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	return code
+}
+
+func (m *mockProvider) setIssuer(issuer string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.issuer = issuer
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func newTestProvider(t *testing.T, m *mockProvider, scopes ...string) *Provider {
+	t.Helper()
+
+	logger := zerolog.Nop()
+	p := NewProvider(Config{
+		Issuer:       m.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: m.secret,
+		RedirectURL:  testRedirectURL,
+		Scopes:       scopes,
+	}, nil, &logger)
+	p.Now = func() time.Time { return testNow }
+	return p
+}
+
+// login runs the flow up to the code exchange, with fresh state, nonce and verifier
+func login(t *testing.T, m *mockProvider, p *Provider) (*Identity, error) {
+	t.Helper()
+
+	verifier, err := RandomString()
+	require.NoError(t, err)
+
+	authURL, err := p.AuthCodeURL(context.Background(), "state", "nonce-1", verifier)
+	require.NoError(t, err)
+
+	return p.Exchange(context.Background(), m.authorize(authURL), verifier, "nonce-1")
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	m := newMockProvider(t, testClientSecret)
+	p := newTestProvider(t, m)
+
+	authURL, err := p.AuthCodeURL(context.Background(), "state-1", "nonce-1", "verifier-1")
+	require.NoError(t, err)
+
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	query := u.Query()
+
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, testClientID, query.Get("client_id"))
+	assert.Equal(t, testRedirectURL, query.Get("redirect_uri"))
+	assert.Equal(t, "openid email profile", query.Get("scope"))
+	assert.Equal(t, "state-1", query.Get("state"))
+	assert.Equal(t, "nonce-1", query.Get("nonce"))
+	assert.Equal(t, CodeChallenge("verifier-1"), query.Get("code_challenge"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.NotContains(t, authURL, "verifier-1", "the verifier never leaves the app")
+}
+
+func TestAuthCodeURLAddsOpenIDScope(t *testing.T) {
+	m := newMockProvider(t, testClientSecret)
+	p := newTestProvider(t, m, "email")
+
+	authURL, err := p.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	require.NoError(t, err)
+
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, "openid email", u.Query().Get("scope"))
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// The example from RFC 7636, appendix B
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	m := newMockProvider(t, testClientSecret)
+	p := newTestProvider(t, m)
+
+	m.setIssuer("https://evil.example.com")
+	_, err := p.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match configured issuer")
+
+	// A failed discovery isn't remembered, so the provider recovers once it's fixed
+	m.setIssuer(m.server.URL)
+	_, err = p.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	assert.NoError(t, err)
+}
+
+func TestExchange(t *testing.T) {
+	m := newMockProvider(t, testClientSecret)
+	p := newTestProvider(t, m)
+
+	identity, err := login(t, m, p)
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{
+		Issuer:        m.server.URL,
+		Subject:       "user-1",
+		Email:         "ana@example.com",
+		EmailVerified: true,
+		Name:          "Ana",
+	}, identity)
+
+	// Confidential clients use basic auth and keep the client out of the body
+	assert.True(t, m.basicAuth)
+	assert.Empty(t, m.form.Get("client_id"))
+	assert.NotEmpty(t, m.form.Get("code_verifier"))
+}
+
+func TestExchangePublicClient(t *testing.T) {
+	m := newMockProvider(t, "")
+	p := newTestProvider(t, m)
+
+	_, err := login(t, m, p)
+	require.NoError(t, err)
+	assert.False(t, m.basicAuth)
+	assert.Equal(t, testClientID, m.form.Get("client_id"))
+}
+
+func TestExchangePKCE(t *testing.T) {
+	m := newMockProvider(t, testClientSecret)
+	p := newTestProvider(t, m)
+
+	authURL, err := p.AuthCodeURL(context.Background(), "state", "nonce", "verifier-1")
+	require.NoError(t, err)
+	code := m.authorize(authURL)
+
+	// A code intercepted on the way back is useless without the verifier
+	_, err = p.Exchange(context.Background(), code, "verifier-2", "nonce")
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+	assert.Contains(t, err.Error(), "invalid_grant")
+
+	// And codes can't be replayed once tried
+	_, err = p.Exchange(context.Background(), code, "verifier-1", "nonce")
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+}
+
+func TestExchangeNonce(t *testing.T) {
+	m := newMockProvider(t, testClientSecret)
+	p := newTestProvider(t, m)
+
+	for _, nonce := range []string{"nonce-2", ""} {
+		authURL, err := p.AuthCodeURL(context.Background(), "state", "nonce-1", "verifier")
+		require.NoError(t, err)
+
+		_, err = p.Exchange(context.Background(), m.authorize(authURL), "verifier", nonce)
+		assert.ErrorIs(t, err, ErrInvalidResponse, "nonce=%q", nonce)
+		assert.Contains(t, err.Error(), "nonce mismatch")
+	}
+}
+
+func TestExchangeVerifiesIDToken(t *testing.T) {
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		claims func(c *jwt.Claims, extra map[string]any)
+		forged bool
+		valid  bool
+	}{
+		{"valid", nil, false, true},
+		{"signed with another key", nil, true, false},
+		{"other issuer", func(c *jwt.Claims, extra map[string]any) { c.Issuer = "https://evil.example.com" }, false, false},
+		{"other audience", func(c *jwt.Claims, extra map[string]any) { c.Audience = jwt.Audience{"other"} }, false, false},
+		{"expired", func(c *jwt.Claims, extra map[string]any) { c.Expiry = jwt.NewNumericDate(testNow.Add(-time.Minute)) }, false, false},
+		{"expired within leeway", func(c *jwt.Claims, extra map[string]any) {
+			c.Expiry = jwt.NewNumericDate(testNow.Add(-10 * time.Second))
+		}, false, true},
+		{"issued to another client", func(c *jwt.Claims, extra map[string]any) {
+			c.Audience = jwt.Audience{testClientID, "other"}
+			extra["azp"] = "other"
+		}, false, false},
+		{"authorized party is this client", func(c *jwt.Claims, extra map[string]any) {
+			c.Audience = jwt.Audience{testClientID, "other"}
+			extra["azp"] = testClientID
+		}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockProvider(t, testClientSecret)
+			m.claims = tt.claims
+			if tt.forged {
+				m.signingKey = otherKey
+			}
+			p := newTestProvider(t, m)
+
+			identity, err := login(t, m, p)
+			if tt.valid {
+				require.NoError(t, err)
+				assert.Equal(t, "user-1", identity.Subject)
+				return
+			}
+			assert.ErrorIs(t, err, ErrInvalidResponse)
+			assert.Nil(t, identity)
+		})
+	}
+}
+
+func TestExchangeEmailVerified(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  bool
+	}{
+		{"bool true", true, true},
+		{"bool false", false, false},
+		{"string true", "true", true},
+		{"string false", "false", false},
+		{"missing", nil, false},
+		{"unexpected type", 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockProvider(t, testClientSecret)
+			m.claims = func(c *jwt.Claims, extra map[string]any) {
+				if tt.value == nil {
+					delete(extra, "email_verified")
+					return
+				}
+				extra["email_verified"] = tt.value
+			}
+			p := newTestProvider(t, m)
+
+			identity, err := login(t, m, p)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, identity.EmailVerified)
+		})
+	}
+}
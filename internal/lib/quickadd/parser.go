@@ -0,0 +1,377 @@
+package quickadd
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goku-m/starter/internal/model/todo"
+)
+
+// DefaultDueHour is used when a date is given without a time of day
+const DefaultDueHour = 9
+
+var ErrEmptyTitle = errors.New("quick add text has no title")
+
+var (
+	clockRegex    = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)$`)
+	clock24Regex  = regexp.MustCompile(`^([01]?\d|2[0-3]):([0-5]\d)$`)
+	isoDateRegex  = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	tagRegex      = regexp.MustCompile(`^#([\p{L}\p{N}_-]+)$`)
+	relativeUnits = map[string]int{
+		"day": 1, "days": 1, "d": 1,
+		"week": 7, "weeks": 7, "w": 7,
+	}
+	weekdays = map[string]time.Weekday{
+		"sunday":    time.Sunday,
+		"monday":    time.Monday,
+		"tuesday":   time.Tuesday,
+		"wednesday": time.Wednesday,
+		"thursday":  time.Thursday,
+		"friday":    time.Friday,
+		"saturday":  time.Saturday,
+	}
+	// Abbreviations are also ordinary words ("sun cream", "sat down"), so they only
+	// count where a date is expected; see weekday
+	weekdayAbbreviations = map[string]time.Weekday{
+		"sun": time.Sunday,
+		"mon": time.Monday,
+		"tue": time.Tuesday, "tues": time.Tuesday,
+		"wed": time.Wednesday,
+		"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday,
+		"fri": time.Friday,
+		"sat": time.Saturday,
+	}
+	priorities = map[string]todo.Priority{
+		"!high": todo.PriorityHigh, "!h": todo.PriorityHigh, "!!!": todo.PriorityHigh,
+		"!medium": todo.PriorityMedium, "!med": todo.PriorityMedium, "!m": todo.PriorityMedium, "!!": todo.PriorityMedium,
+		"!low": todo.PriorityLow, "!l": todo.PriorityLow, "!": todo.PriorityLow,
+	}
+)
+
+type clock struct {
+	hour   int
+	minute int
+}
+
+// parser holds the state of a single Parse call
+type parser struct {
+	tokens   []string
+	pos      int
+	now      time.Time
+	date     *time.Time
+	clock    *clock
+	priority *todo.Priority
+	tags     []string
+	title    []string
+
+	// impliedClock is the time a date stands for when no time is given, as "tonight"
+	// does. It only applies once parsing is done, so a time anywhere in the text wins.
+	impliedClock *clock
+}
+
+// Parse turns free text such as "Pay rent tomorrow 9am !high #home" into a create payload.
+// Relative dates are resolved against now, in now's location, so results are deterministic.
+func Parse(text string, now time.Time) (*todo.CreateTodoPayload, error) {
+	p := &parser{
+		tokens: strings.Fields(text),
+		now:    now,
+	}
+
+	for p.pos < len(p.tokens) {
+		if !p.consume() {
+			p.title = append(p.title, p.tokens[p.pos])
+			p.pos++
+		}
+	}
+
+	title := strings.Join(p.title, " ")
+	if title == "" {
+		return nil, ErrEmptyTitle
+	}
+
+	payload := &todo.CreateTodoPayload{
+		Title:    title,
+		Priority: p.priority,
+		DueDate:  p.dueDate(),
+		Tags:     p.tags,
+	}
+
+	return payload, nil
+}
+
+// consume tries every recognised construct at the current position and advances past it on success
+func (p *parser) consume() bool {
+	token := p.tokens[p.pos]
+	lower := strings.ToLower(token)
+
+	if priority, ok := priorities[lower]; ok {
+		p.priority = &priority
+		p.pos++
+		return true
+	}
+
+	if m := tagRegex.FindStringSubmatch(token); m != nil {
+		tag := strings.ToLower(m[1])
+		for _, existing := range p.tags {
+			if existing == tag {
+				p.pos++
+				return true
+			}
+		}
+		p.tags = append(p.tags, tag)
+		p.pos++
+		return true
+	}
+
+	// Prepositions are only swallowed when they introduce a date or time
+	switch lower {
+	case "on", "by", "due":
+		if p.date == nil && p.peekDate(p.pos+1) > 0 {
+			p.pos++
+			p.pos += p.parseDate(p.pos)
+			return true
+		}
+		return false
+	case "at", "@":
+		if p.clock == nil && p.peekClock(p.pos+1) {
+			p.pos++
+			p.parseClock(p.pos)
+			p.pos++
+			return true
+		}
+		return false
+	}
+
+	if p.date == nil {
+		if n := p.parseDate(p.pos); n > 0 {
+			p.pos += n
+			return true
+		}
+	}
+
+	if p.clock == nil && p.peekClock(p.pos) {
+		p.parseClock(p.pos)
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+// peekDate reports how many tokens a date expression at i would consume without recording it
+func (p *parser) peekDate(i int) int {
+	savedDate, savedClock, savedImplied := p.date, p.clock, p.impliedClock
+	n := p.parseDate(i)
+	p.date, p.clock, p.impliedClock = savedDate, savedClock, savedImplied
+	return n
+}
+
+// parseDate recognises a date expression starting at token i and returns the number of tokens used
+func (p *parser) parseDate(i int) int {
+	if i >= len(p.tokens) {
+		return 0
+	}
+
+	today := startOfDay(p.now)
+	word := strings.ToLower(p.tokens[i])
+
+	switch word {
+	case "today":
+		p.setDate(today)
+		return 1
+	case "tonight":
+		p.setDate(today)
+		p.impliedClock = &clock{hour: 20}
+		return 1
+	case "tomorrow", "tmr", "tmrw":
+		p.setDate(today.AddDate(0, 0, 1))
+		return 1
+	case "next":
+		if i+1 >= len(p.tokens) {
+			return 0
+		}
+		nextWord := strings.ToLower(p.tokens[i+1])
+		if weekday, ok := p.weekday(i+1, true); ok {
+			// "next friday" is the friday of the following (Monday-based) week
+			p.setDate(startOfWeek(today).AddDate(0, 0, 7+(int(weekday)+6)%7))
+			return 2
+		}
+		switch nextWord {
+		case "week":
+			p.setDate(startOfWeek(today).AddDate(0, 0, 7))
+			return 2
+		case "month":
+			p.setDate(time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, today.Location()))
+			return 2
+		}
+		return 0
+	case "in":
+		if i+2 >= len(p.tokens) {
+			return 0
+		}
+		n, err := strconv.Atoi(p.tokens[i+1])
+		if err != nil || n < 0 {
+			return 0
+		}
+		unit := strings.ToLower(p.tokens[i+2])
+		if days, ok := relativeUnits[unit]; ok {
+			p.setDate(today.AddDate(0, 0, n*days))
+			return 3
+		}
+		if unit == "hour" || unit == "hours" || unit == "h" {
+			at := p.now.Add(time.Duration(n) * time.Hour)
+			p.setDate(startOfDay(at))
+			p.clock = &clock{hour: at.Hour(), minute: at.Minute()}
+			return 3
+		}
+		return 0
+	}
+
+	if weekday, ok := p.weekday(i, false); ok {
+		p.setDate(nextWeekday(today, weekday))
+		return 1
+	}
+
+	if isoDateRegex.MatchString(word) {
+		parsed, err := time.ParseInLocation("2006-01-02", word, p.now.Location())
+		if err == nil {
+			p.setDate(parsed)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// weekday reads a day name at token i. Full names count anywhere; abbreviations only
+// after "next", or when nothing but a time, priority or tags follows them, so
+// "Dentist on sat 3pm" has a date and "Put on sun cream" does not.
+func (p *parser) weekday(i int, afterNext bool) (time.Weekday, bool) {
+	word := strings.ToLower(p.tokens[i])
+	if weekday, ok := weekdays[word]; ok {
+		return weekday, true
+	}
+
+	weekday, ok := weekdayAbbreviations[word]
+	if !ok || !(afterNext || p.onlyTrailing(i+1)) {
+		return 0, false
+	}
+	return weekday, true
+}
+
+// onlyTrailing reports whether every token from i on is a time, priority or tag
+func (p *parser) onlyTrailing(i int) bool {
+	for _, token := range p.tokens[i:] {
+		lower := strings.ToLower(token)
+		if _, ok := priorities[lower]; ok {
+			continue
+		}
+		if _, ok := parseClock(lower); ok {
+			continue
+		}
+		if lower == "at" || lower == "@" || tagRegex.MatchString(token) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func (p *parser) setDate(date time.Time) {
+	p.date = &date
+}
+
+func (p *parser) peekClock(i int) bool {
+	if i >= len(p.tokens) {
+		return false
+	}
+	_, ok := parseClock(strings.ToLower(p.tokens[i]))
+	return ok
+}
+
+func (p *parser) parseClock(i int) {
+	c, _ := parseClock(strings.ToLower(p.tokens[i]))
+	p.clock = &c
+}
+
+// dueDate combines the parsed date and clock; a bare clock means its next occurrence
+func (p *parser) dueDate() *time.Time {
+	if p.date == nil && p.clock == nil {
+		return nil
+	}
+
+	c := clock{hour: DefaultDueHour}
+	if p.clock != nil {
+		c = *p.clock
+	} else if p.impliedClock != nil {
+		c = *p.impliedClock
+	}
+
+	var date time.Time
+	if p.date != nil {
+		date = *p.date
+	} else {
+		date = startOfDay(p.now)
+	}
+
+	due := time.Date(date.Year(), date.Month(), date.Day(), c.hour, c.minute, 0, 0, date.Location())
+	if p.date == nil && !due.After(p.now) {
+		due = due.AddDate(0, 0, 1)
+	}
+
+	return &due
+}
+
+func parseClock(word string) (clock, bool) {
+	switch word {
+	case "noon", "midday":
+		return clock{hour: 12}, true
+	case "midnight":
+		return clock{hour: 0}, true
+	}
+
+	if m := clockRegex.FindStringSubmatch(word); m != nil {
+		hour, _ := strconv.Atoi(m[1])
+		minute := 0
+		if m[2] != "" {
+			minute, _ = strconv.Atoi(m[2])
+		}
+		if hour < 1 || hour > 12 || minute > 59 {
+			return clock{}, false
+		}
+		hour %= 12
+		if m[3] == "pm" {
+			hour += 12
+		}
+		return clock{hour: hour, minute: minute}, true
+	}
+
+	if m := clock24Regex.FindStringSubmatch(word); m != nil {
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		return clock{hour: hour, minute: minute}, true
+	}
+
+	return clock{}, false
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// startOfWeek returns the Monday on or before day
+func startOfWeek(day time.Time) time.Time {
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// nextWeekday returns the first day strictly after today that falls on weekday
+func nextWeekday(today time.Time, weekday time.Weekday) time.Time {
+	days := (int(weekday) - int(today.Weekday()) + 7) % 7
+	if days == 0 {
+		days = 7
+	}
+	return today.AddDate(0, 0, days)
+}
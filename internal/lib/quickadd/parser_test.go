@@ -0,0 +1,106 @@
+package quickadd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goku-m/starter/internal/model/todo"
+)
+
+func TestParse(t *testing.T) {
+	// A Wednesday morning
+	now := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+	at := func(month time.Month, day, hour, minute int) *time.Time {
+		due := time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+		return &due
+	}
+	priority := func(p todo.Priority) *todo.Priority { return &p }
+
+	tests := []struct {
+		text     string
+		title    string
+		due      *time.Time
+		priority *todo.Priority
+		tags     []string
+	}{
+		{"Buy milk", "Buy milk", nil, nil, nil},
+		{"Pay rent tomorrow 9am !high #home", "Pay rent", at(5, 16, 9, 0), priority(todo.PriorityHigh), []string{"home"}},
+		{"Report today", "Report", at(5, 15, DefaultDueHour, 0), nil, nil},
+		{"Party tonight", "Party", at(5, 15, 20, 0), nil, nil},
+		{"Party tonight 11pm", "Party", at(5, 15, 23, 0), nil, nil},
+		{"Party at 11pm tonight", "Party", at(5, 15, 23, 0), nil, nil},
+		{"Tax return 2024-06-01", "Tax return", at(6, 1, DefaultDueHour, 0), nil, nil},
+		{"Tax return by 2024-06-01", "Tax return", at(6, 1, DefaultDueHour, 0), nil, nil},
+		{"Gym in 3 days", "Gym", at(5, 18, DefaultDueHour, 0), nil, nil},
+		{"Review in 2 weeks", "Review", at(5, 29, DefaultDueHour, 0), nil, nil},
+		{"Call back in 2 hours", "Call back", at(5, 15, 12, 0), nil, nil},
+		{"Plan next week", "Plan", at(5, 20, DefaultDueHour, 0), nil, nil},
+		{"Budget next month", "Budget", at(6, 1, DefaultDueHour, 0), nil, nil},
+
+		// Times without a date are their next occurrence
+		{"Lunch at noon", "Lunch", at(5, 15, 12, 0), nil, nil},
+		{"Meet 14:30", "Meet", at(5, 15, 14, 30), nil, nil},
+		{"Coffee 8am", "Coffee", at(5, 16, 8, 0), nil, nil},
+		{"Call tomorrow @ 5:15pm", "Call", at(5, 16, 17, 15), nil, nil},
+
+		// Full day names count anywhere, and never mean today
+		{"Report friday summary", "Report summary", at(5, 17, DefaultDueHour, 0), nil, nil},
+		{"Standup Wednesday", "Standup", at(5, 22, DefaultDueHour, 0), nil, nil},
+		{"Review next wednesday", "Review", at(5, 22, DefaultDueHour, 0), nil, nil},
+
+		// Abbreviations only after "next" or with nothing but a time, priority or tags after them
+		{"Put on sun cream", "Put on sun cream", nil, nil, nil},
+		{"sat down with the team", "sat down with the team", nil, nil, nil},
+		{"wed plans", "wed plans", nil, nil, nil},
+		{"Dentist on sat", "Dentist", at(5, 18, DefaultDueHour, 0), nil, nil},
+		{"Dentist on sat 3pm", "Dentist", at(5, 18, 15, 0), nil, nil},
+		{"Call mom fri at 5pm !m #family", "Call mom", at(5, 17, 17, 0), priority(todo.PriorityMedium), []string{"family"}},
+		{"Review next wed", "Review", at(5, 22, DefaultDueHour, 0), nil, nil},
+		{"Brunch next Sun with Ana", "Brunch with Ana", at(5, 26, DefaultDueHour, 0), nil, nil},
+
+		// Prepositions stay in the title unless a date or time follows
+		{"Go on holiday", "Go on holiday", nil, nil, nil},
+		{"Look at this", "Look at this", nil, nil, nil},
+		{"Due diligence", "Due diligence", nil, nil, nil},
+
+		// Only the first date and time are used
+		{"Move today tomorrow", "Move tomorrow", at(5, 15, DefaultDueHour, 0), nil, nil},
+
+		{"Taxes !!! #Home #home #work", "Taxes", nil, priority(todo.PriorityHigh), []string{"home", "work"}},
+		{"Backlog !low", "Backlog", nil, priority(todo.PriorityLow), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			payload, err := Parse(tt.text, now)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.title, payload.Title)
+			assert.Equal(t, tt.due, payload.DueDate)
+			assert.Equal(t, tt.priority, payload.Priority)
+			assert.Equal(t, tt.tags, payload.Tags)
+		})
+	}
+}
+
+func TestParseEmptyTitle(t *testing.T) {
+	now := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+
+	for _, text := range []string{"", "   ", "tomorrow 9am", "!high #home"} {
+		_, err := Parse(text, now)
+		assert.ErrorIs(t, err, ErrEmptyTitle, "text=%q", text)
+	}
+}
+
+func TestParseUsesLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+10", 10*60*60)
+	now := time.Date(2024, 5, 15, 23, 30, 0, 0, loc)
+
+	payload, err := Parse("Ship tomorrow", now)
+	require.NoError(t, err)
+	require.NotNil(t, payload.DueDate)
+	assert.Equal(t, time.Date(2024, 5, 16, DefaultDueHour, 0, 0, 0, loc), *payload.DueDate)
+}
@@ -0,0 +1,67 @@
+package session
+
+import "strings"
+
+// Active is a session as shown to its owner
+type Active struct {
+	Session
+	// Device is a readable summary of the user agent, like "Firefox on Windows"
+	Device string `json:"device"`
+	// Current marks the session the request was made with
+	Current bool `json:"current"`
+}
+
+var browsers = []struct{ token, name string }{
+	// Order matters: Edge and Opera also claim to be Chrome, and Chrome to be Safari
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Firefox/", "Firefox"},
+	{"Chrome/", "Chrome"},
+	{"CriOS/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+}
+
+var platforms = []struct{ token, name string }{
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"Android", "Android"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+// Describe turns a user agent into something a person recognizes; it only needs to
+// tell a user's own devices apart, not identify every browser
+func Describe(userAgent *string) string {
+	if userAgent == nil || *userAgent == "" {
+		return "Unknown device"
+	}
+	ua := *userAgent
+
+	browser, platform := "", ""
+	for _, b := range browsers {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, p := range platforms {
+		if strings.Contains(ua, p.token) {
+			platform = p.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	default:
+		return "Unknown browser"
+	}
+}
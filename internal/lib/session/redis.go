@@ -0,0 +1,188 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps each session under its own key with a matching TTL, plus a set
+// per user so all of a user's sessions can be found without scanning
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) sessionKey(id string) string {
+	return s.prefix + "session:" + id
+}
+
+func (s *RedisStore) userKey(userID string) string {
+	return s.prefix + "user:" + userID
+}
+
+func (s *RedisStore) Create(ctx context.Context, sess *Session) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+
+	ttl := time.Until(sess.ExpiresAt)
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.sessionKey(sess.ID), data, ttl)
+		pipe.SAdd(ctx, s.userKey(sess.UserID), sess.ID)
+		pipe.ExpireGT(ctx, s.userKey(sess.UserID), ttl)
+		// A new set has no TTL yet, and ExpireGT leaves those alone
+		pipe.ExpireNX(ctx, s.userKey(sess.UserID), ttl)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) Get(ctx context.Context, id string) (*Session, error) {
+	data, err := s.client.Get(ctx, s.sessionKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sess Session
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func (s *RedisStore) List(ctx context.Context, userID string) ([]Session, error) {
+	ids, err := s.client.SMembers(ctx, s.userKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []Session{}, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.sessionKey(id)
+	}
+
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(values))
+	var expired []any
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			// The session key expired; its id lingers in the set until now
+			expired = append(expired, ids[i])
+			continue
+		}
+
+		var sess Session
+		if err := json.Unmarshal([]byte(data), &sess); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, sess)
+	}
+
+	if len(expired) > 0 {
+		_ = s.client.SRem(ctx, s.userKey(userID), expired...).Err()
+	}
+
+	slices.SortFunc(sessions, func(a, b Session) int {
+		return b.LastSeenAt.Compare(a.LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func (s *RedisStore) Touch(ctx context.Context, id string, lastSeenAt, expiresAt time.Time) error {
+	sess, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	sess.LastSeenAt = lastSeenAt
+	sess.ExpiresAt = expiresAt
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+
+	// XX only overwrites an existing key, so a session revoked since the Get above
+	// stays revoked
+	ttl := time.Until(expiresAt)
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetXX(ctx, s.sessionKey(id), data, ttl)
+		pipe.ExpireGT(ctx, s.userKey(sess.UserID), ttl)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) Delete(ctx context.Context, id string) error {
+	sess, err := s.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, s.sessionKey(id))
+		pipe.SRem(ctx, s.userKey(sess.UserID), id)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) DeleteForUser(ctx context.Context, userID string, except ...string) error {
+	ids, err := s.client.SMembers(ctx, s.userKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+
+	if len(except) == 0 {
+		keys := make([]string, 0, len(ids)+1)
+		for _, id := range ids {
+			keys = append(keys, s.sessionKey(id))
+		}
+		keys = append(keys, s.userKey(userID))
+
+		return s.client.Del(ctx, keys...).Err()
+	}
+
+	var keys []string
+	var members []any
+	for _, id := range ids {
+		if slices.Contains(except, id) {
+			continue
+		}
+		keys = append(keys, s.sessionKey(id))
+		members = append(members, id)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, keys...)
+		pipe.SRem(ctx, s.userKey(userID), members...)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,87 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrNotFound is returned for sessions that don't exist or have expired
+var ErrNotFound = errors.New("session: not found")
+
+const (
+	CookieName = "starter_session"
+	DefaultTTL = 14 * 24 * time.Hour
+)
+
+// Session is a signed-in browser. ID is the hash of the cookie value; the value
+// itself is only ever held by the browser.
+type Session struct {
+	ID        string    `json:"id" db:"id"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	UserID    string    `json:"userId" db:"user_id"`
+	// Role is the account's role when the session started
+	Role       string    `json:"role" db:"role"`
+	ExpiresAt  time.Time `json:"expiresAt" db:"expires_at"`
+	LastSeenAt time.Time `json:"lastSeenAt" db:"last_seen_at"`
+	IP         *string   `json:"ip" db:"ip"`
+	UserAgent  *string   `json:"userAgent" db:"user_agent"`
+}
+
+// Store persists sessions. Get and List must not return expired sessions, and a
+// deleted session must stay deleted, since deleting is how sessions are revoked.
+type Store interface {
+	Create(ctx context.Context, s *Session) error
+	Get(ctx context.Context, id string) (*Session, error)
+	// List returns a user's sessions, most recently active first
+	List(ctx context.Context, userID string) ([]Session, error)
+	// Touch records activity and pushes the expiry out; it never brings back a
+	// session deleted in the meantime
+	Touch(ctx context.Context, id string, lastSeenAt, expiresAt time.Time) error
+	Delete(ctx context.Context, id string) error
+	// DeleteForUser deletes all of a user's sessions apart from those in except
+	DeleteForUser(ctx context.Context, userID string, except ...string) error
+}
+
+// NewToken returns a random cookie value and the session id derived from it
+func NewToken() (token, id string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("failed to generate session token: %w", err)
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(raw)
+	return token, IDFromToken(token), nil
+}
+
+// IDFromToken maps a cookie value to the id it is stored under
+func IDFromToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Cookie carries token for ttl. Secure should only be off for local plain HTTP.
+func Cookie(token string, ttl time.Duration, secure bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     CookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// ClearCookie removes the session cookie from the browser
+func ClearCookie(secure bool) *http.Cookie {
+	c := Cookie("", 0, secure)
+	c.MaxAge = -1
+	return c
+}
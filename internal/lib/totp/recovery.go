@@ -0,0 +1,53 @@
+package totp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	// RecoveryCodeCount is how many codes a set holds
+	RecoveryCodeCount = 10
+
+	recoveryCodeBytes = 5
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewRecoveryCodes returns a set of one-time codes to show the user once, and the
+// hashes to store in their place
+func NewRecoveryCodes() (codes, hashes []string, err error) {
+	codes = make([]string, RecoveryCodeCount)
+	hashes = make([]string, RecoveryCodeCount)
+
+	for i := range codes {
+		raw := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+
+		encoded := strings.ToLower(recoveryEncoding.EncodeToString(raw))
+		codes[i] = encoded[:4] + "-" + encoded[4:]
+		hashes[i] = HashRecoveryCode(codes[i])
+	}
+
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode hashes a code as typed, ignoring case, spaces and dashes. The
+// codes are random enough that a plain SHA-256 can't be reversed by guessing.
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// LooksLikeRecoveryCode tells recovery codes apart from TOTP codes, which are shorter
+func LooksLikeRecoveryCode(input string) bool {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(input))
+	return len(normalized) == recoveryEncoding.EncodedLen(recoveryCodeBytes)
+}
@@ -0,0 +1,46 @@
+package totp
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes()
+	require.NoError(t, err)
+	require.Len(t, codes, RecoveryCodeCount)
+	require.Len(t, hashes, RecoveryCodeCount)
+
+	format := regexp.MustCompile(`^[a-z2-7]{4}-[a-z2-7]{4}$`)
+	seen := map[string]bool{}
+	for i, code := range codes {
+		assert.Regexp(t, format, code)
+		assert.Equal(t, HashRecoveryCode(code), hashes[i])
+		assert.NotContains(t, hashes[i], code, "hashes must not contain the code")
+		assert.False(t, seen[code], "codes must be unique")
+		seen[code] = true
+	}
+}
+
+func TestHashRecoveryCodeNormalizes(t *testing.T) {
+	want := HashRecoveryCode("abcd-efgh")
+
+	for _, typed := range []string{"ABCD-EFGH", "abcdefgh", " abcd efgh ", "abcd - efgh"} {
+		assert.Equal(t, want, HashRecoveryCode(typed), typed)
+	}
+	assert.NotEqual(t, want, HashRecoveryCode("abcd-efgi"))
+}
+
+func TestLooksLikeRecoveryCode(t *testing.T) {
+	codes, _, err := NewRecoveryCodes()
+	require.NoError(t, err)
+
+	assert.True(t, LooksLikeRecoveryCode(codes[0]))
+	assert.True(t, LooksLikeRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))))
+	assert.False(t, LooksLikeRecoveryCode("123456"))
+	assert.False(t, LooksLikeRecoveryCode("123 456"))
+}
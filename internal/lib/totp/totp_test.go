@@ -0,0 +1,129 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The RFC 6238 appendix B SHA-1 secret, "12345678901234567890", in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238Vectors(t *testing.T) {
+	// The RFC lists 8 digit codes; 6 digit codes are their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			code, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, code)
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	codeAt := func(offset time.Duration) string {
+		code, err := Code(rfcSecret, now.Add(offset))
+		require.NoError(t, err)
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", codeAt(0), current, true},
+		{"previous step within skew", codeAt(-Period), current - 1, true},
+		{"next step within skew", codeAt(Period), current + 1, true},
+		{"two steps old", codeAt(-2 * Period), 0, false},
+		{"two steps ahead", codeAt(2 * Period), 0, false},
+		{"spaces are ignored", codeAt(0)[:3] + " " + codeAt(0)[3:], current, true},
+		{"wrong code", "000000", 0, false},
+		{"too short", "12345", 0, false},
+		{"not digits", "abcdef", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Verify(rfcSecret, tt.input, now)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantStep, step)
+		})
+	}
+}
+
+func TestVerifyReportsStepForReplayChecks(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, err := Code(rfcSecret, now)
+	require.NoError(t, err)
+
+	first, ok := Verify(rfcSecret, code, now)
+	require.True(t, ok)
+
+	// The same code moments later matches the same step, which callers reject as
+	// not after the last step they accepted
+	again, ok := Verify(rfcSecret, code, now.Add(10*time.Second))
+	require.True(t, ok)
+	assert.Equal(t, first, again)
+
+	// The next code is a later step, so it is accepted after the first
+	next, err := Code(rfcSecret, now.Add(Period))
+	require.NoError(t, err)
+	step, ok := Verify(rfcSecret, next, now.Add(Period))
+	require.True(t, ok)
+	assert.Greater(t, step, first)
+}
+
+func TestVerifyRejectsInvalidSecret(t *testing.T) {
+	_, ok := Verify("not base32!", "123456", time.Now())
+	assert.False(t, ok)
+
+	_, err := Code("not base32!", time.Now())
+	assert.Error(t, err)
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	require.NoError(t, err)
+	b, err := GenerateSecret()
+	require.NoError(t, err)
+
+	assert.NotEqual(t, a, b)
+	assert.Len(t, a, 32)
+
+	_, err = Code(a, time.Now())
+	assert.NoError(t, err)
+}
+
+func TestURI(t *testing.T) {
+	uri := URI(rfcSecret, "GO-BP", "someone@example.com")
+	require.True(t, strings.HasPrefix(uri, "otpauth://totp/GO-BP:someone@example.com?"))
+
+	u, err := url.Parse(uri)
+	require.NoError(t, err)
+	query := u.Query()
+	assert.Equal(t, rfcSecret, query.Get("secret"))
+	assert.Equal(t, "GO-BP", query.Get("issuer"))
+	assert.Equal(t, "6", query.Get("digits"))
+	assert.Equal(t, "30", query.Get("period"))
+}
@@ -0,0 +1,85 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+
+	// DefaultTolerance is how old a signed timestamp may be before receivers should reject it
+	DefaultTolerance = 5 * time.Minute
+)
+
+var (
+	ErrInvalidSignatureHeader = errors.New("invalid webhook signature header")
+	ErrSignatureMismatch      = errors.New("webhook signature mismatch")
+	ErrTimestampOutOfRange    = errors.New("webhook timestamp outside tolerance")
+)
+
+// Sign returns the signature header value for body, in the form "t=<unix>,v1=<hex>".
+// The HMAC-SHA256 covers "<unix>.<body>" so a captured payload cannot be replayed with a new timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, compute(secret, ts, body))
+}
+
+// Verify checks a signature header produced by Sign, as a receiver would
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrInvalidSignatureHeader
+		}
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			sig = value
+		}
+	}
+	if ts == "" || sig == "" {
+		return ErrInvalidSignatureHeader
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidSignatureHeader
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrTimestampOutOfRange
+	}
+
+	expected, err := hex.DecodeString(compute(secret, ts, body))
+	if err != nil {
+		return err
+	}
+	given, err := hex.DecodeString(sig)
+	if err != nil {
+		return ErrInvalidSignatureHeader
+	}
+	if !hmac.Equal(expected, given) {
+		return ErrSignatureMismatch
+	}
+
+	return nil
+}
+
+func compute(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
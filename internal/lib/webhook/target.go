@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"syscall"
+)
+
+// ErrPrivateTarget is returned for endpoints that resolve to addresses inside the
+// network the app runs in: loopback, private, link-local, unique-local and unspecified
+// addresses. Posting to them would let users probe internal services and read their
+// responses from the delivery log.
+var ErrPrivateTarget = errors.New("webhook URL must resolve to a public address")
+
+// Ranges the netip predicates don't cover that still reach the app's own network
+var nonPublicPrefixes = []netip.Prefix{
+	// "This network", which some stacks route to the local host
+	netip.MustParsePrefix("0.0.0.0/8"),
+	// Carrier-grade NAT, used inside cloud and overlay networks
+	netip.MustParsePrefix("100.64.0.0/10"),
+	// Benchmarking, assigned inside some networks
+	netip.MustParsePrefix("198.18.0.0/15"),
+	// NAT64, which maps any IPv4 address, private ones included, into IPv6
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// PublicAddr reports whether deliveries may be sent to addr
+func PublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsUnspecified()
+}
+
+// CheckURL resolves the endpoint's host and rejects it unless every address is public
+func CheckURL(ctx context.Context, resolver *net.Resolver, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	if u.Hostname() == "" {
+		return errors.New("invalid webhook URL: missing host")
+	}
+
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil {
+		if !PublicAddr(addr) {
+			return ErrPrivateTarget
+		}
+		return nil
+	}
+
+	addrs, err := resolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("failed to resolve webhook host %s: %w", u.Hostname(), err)
+	}
+	for _, addr := range addrs {
+		if !PublicAddr(addr) {
+			return ErrPrivateTarget
+		}
+	}
+
+	return nil
+}
+
+// DialControl is a net.Dialer Control that refuses connections to non-public
+// addresses. CheckURL runs when an endpoint is saved, but DNS can answer differently
+// by the time a delivery is made, so the address actually dialed is checked again.
+func DialControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("unexpected dial address %s: %w", address, err)
+	}
+	if !PublicAddr(addrPort.Addr()) {
+		return ErrPrivateTarget
+	}
+	return nil
+}
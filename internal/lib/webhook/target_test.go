@@ -0,0 +1,97 @@
+package webhook
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"224.0.0.1", false},
+		{"0.1.2.3", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"100.128.0.1", true},
+		{"198.18.0.1", false},
+		{"198.19.255.254", false},
+		{"198.20.0.1", true},
+		{"64:ff9b::a00:1", false},
+		{"64:ff9b::5db8:d822", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			assert.Equal(t, tt.public, PublicAddr(netip.MustParseAddr(tt.addr)))
+		})
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://93.184.216.34/hook", true},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://127.0.0.1:8080/", false},
+		{"http://[::1]/", false},
+		{"http://localhost:6379/", false},
+		{"http://10.0.0.5/hook", false},
+		{"http://100.100.100.200/latest/meta-data/", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := CheckURL(ctx, net.DefaultResolver, tt.url)
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrPrivateTarget)
+			}
+		})
+	}
+}
+
+func TestCheckURLInvalid(t *testing.T) {
+	ctx := context.Background()
+
+	for _, rawURL := range []string{"", "/hook", "https:///hook", "http://%zz/"} {
+		t.Run(rawURL, func(t *testing.T) {
+			err := CheckURL(ctx, net.DefaultResolver, rawURL)
+			require.Error(t, err)
+			assert.NotErrorIs(t, err, ErrPrivateTarget)
+			assert.NotContains(t, err.Error(), "%!w")
+		})
+	}
+}
+
+func TestDialControl(t *testing.T) {
+	require.NoError(t, DialControl("tcp", "93.184.216.34:443", nil))
+	assert.ErrorIs(t, DialControl("tcp", "127.0.0.1:80", nil), ErrPrivateTarget)
+	assert.ErrorIs(t, DialControl("tcp6", "[fd12::1]:443", nil), ErrPrivateTarget)
+	assert.ErrorIs(t, DialControl("tcp", "169.254.169.254:80", nil), ErrPrivateTarget)
+}
@@ -1,76 +1,296 @@
 package middleware
 
 import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/goku-m/starter/internal/authz"
+	"github.com/goku-m/starter/internal/database"
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/lib/apitoken"
+	"github.com/goku-m/starter/internal/lib/jwtauth"
+	"github.com/goku-m/starter/internal/lib/session"
+	"github.com/goku-m/starter/internal/repository"
 	"github.com/goku-m/starter/internal/server"
+	"github.com/jackc/pgx/v5"
 	"github.com/labstack/echo/v4"
 )
 
+const (
+	defaultJWTCookie = "__session"
+	jwtLeeway        = 30 * time.Second
+	// Sessions are only written back this often, not on every request
+	sessionTouchInterval = 10 * time.Minute
+	// API token last use is recorded at this granularity
+	apiTokenTouchInterval = time.Minute
+)
+
 type AuthMiddleware struct {
-	server *server.Server
+	server     *server.Server
+	verifier   *jwtauth.Verifier
+	jwtCookie  string
+	sessions   session.Store
+	sessionTTL time.Duration
+	apiTokens  *repository.APITokenRepository
 }
 
 func NewAuthMiddleware(s *server.Server) *AuthMiddleware {
-	return &AuthMiddleware{
-		server: s,
+	cfg := s.Config.Auth
+
+	auth := &AuthMiddleware{
+		server:     s,
+		jwtCookie:  cfg.JWTCookie,
+		sessions:   repository.NewSessionStore(s),
+		sessionTTL: SessionTTL(s),
+		apiTokens:  repository.NewAPITokenRepository(s),
+	}
+	if auth.jwtCookie == "" {
+		auth.jwtCookie = defaultJWTCookie
 	}
+
+	if cfg.JWKSURL != "" {
+		keys := jwtauth.NewKeySet(cfg.JWKSURL, time.Duration(cfg.JWKSRefreshInterval)*time.Second, nil, s.Logger)
+		auth.verifier = jwtauth.NewVerifier(keys, jwtauth.Options{
+			Issuer:           cfg.JWTIssuer,
+			Audience:         cfg.JWTAudience,
+			RoleClaim:        cfg.JWTRoleClaim,
+			PermissionsClaim: cfg.JWTPermissionsClaim,
+			Leeway:           jwtLeeway,
+		})
+	}
+
+	return auth
 }
 
-func (auth *AuthMiddleware) RequireAuthIP(next echo.HandlerFunc) echo.HandlerFunc {
-	return (func(c echo.Context) error {
+// SessionTTL is how long a session lasts without activity
+func SessionTTL(s *server.Server) time.Duration {
+	if s.Config.Auth.SessionTTL > 0 {
+		return time.Duration(s.Config.Auth.SessionTTL) * time.Second
+	}
+	return session.DefaultTTL
+}
+
+// SecureCookies is false only for local development over plain HTTP
+func SecureCookies(s *server.Server) bool {
+	return s.Config.Primary.Env != "local"
+}
 
-		c.Set("user_id", c.RealIP())
+// Authenticate identifies the caller when the request carries credentials and lets
+// it through either way. Pages that look different when signed in, such as the
+// login page, use it instead of RequireAuth.
+func (auth *AuthMiddleware) Authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return (func(c echo.Context) error {
+		if err := auth.identify(c, false); err != nil && !isUnauthorized(err) {
+			return err
+		}
+		return next(c)
+	})
+}
 
+// RequireAuth accepts, in order, a bearer JWT, a built-in account session cookie or
+// a JWT cookie, and puts the caller's id, role and permissions on the context.
+// Browsers asking for a page without credentials are sent to the login page.
+// API tokens are refused; routes open to them use RequireScope instead.
+func (auth *AuthMiddleware) RequireAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return (func(c echo.Context) error {
+		if err := auth.require(c, false); err != nil {
+			return err
+		}
 		return next(c)
 	})
 }
 
-// func (auth *AuthMiddleware) RequireAuth(next echo.HandlerFunc) echo.HandlerFunc {
-// 	return echo.WrapMiddleware(
-// 		clerkhttp.WithHeaderAuthorization(
-// 			clerkhttp.AuthorizationFailureHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-// 				start := time.Now()
-
-// 				w.Header().Set("Content-Type", "application/json")
-// 				w.WriteHeader(http.StatusUnauthorized)
-
-// 				response := map[string]string{
-// 					"code":     "UNAUTHORIZED",
-// 					"message":  "Unauthorized",
-// 					"override": "false",
-// 					"status":   "401",
-// 				}
-
-// 				if err := json.NewEncoder(w).Encode(response); err != nil {
-// 					auth.server.Logger.Error().Err(err).Str("function", "RequireAuth").Dur(
-// 						"duration", time.Since(start)).Msg("failed to write JSON response")
-// 				} else {
-// 					auth.server.Logger.Error().Str("function", "RequireAuth").Dur("duration", time.Since(start)).Msg(
-// 						"could not get session claims from context")
-// 				}
-// 			}))))(func(c echo.Context) error {
-// 		start := time.Now()
-// 		claims, ok := clerk.SessionClaimsFromContext(c.Request().Context())
-
-// 		if !ok {
-// 			auth.server.Logger.Error().
-// 				Str("function", "RequireAuth").
-// 				Str("request_id", GetRequestID(c)).
-// 				Dur("duration", time.Since(start)).
-// 				Msg("could not get session claims from context")
-// 			return errs.NewUnauthorizedError("Unauthorized", false)
-// 		}
-
-// 		c.Set("user_id", claims.Subject)
-// 		c.Set("user_role", claims.ActiveOrganizationRole)
-// 		c.Set("permissions", claims.Claims.ActiveOrganizationPermissions)
-
-// 		auth.server.Logger.Info().
-// 			Str("function", "RequireAuth").
-// 			Str("user_id", claims.Subject).
-// 			Str("request_id", GetRequestID(c)).
-// 			Dur("duration", time.Since(start)).
-// 			Msg("user authenticated successfully")
-
-// 		return next(c)
-// 	})
-// }
+// RequireScope is RequireAuth that also accepts API tokens, as long as the token was
+// granted scope. Sessions and JWTs act for the user directly and aren't scoped.
+func (auth *AuthMiddleware) RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if err := auth.require(c, true); err != nil {
+				return err
+			}
+
+			if scopes, ok := GetAPITokenScopes(c); ok && !slices.Contains(scopes, scope) {
+				return errs.NewForbiddenError("API token is missing the "+scope+" scope", true)
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequirePermission rejects callers whose role, token claims or token scopes don't
+// grant permission. It goes after RequireAuth or RequireScope.
+func (auth *AuthMiddleware) RequirePermission(permission string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !slices.Contains(GetPermissions(c), permission) {
+				return authz.Forbidden(permission)
+			}
+			return next(c)
+		}
+	}
+}
+
+func (auth *AuthMiddleware) require(c echo.Context, allowTokens bool) error {
+	if err := auth.identify(c, allowTokens); err != nil {
+		if isUnauthorized(err) && wantsPage(c) {
+			return c.Redirect(http.StatusSeeOther, "/login?next="+url.QueryEscape(c.Request().URL.RequestURI()))
+		}
+		return err
+	}
+	return nil
+}
+
+func (auth *AuthMiddleware) identify(c echo.Context, allowTokens bool) error {
+	start := time.Now()
+
+	if header := c.Request().Header.Get(echo.HeaderAuthorization); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return errs.NewUnauthorizedError("Unauthorized", false)
+		}
+
+		token = strings.TrimSpace(token)
+		if apitoken.Is(token) {
+			if !allowTokens {
+				return errs.NewForbiddenError("API tokens can't be used for this endpoint", true)
+			}
+			return auth.loadAPIToken(c, token, start)
+		}
+		return auth.verifyJWT(c, token, start)
+	}
+
+	if cookie, err := c.Cookie(session.CookieName); err == nil && cookie.Value != "" {
+		return auth.loadSession(c, cookie.Value, start)
+	}
+
+	if cookie, err := c.Cookie(auth.jwtCookie); err == nil && cookie.Value != "" {
+		return auth.verifyJWT(c, cookie.Value, start)
+	}
+
+	return errs.NewUnauthorizedError("Unauthorized", false)
+}
+
+func (auth *AuthMiddleware) loadSession(c echo.Context, token string, start time.Time) error {
+	ctx := c.Request().Context()
+	id := session.IDFromToken(token)
+
+	// Revoking a session deletes it, so this lookup is also the revocation check:
+	// sessions signed out from the sessions page or by a password change end here
+	sess, err := auth.sessions.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, session.ErrNotFound) {
+			c.SetCookie(session.ClearCookie(SecureCookies(auth.server)))
+			return errs.NewUnauthorizedError("Unauthorized", false)
+		}
+		auth.server.Logger.Error().Err(err).
+			Str("function", "RequireAuth").
+			Str("request_id", GetRequestID(c)).
+			Msg("failed to load session")
+		return errs.NewInternalServerError()
+	}
+
+	// Sliding expiry: active sessions keep being extended
+	if now := time.Now(); now.Sub(sess.LastSeenAt) > sessionTouchInterval {
+		if err := auth.sessions.Touch(ctx, sess.ID, now, now.Add(auth.sessionTTL)); err != nil {
+			auth.server.Logger.Warn().Err(err).Str("request_id", GetRequestID(c)).Msg("failed to touch session")
+		} else {
+			c.SetCookie(session.Cookie(token, auth.sessionTTL, SecureCookies(auth.server)))
+		}
+	}
+
+	auth.authenticated(c, sess.UserID, sess.Role, authz.Permissions(sess.Role), start)
+	c.Set(SessionIDKey, sess.ID)
+	return nil
+}
+
+func (auth *AuthMiddleware) loadAPIToken(c echo.Context, token string, start time.Time) error {
+	ctx := c.Request().Context()
+
+	item, err := auth.apiTokens.GetAPITokenByHash(ctx, apitoken.Hash(token))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errs.NewUnauthorizedError("Unauthorized", false)
+		}
+		auth.server.Logger.Error().Err(err).
+			Str("function", "RequireAuth").
+			Str("request_id", GetRequestID(c)).
+			Msg("failed to load api token")
+		return errs.NewInternalServerError()
+	}
+
+	now := time.Now()
+	if item.Expired(now) {
+		auth.server.Logger.Warn().
+			Str("function", "RequireAuth").
+			Str("api_token_id", item.ID.String()).
+			Str("request_id", GetRequestID(c)).
+			Msg("rejected expired api token")
+		return errs.NewUnauthorizedError("Unauthorized", false)
+	}
+
+	if err := auth.apiTokens.TouchAPIToken(ctx, item.ID, now, apiTokenTouchInterval); err != nil {
+		auth.server.Logger.Warn().Err(err).Str("request_id", GetRequestID(c)).Msg("failed to touch api token")
+	}
+
+	auth.authenticated(c, item.UserID, item.Role(), item.Permissions(), start)
+	c.Set(APITokenScopesKey, item.Scopes)
+	return nil
+}
+
+func (auth *AuthMiddleware) verifyJWT(c echo.Context, token string, start time.Time) error {
+	if auth.verifier == nil || token == "" {
+		return errs.NewUnauthorizedError("Unauthorized", false)
+	}
+
+	claims, err := auth.verifier.Verify(c.Request().Context(), token)
+	if err != nil {
+		if !errors.Is(err, jwtauth.ErrInvalidToken) {
+			auth.server.Logger.Error().Err(err).
+				Str("function", "RequireAuth").
+				Str("request_id", GetRequestID(c)).
+				Msg("failed to load signing keys")
+			return errs.NewInternalServerError()
+		}
+
+		auth.server.Logger.Warn().Err(err).
+			Str("function", "RequireAuth").
+			Str("request_id", GetRequestID(c)).
+			Dur("duration", time.Since(start)).
+			Msg("rejected token")
+		return errs.NewUnauthorizedError("Unauthorized", false)
+	}
+
+	auth.authenticated(c, claims.Subject, claims.Role, authz.Permissions(claims.Role, claims.Permissions...), start)
+	return nil
+}
+
+func (auth *AuthMiddleware) authenticated(c echo.Context, userID, role string, permissions []string, start time.Time) {
+	c.Set(UserIDKey, userID)
+	c.Set(UserRoleKey, role)
+	c.Set(PermissionsKey, permissions)
+
+	ctx := database.ContextWithReader(c.Request().Context(), userID)
+	ctx = authz.WithPrincipal(ctx, authz.Principal{UserID: userID, Role: role, Permissions: permissions})
+	c.SetRequest(c.Request().WithContext(ctx))
+
+	auth.server.Logger.Debug().
+		Str("function", "RequireAuth").
+		Str("user_id", userID).
+		Str("request_id", GetRequestID(c)).
+		Dur("duration", time.Since(start)).
+		Msg("user authenticated successfully")
+}
+
+func isUnauthorized(err error) bool {
+	var httpErr *errs.HTTPError
+	return errors.As(err, &httpErr) && httpErr.Status == http.StatusUnauthorized
+}
+
+func wantsPage(c echo.Context) bool {
+	req := c.Request()
+	return req.Method == http.MethodGet && strings.Contains(req.Header.Get(echo.HeaderAccept), echo.MIMETextHTML)
+}
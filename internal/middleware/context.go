@@ -11,9 +11,12 @@ import (
 )
 
 const (
-	UserIDKey   = "user_id"
-	UserRoleKey = "user_role"
-	LoggerKey   = "logger"
+	UserIDKey         = "user_id"
+	UserRoleKey       = "user_role"
+	PermissionsKey    = "permissions"
+	SessionIDKey      = "session_id"
+	APITokenScopesKey = "api_token_scopes"
+	LoggerKey         = "logger"
 )
 
 type ContextEnhancer struct {
@@ -65,7 +68,7 @@ func (ce *ContextEnhancer) EnhanceContext() echo.MiddlewareFunc {
 }
 
 func (ce *ContextEnhancer) extractUserID(c echo.Context) string {
-	// Check if user_id was already set by auth middleware (Clerk)
+	// Check if user_id was already set by auth middleware
 	if userID, ok := c.Get("user_id").(string); ok && userID != "" {
 		return userID
 	}
@@ -73,7 +76,7 @@ func (ce *ContextEnhancer) extractUserID(c echo.Context) string {
 }
 
 func (ce *ContextEnhancer) extractUserRole(c echo.Context) string {
-	// Check if user_role was set by auth middleware (Clerk)
+	// Check if user_role was set by auth middleware
 	if userRole, ok := c.Get("user_role").(string); ok && userRole != "" {
 		return userRole
 	}
@@ -87,6 +90,36 @@ func GetUserID(c echo.Context) string {
 	return ""
 }
 
+func GetUserRole(c echo.Context) string {
+	if userRole, ok := c.Get(UserRoleKey).(string); ok {
+		return userRole
+	}
+	return ""
+}
+
+func GetPermissions(c echo.Context) []string {
+	if permissions, ok := c.Get(PermissionsKey).([]string); ok {
+		return permissions
+	}
+	return nil
+}
+
+// GetSessionID returns the id of the built-in account session the request came with,
+// or "" for token authenticated requests
+func GetSessionID(c echo.Context) string {
+	if sessionID, ok := c.Get(SessionIDKey).(string); ok {
+		return sessionID
+	}
+	return ""
+}
+
+// GetAPITokenScopes returns the scopes of the API token the request came with; ok is
+// false for requests authenticated any other way
+func GetAPITokenScopes(c echo.Context) (scopes []string, ok bool) {
+	scopes, ok = c.Get(APITokenScopesKey).([]string)
+	return scopes, ok
+}
+
 func GetLogger(c echo.Context) *zerolog.Logger {
 	if logger, ok := c.Get(LoggerKey).(*zerolog.Logger); ok {
 		return logger
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/lib/session"
+	"github.com/goku-m/starter/internal/server"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	CSRFTokenKey = "csrf_token"
+	// CSRFFormField is the hidden input forms carry the token in
+	CSRFFormField = "_csrf"
+	// CSRFHeader is where scripts send the token instead
+	CSRFHeader = "X-CSRF-Token"
+
+	// Browsers without a session are bound to this random cookie instead, so the
+	// login and signup forms are protected too
+	csrfCookieName = "starter_csrf"
+	csrfCookieTTL  = 365 * 24 * time.Hour
+)
+
+type CSRFMiddleware struct {
+	server *server.Server
+}
+
+func NewCSRFMiddleware(s *server.Server) *CSRFMiddleware {
+	return &CSRFMiddleware{server: s}
+}
+
+// Protect rejects unsafe requests that don't echo back the token for the browser's
+// session. Tokens are derived from the session rather than stored, so every page of
+// a session shares one and signing in or out changes it. Requests carrying an
+// Authorization header are exempt: browsers never attach one on their own, so a
+// cross-site form can't forge a token-authenticated call.
+func (csrf *CSRFMiddleware) Protect(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+
+		if req.Header.Get(echo.HeaderAuthorization) != "" {
+			return next(c)
+		}
+
+		binding, err := csrf.binding(c)
+		if err != nil {
+			csrf.server.Logger.Error().Err(err).
+				Str("request_id", GetRequestID(c)).
+				Msg("failed to create csrf cookie")
+			return errs.NewInternalServerError()
+		}
+		expected := csrf.token(binding)
+		c.Set(CSRFTokenKey, expected)
+
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			return next(c)
+		}
+
+		sent := req.Header.Get(CSRFHeader)
+		if sent == "" {
+			sent = c.FormValue(CSRFFormField)
+		}
+
+		if sent == "" {
+			return csrfError("This request is missing its CSRF token. Reload the page and try again.")
+		}
+		if subtle.ConstantTimeCompare([]byte(sent), []byte(expected)) != 1 {
+			GetLogger(c).Warn().
+				Str("event", "csrf_token_mismatch").
+				Msg("CSRF token mismatch")
+			return csrfError("This form has expired or came from another site. Reload the page and try again.")
+		}
+
+		return next(c)
+	}
+}
+
+// GetCSRFToken is the token for forms rendered in this request
+func GetCSRFToken(c echo.Context) string {
+	if token, ok := c.Get(CSRFTokenKey).(string); ok {
+		return token
+	}
+	return ""
+}
+
+// binding is the value tokens are tied to: the session ID when signed in with a
+// session cookie, otherwise a random ID kept in a cookie of its own
+func (csrf *CSRFMiddleware) binding(c echo.Context) (string, error) {
+	if cookie, err := c.Cookie(session.CookieName); err == nil && cookie.Value != "" {
+		return "session:" + session.IDFromToken(cookie.Value), nil
+	}
+
+	if cookie, err := c.Cookie(csrfCookieName); err == nil && cookie.Value != "" {
+		return "anonymous:" + cookie.Value, nil
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	id := base64.RawURLEncoding.EncodeToString(raw)
+
+	c.SetCookie(&http.Cookie{
+		Name:     csrfCookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(csrfCookieTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   SecureCookies(csrf.server),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return "anonymous:" + id, nil
+}
+
+func (csrf *CSRFMiddleware) token(binding string) string {
+	mac := hmac.New(sha256.New, []byte(csrf.server.Config.Auth.SecretKey))
+	mac.Write([]byte("csrf:" + binding))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func csrfError(message string) *errs.HTTPError {
+	err := errs.NewForbiddenError(message, true)
+	err.Code = "CSRF_TOKEN_INVALID"
+	return err
+}
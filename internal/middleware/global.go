@@ -126,6 +126,7 @@ func (global *GlobalMiddlewares) GlobalErrorHandler(err error, c echo.Context) {
 	var message string
 	var fieldErrors []errs.FieldError
 	var action *errs.Action
+	var permission string
 
 	switch {
 	case errors.As(err, &httpErr):
@@ -134,6 +135,7 @@ func (global *GlobalMiddlewares) GlobalErrorHandler(err error, c echo.Context) {
 		message = httpErr.Message
 		fieldErrors = httpErr.Errors
 		action = httpErr.Action
+		permission = httpErr.Permission
 
 	case errors.As(err, &echoErr):
 		status = echoErr.Code
@@ -163,12 +165,13 @@ func (global *GlobalMiddlewares) GlobalErrorHandler(err error, c echo.Context) {
 
 	if !c.Response().Committed {
 		_ = c.JSON(status, errs.HTTPError{
-			Code:     code,
-			Message:  message,
-			Status:   status,
-			Override: httpErr != nil && httpErr.Override,
-			Errors:   fieldErrors,
-			Action:   action,
+			Code:       code,
+			Message:    message,
+			Status:     status,
+			Override:   httpErr != nil && httpErr.Override,
+			Errors:     fieldErrors,
+			Action:     action,
+			Permission: permission,
 		})
 	}
 }
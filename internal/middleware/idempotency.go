@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/model/idempotency"
+	"github.com/goku-m/starter/internal/repository"
+	"github.com/goku-m/starter/internal/server"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	idempotencyKeyMaxLength  = 255
+	idempotencyTTL           = 24 * time.Hour
+	idempotencyLockTimeout   = time.Minute
+	idempotencyMaxBodySize   = 1 << 20
+	idempotencySweepInterval = time.Hour
+	idempotencySweepTimeout  = 30 * time.Second
+	idempotencyRetryAfter    = "1"
+)
+
+// Response headers that describe the original exchange rather than the resource
+var idempotencySkippedHeaders = map[string]bool{
+	echo.HeaderContentLength: true,
+	echo.HeaderSetCookie:     true,
+	echo.HeaderXRequestID:    true,
+	"Date":                   true,
+}
+
+// idempotencyStore is the part of the repository the middleware uses
+type idempotencyStore interface {
+	Acquire(ctx context.Context, userID, key, fingerprint string, ttl, lockTimeout time.Duration) (*idempotency.Record, bool, error)
+	Complete(ctx context.Context, userID, key string, lockToken uuid.UUID, status int, headers http.Header, body []byte) error
+	Release(ctx context.Context, userID, key string, lockToken uuid.UUID) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type IdempotencyMiddleware struct {
+	server    *server.Server
+	repo      idempotencyStore
+	lastSweep atomic.Int64
+}
+
+func NewIdempotencyMiddleware(s *server.Server) *IdempotencyMiddleware {
+	return &IdempotencyMiddleware{
+		server: s,
+		repo:   repository.NewIdempotencyRepository(s),
+	}
+}
+
+// Handle makes POST, PATCH and DELETE requests carrying an Idempotency-Key safe to retry.
+// The first response is stored per user and key; retries get it replayed, and a retry
+// that arrives while the first request is still running gets a 409. It must run after
+// the auth middleware so the key is scoped to the user.
+func (m *IdempotencyMiddleware) Handle(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		switch req.Method {
+		case http.MethodPost, http.MethodPatch, http.MethodDelete:
+		default:
+			return next(c)
+		}
+
+		key := req.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			return next(c)
+		}
+		if len(key) > idempotencyKeyMaxLength {
+			code := "IDEMPOTENCY_KEY_INVALID"
+			return errs.NewBadRequestError("Idempotency-Key must be at most 255 characters", false, &code, nil, nil)
+		}
+
+		m.maybeSweep()
+
+		body, err := io.ReadAll(io.LimitReader(req.Body, idempotencyMaxBodySize+1))
+		if err != nil {
+			return err
+		}
+		if len(body) > idempotencyMaxBodySize {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "request body is too large")
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		userID := GetUserID(c)
+		fingerprint := requestFingerprint(req, body)
+
+		record, acquired, err := m.repo.Acquire(req.Context(), userID, key, fingerprint, idempotencyTTL, idempotencyLockTimeout)
+		if err != nil {
+			// The request holding the key failed and released it between our claim and
+			// our read; the client can retry and take it over
+			if errors.Is(err, pgx.ErrNoRows) {
+				return inProgress(c)
+			}
+			return err
+		}
+
+		if !acquired {
+			return m.replay(c, record, fingerprint)
+		}
+
+		return m.record(c, next, userID, key, *record.LockToken)
+	}
+}
+
+func (m *IdempotencyMiddleware) replay(c echo.Context, record *idempotency.Record, fingerprint string) error {
+	if record.Fingerprint != fingerprint {
+		code := "IDEMPOTENCY_KEY_REUSED"
+		return &errs.HTTPError{
+			Code:    code,
+			Message: "Idempotency-Key was already used for a different request",
+			Status:  http.StatusUnprocessableEntity,
+		}
+	}
+
+	if record.Status == idempotency.StatusInFlight {
+		return inProgress(c)
+	}
+
+	header := c.Response().Header()
+	for name, values := range record.ResponseHeaders {
+		for _, value := range values {
+			header.Add(name, value)
+		}
+	}
+	header.Set(IdempotentReplayedHeader, "true")
+
+	status := http.StatusOK
+	if record.ResponseStatus != nil {
+		status = *record.ResponseStatus
+	}
+
+	c.Response().WriteHeader(status)
+	_, err := c.Response().Write(record.ResponseBody)
+	return err
+}
+
+// inProgress is the retryable 409 for a key another request is holding
+func inProgress(c echo.Context) error {
+	code := "IDEMPOTENCY_REQUEST_IN_PROGRESS"
+	c.Response().Header().Set(echo.HeaderRetryAfter, idempotencyRetryAfter)
+	return errs.NewConflictError("a request with this Idempotency-Key is still being processed", false, &code)
+}
+
+func (m *IdempotencyMiddleware) record(c echo.Context, next echo.HandlerFunc, userID, key string, lockToken uuid.UUID) error {
+	res := c.Response()
+	recorder := &responseRecorder{ResponseWriter: res.Writer}
+	res.Writer = recorder
+
+	// Errors are rendered here rather than by the router so the response can be captured
+	if err := next(c); err != nil {
+		c.Error(err)
+	}
+	res.Writer = recorder.ResponseWriter
+
+	// Storing is best effort; the client already has its response
+	ctx := context.WithoutCancel(c.Request().Context())
+	logger := GetLogger(c)
+
+	// Server errors are not replayed so the client can retry them
+	if res.Status >= http.StatusInternalServerError {
+		if err := m.repo.Release(ctx, userID, key, lockToken); err != nil {
+			logger.Error().Err(err).Msg("failed to release idempotency key")
+		}
+		return nil
+	}
+
+	headers := make(http.Header)
+	for name, values := range res.Header() {
+		if !idempotencySkippedHeaders[name] {
+			headers[name] = values
+		}
+	}
+
+	if err := m.repo.Complete(ctx, userID, key, lockToken, res.Status, headers, recorder.body.Bytes()); err != nil {
+		logger.Error().Err(err).Msg("failed to store idempotent response")
+	}
+
+	return nil
+}
+
+func (m *IdempotencyMiddleware) maybeSweep() {
+	now := time.Now().Unix()
+	last := m.lastSweep.Load()
+	if now-last < int64(idempotencySweepInterval/time.Second) || !m.lastSweep.CompareAndSwap(last, now) {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), idempotencySweepTimeout)
+		defer cancel()
+
+		deleted, err := m.repo.DeleteExpired(ctx)
+		if err != nil {
+			m.server.Logger.Error().Err(err).Msg("failed to delete expired idempotency keys")
+			return
+		}
+		m.server.Logger.Debug().Int64("deleted", deleted).Msg("deleted expired idempotency keys")
+	}()
+}
+
+// requestFingerprint detects a key reused for a different request
+func requestFingerprint(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.RequestURI() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder copies everything written to the client
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
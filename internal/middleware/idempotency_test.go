@@ -0,0 +1,203 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/model/idempotency"
+	"github.com/goku-m/starter/internal/repository"
+	testutil "github.com/goku-m/starter/internal/testing"
+)
+
+const idempotencyTestUser = "user-1"
+
+// idempotencyTest serves POST /todos behind the middleware, answering with status
+type idempotencyTest struct {
+	e      *echo.Echo
+	m      *IdempotencyMiddleware
+	repo   *repository.IdempotencyRepository
+	calls  int
+	status int
+}
+
+func setupIdempotencyTest(t *testing.T) (*idempotencyTest, func()) {
+	t.Helper()
+
+	_, srv, cleanup := testutil.SetupTest(t)
+
+	it := &idempotencyTest{
+		e:      echo.New(),
+		m:      NewIdempotencyMiddleware(srv),
+		repo:   repository.NewIdempotencyRepository(srv),
+		status: http.StatusCreated,
+	}
+	// No sweeps racing the test's cleanup
+	it.m.lastSweep.Store(time.Now().Unix())
+
+	it.e.HTTPErrorHandler = func(err error, c echo.Context) {
+		var httpErr *errs.HTTPError
+		if errors.As(err, &httpErr) {
+			c.JSON(httpErr.Status, httpErr)
+			return
+		}
+		it.e.DefaultHTTPErrorHandler(err, c)
+	}
+	it.e.POST("/todos", func(c echo.Context) error {
+		it.calls++
+		return c.JSON(it.status, map[string]int{"call": it.calls})
+	}, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(UserIDKey, idempotencyTestUser)
+			return next(c)
+		}
+	}, it.m.Handle)
+
+	return it, cleanup
+}
+
+func (it *idempotencyTest) post(key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(IdempotencyKeyHeader, key)
+	rec := httptest.NewRecorder()
+	it.e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotencyReplaysStoredResponse(t *testing.T) {
+	it, cleanup := setupIdempotencyTest(t)
+	defer cleanup()
+
+	first := it.post("key-1", `{"title":"Buy milk"}`)
+	require.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get(IdempotentReplayedHeader))
+
+	second := it.post("key-1", `{"title":"Buy milk"}`)
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, "true", second.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, first.Header().Get(echo.HeaderContentType), second.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, 1, it.calls)
+
+	// Another key is another request
+	assert.Equal(t, http.StatusCreated, it.post("key-2", `{"title":"Buy milk"}`).Code)
+	assert.Equal(t, 2, it.calls)
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+	it, cleanup := setupIdempotencyTest(t)
+	defer cleanup()
+
+	// The first request is still running
+	body := `{"title":"Buy milk"}`
+	req := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(body))
+	_, acquired, err := it.repo.Acquire(context.Background(), idempotencyTestUser, "key-1", requestFingerprint(req, []byte(body)), idempotencyTTL, idempotencyLockTimeout)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	rec := it.post("key-1", body)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, idempotencyRetryAfter, rec.Header().Get(echo.HeaderRetryAfter))
+	assert.Contains(t, rec.Body.String(), "IDEMPOTENCY_REQUEST_IN_PROGRESS")
+	assert.Zero(t, it.calls)
+}
+
+func TestIdempotencyFingerprintMismatch(t *testing.T) {
+	it, cleanup := setupIdempotencyTest(t)
+	defer cleanup()
+
+	require.Equal(t, http.StatusCreated, it.post("key-1", `{"title":"Buy milk"}`).Code)
+
+	rec := it.post("key-1", `{"title":"Buy bread"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), "IDEMPOTENCY_KEY_REUSED")
+	assert.Equal(t, 1, it.calls)
+}
+
+func TestIdempotencyReleasesKeyAfterServerError(t *testing.T) {
+	it, cleanup := setupIdempotencyTest(t)
+	defer cleanup()
+
+	it.status = http.StatusInternalServerError
+	require.Equal(t, http.StatusInternalServerError, it.post("key-1", `{"title":"Buy milk"}`).Code)
+
+	// The retry runs the handler again, and its response is the one kept
+	it.status = http.StatusCreated
+	rec := it.post("key-1", `{"title":"Buy milk"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Empty(t, rec.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, 2, it.calls)
+
+	rec = it.post("key-1", `{"title":"Buy milk"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, 2, it.calls)
+}
+
+// releasedStore loses the race with a request releasing the key, as Acquire does when
+// the holder deletes it between the claim and the read
+type releasedStore struct {
+	idempotencyStore
+}
+
+func (releasedStore) Acquire(context.Context, string, string, string, time.Duration, time.Duration) (*idempotency.Record, bool, error) {
+	return nil, false, fmt.Errorf("failed to collect row from table:idempotency_keys: %w", pgx.ErrNoRows)
+}
+
+func TestIdempotencyKeyReleasedDuringAcquire(t *testing.T) {
+	it, cleanup := setupIdempotencyTest(t)
+	defer cleanup()
+
+	it.m.repo = releasedStore{it.m.repo}
+
+	rec := it.post("key-1", `{"title":"Buy milk"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, idempotencyRetryAfter, rec.Header().Get(echo.HeaderRetryAfter))
+	assert.Contains(t, rec.Body.String(), "IDEMPOTENCY_REQUEST_IN_PROGRESS")
+	assert.Zero(t, it.calls)
+}
+
+func TestIdempotencyLockTakenOver(t *testing.T) {
+	it, cleanup := setupIdempotencyTest(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// The first request's lock lapses and a retry takes the key over
+	stale, acquired, err := it.repo.Acquire(ctx, idempotencyTestUser, "key-1", "fingerprint", idempotencyTTL, -time.Second)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	current, acquired, err := it.repo.Acquire(ctx, idempotencyTestUser, "key-1", "fingerprint", idempotencyTTL, idempotencyLockTimeout)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	require.NotEqual(t, *stale.LockToken, *current.LockToken)
+
+	// The first request finishing late changes nothing
+	assert.Error(t, it.repo.Complete(ctx, idempotencyTestUser, "key-1", *stale.LockToken, http.StatusCreated, nil, []byte("stale")))
+	require.NoError(t, it.repo.Release(ctx, idempotencyTestUser, "key-1", *stale.LockToken))
+
+	record, acquired, err := it.repo.Acquire(ctx, idempotencyTestUser, "key-1", "fingerprint", idempotencyTTL, idempotencyLockTimeout)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+	assert.Equal(t, idempotency.StatusInFlight, record.Status)
+
+	require.NoError(t, it.repo.Complete(ctx, idempotencyTestUser, "key-1", *current.LockToken, http.StatusCreated, nil, []byte("current")))
+
+	record, _, err = it.repo.Acquire(ctx, idempotencyTestUser, "key-1", "fingerprint", idempotencyTTL, idempotencyLockTimeout)
+	require.NoError(t, err)
+	assert.Equal(t, idempotency.StatusCompleted, record.Status)
+	assert.Equal(t, []byte("current"), record.ResponseBody)
+	assert.Nil(t, record.LockToken)
+}
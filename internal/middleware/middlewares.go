@@ -9,6 +9,8 @@ type Middlewares struct {
 	Auth            *AuthMiddleware
 	ContextEnhancer *ContextEnhancer
 	RateLimit       *RateLimitMiddleware
+	Idempotency     *IdempotencyMiddleware
+	CSRF            *CSRFMiddleware
 }
 
 func NewMiddlewares(s *server.Server) *Middlewares {
@@ -18,5 +20,7 @@ func NewMiddlewares(s *server.Server) *Middlewares {
 		Auth:            NewAuthMiddleware(s),
 		ContextEnhancer: NewContextEnhancer(s),
 		RateLimit:       NewRateLimitMiddleware(s),
+		Idempotency:     NewIdempotencyMiddleware(s),
+		CSRF:            NewCSRFMiddleware(s),
 	}
 }
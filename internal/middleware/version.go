@@ -0,0 +1,175 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	APIVersionHeader = "API-Version"
+	APIVersionKey    = "api_version"
+)
+
+// APIVersion describes one version of the REST API mounted at <prefix>/<Name>
+type APIVersion struct {
+	Name string
+	// DeprecatedAt and SunsetAt are advertised to clients once set
+	DeprecatedAt *time.Time
+	SunsetAt     *time.Time
+	// Successor is the path clients should migrate to
+	Successor string
+}
+
+// Handle tags every response of the version with its name and, once deprecated,
+// the Deprecation, Sunset and Link headers
+func (v APIVersion) Handle(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Set(APIVersionKey, v.Name)
+		c.Response().Header().Set(APIVersionHeader, v.Name)
+
+		if v.DeprecatedAt != nil {
+			setDeprecationHeaders(c, *v.DeprecatedAt, v.SunsetAt, v.Successor)
+		}
+
+		return next(c)
+	}
+}
+
+// Deprecated marks routes that remain for existing clients but have a replacement
+func Deprecated(deprecatedAt time.Time, sunsetAt *time.Time, successor string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			setDeprecationHeaders(c, deprecatedAt, sunsetAt, successor)
+			return next(c)
+		}
+	}
+}
+
+func setDeprecationHeaders(c echo.Context, deprecatedAt time.Time, sunsetAt *time.Time, successor string) {
+	header := c.Response().Header()
+
+	// RFC 9745 and RFC 8594
+	header.Set("Deprecation", fmt.Sprintf("@%d", deprecatedAt.Unix()))
+	if sunsetAt != nil {
+		header.Set("Sunset", sunsetAt.UTC().Format(http.TimeFormat))
+	}
+	if successor != "" {
+		header.Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+	}
+}
+
+// NegotiateAPIVersion lets clients pick a version with the API-Version header instead
+// of the path: a request for <prefix>/todos with "API-Version: v1" (or "1") is routed
+// to <prefix>/v1/todos. Only paths the version registers are rewritten, so unversioned
+// endpoints such as <prefix>/graphql keep working for clients that always send the
+// header. A version in the path always wins, but a header that names a different
+// version is rejected rather than silently ignored. It must be registered with echo's
+// Pre so the rewrite happens before routing.
+func NegotiateAPIVersion(prefix string, versions ...APIVersion) echo.MiddlewareFunc {
+	supported := make(map[string]bool, len(versions))
+	names := make([]string, 0, len(versions))
+	for _, v := range versions {
+		supported[v.Name] = true
+		names = append(names, v.Name)
+	}
+
+	// Routes are read on the first request, once all of them are registered
+	var (
+		routesOnce sync.Once
+		routes     []string
+	)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+
+			rest, ok := strings.CutPrefix(req.URL.Path, prefix+"/")
+			if !ok {
+				return next(c)
+			}
+
+			requested := normalizeAPIVersion(req.Header.Get(APIVersionHeader))
+			pathVersion, _, _ := strings.Cut(rest, "/")
+			if !supported[pathVersion] {
+				pathVersion = ""
+			}
+
+			switch {
+			case requested == "":
+				return next(c)
+			case !supported[requested]:
+				code := "UNSUPPORTED_API_VERSION"
+				return errs.NewBadRequestError(
+					fmt.Sprintf("API version %q is not supported; supported versions: %s", requested, strings.Join(names, ", ")),
+					false, &code, nil, nil,
+				)
+			case pathVersion != "" && pathVersion != requested:
+				code := "API_VERSION_MISMATCH"
+				return errs.NewBadRequestError(
+					fmt.Sprintf("API-Version header %q does not match the %q path", requested, pathVersion),
+					false, &code, nil, nil,
+				)
+			case pathVersion == "":
+				routesOnce.Do(func() {
+					for _, route := range c.Echo().Routes() {
+						routes = append(routes, route.Path)
+					}
+				})
+
+				versioned := prefix + "/" + requested + "/" + rest
+				if !slices.ContainsFunc(routes, func(route string) bool { return routeMatches(route, versioned) }) {
+					return next(c)
+				}
+
+				req.URL.Path = versioned
+				if req.URL.RawPath != "" {
+					req.URL.RawPath = strings.Replace(req.URL.RawPath, prefix+"/", prefix+"/"+requested+"/", 1)
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// routeMatches reports whether path would be routed to an echo route pattern, in which
+// ":name" matches one segment and a trailing "*" the rest of the path
+func routeMatches(pattern, path string) bool {
+	patternParts := strings.Split(pattern, "/")
+	pathParts := strings.Split(path, "/")
+
+	for i, part := range patternParts {
+		if part == "*" && i == len(patternParts)-1 {
+			return true
+		}
+		if i >= len(pathParts) {
+			return false
+		}
+		if strings.HasPrefix(part, ":") {
+			if pathParts[i] == "" {
+				return false
+			}
+			continue
+		}
+		if part != pathParts[i] {
+			return false
+		}
+	}
+
+	return len(patternParts) == len(pathParts)
+}
+
+func normalizeAPIVersion(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" || strings.HasPrefix(value, "v") {
+		return value
+	}
+	return "v" + value
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/goku-m/starter/internal/errs"
+)
+
+func TestNegotiateAPIVersion(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = func(err error, c echo.Context) {
+		var httpErr *errs.HTTPError
+		if errors.As(err, &httpErr) {
+			c.NoContent(httpErr.Status)
+			return
+		}
+		e.DefaultHTTPErrorHandler(err, c)
+	}
+	e.Pre(NegotiateAPIVersion("/api", APIVersion{Name: "v1"}))
+
+	route := func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Path())
+	}
+	e.GET("/api/todos", route)
+	e.GET("/api/todos/:id", route)
+	e.POST("/api/graphql", route)
+	e.GET("/api/events", route)
+	e.GET("/api/v1/todos", route)
+	e.GET("/api/v1/todos/:id", route)
+	e.GET("/api/v1/files/*", route)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		status int
+		route  string
+	}{
+		{"no header", http.MethodGet, "/api/todos", "", http.StatusOK, "/api/todos"},
+		{"header picks the version", http.MethodGet, "/api/todos", "v1", http.StatusOK, "/api/v1/todos"},
+		{"bare number", http.MethodGet, "/api/todos", "1", http.StatusOK, "/api/v1/todos"},
+		{"params", http.MethodGet, "/api/todos/123", "v1", http.StatusOK, "/api/v1/todos/:id"},
+		{"wildcard", http.MethodGet, "/api/files/a/b", "v1", http.StatusOK, "/api/v1/files/*"},
+		{"unversioned graphql", http.MethodPost, "/api/graphql", "v1", http.StatusOK, "/api/graphql"},
+		{"unversioned events", http.MethodGet, "/api/events", "v1", http.StatusOK, "/api/events"},
+		{"version in path", http.MethodGet, "/api/v1/todos", "v1", http.StatusOK, "/api/v1/todos"},
+		{"path and header disagree", http.MethodGet, "/api/v1/todos", "v2", http.StatusBadRequest, ""},
+		{"unsupported version", http.MethodGet, "/api/todos", "v9", http.StatusBadRequest, ""},
+		{"outside the prefix", http.MethodGet, "/todos", "v1", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(APIVersionHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+			if tt.route != "" {
+				assert.Equal(t, tt.route, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouteMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/api/v1/todos", "/api/v1/todos", true},
+		{"/api/v1/todos", "/api/v1/todos/1", false},
+		{"/api/v1/todos/:id", "/api/v1/todos/1", true},
+		{"/api/v1/todos/:id", "/api/v1/todos/", false},
+		{"/api/v1/todos/:id/snooze", "/api/v1/todos/1/snooze", true},
+		{"/api/v1/*", "/api/v1/anything/at/all", true},
+		{"/api/v1/todos", "/api/v1/graphql", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, routeMatches(tt.pattern, tt.path), "%s %s", tt.pattern, tt.path)
+	}
+}
@@ -0,0 +1,92 @@
+package apitoken
+
+import (
+	"slices"
+	"time"
+
+	"github.com/goku-m/starter/internal/authz"
+	"github.com/goku-m/starter/internal/model"
+)
+
+const (
+	ScopeTodosRead  = "todos:read"
+	ScopeTodosWrite = "todos:write"
+)
+
+// Scopes lists everything a token can be granted
+var Scopes = []string{
+	ScopeTodosRead,
+	ScopeTodosWrite,
+}
+
+// ScopePermissions is the most each scope lets a token do, whatever its owner's role
+var ScopePermissions = map[string][]string{
+	ScopeTodosRead:  {authz.TodosRead},
+	ScopeTodosWrite: {authz.TodosWrite, authz.TodosDelete},
+}
+
+type APIToken struct {
+	model.Base
+	UserID      string     `json:"userId" db:"user_id"`
+	Name        string     `json:"name" db:"name"`
+	TokenHash   string     `json:"-" db:"token_hash"`
+	TokenPrefix string     `json:"tokenPrefix" db:"token_prefix"`
+	Scopes      []string   `json:"scopes" db:"scopes"`
+	ExpiresAt   *time.Time `json:"expiresAt" db:"expires_at"`
+	LastUsedAt  *time.Time `json:"lastUsedAt" db:"last_used_at"`
+	// The creator's role and permissions when the token was created
+	OwnerRole        *string  `json:"-" db:"owner_role"`
+	OwnerPermissions []string `json:"-" db:"owner_permissions"`
+}
+
+func (t *APIToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+func (t *APIToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// Authenticated is a token looked up for a request, with its owner's current role
+// when they have a built-in account
+type Authenticated struct {
+	APIToken
+	AccountRole *string `db:"account_role"`
+}
+
+// Role is the owner's current role, or for owners without an account the role they
+// had when the token was created
+func (t *Authenticated) Role() string {
+	switch {
+	case t.AccountRole != nil:
+		return *t.AccountRole
+	case t.OwnerRole != nil:
+		return *t.OwnerRole
+	default:
+		return authz.RoleViewer
+	}
+}
+
+// Permissions is what the token may do: what its creator could do, less anything the
+// account has lost since, narrowed to the token's scopes
+func (t *Authenticated) Permissions() []string {
+	owner := t.OwnerPermissions
+	if owner == nil {
+		owner = authz.Permissions(t.Role())
+	}
+	if t.AccountRole != nil {
+		owner = authz.Restrict(owner, authz.Permissions(*t.AccountRole))
+	}
+
+	var allowed []string
+	for _, scope := range t.Scopes {
+		allowed = append(allowed, ScopePermissions[scope]...)
+	}
+	return authz.Restrict(owner, allowed)
+}
+
+// CreatedAPIToken carries the plain token, which is only ever returned here
+type CreatedAPIToken struct {
+	APIToken
+	Token string `json:"token"`
+}
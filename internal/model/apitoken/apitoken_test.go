@@ -0,0 +1,82 @@
+package apitoken
+
+import (
+	"testing"
+
+	"github.com/goku-m/starter/internal/authz"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticatedPermissions(t *testing.T) {
+	ptr := func(s string) *string { return &s }
+
+	tests := []struct {
+		name  string
+		token Authenticated
+		role  string
+		want  []string
+	}{
+		{
+			name: "account owner gets scopes within their role",
+			token: Authenticated{
+				APIToken: APIToken{
+					Scopes:           []string{ScopeTodosWrite},
+					OwnerRole:        ptr(authz.RoleMember),
+					OwnerPermissions: authz.Permissions(authz.RoleMember),
+				},
+				AccountRole: ptr(authz.RoleMember),
+			},
+			role: authz.RoleMember,
+			want: []string{authz.TodosDelete, authz.TodosWrite},
+		},
+		{
+			name: "demoted account loses what the role no longer grants",
+			token: Authenticated{
+				APIToken: APIToken{
+					Scopes:           []string{ScopeTodosRead, ScopeTodosWrite},
+					OwnerRole:        ptr(authz.RoleMember),
+					OwnerPermissions: authz.Permissions(authz.RoleMember),
+				},
+				AccountRole: ptr(authz.RoleViewer),
+			},
+			role: authz.RoleViewer,
+			want: []string{authz.TodosRead},
+		},
+		{
+			name: "owner without an account keeps what they had at creation",
+			token: Authenticated{
+				APIToken: APIToken{
+					Scopes:           []string{ScopeTodosRead, ScopeTodosWrite},
+					OwnerRole:        ptr(authz.RoleViewer),
+					OwnerPermissions: authz.Permissions(authz.RoleViewer),
+				},
+			},
+			role: authz.RoleViewer,
+			want: []string{authz.TodosRead},
+		},
+		{
+			name: "legacy token without an account falls back to viewer",
+			token: Authenticated{
+				APIToken: APIToken{Scopes: []string{ScopeTodosWrite}},
+			},
+			role: authz.RoleViewer,
+			want: []string{},
+		},
+		{
+			name: "legacy token follows its account's role",
+			token: Authenticated{
+				APIToken:    APIToken{Scopes: []string{ScopeTodosRead}},
+				AccountRole: ptr(authz.RoleMember),
+			},
+			role: authz.RoleMember,
+			want: []string{authz.TodosRead},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.role, tt.token.Role())
+			assert.ElementsMatch(t, tt.want, tt.token.Permissions())
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package apitoken
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+type CreateAPITokenPayload struct {
+	Name   string   `json:"name" form:"name" validate:"required,min=1,max=100"`
+	Scopes []string `json:"scopes" form:"scopes" validate:"required,min=1,dive,oneof=todos:read todos:write"`
+	// ExpiresInDays of 0 makes a token that doesn't expire
+	ExpiresInDays int `json:"expiresInDays" form:"expiresInDays" validate:"omitempty,min=1,max=365"`
+}
+
+func (p *CreateAPITokenPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+type APITokenIDPayload struct {
+	ID uuid.UUID `param:"id" validate:"required,uuid"`
+}
+
+func (p *APITokenIDPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+type GetAPITokensPayload struct{}
+
+func (p *GetAPITokensPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
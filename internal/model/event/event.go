@@ -0,0 +1,26 @@
+package event
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Stream-only event types; todo changes shared with webhooks reuse the webhook event names
+const (
+	TypeTodoSnoozed   = "todo.snoozed"
+	TypeTodoUnsnoozed = "todo.unsnoozed"
+)
+
+type Event struct {
+	ID        int64           `json:"id" db:"id"`
+	CreatedAt time.Time       `json:"createdAt" db:"created_at"`
+	UserID    string          `json:"userId" db:"user_id"`
+	Type      string          `json:"type" db:"type"`
+	Data      json.RawMessage `json:"data" db:"data"`
+}
+
+// Notification is the small payload sent over Postgres NOTIFY; listeners load the full event by id
+type Notification struct {
+	ID     int64  `json:"id"`
+	UserID string `json:"user_id"`
+}
@@ -0,0 +1,30 @@
+package idempotency
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Status string
+
+const (
+	StatusInFlight  Status = "in_flight"
+	StatusCompleted Status = "completed"
+)
+
+// Record is a stored Idempotency-Key and, once the first request finished, its response
+type Record struct {
+	UserID          string      `json:"userId" db:"user_id"`
+	Key             string      `json:"key" db:"key"`
+	CreatedAt       time.Time   `json:"createdAt" db:"created_at"`
+	ExpiresAt       time.Time   `json:"expiresAt" db:"expires_at"`
+	LockedUntil     *time.Time  `json:"lockedUntil" db:"locked_until"`
+	LockToken       *uuid.UUID  `json:"-" db:"lock_token"`
+	Fingerprint     string      `json:"fingerprint" db:"fingerprint"`
+	Status          Status      `json:"status" db:"status"`
+	ResponseStatus  *int        `json:"responseStatus" db:"response_status"`
+	ResponseHeaders http.Header `json:"responseHeaders" db:"response_headers"`
+	ResponseBody    []byte      `json:"responseBody" db:"response_body"`
+}
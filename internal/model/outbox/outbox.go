@@ -0,0 +1,38 @@
+package outbox
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const AggregateTodo = "todo"
+
+// Event is a domain event to be recorded alongside the change that produced it
+type Event struct {
+	AggregateType string
+	AggregateID   string
+	Type          string
+	UserID        string
+	Payload       any
+}
+
+// Message is a stored outbox row
+type Message struct {
+	ID            int64           `json:"id" db:"id"`
+	CreatedAt     time.Time       `json:"createdAt" db:"created_at"`
+	AggregateType string          `json:"aggregateType" db:"aggregate_type"`
+	AggregateID   string          `json:"aggregateId" db:"aggregate_id"`
+	EventType     string          `json:"eventType" db:"event_type"`
+	UserID        string          `json:"userId" db:"user_id"`
+	Payload       json.RawMessage `json:"payload" db:"payload"`
+	Attempts      int             `json:"attempts" db:"attempts"`
+	LastError     *string         `json:"lastError" db:"last_error"`
+	NextAttemptAt *time.Time      `json:"nextAttemptAt" db:"next_attempt_at"`
+	PublishedAt   *time.Time      `json:"publishedAt" db:"published_at"`
+	DeadAt        *time.Time      `json:"deadAt" db:"dead_at"`
+}
+
+// Aggregate identifies the entity whose events must be published in order
+func (m Message) Aggregate() string {
+	return m.AggregateType + ":" + m.AggregateID
+}
@@ -0,0 +1,39 @@
+package privacy
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+// RequestExportPayload is empty: the link always goes to the account's own email, never
+// to an address the caller names
+type RequestExportPayload struct{}
+
+func (p *RequestExportPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+type DownloadExportPayload struct {
+	ID    uuid.UUID `param:"id" validate:"required,uuid"`
+	Token string    `query:"token" validate:"required"`
+}
+
+func (p *DownloadExportPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+// ErasePayload asks the caller to confirm, since erasure cannot be undone
+type ErasePayload struct {
+	Confirm string `json:"confirm" form:"confirm" validate:"required,eq=ERASE"`
+}
+
+func (p *ErasePayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
@@ -0,0 +1,55 @@
+package privacy
+
+import (
+	"time"
+
+	"github.com/goku-m/starter/internal/lib/session"
+	"github.com/goku-m/starter/internal/model"
+	"github.com/goku-m/starter/internal/model/apitoken"
+	"github.com/goku-m/starter/internal/model/event"
+	"github.com/goku-m/starter/internal/model/todo"
+	"github.com/goku-m/starter/internal/model/user"
+	"github.com/goku-m/starter/internal/model/webhook"
+)
+
+type ExportStatus string
+
+const (
+	ExportStatusPending ExportStatus = "pending"
+	ExportStatusReady   ExportStatus = "ready"
+	ExportStatusFailed  ExportStatus = "failed"
+)
+
+// DataExport tracks one export request; the archive itself is only loaded for download
+type DataExport struct {
+	model.Base
+	UserID      string       `json:"-" db:"user_id"`
+	Email       string       `json:"email" db:"email"`
+	Status      ExportStatus `json:"status" db:"status"`
+	ExpiresAt   *time.Time   `json:"expiresAt" db:"expires_at"`
+	CompletedAt *time.Time   `json:"completedAt" db:"completed_at"`
+	Error       *string      `json:"-" db:"error"`
+}
+
+// UserData is everything stored about a user, as written to the export archive.
+// Account is nil for users without one, such as those known only by address.
+type UserData struct {
+	Account    *user.User          `json:"account"`
+	Identities []user.Identity     `json:"identities"`
+	Sessions   []session.Session   `json:"sessions"`
+	APITokens  []apitoken.APIToken `json:"apiTokens"`
+	Todos      []todo.Todo         `json:"todos"`
+	Webhooks   []webhook.Webhook   `json:"webhooks"`
+	Deliveries []webhook.Delivery  `json:"webhookDeliveries"`
+	Events     []event.Event       `json:"events"`
+	Exports    []DataExport        `json:"dataExports"`
+}
+
+// ErasureRecord is the audit entry left behind by an erasure
+type ErasureRecord struct {
+	model.BaseWithId
+	model.BaseWithCreatedAt
+	SubjectHash string           `json:"subjectHash" db:"subject_hash"`
+	RequestID   *string          `json:"requestId" db:"request_id"`
+	DeletedRows map[string]int64 `json:"deletedRows" db:"deleted_rows"`
+}
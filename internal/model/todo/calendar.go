@@ -0,0 +1,56 @@
+package todo
+
+import (
+	"time"
+)
+
+type CalendarView string
+
+const (
+	CalendarViewMonth  CalendarView = "month"
+	CalendarViewWeek   CalendarView = "week"
+	CalendarViewAgenda CalendarView = "agenda"
+)
+
+type CalendarItem struct {
+	Todo
+	Overdue   bool   `json:"overdue"`
+	Completed bool   `json:"completed"`
+	LocalTime string `json:"localTime"`
+}
+
+type CalendarDay struct {
+	Date    string         `json:"date"`
+	Day     int            `json:"day"`
+	Weekday string         `json:"weekday"`
+	InRange bool           `json:"inRange"`
+	IsToday bool           `json:"isToday"`
+	Items   []CalendarItem `json:"items"`
+}
+
+type Calendar struct {
+	View     CalendarView    `json:"view"`
+	Title    string          `json:"title"`
+	Timezone string          `json:"timezone"`
+	Date     string          `json:"date"`
+	Prev     string          `json:"prev"`
+	Next     string          `json:"next"`
+	Today    string          `json:"today"`
+	Weeks    [][]CalendarDay `json:"weeks"`
+	Agenda   []CalendarDay   `json:"agenda"`
+}
+
+// NewCalendarItem converts a todo into its calendar representation in the given location
+func NewCalendarItem(t Todo, loc *time.Location) CalendarItem {
+	item := CalendarItem{
+		Todo:      t,
+		Overdue:   t.IsOverdue(),
+		Completed: t.Status == StatusCompleted,
+	}
+
+	if t.DueDate != nil {
+		item.LocalTime = t.DueDate.In(loc).Format("15:04")
+	}
+
+	return item
+}
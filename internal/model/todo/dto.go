@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/goku-m/starter/internal/validation"
 	"github.com/google/uuid"
 )
 
@@ -12,6 +13,7 @@ type CreateTodoPayload struct {
 	Description *string    `json:"description" validate:"omitempty,max=1000"`
 	Priority    *Priority  `json:"priority" validate:"omitempty,oneof=low medium high"`
 	DueDate     *time.Time `json:"dueDate"`
+	Tags        []string   `json:"tags" validate:"omitempty,max=20,dive,min=1,max=50"`
 }
 
 func (p *CreateTodoPayload) Validate() error {
@@ -36,6 +38,56 @@ func (p *UpdateTodoPayload) Validate() error {
 
 // ------------------------------------------------------------
 
+type PatchType string
+
+const (
+	PatchTypeMerge PatchType = "application/merge-patch+json"
+	PatchTypeJSON  PatchType = "application/json-patch+json"
+)
+
+type PatchTodoPayload struct {
+	ID uuid.UUID `param:"id" validate:"required,uuid"`
+}
+
+func (p *PatchTodoPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// TodoDocument is the editable view of a todo that PATCH requests are applied to.
+// Nullable fields can be cleared by patching them to null.
+type TodoDocument struct {
+	Title       string     `json:"title" validate:"required,min=1,max=255"`
+	Description *string    `json:"description" validate:"omitempty,max=1000"`
+	Status      Status     `json:"status" validate:"required,oneof=draft active completed archived"`
+	Priority    Priority   `json:"priority" validate:"required,oneof=low medium high"`
+	DueDate     *time.Time `json:"dueDate"`
+	Tags        []string   `json:"tags" validate:"max=20,dive,min=1,max=50"`
+}
+
+func NewTodoDocument(t *Todo) *TodoDocument {
+	tags := t.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return &TodoDocument{
+		Title:       t.Title,
+		Description: t.Description,
+		Status:      t.Status,
+		Priority:    t.Priority,
+		DueDate:     t.DueDate,
+		Tags:        tags,
+	}
+}
+
+func (d *TodoDocument) Validate() error {
+	validate := validator.New()
+	return validate.Struct(d)
+}
+
+// ------------------------------------------------------------
+
 type GetTodosQuery struct {
 	Page      *int      `query:"page" validate:"omitempty,min=1"`
 	Limit     *int      `query:"limit" validate:"omitempty,min=1,max=100"`
@@ -46,6 +98,7 @@ type GetTodosQuery struct {
 	Priority  *Priority `query:"priority" validate:"omitempty,oneof=low medium high"`
 	Overdue   *bool     `query:"overdue"`
 	Completed *bool     `query:"completed"`
+	Snoozed   *bool     `query:"snoozed"`
 }
 
 func (q *GetTodosQuery) Validate() error {
@@ -97,3 +150,73 @@ func (p *DeleteTodoPayload) Validate() error {
 	validate := validator.New()
 	return validate.Struct(p)
 }
+
+// ------------------------------------------------------------
+
+type SnoozeTodoPayload struct {
+	ID    uuid.UUID `param:"id" validate:"required,uuid"`
+	Until time.Time `json:"until" validate:"required"`
+}
+
+func (p *SnoozeTodoPayload) Validate() error {
+	validate := validator.New()
+
+	if err := validate.Struct(p); err != nil {
+		return err
+	}
+
+	if !p.Until.After(time.Now()) {
+		return validation.CustomValidationErrors{
+			{Field: "until", Message: "must be in the future"},
+		}
+	}
+
+	return nil
+}
+
+// ------------------------------------------------------------
+
+type UnsnoozeTodoPayload struct {
+	ID uuid.UUID `param:"id" validate:"required,uuid"`
+}
+
+func (p *UnsnoozeTodoPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+type ParseTodoPayload struct {
+	Text     string  `json:"text" form:"text" validate:"required,min=1,max=500"`
+	Timezone *string `json:"tz" query:"tz" validate:"omitempty,timezone"`
+}
+
+func (p *ParseTodoPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+type GetCalendarQuery struct {
+	View     *CalendarView `query:"view" validate:"omitempty,oneof=month week agenda"`
+	Date     *string       `query:"date" validate:"omitempty,datetime=2006-01-02"`
+	Timezone *string       `query:"tz" validate:"omitempty,timezone"`
+}
+
+func (q *GetCalendarQuery) Validate() error {
+	validate := validator.New()
+
+	if err := validate.Struct(q); err != nil {
+		return err
+	}
+
+	// Set defaults
+	if q.View == nil {
+		defaultView := CalendarViewMonth
+		q.View = &defaultView
+	}
+
+	return nil
+}
@@ -33,6 +33,8 @@ type Todo struct {
 	DueDate     *time.Time `json:"dueDate" db:"due_date"`
 	CompletedAt *time.Time `json:"completedAt" db:"completed_at"`
 	SortOrder   int        `json:"sortOrder" db:"sort_order"`
+	Tags         []string   `json:"tags" db:"tags"`
+	SnoozedUntil *time.Time `json:"snoozedUntil" db:"snoozed_until"`
 }
 
 
@@ -48,6 +50,7 @@ type TodoStats struct {
 	Completed int `json:"completed"`
 	Archived  int `json:"archived"`
 	Overdue   int `json:"overdue"`
+	Snoozed   int `json:"snoozed"`
 }
 
 type UserWeeklyStats struct {
@@ -61,3 +64,7 @@ type UserWeeklyStats struct {
 func (t *Todo) IsOverdue() bool {
 	return t.DueDate != nil && t.DueDate.Before(time.Now()) && t.Status != StatusCompleted
 }
+
+func (t *Todo) IsSnoozed() bool {
+	return t.SnoozedUntil != nil && t.SnoozedUntil.After(time.Now())
+}
@@ -0,0 +1,159 @@
+package user
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+type SignupPayload struct {
+	Email    string `json:"email" form:"email" validate:"required,email,max=254"`
+	Password string `json:"password" form:"password" validate:"required,min=10,max=128"`
+	Next     string `query:"next" form:"next"`
+}
+
+func (p *SignupPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+type LoginPayload struct {
+	Email    string `json:"email" form:"email" validate:"required,email,max=254"`
+	Password string `json:"password" form:"password" validate:"required,max=128"`
+	Next     string `query:"next" form:"next"`
+}
+
+func (p *LoginPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+type OIDCLoginPayload struct {
+	Next string `query:"next"`
+}
+
+func (p *OIDCLoginPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+// OIDCCallbackPayload is what the provider sends the browser back with: a code on
+// success, an error otherwise
+type OIDCCallbackPayload struct {
+	Code             string `query:"code"`
+	State            string `query:"state" validate:"required"`
+	Error            string `query:"error"`
+	ErrorDescription string `query:"error_description"`
+}
+
+func (p *OIDCCallbackPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+type IdentityIDPayload struct {
+	ID uuid.UUID `param:"id" validate:"required,uuid"`
+}
+
+func (p *IdentityIDPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+type RequestMagicLinkPayload struct {
+	Email string `json:"email" form:"email" validate:"required,email,max=254"`
+	Next  string `query:"next" form:"next"`
+}
+
+func (p *RequestMagicLinkPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+// MagicLinkPayload arrives as query parameters on the emailed link and as form
+// fields when the user confirms
+type MagicLinkPayload struct {
+	Token string `query:"token" form:"token" validate:"required,max=128"`
+	Next  string `query:"next" form:"next"`
+}
+
+func (p *MagicLinkPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+// TwoFactorCodePayload takes a code from an authenticator app or a recovery code
+type TwoFactorCodePayload struct {
+	Code string `json:"code" form:"code" validate:"required,max=32"`
+}
+
+func (p *TwoFactorCodePayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+type UserIDPayload struct {
+	ID uuid.UUID `param:"id" validate:"required,uuid"`
+}
+
+func (p *UserIDPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"currentPassword" form:"currentPassword" validate:"required,max=128"`
+	NewPassword     string `json:"newPassword" form:"newPassword" validate:"required,min=10,max=128"`
+}
+
+func (p *ChangePasswordPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+// SessionIDPayload names a session by its id, the hash of its cookie value
+type SessionIDPayload struct {
+	ID string `param:"id" validate:"required,hexadecimal,len=64"`
+}
+
+func (p *SessionIDPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+type GetSessionsPayload struct{}
+
+func (p *GetSessionsPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+type RevokeSessionsPayload struct{}
+
+func (p *RevokeSessionsPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
@@ -0,0 +1,48 @@
+package user
+
+import (
+	"time"
+
+	"github.com/goku-m/starter/internal/model"
+	"github.com/google/uuid"
+)
+
+type User struct {
+	model.Base
+	Email string `json:"email" db:"email"`
+	// PasswordHash is nil for accounts that only sign in through an OpenID provider
+	PasswordHash *string `json:"-" db:"password_hash"`
+	Role         string  `json:"role" db:"role"`
+	// TOTPSecret is set from the start of enrollment; two-factor is on once
+	// TOTPEnabledAt is set too
+	TOTPSecret    *string    `json:"-" db:"totp_secret"`
+	TOTPEnabledAt *time.Time `json:"totpEnabledAt" db:"totp_enabled_at"`
+	TOTPLastStep  *int64     `json:"-" db:"totp_last_step"`
+	TOTPFailures  int        `json:"-" db:"totp_failures"`
+	TOTPFailedAt  *time.Time `json:"-" db:"totp_failed_at"`
+	// TodoClaimOfferedAt is when the account was offered the todos created from its
+	// address before it existed
+	TodoClaimOfferedAt *time.Time `json:"-" db:"todo_claim_offered_at"`
+}
+
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil && u.TOTPSecret != nil
+}
+
+// Identity links an account to a user at an OpenID provider
+type Identity struct {
+	model.Base
+	UserID  uuid.UUID `json:"userId" db:"user_id"`
+	Issuer  string    `json:"issuer" db:"issuer"`
+	Subject string    `json:"subject" db:"subject"`
+	Email   *string   `json:"email" db:"email"`
+}
+
+// MagicLink is an emailed sign-in link. The token itself only ever exists in the email.
+type MagicLink struct {
+	model.Base
+	UserID    uuid.UUID  `json:"userId" db:"user_id"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	ExpiresAt time.Time  `json:"expiresAt" db:"expires_at"`
+	UsedAt    *time.Time `json:"usedAt" db:"used_at"`
+}
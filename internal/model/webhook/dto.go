@@ -0,0 +1,28 @@
+package webhook
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+type CreateWebhookPayload struct {
+	URL         string   `json:"url" form:"url" validate:"required,http_url,max=2048"`
+	Description *string  `json:"description" form:"description" validate:"omitempty,max=255"`
+	Events      []string `json:"events" form:"events" validate:"required,min=1,dive,oneof=todo.created todo.updated todo.deleted todo.completed"`
+}
+
+func (p *CreateWebhookPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+// ------------------------------------------------------------
+
+type WebhookIDPayload struct {
+	ID uuid.UUID `param:"id" validate:"required,uuid"`
+}
+
+func (p *WebhookIDPayload) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
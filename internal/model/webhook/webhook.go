@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/goku-m/starter/internal/model"
+	"github.com/google/uuid"
+)
+
+type Event string
+
+const (
+	EventTodoCreated   Event = "todo.created"
+	EventTodoUpdated   Event = "todo.updated"
+	EventTodoDeleted   Event = "todo.deleted"
+	EventTodoCompleted Event = "todo.completed"
+	EventPing          Event = "ping"
+)
+
+// Events lists everything an endpoint can subscribe to
+var Events = []Event{
+	EventTodoCreated,
+	EventTodoUpdated,
+	EventTodoDeleted,
+	EventTodoCompleted,
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryStatusPending   DeliveryStatus = "pending"
+	DeliveryStatusRetrying  DeliveryStatus = "retrying"
+	DeliveryStatusSucceeded DeliveryStatus = "succeeded"
+	DeliveryStatusFailed    DeliveryStatus = "failed"
+)
+
+type Webhook struct {
+	model.Base
+	UserID      string   `json:"userId" db:"user_id"`
+	URL         string   `json:"url" db:"url"`
+	Description *string  `json:"description" db:"description"`
+	Secret      string   `json:"-" db:"secret"`
+	Events      []string `json:"events" db:"events"`
+	Active      bool     `json:"active" db:"active"`
+}
+
+func (w *Webhook) Subscribes(event Event) bool {
+	for _, e := range w.Events {
+		if e == string(event) {
+			return true
+		}
+	}
+	return false
+}
+
+type Delivery struct {
+	model.Base
+	WebhookID    uuid.UUID       `json:"webhookId" db:"webhook_id"`
+	Event        Event           `json:"event" db:"event"`
+	Payload      json.RawMessage `json:"payload" db:"payload"`
+	Status       DeliveryStatus  `json:"status" db:"status"`
+	Attempts     int             `json:"attempts" db:"attempts"`
+	ResponseCode *int            `json:"responseCode" db:"response_code"`
+	ResponseBody *string         `json:"responseBody" db:"response_body"`
+	Error        *string         `json:"error" db:"error"`
+	DurationMs   *int            `json:"durationMs" db:"duration_ms"`
+	DeliveredAt  *time.Time      `json:"deliveredAt" db:"delivered_at"`
+	// OutboxID is the domain event the delivery was dispatched for; nil for test pings
+	OutboxID *int64 `json:"-" db:"outbox_id"`
+}
+
+// Envelope is the JSON body posted to webhook endpoints
+type Envelope struct {
+	ID        uuid.UUID `json:"id"`
+	Event     Event     `json:"event"`
+	CreatedAt time.Time `json:"createdAt"`
+	Data      any       `json:"data"`
+}
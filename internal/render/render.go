@@ -6,6 +6,7 @@ import (
 	"log"
 
 	"github.com/CloudyKit/jet/v6"
+	"github.com/goku-m/starter/internal/middleware"
 	"github.com/labstack/echo/v4"
 )
 
@@ -15,6 +16,7 @@ type Renderer struct {
 
 type TemplateData struct {
 	IsAuthenticated bool
+	CSRFToken       string
 	IntMap          map[string]int
 	StringMap       map[string]string
 	FloatMap        map[string]float32
@@ -43,6 +45,11 @@ func (r *Renderer) Render(w io.Writer, name string, data interface{}, c echo.Con
 
 	td := toTemplateData(data)
 
+	// Every page knows whether someone is signed in, whichever handler rendered it
+	td.IsAuthenticated = middleware.GetUserID(c) != ""
+	// ...and carries the CSRF token its forms have to post back
+	td.CSRFToken = middleware.GetCSRFToken(c)
+
 	// Build Jet VarMap
 	vars := make(jet.VarMap)
 
@@ -52,6 +59,7 @@ func (r *Renderer) Render(w io.Writer, name string, data interface{}, c echo.Con
 	vars.Set("FloatMap", td.FloatMap)
 	vars.Set("Data", td.Data)
 	vars.Set("IsAuthenticated", td.IsAuthenticated)
+	vars.Set("CSRFToken", td.CSRFToken)
 
 	// PASS td AS THE EXECUTION CONTEXT (3rd parameter)
 	return tmpl.Execute(w, vars, td)
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/goku-m/starter/internal/authz"
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/model/apitoken"
+	"github.com/goku-m/starter/internal/server"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type APITokenRepository struct {
+	server *server.Server
+}
+
+func NewAPITokenRepository(server *server.Server) *APITokenRepository {
+	return &APITokenRepository{server: server}
+}
+
+func (r *APITokenRepository) CreateAPIToken(ctx context.Context, owner authz.Principal, name, tokenHash, tokenPrefix string, scopes []string, expiresAt *time.Time) (*apitoken.APIToken, error) {
+	stmt := `
+		INSERT INTO
+			api_tokens (
+				user_id,
+				name,
+				token_hash,
+				token_prefix,
+				scopes,
+				expires_at,
+				owner_role,
+				owner_permissions
+			)
+		VALUES
+			(
+				@user_id,
+				@name,
+				@token_hash,
+				@token_prefix,
+				@scopes,
+				@expires_at,
+				@owner_role,
+				@owner_permissions
+			)
+		RETURNING
+			*
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"user_id":           owner.UserID,
+		"name":              name,
+		"token_hash":        tokenHash,
+		"token_prefix":      tokenPrefix,
+		"scopes":            scopes,
+		"expires_at":        expiresAt,
+		"owner_role":        owner.Role,
+		"owner_permissions": owner.Permissions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute create api token query for user_id=%s: %w", owner.UserID, err)
+	}
+
+	item, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[apitoken.APIToken])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:api_tokens for user_id=%s: %w", owner.UserID, err)
+	}
+
+	return &item, nil
+}
+
+func (r *APITokenRepository) GetAPITokens(ctx context.Context, userID string) ([]apitoken.APIToken, error) {
+	stmt := `
+		SELECT
+			*
+		FROM
+			api_tokens
+		WHERE
+			user_id=@user_id
+		ORDER BY
+			created_at DESC
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"user_id": userID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get api tokens query for user_id=%s: %w", userID, err)
+	}
+
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByName[apitoken.APIToken])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows from table:api_tokens for user_id=%s: %w", userID, err)
+	}
+
+	return items, nil
+}
+
+// GetAPITokenByHash looks a presented token up along with its owner's current role,
+// which is NULL for owners without a built-in account; callers check expiry themselves
+func (r *APITokenRepository) GetAPITokenByHash(ctx context.Context, tokenHash string) (*apitoken.Authenticated, error) {
+	stmt := `
+		SELECT
+			t.*,
+			u.role AS account_role
+		FROM
+			api_tokens t
+			LEFT JOIN users u ON u.id::text=t.user_id
+		WHERE
+			t.token_hash=@token_hash
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"token_hash": tokenHash,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get api token by hash query: %w", err)
+	}
+
+	item, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[apitoken.Authenticated])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:api_tokens: %w", err)
+	}
+
+	return &item, nil
+}
+
+// TouchAPIToken records use of a token, at most once per interval so busy scripts
+// don't turn every request into a write
+func (r *APITokenRepository) TouchAPIToken(ctx context.Context, tokenID uuid.UUID, usedAt time.Time, interval time.Duration) error {
+	stmt := `
+		UPDATE api_tokens
+		SET
+			last_used_at=@used_at
+		WHERE
+			id=@id
+			AND (
+				last_used_at IS NULL
+				OR last_used_at<@stale_before
+			)
+	`
+
+	if _, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"id":           tokenID,
+		"used_at":      usedAt,
+		"stale_before": usedAt.Add(-interval),
+	}); err != nil {
+		return fmt.Errorf("failed to execute touch api token query for token_id=%s: %w", tokenID.String(), err)
+	}
+
+	return nil
+}
+
+func (r *APITokenRepository) DeleteAPIToken(ctx context.Context, userID string, tokenID uuid.UUID) error {
+	stmt := `
+		DELETE FROM api_tokens
+		WHERE
+			id=@token_id
+			AND user_id=@user_id
+	`
+
+	result, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"token_id": tokenID,
+		"user_id":  userID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		code := "API_TOKEN_NOT_FOUND"
+		return errs.NewNotFoundError("api token not found", false, &code)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/goku-m/starter/internal/model/event"
+	"github.com/goku-m/starter/internal/server"
+	"github.com/jackc/pgx/v5"
+)
+
+// EventsChannel is the Postgres NOTIFY channel that fans events out across app instances
+const EventsChannel = "events"
+
+type EventRepository struct {
+	server *server.Server
+}
+
+func NewEventRepository(server *server.Server) *EventRepository {
+	return &EventRepository{server: server}
+}
+
+// CreateEvent stores an event and notifies listeners on every instance once the insert is visible
+func (r *EventRepository) CreateEvent(ctx context.Context, userID, eventType string, data []byte) (*event.Event, error) {
+	stmt := `
+		INSERT INTO
+			events (
+				user_id,
+				type,
+				data
+			)
+		VALUES
+			(
+				@user_id,
+				@type,
+				@data
+			)
+		RETURNING
+			*
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"user_id": userID,
+		"type":    eventType,
+		"data":    data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute create event query for user_id=%s type=%s: %w", userID, eventType, err)
+	}
+
+	item, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[event.Event])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:events for user_id=%s type=%s: %w", userID, eventType, err)
+	}
+
+	notification, err := json.Marshal(event.Notification{ID: item.ID, UserID: userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event notification: %w", err)
+	}
+
+	if _, err := r.server.DB.Querier(ctx).Exec(ctx, "SELECT pg_notify(@channel, @payload)", pgx.NamedArgs{
+		"channel": EventsChannel,
+		"payload": string(notification),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to notify event_id=%d: %w", item.ID, err)
+	}
+
+	return &item, nil
+}
+
+func (r *EventRepository) GetEventByID(ctx context.Context, eventID int64) (*event.Event, error) {
+	stmt := `
+		SELECT
+			*
+		FROM
+			events
+		WHERE
+			id=@id
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"id": eventID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get event by id query for event_id=%d: %w", eventID, err)
+	}
+
+	item, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[event.Event])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:events for event_id=%d: %w", eventID, err)
+	}
+
+	return &item, nil
+}
+
+// GetEventsSince returns the user's events after lastID in order, for Last-Event-ID resume
+func (r *EventRepository) GetEventsSince(ctx context.Context, userID string, lastID int64, limit int) ([]event.Event, error) {
+	stmt := `
+		SELECT
+			*
+		FROM
+			events
+		WHERE
+			user_id=@user_id
+			AND id>@last_id
+		ORDER BY
+			id ASC
+		LIMIT
+			@limit
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"user_id": userID,
+		"last_id": lastID,
+		"limit":   limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get events since query for user_id=%s: %w", userID, err)
+	}
+
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByName[event.Event])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows from table:events for user_id=%s: %w", userID, err)
+	}
+
+	return items, nil
+}
+
+func (r *EventRepository) DeleteEventsBefore(ctx context.Context, before time.Time) (int64, error) {
+	stmt := `
+		DELETE FROM events
+		WHERE
+			created_at<@before
+	`
+
+	result, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"before": before,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute delete events query: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/goku-m/starter/internal/model/idempotency"
+	"github.com/goku-m/starter/internal/server"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type IdempotencyRepository struct {
+	server *server.Server
+}
+
+func NewIdempotencyRepository(server *server.Server) *IdempotencyRepository {
+	return &IdempotencyRepository{server: server}
+}
+
+// Acquire claims key for a new request. When the key is already taken it returns the
+// existing record and false. Expired keys, and in-flight keys whose lock lapsed because
+// the original request died, are taken over. The claimed record's LockToken must be
+// passed to Complete or Release.
+func (r *IdempotencyRepository) Acquire(ctx context.Context, userID, key, fingerprint string, ttl, lockTimeout time.Duration) (*idempotency.Record, bool, error) {
+	stmt := `
+		INSERT INTO
+			idempotency_keys (
+				user_id,
+				key,
+				fingerprint,
+				expires_at,
+				locked_until,
+				lock_token
+			)
+		VALUES
+			(
+				@user_id,
+				@key,
+				@fingerprint,
+				NOW() + @ttl::INTERVAL,
+				NOW() + @lock_timeout::INTERVAL,
+				gen_random_uuid()
+			)
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET
+			created_at=NOW(),
+			fingerprint=EXCLUDED.fingerprint,
+			expires_at=EXCLUDED.expires_at,
+			locked_until=EXCLUDED.locked_until,
+			lock_token=EXCLUDED.lock_token,
+			status='in_flight',
+			response_status=NULL,
+			response_headers=NULL,
+			response_body=NULL
+		WHERE
+			idempotency_keys.expires_at<NOW()
+			OR (
+				idempotency_keys.status='in_flight'
+				AND idempotency_keys.locked_until<NOW()
+			)
+		RETURNING
+			*
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"user_id":      userID,
+		"key":          key,
+		"fingerprint":  fingerprint,
+		"ttl":          ttl,
+		"lock_timeout": lockTimeout,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to execute acquire idempotency key query for user_id=%s: %w", userID, err)
+	}
+
+	records, err := pgx.CollectRows(rows, pgx.RowToStructByName[idempotency.Record])
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to collect rows from table:idempotency_keys for user_id=%s: %w", userID, err)
+	}
+	if len(records) == 1 {
+		return &records[0], true, nil
+	}
+
+	existing, err := r.get(ctx, userID, key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return existing, false, nil
+}
+
+func (r *IdempotencyRepository) get(ctx context.Context, userID, key string) (*idempotency.Record, error) {
+	stmt := `
+		SELECT
+			*
+		FROM
+			idempotency_keys
+		WHERE
+			user_id=@user_id
+			AND key=@key
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"user_id": userID,
+		"key":     key,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get idempotency key query for user_id=%s: %w", userID, err)
+	}
+
+	record, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[idempotency.Record])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:idempotency_keys for user_id=%s: %w", userID, err)
+	}
+
+	return &record, nil
+}
+
+// Complete stores the response of the request that holds the key. It fails when the
+// lock lapsed and another request took the key over, whose response is the one kept.
+func (r *IdempotencyRepository) Complete(ctx context.Context, userID, key string, lockToken uuid.UUID, status int, headers http.Header, body []byte) error {
+	stmt := `
+		UPDATE idempotency_keys
+		SET
+			status='completed',
+			locked_until=NULL,
+			lock_token=NULL,
+			response_status=@response_status,
+			response_headers=@response_headers,
+			response_body=@response_body
+		WHERE
+			user_id=@user_id
+			AND key=@key
+			AND lock_token=@lock_token
+	`
+
+	result, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"user_id":          userID,
+		"key":              key,
+		"lock_token":       lockToken,
+		"response_status":  status,
+		"response_headers": headers,
+		"response_body":    body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key for user_id=%s: %w", userID, err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("idempotency key for user_id=%s is no longer held by this request", userID)
+	}
+
+	return nil
+}
+
+// Release forgets a key so the client can retry, used when the request failed
+// server-side. A key another request has taken over is left alone.
+func (r *IdempotencyRepository) Release(ctx context.Context, userID, key string, lockToken uuid.UUID) error {
+	stmt := `
+		DELETE FROM idempotency_keys
+		WHERE
+			user_id=@user_id
+			AND key=@key
+			AND lock_token=@lock_token
+	`
+
+	if _, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"user_id":    userID,
+		"key":        key,
+		"lock_token": lockToken,
+	}); err != nil {
+		return fmt.Errorf("failed to release idempotency key for user_id=%s: %w", userID, err)
+	}
+
+	return nil
+}
+
+func (r *IdempotencyRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	stmt := `
+		DELETE FROM idempotency_keys
+		WHERE
+			expires_at<NOW()
+	`
+
+	result, err := r.server.DB.Querier(ctx).Exec(ctx, stmt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute delete expired idempotency keys query: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/goku-m/starter/internal/model/outbox"
+	"github.com/goku-m/starter/internal/server"
+	"github.com/jackc/pgx/v5"
+)
+
+// outboxRelayLockKey is the advisory lock that keeps a single relay publishing at a time
+const outboxRelayLockKey = 7_310_001
+
+type OutboxRepository struct {
+	server *server.Server
+}
+
+func NewOutboxRepository(server *server.Server) *OutboxRepository {
+	return &OutboxRepository{server: server}
+}
+
+// AddEvents records events inside tx so they commit or roll back with the change itself
+func (r *OutboxRepository) AddEvents(ctx context.Context, tx pgx.Tx, events ...outbox.Event) error {
+	stmt := `
+		INSERT INTO
+			outbox (
+				aggregate_type,
+				aggregate_id,
+				event_type,
+				user_id,
+				payload
+			)
+		VALUES
+			(
+				@aggregate_type,
+				@aggregate_id,
+				@event_type,
+				@user_id,
+				@payload
+			)
+	`
+
+	for _, e := range events {
+		payload, err := json.Marshal(e.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal outbox payload for event_type=%s: %w", e.Type, err)
+		}
+
+		if _, err := tx.Exec(ctx, stmt, pgx.NamedArgs{
+			"aggregate_type": e.AggregateType,
+			"aggregate_id":   e.AggregateID,
+			"event_type":     e.Type,
+			"user_id":        e.UserID,
+			"payload":        payload,
+		}); err != nil {
+			return fmt.Errorf("failed to execute add outbox event query for aggregate=%s:%s event_type=%s: %w", e.AggregateType, e.AggregateID, e.Type, err)
+		}
+	}
+
+	return nil
+}
+
+// LockRelay takes the relay lock for the lifetime of tx; false means another relay holds it
+func (r *OutboxRepository) LockRelay(ctx context.Context, tx pgx.Tx) (bool, error) {
+	var locked bool
+	if err := tx.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock(@key)", pgx.NamedArgs{
+		"key": outboxRelayLockKey,
+	}).Scan(&locked); err != nil {
+		return false, fmt.Errorf("failed to execute outbox relay lock query: %w", err)
+	}
+
+	return locked, nil
+}
+
+// GetPending returns unpublished messages that are due, in insertion order. Messages
+// behind one of their aggregate's that is still backing off are left out too, so a
+// blocked aggregate can't fill the batch and hold back the others.
+func (r *OutboxRepository) GetPending(ctx context.Context, tx pgx.Tx, limit int) ([]outbox.Message, error) {
+	stmt := `
+		SELECT
+			o.*
+		FROM
+			outbox o
+		WHERE
+			o.published_at IS NULL
+			AND o.dead_at IS NULL
+			AND (
+				o.next_attempt_at IS NULL
+				OR o.next_attempt_at<=NOW()
+			)
+			AND NOT EXISTS (
+				SELECT
+					1
+				FROM
+					outbox b
+				WHERE
+					b.aggregate_type=o.aggregate_type
+					AND b.aggregate_id=o.aggregate_id
+					AND b.id<o.id
+					AND b.published_at IS NULL
+					AND b.dead_at IS NULL
+					AND b.next_attempt_at>NOW()
+			)
+		ORDER BY
+			o.id ASC
+		LIMIT
+			@limit
+	`
+
+	rows, err := tx.Query(ctx, stmt, pgx.NamedArgs{
+		"limit": limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get pending outbox query: %w", err)
+	}
+
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByName[outbox.Message])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows from table:outbox: %w", err)
+	}
+
+	return items, nil
+}
+
+func (r *OutboxRepository) MarkPublished(ctx context.Context, tx pgx.Tx, ids []int64) error {
+	stmt := `
+		UPDATE outbox
+		SET
+			published_at=NOW(),
+			attempts=attempts + 1,
+			last_error=NULL,
+			next_attempt_at=NULL
+		WHERE
+			id=ANY(@ids)
+	`
+
+	if _, err := tx.Exec(ctx, stmt, pgx.NamedArgs{
+		"ids": ids,
+	}); err != nil {
+		return fmt.Errorf("failed to execute mark outbox published query: %w", err)
+	}
+
+	return nil
+}
+
+// RecordFailure schedules another attempt, or parks the message when dead is set
+func (r *OutboxRepository) RecordFailure(ctx context.Context, tx pgx.Tx, id int64, lastError string, nextAttemptAt time.Time, dead bool) error {
+	stmt := `
+		UPDATE outbox
+		SET
+			attempts=attempts + 1,
+			last_error=@last_error,
+			next_attempt_at=@next_attempt_at,
+			dead_at=CASE
+				WHEN @dead THEN NOW()
+				ELSE NULL
+			END
+		WHERE
+			id=@id
+	`
+
+	if _, err := tx.Exec(ctx, stmt, pgx.NamedArgs{
+		"id":              id,
+		"last_error":      lastError,
+		"next_attempt_at": nextAttemptAt,
+		"dead":            dead,
+	}); err != nil {
+		return fmt.Errorf("failed to record outbox failure for outbox_id=%d: %w", id, err)
+	}
+
+	return nil
+}
+
+func (r *OutboxRepository) DeletePublishedBefore(ctx context.Context, before time.Time) (int64, error) {
+	stmt := `
+		DELETE FROM outbox
+		WHERE
+			published_at<@before
+	`
+
+	result, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"before": before,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute delete published outbox query: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
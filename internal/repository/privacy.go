@@ -0,0 +1,463 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/goku-m/starter/internal/model/apitoken"
+	"github.com/goku-m/starter/internal/model/event"
+	"github.com/goku-m/starter/internal/model/privacy"
+	"github.com/goku-m/starter/internal/model/todo"
+	"github.com/goku-m/starter/internal/model/user"
+	"github.com/goku-m/starter/internal/model/webhook"
+	"github.com/goku-m/starter/internal/server"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// userDataTables lists every table holding rows keyed by user_id, in the order erasure
+// deletes them. Tables that reference these, such as webhook_deliveries, cascade.
+// GetUserData exports each of them unless noted here, so add new tables to both.
+var userDataTables = []string{
+	"todos",
+	"webhooks",
+	"events",
+	// Not exported: undelivered copies of events, which are exported themselves
+	"outbox",
+	// Not exported: cached responses of requests already reflected in the other tables
+	"idempotency_keys",
+	"data_exports",
+	// Exported through the session store, which may keep them in Redis instead
+	"sessions",
+	"api_tokens",
+}
+
+type PrivacyRepository struct {
+	server *server.Server
+}
+
+func NewPrivacyRepository(server *server.Server) *PrivacyRepository {
+	return &PrivacyRepository{server: server}
+}
+
+const dataExportColumns = `
+	id,
+	created_at,
+	updated_at,
+	user_id,
+	email,
+	status,
+	expires_at,
+	completed_at,
+	error
+`
+
+func (r *PrivacyRepository) CreateExport(ctx context.Context, userID, email string) (*privacy.DataExport, error) {
+	stmt := `
+		INSERT INTO
+			data_exports (user_id, email)
+		VALUES
+			(@user_id, @email)
+		RETURNING
+	` + dataExportColumns
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"user_id": userID,
+		"email":   email,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute create data export query for user_id=%s: %w", userID, err)
+	}
+
+	export, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[privacy.DataExport])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:data_exports for user_id=%s: %w", userID, err)
+	}
+
+	return &export, nil
+}
+
+func (r *PrivacyRepository) GetExportByID(ctx context.Context, exportID uuid.UUID) (*privacy.DataExport, error) {
+	stmt := `
+		SELECT
+	` + dataExportColumns + `
+		FROM
+			data_exports
+		WHERE
+			id=@id
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"id": exportID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get data export query for export_id=%s: %w", exportID.String(), err)
+	}
+
+	export, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[privacy.DataExport])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:data_exports for export_id=%s: %w", exportID.String(), err)
+	}
+
+	return &export, nil
+}
+
+func (r *PrivacyRepository) CompleteExport(ctx context.Context, exportID uuid.UUID, archive []byte, tokenHash string, expiresAt time.Time) error {
+	stmt := `
+		UPDATE data_exports
+		SET
+			status='ready',
+			archive=@archive,
+			token_hash=@token_hash,
+			expires_at=@expires_at,
+			completed_at=NOW(),
+			error=NULL
+		WHERE
+			id=@id
+	`
+
+	if _, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"id":         exportID,
+		"archive":    archive,
+		"token_hash": tokenHash,
+		"expires_at": expiresAt,
+	}); err != nil {
+		return fmt.Errorf("failed to execute complete data export query for export_id=%s: %w", exportID.String(), err)
+	}
+
+	return nil
+}
+
+func (r *PrivacyRepository) FailExport(ctx context.Context, exportID uuid.UUID, message string) error {
+	stmt := `
+		UPDATE data_exports
+		SET
+			status='failed',
+			error=@error
+		WHERE
+			id=@id
+	`
+
+	if _, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"id":    exportID,
+		"error": message,
+	}); err != nil {
+		return fmt.Errorf("failed to execute fail data export query for export_id=%s: %w", exportID.String(), err)
+	}
+
+	return nil
+}
+
+// GetExportArchive returns the archive of a ready, unexpired export whose download
+// token hashes to tokenHash
+func (r *PrivacyRepository) GetExportArchive(ctx context.Context, exportID uuid.UUID, tokenHash string) ([]byte, error) {
+	stmt := `
+		SELECT
+			archive
+		FROM
+			data_exports
+		WHERE
+			id=@id
+			AND token_hash=@token_hash
+			AND status='ready'
+			AND expires_at>NOW()
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"id":         exportID,
+		"token_hash": tokenHash,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get data export archive query for export_id=%s: %w", exportID.String(), err)
+	}
+
+	archive, err := pgx.CollectOneRow(rows, pgx.RowTo[[]byte])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:data_exports for export_id=%s: %w", exportID.String(), err)
+	}
+
+	return archive, nil
+}
+
+// DeleteExpiredExportArchives drops archives past their download window and keeps
+// the request rows
+func (r *PrivacyRepository) DeleteExpiredExportArchives(ctx context.Context) (int64, error) {
+	stmt := `
+		UPDATE data_exports
+		SET
+			archive=NULL,
+			token_hash=NULL
+		WHERE
+			archive IS NOT NULL
+			AND expires_at<NOW()
+	`
+
+	result, err := r.server.DB.Querier(ctx).Exec(ctx, stmt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute delete expired data export archives query: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// GetUserData reads everything stored about the user in one snapshot. Sessions are left
+// to the session store, and secrets such as recovery codes and magic links are left out.
+func (r *PrivacyRepository) GetUserData(ctx context.Context, userID string) (*privacy.UserData, error) {
+	// Built-in accounts are keyed by id rather than user_id, as in EraseUserData
+	accountStmt := `
+		SELECT
+			*
+		FROM
+			users
+		WHERE
+			id::text=@user_id
+	`
+
+	identitiesStmt := `
+		SELECT
+			*
+		FROM
+			user_identities
+		WHERE
+			user_id::text=@user_id
+		ORDER BY
+			created_at ASC
+	`
+
+	apiTokensStmt := `
+		SELECT
+			*
+		FROM
+			api_tokens
+		WHERE
+			user_id=@user_id
+		ORDER BY
+			created_at ASC
+	`
+
+	todosStmt := `
+		SELECT
+			*
+		FROM
+			todos
+		WHERE
+			user_id=@user_id
+		ORDER BY
+			created_at ASC
+	`
+
+	webhooksStmt := `
+		SELECT
+			*
+		FROM
+			webhooks
+		WHERE
+			user_id=@user_id
+		ORDER BY
+			created_at ASC
+	`
+
+	deliveriesStmt := `
+		SELECT
+			d.*
+		FROM
+			webhook_deliveries d
+			JOIN webhooks w ON w.id=d.webhook_id
+		WHERE
+			w.user_id=@user_id
+		ORDER BY
+			d.created_at ASC
+	`
+
+	eventsStmt := `
+		SELECT
+			*
+		FROM
+			events
+		WHERE
+			user_id=@user_id
+		ORDER BY
+			id ASC
+	`
+
+	exportsStmt := `
+		SELECT
+	` + dataExportColumns + `
+		FROM
+			data_exports
+		WHERE
+			user_id=@user_id
+		ORDER BY
+			created_at ASC
+	`
+
+	args := pgx.NamedArgs{"user_id": userID}
+	data := &privacy.UserData{}
+
+	err := r.server.DB.InTx(ctx, func(ctx context.Context) error {
+		q := r.server.DB.Querier(ctx)
+
+		// One snapshot, so rows written while the export runs can't half appear
+		if _, err := q.Exec(ctx, "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ READ ONLY"); err != nil {
+			return fmt.Errorf("failed to set export transaction isolation for user_id=%s: %w", userID, err)
+		}
+
+		rows, err := q.Query(ctx, accountStmt, args)
+		if err != nil {
+			return fmt.Errorf("failed to execute export account query for user_id=%s: %w", userID, err)
+		}
+		accounts, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[user.User])
+		if err != nil {
+			return fmt.Errorf("failed to collect rows from table:users for user_id=%s: %w", userID, err)
+		}
+		if len(accounts) > 0 {
+			data.Account = accounts[0]
+		}
+
+		rows, err = q.Query(ctx, identitiesStmt, args)
+		if err != nil {
+			return fmt.Errorf("failed to execute export identities query for user_id=%s: %w", userID, err)
+		}
+		if data.Identities, err = pgx.CollectRows(rows, pgx.RowToStructByName[user.Identity]); err != nil {
+			return fmt.Errorf("failed to collect rows from table:user_identities for user_id=%s: %w", userID, err)
+		}
+
+		rows, err = q.Query(ctx, apiTokensStmt, args)
+		if err != nil {
+			return fmt.Errorf("failed to execute export api tokens query for user_id=%s: %w", userID, err)
+		}
+		if data.APITokens, err = pgx.CollectRows(rows, pgx.RowToStructByName[apitoken.APIToken]); err != nil {
+			return fmt.Errorf("failed to collect rows from table:api_tokens for user_id=%s: %w", userID, err)
+		}
+
+		rows, err = q.Query(ctx, todosStmt, args)
+		if err != nil {
+			return fmt.Errorf("failed to execute export todos query for user_id=%s: %w", userID, err)
+		}
+		if data.Todos, err = pgx.CollectRows(rows, pgx.RowToStructByName[todo.Todo]); err != nil {
+			return fmt.Errorf("failed to collect rows from table:todos for user_id=%s: %w", userID, err)
+		}
+
+		rows, err = q.Query(ctx, webhooksStmt, args)
+		if err != nil {
+			return fmt.Errorf("failed to execute export webhooks query for user_id=%s: %w", userID, err)
+		}
+		if data.Webhooks, err = pgx.CollectRows(rows, pgx.RowToStructByName[webhook.Webhook]); err != nil {
+			return fmt.Errorf("failed to collect rows from table:webhooks for user_id=%s: %w", userID, err)
+		}
+
+		rows, err = q.Query(ctx, deliveriesStmt, args)
+		if err != nil {
+			return fmt.Errorf("failed to execute export webhook deliveries query for user_id=%s: %w", userID, err)
+		}
+		if data.Deliveries, err = pgx.CollectRows(rows, pgx.RowToStructByName[webhook.Delivery]); err != nil {
+			return fmt.Errorf("failed to collect rows from table:webhook_deliveries for user_id=%s: %w", userID, err)
+		}
+
+		rows, err = q.Query(ctx, eventsStmt, args)
+		if err != nil {
+			return fmt.Errorf("failed to execute export events query for user_id=%s: %w", userID, err)
+		}
+		if data.Events, err = pgx.CollectRows(rows, pgx.RowToStructByName[event.Event]); err != nil {
+			return fmt.Errorf("failed to collect rows from table:events for user_id=%s: %w", userID, err)
+		}
+
+		rows, err = q.Query(ctx, exportsStmt, args)
+		if err != nil {
+			return fmt.Errorf("failed to execute export data exports query for user_id=%s: %w", userID, err)
+		}
+		if data.Exports, err = pgx.CollectRows(rows, pgx.RowToStructByName[privacy.DataExport]); err != nil {
+			return fmt.Errorf("failed to collect rows from table:data_exports for user_id=%s: %w", userID, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// GetTodoIDs lists the user's todo ids so their cache entries can be dropped after erasure
+func (r *PrivacyRepository) GetTodoIDs(ctx context.Context, userID string) ([]uuid.UUID, error) {
+	stmt := `
+		SELECT
+			id
+		FROM
+			todos
+		WHERE
+			user_id=@user_id
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"user_id": userID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get todo ids query for user_id=%s: %w", userID, err)
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows from table:todos for user_id=%s: %w", userID, err)
+	}
+
+	return ids, nil
+}
+
+// EraseUserData deletes every row keyed by the user and returns how many rows each
+// table lost. It runs in the caller's unit of work so the audit record commits with it.
+func (r *PrivacyRepository) EraseUserData(ctx context.Context, userID string) (map[string]int64, error) {
+	deleted := make(map[string]int64, len(userDataTables))
+	q := r.server.DB.Querier(ctx)
+
+	for _, table := range userDataTables {
+		// Table names come from userDataTables, never from input
+		result, err := q.Exec(ctx, "DELETE FROM "+table+" WHERE user_id=@user_id", pgx.NamedArgs{
+			"user_id": userID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute erase query on table:%s for user_id=%s: %w", table, userID, err)
+		}
+		deleted[table] = result.RowsAffected()
+	}
+
+	// Built-in accounts are keyed by id rather than user_id; other ids simply match nothing
+	result, err := q.Exec(ctx, "DELETE FROM users WHERE id::text=@user_id", pgx.NamedArgs{
+		"user_id": userID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute erase query on table:users for user_id=%s: %w", userID, err)
+	}
+	deleted["users"] = result.RowsAffected()
+
+	return deleted, nil
+}
+
+func (r *PrivacyRepository) CreateErasureRecord(ctx context.Context, subjectHash string, requestID *string, deletedRows map[string]int64) (*privacy.ErasureRecord, error) {
+	stmt := `
+		INSERT INTO
+			erasure_audit (subject_hash, request_id, deleted_rows)
+		VALUES
+			(@subject_hash, @request_id, @deleted_rows)
+		RETURNING
+			*
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"subject_hash": subjectHash,
+		"request_id":   requestID,
+		"deleted_rows": deletedRows,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute create erasure record query: %w", err)
+	}
+
+	record, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[privacy.ErasureRecord])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:erasure_audit: %w", err)
+	}
+
+	return &record, nil
+}
@@ -1,13 +1,32 @@
 package repository
 
-import "github.com/goku-m/starter/internal/server"
+import (
+	"github.com/goku-m/starter/internal/lib/session"
+	"github.com/goku-m/starter/internal/server"
+)
 
 type Repositories struct {
-	Todo *TodoRepository
+	Todo     *TodoRepository
+	Webhook  *WebhookRepository
+	Event    *EventRepository
+	Outbox   *OutboxRepository
+	Privacy  *PrivacyRepository
+	User     *UserRepository
+	Session  session.Store
+	APIToken *APITokenRepository
 }
 
 func NewRepositories(s *server.Server) *Repositories {
+	outbox := NewOutboxRepository(s)
+
 	return &Repositories{
-		Todo: NewTodoRepository(s),
+		Todo:     NewTodoRepository(s, outbox),
+		Webhook:  NewWebhookRepository(s),
+		Event:    NewEventRepository(s),
+		Outbox:   outbox,
+		Privacy:  NewPrivacyRepository(s),
+		User:     NewUserRepository(s),
+		Session:  NewSessionStore(s),
+		APIToken: NewAPITokenRepository(s),
 	}
 }
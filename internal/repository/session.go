@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/goku-m/starter/internal/lib/session"
+	"github.com/goku-m/starter/internal/server"
+	"github.com/jackc/pgx/v5"
+)
+
+// NewSessionStore keeps sessions in Redis when auth.session_store asks for it and
+// Redis is configured, and in Postgres otherwise
+func NewSessionStore(s *server.Server) session.Store {
+	if s.Config.Auth.SessionStore == "redis" && s.Redis != nil {
+		return session.NewRedisStore(s.Redis, "starter:sessions:")
+	}
+	return NewSessionRepository(s)
+}
+
+// SessionRepository is the Postgres session.Store
+type SessionRepository struct {
+	server *server.Server
+}
+
+func NewSessionRepository(server *server.Server) *SessionRepository {
+	return &SessionRepository{server: server}
+}
+
+func (r *SessionRepository) Create(ctx context.Context, s *session.Session) error {
+	stmt := `
+		INSERT INTO
+			sessions (id, user_id, role, expires_at, last_seen_at, ip, user_agent)
+		VALUES
+			(@id, @user_id, @role, @expires_at, @last_seen_at, @ip, @user_agent)
+	`
+
+	if _, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"id":           s.ID,
+		"user_id":      s.UserID,
+		"role":         s.Role,
+		"expires_at":   s.ExpiresAt,
+		"last_seen_at": s.LastSeenAt,
+		"ip":           s.IP,
+		"user_agent":   s.UserAgent,
+	}); err != nil {
+		return fmt.Errorf("failed to execute create session query for user_id=%s: %w", s.UserID, err)
+	}
+
+	return nil
+}
+
+func (r *SessionRepository) Get(ctx context.Context, id string) (*session.Session, error) {
+	stmt := `
+		SELECT
+			*
+		FROM
+			sessions
+		WHERE
+			id=@id
+			AND expires_at>NOW()
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"id": id,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get session query: %w", err)
+	}
+
+	s, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[session.Session])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, session.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to collect row from table:sessions: %w", err)
+	}
+
+	return &s, nil
+}
+
+func (r *SessionRepository) List(ctx context.Context, userID string) ([]session.Session, error) {
+	stmt := `
+		SELECT
+			*
+		FROM
+			sessions
+		WHERE
+			user_id=@user_id
+			AND expires_at>NOW()
+		ORDER BY
+			last_seen_at DESC
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"user_id": userID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute list sessions query for user_id=%s: %w", userID, err)
+	}
+
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByName[session.Session])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows from table:sessions for user_id=%s: %w", userID, err)
+	}
+
+	return items, nil
+}
+
+func (r *SessionRepository) Touch(ctx context.Context, id string, lastSeenAt, expiresAt time.Time) error {
+	stmt := `
+		UPDATE sessions
+		SET
+			last_seen_at=@last_seen_at,
+			expires_at=@expires_at
+		WHERE
+			id=@id
+	`
+
+	if _, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"id":           id,
+		"last_seen_at": lastSeenAt,
+		"expires_at":   expiresAt,
+	}); err != nil {
+		return fmt.Errorf("failed to execute touch session query: %w", err)
+	}
+
+	return nil
+}
+
+// Delete also sweeps expired sessions, which Get already ignores, so the table doesn't grow
+func (r *SessionRepository) Delete(ctx context.Context, id string) error {
+	stmt := `
+		DELETE FROM sessions
+		WHERE
+			id=@id
+			OR expires_at<NOW()
+	`
+
+	if _, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"id": id,
+	}); err != nil {
+		return fmt.Errorf("failed to execute delete session query: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SessionRepository) DeleteForUser(ctx context.Context, userID string, except ...string) error {
+	stmt := `
+		DELETE FROM sessions
+		WHERE
+			user_id=@user_id
+			AND id<>ALL(@except)
+	`
+
+	// A nil slice is sent as NULL, which would match nothing
+	if except == nil {
+		except = []string{}
+	}
+
+	if _, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"user_id": userID,
+		"except":  except,
+	}); err != nil {
+		return fmt.Errorf("failed to execute delete sessions query for user_id=%s: %w", userID, err)
+	}
+
+	return nil
+}
@@ -2,25 +2,56 @@ package repository
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"strings"
 	"time"
 
+	"github.com/goku-m/starter/internal/database"
 	"github.com/goku-m/starter/internal/errs"
 	"github.com/goku-m/starter/internal/model"
+	"github.com/goku-m/starter/internal/model/event"
+	"github.com/goku-m/starter/internal/model/outbox"
 	"github.com/goku-m/starter/internal/model/todo"
+	"github.com/goku-m/starter/internal/model/webhook"
 	"github.com/goku-m/starter/internal/server"
+	"github.com/goku-m/starter/internal/sqlb"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 )
 
 type TodoRepository struct {
 	server *server.Server
+	outbox *OutboxRepository
 }
 
-func NewTodoRepository(server *server.Server) *TodoRepository {
-	return &TodoRepository{server: server}
+func NewTodoRepository(server *server.Server, outbox *OutboxRepository) *TodoRepository {
+	return &TodoRepository{server: server, outbox: outbox}
+}
+
+// withOutbox runs fn in a transaction and records the events it returns in the same
+// transaction. Events are inserted after the todo write, so the row lock it takes keeps
+// outbox ids in commit order for each todo. Inside a unit of work it uses a savepoint
+// and the events are committed with the outer transaction.
+func (r *TodoRepository) withOutbox(ctx context.Context, fn func(tx pgx.Tx) ([]outbox.Event, error)) error {
+	return r.server.DB.InTx(ctx, func(ctx context.Context) error {
+		tx, _ := database.TxFromContext(ctx)
+
+		events, err := fn(tx)
+		if err != nil {
+			return err
+		}
+
+		return r.outbox.AddEvents(ctx, tx, events...)
+	})
+}
+
+func todoEvent(eventType, userID string, todoID uuid.UUID, payload any) outbox.Event {
+	return outbox.Event{
+		AggregateType: outbox.AggregateTodo,
+		AggregateID:   todoID.String(),
+		Type:          eventType,
+		UserID:        userID,
+		Payload:       payload,
+	}
 }
 
 func (r *TodoRepository) CreateTodo(ctx context.Context, userID string, payload *todo.CreateTodoPayload) (*todo.Todo, error) {
@@ -31,16 +62,17 @@ func (r *TodoRepository) CreateTodo(ctx context.Context, userID string, payload
 				title,
 				description,
 				priority,
-				due_date
-							)
+				due_date,
+				tags
+			)
 		VALUES
 			(
 				@user_id,
 				@title,
 				@description,
 				@priority,
-				@due_date
-				
+				@due_date,
+				@tags
 			)
 		RETURNING
 		*
@@ -49,21 +81,36 @@ func (r *TodoRepository) CreateTodo(ctx context.Context, userID string, payload
 	if payload.Priority != nil {
 		priority = *payload.Priority
 	}
-
-	rows, err := r.server.DB.Pool.Query(ctx, stmt, pgx.NamedArgs{
-		"user_id":     userID,
-		"title":       payload.Title,
-		"description": payload.Description,
-		"priority":    priority,
-		"due_date":    payload.DueDate,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute create todo query for user_id=%s title=%s: %w", userID, payload.Title, err)
+	tags := payload.Tags
+	if tags == nil {
+		tags = []string{}
 	}
 
-	todoItem, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[todo.Todo])
+	var todoItem todo.Todo
+	err := r.withOutbox(ctx, func(tx pgx.Tx) ([]outbox.Event, error) {
+		rows, err := tx.Query(ctx, stmt, pgx.NamedArgs{
+			"user_id":     userID,
+			"title":       payload.Title,
+			"description": payload.Description,
+			"priority":    priority,
+			"due_date":    payload.DueDate,
+			"tags":        tags,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute create todo query for user_id=%s title=%s: %w", userID, payload.Title, err)
+		}
+
+		todoItem, err = pgx.CollectOneRow(rows, pgx.RowToStructByName[todo.Todo])
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect row from table:todos for user_id=%s title=%s: %w", userID, payload.Title, err)
+		}
+
+		return []outbox.Event{
+			todoEvent(string(webhook.EventTodoCreated), userID, todoItem.ID, todoItem),
+		}, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to collect row from table:todos for user_id=%s title=%s: %w", userID, payload.Title, err)
+		return nil, err
 	}
 
 	return &todoItem, nil
@@ -85,7 +132,7 @@ func (r *TodoRepository) GetTodoByID(ctx context.Context, userID string, todoID
 		
 `
 
-	rows, err := r.server.DB.Pool.Query(ctx, stmt, pgx.NamedArgs{
+	rows, err := r.server.DB.Reader(ctx).Query(ctx, stmt, pgx.NamedArgs{
 		"id":      todoID,
 		"user_id": userID,
 	})
@@ -101,6 +148,34 @@ func (r *TodoRepository) GetTodoByID(ctx context.Context, userID string, todoID
 	return &todoItem, nil
 }
 
+// GetTodosByIDs loads several of the user's todos in one query; ids that don't match are skipped
+func (r *TodoRepository) GetTodosByIDs(ctx context.Context, userID string, todoIDs []uuid.UUID) ([]todo.PopulatedTodo, error) {
+	stmt := `
+		SELECT
+			t.*
+		FROM
+			todos t
+		WHERE
+			t.id=ANY(@ids)
+			AND t.user_id=@user_id
+	`
+
+	rows, err := r.server.DB.Reader(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"ids":     todoIDs,
+		"user_id": userID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get todos by ids query for user_id=%s: %w", userID, err)
+	}
+
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByName[todo.PopulatedTodo])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows from table:todos for user_id=%s: %w", userID, err)
+	}
+
+	return items, nil
+}
+
 func (r *TodoRepository) CheckTodoExists(ctx context.Context, userID string, todoID uuid.UUID) (*todo.Todo, error) {
 	stmt := `
 		SELECT
@@ -112,7 +187,7 @@ func (r *TodoRepository) CheckTodoExists(ctx context.Context, userID string, tod
 			AND user_id=@user_id
 	`
 
-	rows, err := r.server.DB.Pool.Query(ctx, stmt, pgx.NamedArgs{
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
 		"id":      todoID,
 		"user_id": userID,
 	})
@@ -128,132 +203,110 @@ func (r *TodoRepository) CheckTodoExists(ctx context.Context, userID string, tod
 	return &todoItem, nil
 }
 
+// todoSortColumns whitelists the columns GetTodos can sort by
+var todoSortColumns = sqlb.Columns{
+	"created_at": "t.created_at",
+	"updated_at": "t.updated_at",
+	"title":      "t.title",
+	"priority":   "t.priority",
+	"status":     "t.status",
+	"due_date":   "t.due_date",
+}
+
 func (r *TodoRepository) GetTodos(
 	ctx context.Context,
+	userID string,
 	query *todo.GetTodosQuery,
 ) (*model.PaginatedResponse[todo.PopulatedTodo], error) {
+	if query == nil {
+		query = &todo.GetTodosQuery{}
+	}
 
-	stmt := `
-	SELECT
-		t.*
-	FROM
-		todos t
-	`
-
-	args := pgx.NamedArgs{}
-	conditions := []string{}
+	builder := sqlb.Select("t.*").From("todos t").WhereEq("t.user_id", userID)
 
-	if query != nil {
-		if query.Status != nil {
-			conditions = append(conditions, "t.status = @status")
-			args["status"] = *query.Status
-		}
+	if query.Status != nil {
+		builder.WhereEq("t.status", query.Status)
+	}
 
-		if query.Priority != nil {
-			conditions = append(conditions, "t.priority = @priority")
-			args["priority"] = *query.Priority
-		}
+	if query.Priority != nil {
+		builder.WhereEq("t.priority", query.Priority)
+	}
 
-		if query.Completed != nil {
-			if *query.Completed {
-				conditions = append(conditions, "t.status = 'completed'")
-			} else {
-				conditions = append(conditions, "t.status != 'completed'")
-			}
+	if query.Completed != nil {
+		if *query.Completed {
+			builder.Where("t.status = 'completed'")
+		} else {
+			builder.Where("t.status != 'completed'")
 		}
+	}
 
-		if query.Search != nil {
-			conditions = append(conditions, "(t.title ILIKE @search OR t.description ILIKE @search)")
-			args["search"] = "%" + *query.Search + "%"
+	if query.Overdue != nil {
+		if *query.Overdue {
+			builder.Where("t.due_date < NOW() AND t.status != 'completed'")
+		} else {
+			builder.Where("(t.due_date IS NULL OR t.due_date >= NOW() OR t.status = 'completed')")
 		}
 	}
 
-	if len(conditions) > 0 {
-		stmt += " WHERE " + strings.Join(conditions, " AND ")
+	if query.Search != nil {
+		builder.Where("(t.title ILIKE @search OR t.description ILIKE @search)", sqlb.Named("search", "%"+*query.Search+"%"))
 	}
 
-	// ----- count query -----
-	countStmt := "SELECT COUNT(*) FROM todos t"
-	if len(conditions) > 0 {
-		countStmt += " WHERE " + strings.Join(conditions, " AND ")
+	// Snoozed todos are hidden unless explicitly asked for
+	if query.Snoozed != nil && *query.Snoozed {
+		builder.Where("t.snoozed_until > NOW()")
+	} else {
+		builder.Where("(t.snoozed_until IS NULL OR t.snoozed_until <= NOW())")
 	}
 
-	// If server/DB/Pool can be nil in your wiring, you may also want to guard here:
-	// if r == nil || r.server == nil || r.server.DB == nil || r.server.DB.Pool == nil { ... }
+	// Count and page come from the same server so they agree
+	reader := r.server.DB.Reader(ctx)
+
+	countStmt, countArgs, err := builder.Count()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build todos count query: %w", err)
+	}
 
 	var total int
-	err := r.server.DB.Pool.QueryRow(ctx, countStmt, args).Scan(&total)
+	err = reader.QueryRow(ctx, countStmt, countArgs).Scan(&total)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get total count for todos: %w", err)
 	}
 
-	// You don't need GROUP BY for "SELECT t.*" from a single table.
-	// But keeping your intent: remove it to avoid unnecessary work.
-	// stmt += " GROUP BY t.id"
-
-	// ----- safe defaults for pagination -----
 	page := 1
-	limit := 10
-	if query != nil {
-		if query.Page != nil && *query.Page > 0 {
-			page = *query.Page
-		}
-		if query.Limit != nil && *query.Limit > 0 {
-			limit = *query.Limit
-		}
+	if query.Page != nil && *query.Page > 0 {
+		page = *query.Page
 	}
-
-	// ----- safe sorting (whitelist to prevent SQL injection) -----
-	sortCol := "created_at"
-	orderDesc := true
-
-	allowedSort := map[string]bool{
-		"created_at": true,
-		"title":      true,
-		"priority":   true,
-		"status":     true,
-		"updated_at": true,
+	limit := 10
+	if query.Limit != nil && *query.Limit > 0 {
+		limit = *query.Limit
 	}
 
-	if query != nil && query.Sort != nil && allowedSort[*query.Sort] {
-		sortCol = *query.Sort
+	sort := "created_at"
+	if query.Sort != nil {
+		sort = *query.Sort
 	}
-
-	if query != nil && query.Order != nil && strings.EqualFold(*query.Order, "desc") {
-		orderDesc = true
+	direction := sqlb.Desc
+	if query.Order != nil {
+		direction = sqlb.ParseDirection(*query.Order, sqlb.Desc)
 	}
 
-	stmt += " ORDER BY t." + sortCol
-	if orderDesc {
-		stmt += " DESC"
-	} else {
-		stmt += " ASC"
+	stmt, args, err := builder.
+		OrderBy(todoSortColumns.Resolve(sort, "created_at"), direction).
+		OrderBy("t.id", direction).
+		Page(page, limit).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build get todos query: %w", err)
 	}
 
-	// ----- pagination -----
-	stmt += " LIMIT @limit OFFSET @offset"
-	args["limit"] = limit
-	args["offset"] = (page - 1) * limit
-
-	rows, err := r.server.DB.Pool.Query(ctx, stmt, args)
+	rows, err := reader.Query(ctx, stmt, args)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute get todos query: %w", err)
 	}
-	defer rows.Close()
 
 	todos, err := pgx.CollectRows(rows, pgx.RowToStructByName[todo.PopulatedTodo])
 	if err != nil {
-		// NOTE: CollectRows typically returns nil error with empty slice if no rows,
-		// but keeping your fallback logic is fine.
-		if errors.Is(err, pgx.ErrNoRows) {
-			return &model.PaginatedResponse[todo.PopulatedTodo]{
-				Data:       []todo.PopulatedTodo{},
-				Page:       page,
-				Limit:      limit,
-				Total:      0,
-				TotalPages: 0,
-			}, nil
-		}
 		return nil, fmt.Errorf("failed to collect rows from table:todos: %w", err)
 	}
 
@@ -267,59 +320,178 @@ func (r *TodoRepository) GetTodos(
 }
 
 func (r *TodoRepository) UpdateTodo(ctx context.Context, userID string, payload *todo.UpdateTodoPayload) (*todo.Todo, error) {
-	stmt := "UPDATE todos SET "
-	args := pgx.NamedArgs{
-		"todo_id": payload.ID,
-		"user_id": userID,
+	builder := sqlb.Update("todos").
+		SetOptional("title", payload.Title).
+		SetOptional("description", payload.Description).
+		SetOptional("status", payload.Status).
+		SetOptional("priority", payload.Priority)
+
+	// Keep completed_at in step with the status; completing again keeps the first time
+	if payload.Status != nil {
+		if *payload.Status == todo.StatusCompleted {
+			builder.SetExpr("completed_at", "COALESCE(completed_at, NOW())")
+		} else {
+			builder.SetExpr("completed_at", "NULL")
+		}
 	}
-	setClauses := []string{}
 
-	if payload.Title != nil {
-		setClauses = append(setClauses, "title = @title")
-		args["title"] = *payload.Title
+	if builder.Empty() {
+		return nil, errs.NewBadRequestError("no fields to update", false, nil, nil, nil)
 	}
 
-	if payload.Description != nil {
-		setClauses = append(setClauses, "description = @description")
-		args["description"] = *payload.Description
+	stmt, args, err := builder.
+		WhereEq("id", payload.ID).
+		WhereEq("user_id", userID).
+		Returning("*").
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build update todo query: %w", err)
 	}
 
-	if payload.Status != nil {
-		setClauses = append(setClauses, "status = @status")
-		args["status"] = *payload.Status
+	// The status before the update, locked so a concurrent update can't also see the
+	// todo as not yet completed
+	statusStmt := `
+		SELECT
+			status
+		FROM
+			todos
+		WHERE
+			id=@todo_id
+			AND user_id=@user_id
+		FOR UPDATE
+	`
 
-		// Auto-set completed_at when status changes to completed
-		if *payload.Status == todo.StatusCompleted {
-			setClauses = append(setClauses, "completed_at = @completed_at")
-			args["completed_at"] = time.Now()
-		} else if *payload.Status != todo.StatusCompleted {
-			setClauses = append(setClauses, "completed_at = NULL")
+	var updatedTodo todo.Todo
+	err = r.withOutbox(ctx, func(tx pgx.Tx) ([]outbox.Event, error) {
+		var previousStatus todo.Status
+		if payload.Status != nil {
+			err := tx.QueryRow(ctx, statusStmt, pgx.NamedArgs{
+				"todo_id": payload.ID,
+				"user_id": userID,
+			}).Scan(&previousStatus)
+			if err != nil {
+				return nil, fmt.Errorf("failed to execute get todo status query for todo_id=%s user_id=%s: %w", payload.ID.String(), userID, err)
+			}
 		}
-	}
 
-	if payload.Priority != nil {
-		setClauses = append(setClauses, "priority = @priority")
-		args["priority"] = *payload.Priority
-	}
+		rows, err := tx.Query(ctx, stmt, args)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute query: %w", err)
+		}
 
-	if len(setClauses) == 0 {
-		return nil, errs.NewBadRequestError("no fields to update", false, nil, nil, nil)
-	}
+		updatedTodo, err = pgx.CollectOneRow(rows, pgx.RowToStructByName[todo.Todo])
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect row from table:todos: %w", err)
+		}
 
-	stmt += strings.Join(setClauses, ", ")
-	stmt += " WHERE id = @todo_id AND user_id = @user_id RETURNING *"
+		events := []outbox.Event{
+			todoEvent(string(webhook.EventTodoUpdated), userID, updatedTodo.ID, updatedTodo),
+		}
+		if payload.Status != nil && previousStatus != todo.StatusCompleted && updatedTodo.Status == todo.StatusCompleted {
+			events = append(events, todoEvent(string(webhook.EventTodoCompleted), userID, updatedTodo.ID, updatedTodo))
+		}
 
-	rows, err := r.server.DB.Pool.Query(ctx, stmt, args)
+		return events, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
+		return nil, err
 	}
 
-	updatedTodo, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[todo.Todo])
+	return &updatedTodo, nil
+}
+
+// PatchTodo locks the todo, lets apply compute its new editable fields from the current
+// row and writes them back in the same transaction
+func (r *TodoRepository) PatchTodo(ctx context.Context, userID string, todoID uuid.UUID, apply func(current *todo.Todo) (*todo.TodoDocument, error)) (*todo.Todo, error) {
+	selectStmt := `
+		SELECT
+			*
+		FROM
+			todos
+		WHERE
+			id=@todo_id
+			AND user_id=@user_id
+		FOR UPDATE
+	`
+
+	updateStmt := `
+		UPDATE todos
+		SET
+			title=@title,
+			description=@description,
+			status=@status,
+			priority=@priority,
+			due_date=@due_date,
+			tags=@tags,
+			completed_at=CASE
+				WHEN @status='completed' THEN COALESCE(completed_at, NOW())
+				ELSE NULL
+			END
+		WHERE
+			id=@todo_id
+			AND user_id=@user_id
+		RETURNING
+			*
+	`
+
+	var patchedTodo todo.Todo
+	err := r.withOutbox(ctx, func(tx pgx.Tx) ([]outbox.Event, error) {
+		rows, err := tx.Query(ctx, selectStmt, pgx.NamedArgs{
+			"todo_id": todoID,
+			"user_id": userID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute get todo for patch query for todo_id=%s user_id=%s: %w", todoID.String(), userID, err)
+		}
+
+		current, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[todo.Todo])
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect row from table:todos for todo_id=%s user_id=%s: %w", todoID.String(), userID, err)
+		}
+
+		doc, err := apply(&current)
+		if err != nil {
+			return nil, err
+		}
+
+		tags := doc.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+
+		rows, err = tx.Query(ctx, updateStmt, pgx.NamedArgs{
+			"todo_id":     todoID,
+			"user_id":     userID,
+			"title":       doc.Title,
+			"description": doc.Description,
+			"status":      doc.Status,
+			"priority":    doc.Priority,
+			"due_date":    doc.DueDate,
+			"tags":        tags,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute patch todo query for todo_id=%s user_id=%s: %w", todoID.String(), userID, err)
+		}
+
+		patchedTodo, err = pgx.CollectOneRow(rows, pgx.RowToStructByName[todo.Todo])
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect row from table:todos for todo_id=%s user_id=%s: %w", todoID.String(), userID, err)
+		}
+
+		events := []outbox.Event{
+			todoEvent(string(webhook.EventTodoUpdated), userID, todoID, patchedTodo),
+		}
+		if current.Status != todo.StatusCompleted && patchedTodo.Status == todo.StatusCompleted {
+			events = append(events, todoEvent(string(webhook.EventTodoCompleted), userID, todoID, patchedTodo))
+		}
+
+		return events, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to collect row from table:todos: %w", err)
+		return nil, err
 	}
 
-	return &updatedTodo, nil
+	return &patchedTodo, nil
 }
 
 func (r *TodoRepository) DeleteTodo(ctx context.Context, userID string, todoID uuid.UUID) error {
@@ -330,20 +502,147 @@ func (r *TodoRepository) DeleteTodo(ctx context.Context, userID string, todoID u
 			AND user_id=@user_id
 	`
 
-	result, err := r.server.DB.Pool.Exec(ctx, stmt, pgx.NamedArgs{
-		"todo_id": todoID,
-		"user_id": userID,
+	return r.withOutbox(ctx, func(tx pgx.Tx) ([]outbox.Event, error) {
+		result, err := tx.Exec(ctx, stmt, pgx.NamedArgs{
+			"todo_id": todoID,
+			"user_id": userID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute query: %w", err)
+		}
+
+		if result.RowsAffected() == 0 {
+			code := "TODO_NOT_FOUND"
+			return nil, errs.NewNotFoundError("todo not found", false, &code)
+		}
+
+		return []outbox.Event{
+			todoEvent(string(webhook.EventTodoDeleted), userID, todoID, map[string]any{"id": todoID}),
+		}, nil
+	})
+}
+
+func (r *TodoRepository) SnoozeTodo(ctx context.Context, userID string, todoID uuid.UUID, until time.Time) (*todo.Todo, error) {
+	stmt := `
+		UPDATE todos
+		SET
+			snoozed_until=@snoozed_until
+		WHERE
+			id=@todo_id
+			AND user_id=@user_id
+		RETURNING
+			*
+	`
+
+	var todoItem todo.Todo
+	err := r.withOutbox(ctx, func(tx pgx.Tx) ([]outbox.Event, error) {
+		rows, err := tx.Query(ctx, stmt, pgx.NamedArgs{
+			"todo_id":       todoID,
+			"user_id":       userID,
+			"snoozed_until": until,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute snooze todo query for todo_id=%s user_id=%s: %w", todoID.String(), userID, err)
+		}
+
+		todoItem, err = pgx.CollectOneRow(rows, pgx.RowToStructByName[todo.Todo])
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect row from table:todos for todo_id=%s user_id=%s: %w", todoID.String(), userID, err)
+		}
+
+		return []outbox.Event{
+			todoEvent(event.TypeTodoSnoozed, userID, todoID, todoItem),
+		}, nil
 	})
 	if err != nil {
-		return fmt.Errorf("failed to execute query: %w", err)
+		return nil, err
 	}
 
-	if result.RowsAffected() == 0 {
-		code := "TODO_NOT_FOUND"
-		return errs.NewNotFoundError("todo not found", false, &code)
+	return &todoItem, nil
+}
+
+func (r *TodoRepository) UnsnoozeTodo(ctx context.Context, userID string, todoID uuid.UUID) (*todo.Todo, error) {
+	stmt := `
+		UPDATE todos
+		SET
+			snoozed_until=NULL
+		WHERE
+			id=@todo_id
+			AND user_id=@user_id
+		RETURNING
+			*
+	`
+
+	var todoItem todo.Todo
+	err := r.withOutbox(ctx, func(tx pgx.Tx) ([]outbox.Event, error) {
+		rows, err := tx.Query(ctx, stmt, pgx.NamedArgs{
+			"todo_id": todoID,
+			"user_id": userID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute unsnooze todo query for todo_id=%s user_id=%s: %w", todoID.String(), userID, err)
+		}
+
+		todoItem, err = pgx.CollectOneRow(rows, pgx.RowToStructByName[todo.Todo])
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect row from table:todos for todo_id=%s user_id=%s: %w", todoID.String(), userID, err)
+		}
+
+		return []outbox.Event{
+			todoEvent(event.TypeTodoUnsnoozed, userID, todoID, todoItem),
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &todoItem, nil
+}
+
+// ExpireSnooze clears a snooze only if it still matches the scheduled time, so
+// cancelled or re-snoozed todos are left alone. It reports whether a row changed.
+func (r *TodoRepository) ExpireSnooze(ctx context.Context, userID string, todoID uuid.UUID, until time.Time) (bool, error) {
+	stmt := `
+		UPDATE todos
+		SET
+			snoozed_until=NULL
+		WHERE
+			id=@todo_id
+			AND user_id=@user_id
+			AND snoozed_until=@snoozed_until
+		RETURNING
+			*
+	`
+
+	changed := false
+	err := r.withOutbox(ctx, func(tx pgx.Tx) ([]outbox.Event, error) {
+		rows, err := tx.Query(ctx, stmt, pgx.NamedArgs{
+			"todo_id":       todoID,
+			"user_id":       userID,
+			"snoozed_until": until,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute expire snooze query for todo_id=%s user_id=%s: %w", todoID.String(), userID, err)
+		}
+
+		todoItems, err := pgx.CollectRows(rows, pgx.RowToStructByName[todo.Todo])
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect rows from table:todos for todo_id=%s user_id=%s: %w", todoID.String(), userID, err)
+		}
+		if len(todoItems) == 0 {
+			return nil, nil
+		}
+
+		changed = true
+		return []outbox.Event{
+			todoEvent(event.TypeTodoUnsnoozed, userID, todoID, todoItems[0]),
+		}, nil
+	})
+	if err != nil {
+		return false, err
 	}
 
-	return nil
+	return changed, nil
 }
 
 func (r *TodoRepository) GetTodoStats(ctx context.Context, userID string) (*todo.TodoStats, error) {
@@ -375,14 +674,19 @@ func (r *TodoRepository) GetTodoStats(ctx context.Context, userID string) (*todo
 					WHEN due_date<NOW()
 					AND status!='completed' THEN 1
 				END
-			) AS overdue
+			) AS overdue,
+			COUNT(
+				CASE
+					WHEN snoozed_until>NOW() THEN 1
+				END
+			) AS snoozed
 		FROM
 			todos
 		WHERE
 			user_id=@user_id
 	`
 
-	rows, err := r.server.DB.Pool.Query(ctx, stmt, pgx.NamedArgs{
+	rows, err := r.server.DB.Reader(ctx).Query(ctx, stmt, pgx.NamedArgs{
 		"user_id": userID,
 	})
 	if err != nil {
@@ -396,3 +700,85 @@ func (r *TodoRepository) GetTodoStats(ctx context.Context, userID string) (*todo
 
 	return &stats, nil
 }
+
+func (r *TodoRepository) GetTodosByDueDateRange(ctx context.Context, userID string, from, to time.Time) ([]todo.Todo, error) {
+	stmt := `
+		SELECT
+			*
+		FROM
+			todos
+		WHERE
+			user_id=@user_id
+			AND due_date>=@from
+			AND due_date<@to
+		ORDER BY
+			due_date ASC,
+			sort_order ASC
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"user_id": userID,
+		"from":    from,
+		"to":      to,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get todos by due date range query for user_id=%s: %w", userID, err)
+	}
+
+	todos, err := pgx.CollectRows(rows, pgx.RowToStructByName[todo.Todo])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows from table:todos for user_id=%s: %w", userID, err)
+	}
+
+	return todos, nil
+}
+
+func (r *TodoRepository) CountTodosByOwner(ctx context.Context, userID string) (int, error) {
+	stmt := `
+		SELECT
+			COUNT(*)
+		FROM
+			todos
+		WHERE
+			user_id=@user_id
+	`
+
+	var count int
+	if err := r.server.DB.Querier(ctx).QueryRow(ctx, stmt, pgx.NamedArgs{
+		"user_id": userID,
+	}).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to execute count todos query for user_id=%s: %w", userID, err)
+	}
+
+	return count, nil
+}
+
+// ReassignTodos moves every todo owned by from to to, returning the ids moved. No
+// events are recorded: the todos themselves are unchanged, and a bulk move would
+// otherwise flood the new owner's webhooks.
+func (r *TodoRepository) ReassignTodos(ctx context.Context, from, to string) ([]uuid.UUID, error) {
+	stmt := `
+		UPDATE todos
+		SET
+			user_id=@to
+		WHERE
+			user_id=@from
+		RETURNING
+			id
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"from": from,
+		"to":   to,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute reassign todos query from user_id=%s to user_id=%s: %w", from, to, err)
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows from table:todos from user_id=%s: %w", from, err)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,736 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/model/user"
+	"github.com/goku-m/starter/internal/server"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type UserRepository struct {
+	server *server.Server
+}
+
+func NewUserRepository(server *server.Server) *UserRepository {
+	return &UserRepository{server: server}
+}
+
+// CreateUser adds an account; passwordHash is nil for accounts provisioned by an OpenID provider
+func (r *UserRepository) CreateUser(ctx context.Context, email string, passwordHash *string) (*user.User, error) {
+	stmt := `
+		INSERT INTO
+			users (email, password_hash)
+		VALUES
+			(@email, @password_hash)
+		RETURNING
+			*
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"email":         email,
+		"password_hash": passwordHash,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute create user query: %w", err)
+	}
+
+	item, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[user.User])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:users: %w", err)
+	}
+
+	return &item, nil
+}
+
+func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (*user.User, error) {
+	stmt := `
+		SELECT
+			*
+		FROM
+			users
+		WHERE
+			LOWER(email)=LOWER(@email)
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"email": email,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get user by email query: %w", err)
+	}
+
+	item, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[user.User])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:users: %w", err)
+	}
+
+	return &item, nil
+}
+
+func (r *UserRepository) GetUserByID(ctx context.Context, userID uuid.UUID) (*user.User, error) {
+	stmt := `
+		SELECT
+			*
+		FROM
+			users
+		WHERE
+			id=@id
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"id": userID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get user by id query for user_id=%s: %w", userID.String(), err)
+	}
+
+	item, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[user.User])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:users for user_id=%s: %w", userID.String(), err)
+	}
+
+	return &item, nil
+}
+
+func (r *UserRepository) UpdatePasswordHash(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	stmt := `
+		UPDATE users
+		SET
+			password_hash=@password_hash
+		WHERE
+			id=@id
+	`
+
+	if _, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"id":            userID,
+		"password_hash": passwordHash,
+	}); err != nil {
+		return fmt.Errorf("failed to execute update password hash query for user_id=%s: %w", userID.String(), err)
+	}
+
+	return nil
+}
+
+func (r *UserRepository) GetIdentity(ctx context.Context, issuer, subject string) (*user.Identity, error) {
+	stmt := `
+		SELECT
+			*
+		FROM
+			user_identities
+		WHERE
+			issuer=@issuer
+			AND subject=@subject
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"issuer":  issuer,
+		"subject": subject,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get identity query for issuer=%s: %w", issuer, err)
+	}
+
+	item, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[user.Identity])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:user_identities for issuer=%s: %w", issuer, err)
+	}
+
+	return &item, nil
+}
+
+func (r *UserRepository) GetIdentities(ctx context.Context, userID uuid.UUID) ([]user.Identity, error) {
+	stmt := `
+		SELECT
+			*
+		FROM
+			user_identities
+		WHERE
+			user_id=@user_id
+		ORDER BY
+			created_at ASC
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"user_id": userID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get identities query for user_id=%s: %w", userID.String(), err)
+	}
+
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByName[user.Identity])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows from table:user_identities for user_id=%s: %w", userID.String(), err)
+	}
+
+	return items, nil
+}
+
+func (r *UserRepository) CreateIdentity(ctx context.Context, userID uuid.UUID, issuer, subject string, email *string) (*user.Identity, error) {
+	stmt := `
+		INSERT INTO
+			user_identities (user_id, issuer, subject, email)
+		VALUES
+			(@user_id, @issuer, @subject, @email)
+		RETURNING
+			*
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"user_id": userID,
+		"issuer":  issuer,
+		"subject": subject,
+		"email":   email,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute create identity query for user_id=%s issuer=%s: %w", userID.String(), issuer, err)
+	}
+
+	item, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[user.Identity])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:user_identities for user_id=%s issuer=%s: %w", userID.String(), issuer, err)
+	}
+
+	return &item, nil
+}
+
+// UpdateIdentityEmail keeps the displayed email in step with the provider
+func (r *UserRepository) UpdateIdentityEmail(ctx context.Context, identityID uuid.UUID, email *string) error {
+	stmt := `
+		UPDATE user_identities
+		SET
+			email=@email
+		WHERE
+			id=@id
+			AND email IS DISTINCT FROM @email
+	`
+
+	if _, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"id":    identityID,
+		"email": email,
+	}); err != nil {
+		return fmt.Errorf("failed to execute update identity email query for identity_id=%s: %w", identityID.String(), err)
+	}
+
+	return nil
+}
+
+func (r *UserRepository) DeleteIdentity(ctx context.Context, userID, identityID uuid.UUID) error {
+	stmt := `
+		DELETE FROM user_identities
+		WHERE
+			id=@identity_id
+			AND user_id=@user_id
+	`
+
+	result, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"identity_id": identityID,
+		"user_id":     userID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		code := "IDENTITY_NOT_FOUND"
+		return errs.NewNotFoundError("identity not found", false, &code)
+	}
+
+	return nil
+}
+
+func (r *UserRepository) UpdateUserRole(ctx context.Context, userID uuid.UUID, role string) error {
+	stmt := `
+		UPDATE users
+		SET
+			role=@role
+		WHERE
+			id=@id
+	`
+
+	result, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"id":   userID,
+		"role": role,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to execute update user role query for user_id=%s: %w", userID.String(), err)
+	}
+
+	if result.RowsAffected() == 0 {
+		code := "USER_NOT_FOUND"
+		return errs.NewNotFoundError("user not found", false, &code)
+	}
+
+	return nil
+}
+
+// MarkTodoClaimOffered records that the account was offered its address's todos,
+// reporting false when it already had been
+func (r *UserRepository) MarkTodoClaimOffered(ctx context.Context, userID uuid.UUID, offeredAt time.Time) (bool, error) {
+	stmt := `
+		UPDATE users
+		SET
+			todo_claim_offered_at=@offered_at
+		WHERE
+			id=@id
+			AND todo_claim_offered_at IS NULL
+	`
+
+	result, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"id":         userID,
+		"offered_at": offeredAt,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to execute mark todo claim offered query for user_id=%s: %w", userID.String(), err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+func (r *UserRepository) CreateMagicLink(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) (*user.MagicLink, error) {
+	stmt := `
+		INSERT INTO
+			magic_links (
+				user_id,
+				token_hash,
+				expires_at
+			)
+		VALUES
+			(
+				@user_id,
+				@token_hash,
+				@expires_at
+			)
+		RETURNING
+			*
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"user_id":    userID,
+		"token_hash": tokenHash,
+		"expires_at": expiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute create magic link query for user_id=%s: %w", userID.String(), err)
+	}
+
+	item, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[user.MagicLink])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:magic_links for user_id=%s: %w", userID.String(), err)
+	}
+
+	return &item, nil
+}
+
+// LockUser locks the account's row until the surrounding transaction ends, so checks
+// on per-account state and the writes that depend on them run one account at a time
+func (r *UserRepository) LockUser(ctx context.Context, userID uuid.UUID) error {
+	stmt := `
+		SELECT
+			id
+		FROM
+			users
+		WHERE
+			id=@id
+		FOR UPDATE
+	`
+
+	var id uuid.UUID
+	if err := r.server.DB.Querier(ctx).QueryRow(ctx, stmt, pgx.NamedArgs{
+		"id": userID,
+	}).Scan(&id); err != nil {
+		return fmt.Errorf("failed to execute lock user query for user_id=%s: %w", userID.String(), err)
+	}
+
+	return nil
+}
+
+// CountMagicLinksSince counts the links issued to a user after since, spent or not
+func (r *UserRepository) CountMagicLinksSince(ctx context.Context, userID uuid.UUID, since time.Time) (int, error) {
+	stmt := `
+		SELECT
+			COUNT(*)
+		FROM
+			magic_links
+		WHERE
+			user_id=@user_id
+			AND created_at>@since
+	`
+
+	var count int
+	if err := r.server.DB.Querier(ctx).QueryRow(ctx, stmt, pgx.NamedArgs{
+		"user_id": userID,
+		"since":   since,
+	}).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to execute count magic links query for user_id=%s: %w", userID.String(), err)
+	}
+
+	return count, nil
+}
+
+// UseMagicLink spends an unexpired link in one statement, so two clicks racing each
+// other can't both sign in. It returns pgx.ErrNoRows for unknown, spent or expired links.
+func (r *UserRepository) UseMagicLink(ctx context.Context, tokenHash string, usedAt time.Time) (*user.MagicLink, error) {
+	stmt := `
+		UPDATE magic_links
+		SET
+			used_at=@used_at
+		WHERE
+			token_hash=@token_hash
+			AND used_at IS NULL
+			AND expires_at>@used_at
+		RETURNING
+			*
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"token_hash": tokenHash,
+		"used_at":    usedAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute use magic link query: %w", err)
+	}
+
+	item, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[user.MagicLink])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:magic_links: %w", err)
+	}
+
+	return &item, nil
+}
+
+// StartTOTPEnrollment stores a new secret for an account that hasn't turned two-factor
+// on yet, replacing any enrollment left unfinished
+func (r *UserRepository) StartTOTPEnrollment(ctx context.Context, userID uuid.UUID, secret string) error {
+	stmt := `
+		UPDATE users
+		SET
+			totp_secret=@secret,
+			totp_last_step=NULL
+		WHERE
+			id=@id
+			AND totp_enabled_at IS NULL
+	`
+
+	result, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"id":     userID,
+		"secret": secret,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to execute start totp enrollment query for user_id=%s: %w", userID.String(), err)
+	}
+
+	if result.RowsAffected() == 0 {
+		code := "TWO_FACTOR_ENABLED"
+		return errs.NewConflictError("Two-factor authentication is already on", true, &code)
+	}
+
+	return nil
+}
+
+// EnableTOTP finishes enrollment with the step of the code that confirmed it
+func (r *UserRepository) EnableTOTP(ctx context.Context, userID uuid.UUID, step int64, enabledAt time.Time) error {
+	stmt := `
+		UPDATE users
+		SET
+			totp_enabled_at=@enabled_at,
+			totp_last_step=@step,
+			totp_failures=0,
+			totp_failed_at=NULL
+		WHERE
+			id=@id
+			AND totp_secret IS NOT NULL
+			AND totp_enabled_at IS NULL
+	`
+
+	result, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"id":         userID,
+		"step":       step,
+		"enabled_at": enabledAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to execute enable totp query for user_id=%s: %w", userID.String(), err)
+	}
+
+	if result.RowsAffected() == 0 {
+		code := "TWO_FACTOR_NOT_PENDING"
+		return errs.NewConflictError("Start setting up two-factor authentication again", true, &code)
+	}
+
+	return nil
+}
+
+// AcceptTOTPStep records a used code's step, reporting false when that step or a
+// later one was already used
+func (r *UserRepository) AcceptTOTPStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	stmt := `
+		UPDATE users
+		SET
+			totp_last_step=@step,
+			totp_failures=0,
+			totp_failed_at=NULL
+		WHERE
+			id=@id
+			AND (
+				totp_last_step IS NULL
+				OR totp_last_step<@step
+			)
+	`
+
+	result, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"id":   userID,
+		"step": step,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to execute accept totp step query for user_id=%s: %w", userID.String(), err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+// RecordTOTPFailure counts a wrong code, starting the count again once the last
+// failure is older than windowStart
+func (r *UserRepository) RecordTOTPFailure(ctx context.Context, userID uuid.UUID, failedAt, windowStart time.Time) error {
+	stmt := `
+		UPDATE users
+		SET
+			totp_failures=CASE
+				WHEN totp_failed_at IS NULL
+				OR totp_failed_at<@window_start THEN 1
+				ELSE totp_failures+1
+			END,
+			totp_failed_at=@failed_at
+		WHERE
+			id=@id
+	`
+
+	if _, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"id":           userID,
+		"failed_at":    failedAt,
+		"window_start": windowStart,
+	}); err != nil {
+		return fmt.Errorf("failed to execute record totp failure query for user_id=%s: %w", userID.String(), err)
+	}
+
+	return nil
+}
+
+// DisableTOTP turns two-factor off and drops the account's recovery codes
+func (r *UserRepository) DisableTOTP(ctx context.Context, userID uuid.UUID) error {
+	stmt := `
+		UPDATE users
+		SET
+			totp_secret=NULL,
+			totp_enabled_at=NULL,
+			totp_last_step=NULL,
+			totp_failures=0,
+			totp_failed_at=NULL
+		WHERE
+			id=@id
+	`
+
+	q := r.server.DB.Querier(ctx)
+
+	result, err := q.Exec(ctx, stmt, pgx.NamedArgs{
+		"id": userID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to execute disable totp query for user_id=%s: %w", userID.String(), err)
+	}
+
+	if result.RowsAffected() == 0 {
+		code := "USER_NOT_FOUND"
+		return errs.NewNotFoundError("user not found", false, &code)
+	}
+
+	if _, err := q.Exec(ctx, "DELETE FROM user_recovery_codes WHERE user_id=@user_id", pgx.NamedArgs{
+		"user_id": userID,
+	}); err != nil {
+		return fmt.Errorf("failed to execute delete recovery codes query for user_id=%s: %w", userID.String(), err)
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes swaps the account's recovery codes for a new set
+func (r *UserRepository) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	stmt := `
+		INSERT INTO
+			user_recovery_codes (user_id, code_hash)
+		SELECT
+			@user_id,
+			UNNEST(@code_hashes::TEXT[])
+	`
+
+	q := r.server.DB.Querier(ctx)
+
+	if _, err := q.Exec(ctx, "DELETE FROM user_recovery_codes WHERE user_id=@user_id", pgx.NamedArgs{
+		"user_id": userID,
+	}); err != nil {
+		return fmt.Errorf("failed to execute delete recovery codes query for user_id=%s: %w", userID.String(), err)
+	}
+
+	if _, err := q.Exec(ctx, stmt, pgx.NamedArgs{
+		"user_id":     userID,
+		"code_hashes": codeHashes,
+	}); err != nil {
+		return fmt.Errorf("failed to execute create recovery codes query for user_id=%s: %w", userID.String(), err)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode spends an unused code, reporting false when there is none to spend
+func (r *UserRepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string, usedAt time.Time) (bool, error) {
+	stmt := `
+		UPDATE user_recovery_codes
+		SET
+			used_at=@used_at
+		WHERE
+			user_id=@user_id
+			AND code_hash=@code_hash
+			AND used_at IS NULL
+	`
+
+	result, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"user_id":   userID,
+		"code_hash": codeHash,
+		"used_at":   usedAt,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to execute use recovery code query for user_id=%s: %w", userID.String(), err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+func (r *UserRepository) CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error) {
+	stmt := `
+		SELECT
+			COUNT(*)
+		FROM
+			user_recovery_codes
+		WHERE
+			user_id=@user_id
+			AND used_at IS NULL
+	`
+
+	var count int
+	if err := r.server.DB.Querier(ctx).QueryRow(ctx, stmt, pgx.NamedArgs{
+		"user_id": userID,
+	}).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to execute count recovery codes query for user_id=%s: %w", userID.String(), err)
+	}
+
+	return count, nil
+}
+
+// GetLoginFailures returns the failure count of each key whose last failure is at or
+// after windowStart; keys without one are left out
+func (r *UserRepository) GetLoginFailures(ctx context.Context, keys []string, windowStart time.Time) (map[string]int, error) {
+	stmt := `
+		SELECT
+			key,
+			failures
+		FROM
+			login_failures
+		WHERE
+			key=ANY(@keys)
+			AND failed_at>=@window_start
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"keys":         keys,
+		"window_start": windowStart,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get login failures query: %w", err)
+	}
+
+	type loginFailure struct {
+		Key      string `db:"key"`
+		Failures int    `db:"failures"`
+	}
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByName[loginFailure])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows from table:login_failures: %w", err)
+	}
+
+	failures := make(map[string]int, len(items))
+	for _, item := range items {
+		failures[item.Key] = item.Failures
+	}
+
+	return failures, nil
+}
+
+// RecordLoginFailure counts a failed login against each key, starting a key's count
+// again once its last failure is older than windowStart
+func (r *UserRepository) RecordLoginFailure(ctx context.Context, keys []string, failedAt, windowStart time.Time) error {
+	stmt := `
+		INSERT INTO
+			login_failures (key, failures, failed_at)
+		SELECT
+			key,
+			1,
+			@failed_at
+		FROM
+			UNNEST(@keys::TEXT[]) AS key
+		ON CONFLICT (key) DO UPDATE
+		SET
+			failures=CASE
+				WHEN login_failures.failed_at<@window_start THEN 1
+				ELSE login_failures.failures+1
+			END,
+			failed_at=EXCLUDED.failed_at
+	`
+
+	if _, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"keys":         keys,
+		"failed_at":    failedAt,
+		"window_start": windowStart,
+	}); err != nil {
+		return fmt.Errorf("failed to execute record login failure query: %w", err)
+	}
+
+	return nil
+}
+
+// ClearLoginFailures forgets the failures counted against key
+func (r *UserRepository) ClearLoginFailures(ctx context.Context, key string) error {
+	stmt := `
+		DELETE FROM login_failures
+		WHERE
+			key=@key
+	`
+
+	if _, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"key": key,
+	}); err != nil {
+		return fmt.Errorf("failed to execute clear login failures query: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteLoginFailuresBefore drops counts whose last failure is older than before
+func (r *UserRepository) DeleteLoginFailuresBefore(ctx context.Context, before time.Time) (int64, error) {
+	stmt := `
+		DELETE FROM login_failures
+		WHERE
+			failed_at<@before
+	`
+
+	result, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"before": before,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute delete login failures query: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,335 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/model/webhook"
+	"github.com/goku-m/starter/internal/server"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type WebhookRepository struct {
+	server *server.Server
+}
+
+func NewWebhookRepository(server *server.Server) *WebhookRepository {
+	return &WebhookRepository{server: server}
+}
+
+func (r *WebhookRepository) CreateWebhook(ctx context.Context, userID string, payload *webhook.CreateWebhookPayload, secret string) (*webhook.Webhook, error) {
+	stmt := `
+		INSERT INTO
+			webhooks (
+				user_id,
+				url,
+				description,
+				secret,
+				events
+			)
+		VALUES
+			(
+				@user_id,
+				@url,
+				@description,
+				@secret,
+				@events
+			)
+		RETURNING
+			*
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"user_id":     userID,
+		"url":         payload.URL,
+		"description": payload.Description,
+		"secret":      secret,
+		"events":      payload.Events,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute create webhook query for user_id=%s url=%s: %w", userID, payload.URL, err)
+	}
+
+	item, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[webhook.Webhook])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:webhooks for user_id=%s url=%s: %w", userID, payload.URL, err)
+	}
+
+	return &item, nil
+}
+
+func (r *WebhookRepository) GetWebhooks(ctx context.Context, userID string) ([]webhook.Webhook, error) {
+	stmt := `
+		SELECT
+			*
+		FROM
+			webhooks
+		WHERE
+			user_id=@user_id
+		ORDER BY
+			created_at DESC
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"user_id": userID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get webhooks query for user_id=%s: %w", userID, err)
+	}
+
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByName[webhook.Webhook])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows from table:webhooks for user_id=%s: %w", userID, err)
+	}
+
+	return items, nil
+}
+
+func (r *WebhookRepository) GetWebhookByID(ctx context.Context, userID string, webhookID uuid.UUID) (*webhook.Webhook, error) {
+	stmt := `
+		SELECT
+			*
+		FROM
+			webhooks
+		WHERE
+			id=@id
+			AND user_id=@user_id
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"id":      webhookID,
+		"user_id": userID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get webhook by id query for webhook_id=%s user_id=%s: %w", webhookID.String(), userID, err)
+	}
+
+	item, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[webhook.Webhook])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:webhooks for webhook_id=%s user_id=%s: %w", webhookID.String(), userID, err)
+	}
+
+	return &item, nil
+}
+
+func (r *WebhookRepository) DeleteWebhook(ctx context.Context, userID string, webhookID uuid.UUID) error {
+	stmt := `
+		DELETE FROM webhooks
+		WHERE
+			id=@webhook_id
+			AND user_id=@user_id
+	`
+
+	result, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"webhook_id": webhookID,
+		"user_id":    userID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		code := "WEBHOOK_NOT_FOUND"
+		return errs.NewNotFoundError("webhook not found", false, &code)
+	}
+
+	return nil
+}
+
+// GetSubscribedWebhooks returns the user's active endpoints that listen for event
+func (r *WebhookRepository) GetSubscribedWebhooks(ctx context.Context, userID string, event webhook.Event) ([]webhook.Webhook, error) {
+	stmt := `
+		SELECT
+			*
+		FROM
+			webhooks
+		WHERE
+			user_id=@user_id
+			AND active
+			AND @event=ANY(events)
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"user_id": userID,
+		"event":   string(event),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get subscribed webhooks query for user_id=%s event=%s: %w", userID, event, err)
+	}
+
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByName[webhook.Webhook])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows from table:webhooks for user_id=%s event=%s: %w", userID, event, err)
+	}
+
+	return items, nil
+}
+
+// CreateDelivery records a pending delivery. Deliveries of an outbox message are
+// created once per endpoint; creating one again returns the existing delivery.
+func (r *WebhookRepository) CreateDelivery(ctx context.Context, webhookID uuid.UUID, event webhook.Event, payload []byte, outboxID *int64) (*webhook.Delivery, error) {
+	stmt := `
+		INSERT INTO
+			webhook_deliveries (
+				webhook_id,
+				event,
+				payload,
+				outbox_id
+			)
+		VALUES
+			(
+				@webhook_id,
+				@event,
+				@payload,
+				@outbox_id
+			)
+		ON CONFLICT (webhook_id, outbox_id) WHERE outbox_id IS NOT NULL DO UPDATE
+		SET
+			outbox_id=EXCLUDED.outbox_id
+		RETURNING
+			*
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"webhook_id": webhookID,
+		"event":      event,
+		"payload":    payload,
+		"outbox_id":  outboxID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute create webhook delivery query for webhook_id=%s: %w", webhookID.String(), err)
+	}
+
+	item, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[webhook.Delivery])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:webhook_deliveries for webhook_id=%s: %w", webhookID.String(), err)
+	}
+
+	return &item, nil
+}
+
+func (r *WebhookRepository) GetDeliveryByID(ctx context.Context, deliveryID uuid.UUID) (*webhook.Delivery, error) {
+	stmt := `
+		SELECT
+			*
+		FROM
+			webhook_deliveries
+		WHERE
+			id=@id
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"id": deliveryID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get webhook delivery query for delivery_id=%s: %w", deliveryID.String(), err)
+	}
+
+	item, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[webhook.Delivery])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:webhook_deliveries for delivery_id=%s: %w", deliveryID.String(), err)
+	}
+
+	return &item, nil
+}
+
+// GetWebhookForDelivery loads the endpoint a delivery belongs to, regardless of owner
+func (r *WebhookRepository) GetWebhookForDelivery(ctx context.Context, deliveryID uuid.UUID) (*webhook.Webhook, error) {
+	stmt := `
+		SELECT
+			w.*
+		FROM
+			webhooks w
+			JOIN webhook_deliveries d ON d.webhook_id=w.id
+		WHERE
+			d.id=@delivery_id
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"delivery_id": deliveryID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get webhook for delivery query for delivery_id=%s: %w", deliveryID.String(), err)
+	}
+
+	item, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[webhook.Webhook])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect row from table:webhooks for delivery_id=%s: %w", deliveryID.String(), err)
+	}
+
+	return &item, nil
+}
+
+type DeliveryAttempt struct {
+	Status       webhook.DeliveryStatus
+	ResponseCode *int
+	ResponseBody *string
+	Error        *string
+	Duration     time.Duration
+}
+
+func (r *WebhookRepository) RecordDeliveryAttempt(ctx context.Context, deliveryID uuid.UUID, attempt DeliveryAttempt) error {
+	stmt := `
+		UPDATE webhook_deliveries
+		SET
+			status=@status,
+			attempts=attempts + 1,
+			response_code=@response_code,
+			response_body=@response_body,
+			error=@error,
+			duration_ms=@duration_ms,
+			delivered_at=CASE
+				WHEN @status='succeeded' THEN NOW()
+				ELSE delivered_at
+			END
+		WHERE
+			id=@delivery_id
+	`
+
+	_, err := r.server.DB.Querier(ctx).Exec(ctx, stmt, pgx.NamedArgs{
+		"delivery_id":   deliveryID,
+		"status":        attempt.Status,
+		"response_code": attempt.ResponseCode,
+		"response_body": attempt.ResponseBody,
+		"error":         attempt.Error,
+		"duration_ms":   attempt.Duration.Milliseconds(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery attempt for delivery_id=%s: %w", deliveryID.String(), err)
+	}
+
+	return nil
+}
+
+func (r *WebhookRepository) GetDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]webhook.Delivery, error) {
+	stmt := `
+		SELECT
+			*
+		FROM
+			webhook_deliveries
+		WHERE
+			webhook_id=@webhook_id
+		ORDER BY
+			created_at DESC
+		LIMIT
+			@limit
+	`
+
+	rows, err := r.server.DB.Querier(ctx).Query(ctx, stmt, pgx.NamedArgs{
+		"webhook_id": webhookID,
+		"limit":      limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute get webhook deliveries query for webhook_id=%s: %w", webhookID.String(), err)
+	}
+
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByName[webhook.Delivery])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows from table:webhook_deliveries for webhook_id=%s: %w", webhookID.String(), err)
+	}
+
+	return items, nil
+}
@@ -0,0 +1,14 @@
+package router
+
+import (
+	"github.com/goku-m/starter/internal/handler"
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/labstack/echo/v4"
+)
+
+func registerGraphQLRoutes(r *echo.Group, h *handler.GraphQLHandler, auth *middleware.AuthMiddleware, idempotency *middleware.IdempotencyMiddleware) {
+	graphql := r.Group("/graphql")
+	graphql.Use(auth.RequireAuth, idempotency.Handle)
+
+	graphql.POST("", h.Query)
+}
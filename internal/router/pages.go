@@ -3,15 +3,49 @@ package router
 import (
 	"github.com/goku-m/starter/internal/handler"
 	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/service"
 
 	"github.com/labstack/echo/v4"
 )
 
 func registerPagesRoutes(r *echo.Echo, h *handler.Handlers, auth *middleware.AuthMiddleware) {
+	// Reachable signed out; signed in users are sent on
+	r.GET("/login", h.Auth.LoginPage, auth.Authenticate)
+	r.POST("/login", h.Auth.Login, auth.Authenticate)
+	r.GET("/signup", h.Auth.SignupPage, auth.Authenticate)
+	r.POST("/signup", h.Auth.Signup, auth.Authenticate)
+	r.POST("/logout", h.Auth.Logout, auth.Authenticate)
+	r.GET("/login/magic", h.Auth.MagicLinkPage, auth.Authenticate)
+	r.POST("/login/magic", h.Auth.RequestMagicLink, auth.Authenticate)
+	r.GET(service.MagicLinkPath, h.Auth.MagicLinkConfirmPage, auth.Authenticate)
+	r.POST(service.MagicLinkPath, h.Auth.LoginWithMagicLink, auth.Authenticate)
+	r.GET(service.TwoFactorPath, h.Auth.TwoFactorPage, auth.Authenticate)
+	r.POST(service.TwoFactorPath, h.Auth.CompleteTwoFactor, auth.Authenticate)
+	r.GET("/auth/oidc/login", h.Auth.OIDCLogin, auth.Authenticate)
+	r.GET(service.OIDCCallbackPath, h.Auth.OIDCCallback, auth.Authenticate)
 
-	r.GET("/login", h.Auth.LoginPage)
-	r.GET("/", h.Todo.GetTodoPage)
-	r.GET("/create", h.Todo.CreateTodoPage)
-	r.Use(auth.RequireAuthIP)
-	r.GET("/update/:id", h.Todo.UpdateTodoPage)
+	// Route level rather than r.Use, which would also guard the login page and /status
+	r.GET("/", h.Todo.GetTodoPage, auth.RequireAuth)
+	r.GET("/create", h.Todo.CreateTodoPage, auth.RequireAuth)
+	r.GET("/update/:id", h.Todo.UpdateTodoPage, auth.RequireAuth)
+	r.GET("/calendar", h.Todo.CalendarPage, auth.RequireAuth)
+	r.GET("/webhooks", h.Webhook.WebhooksPage, auth.RequireAuth)
+	r.GET("/webhooks/:id", h.Webhook.WebhookPage, auth.RequireAuth)
+	r.GET("/tokens", h.APIToken.TokensPage, auth.RequireAuth)
+	r.GET("/account", h.Auth.AccountPage, auth.RequireAuth)
+	r.GET("/account/sessions", h.Auth.SessionsPage, auth.RequireAuth)
+
+	// Forms that render their page again post here rather than under /api; for tokens
+	// that page is the only place a new token is shown
+	r.POST("/tokens", h.APIToken.CreateAPIToken, auth.RequireAuth)
+	r.POST("/tokens/:id/delete", h.APIToken.DeleteAPIToken, auth.RequireAuth)
+	r.POST("/account/identities", h.Auth.LinkIdentity, auth.RequireAuth)
+	r.POST("/account/identities/:id/delete", h.Auth.UnlinkIdentity, auth.RequireAuth)
+	r.POST("/account/2fa/setup", h.Auth.StartTwoFactorSetup, auth.RequireAuth)
+	r.POST("/account/2fa/enable", h.Auth.EnableTwoFactor, auth.RequireAuth)
+	r.POST("/account/2fa/disable", h.Auth.DisableTwoFactor, auth.RequireAuth)
+	r.POST("/account/2fa/recovery-codes", h.Auth.RegenerateRecoveryCodes, auth.RequireAuth)
+	r.POST("/account/password", h.Auth.ChangePassword, auth.RequireAuth)
+	r.POST("/account/sessions/delete", h.Auth.RevokeAllSessions, auth.RequireAuth)
+	r.POST("/account/sessions/:id/delete", h.Auth.RevokeSession, auth.RequireAuth)
 }
@@ -0,0 +1,14 @@
+package router
+
+import (
+	"github.com/goku-m/starter/internal/handler"
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/labstack/echo/v4"
+)
+
+func registerRealtimeRoutes(r *echo.Group, h *handler.RealtimeHandler, auth *middleware.AuthMiddleware) {
+	events := r.Group("/events")
+	events.Use(auth.RequireAuth)
+
+	events.GET("", h.StreamEvents)
+}
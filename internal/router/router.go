@@ -1,6 +1,7 @@
 package router
 
 import (
+	"net"
 	"net/http"
 
 	"github.com/goku-m/starter/internal/handler"
@@ -21,6 +22,7 @@ func NewRouter(s *server.Server, h *handler.Handlers) *echo.Echo {
 	router.File("/favicon.ico", "/static/favicon.ico")
 
 	router.HTTPErrorHandler = middlewares.Global.GlobalErrorHandler
+	router.IPExtractor = ipExtractor(s.Config.Server.TrustedProxies)
 
 	// global middlewares
 	router.Use(
@@ -49,6 +51,7 @@ func NewRouter(s *server.Server, h *handler.Handlers) *echo.Echo {
 		middlewares.ContextEnhancer.EnhanceContext(),
 		middlewares.Global.RequestLogger(),
 		middlewares.Global.Recover(),
+		middlewares.CSRF.Protect,
 	)
 
 	// register system routes
@@ -57,7 +60,32 @@ func NewRouter(s *server.Server, h *handler.Handlers) *echo.Echo {
 	registerPagesRoutes(router, h,  middlewares.Auth)
 	// register api routes
 	r := router.Group("/api")
-	registerTodoRoutes(r, h.Todo, middlewares.Auth)
+	registerTodoRoutes(r, h.Todo, middlewares.Auth, middlewares.Idempotency)
+	registerWebhookRoutes(r, h.Webhook, middlewares.Auth, middlewares.Idempotency)
+	registerRealtimeRoutes(r, h.Realtime, middlewares.Auth)
+	registerGraphQLRoutes(r, h.GraphQL, middlewares.Auth, middlewares.Idempotency)
+	// register versioned api routes
+	registerVersionedRoutes(router, h, middlewares)
 
 	return router
 }
+
+// ipExtractor decides where RealIP comes from. Client addresses own sessions and are
+// rate limited on, so forwarding headers only count when a trusted proxy set them.
+func ipExtractor(trustedProxies []string) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, cidr := range trustedProxies {
+		// Validated as CIDRs when the config loaded
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
@@ -0,0 +1,63 @@
+package router
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPExtractor(t *testing.T) {
+	tests := []struct {
+		name       string
+		proxies    []string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "forwarding headers ignored without trusted proxies",
+			remoteAddr: "198.51.100.7:5000",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.9", "X-Real-IP": "203.0.113.9"},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "private peers aren't trusted by default",
+			remoteAddr: "10.0.0.2:5000",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.9"},
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "trusted proxy's forwarded address is used",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.2:5000",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.9"},
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "untrusted peer can't forward",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "198.51.100.7:5000",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.9"},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "addresses spoofed ahead of the proxy's are skipped",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.2:5000",
+			headers:    map[string]string{"X-Forwarded-For": "192.0.2.1, 203.0.113.9"},
+			want:       "203.0.113.9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			assert.Equal(t, tt.want, ipExtractor(tt.proxies)(req))
+		})
+	}
+}
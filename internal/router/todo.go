@@ -1,26 +1,32 @@
 package router
 
 import (
+	"github.com/goku-m/starter/internal/authz"
 	"github.com/goku-m/starter/internal/handler"
 	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/model/apitoken"
 	"github.com/labstack/echo/v4"
 )
 
-func registerTodoRoutes(r *echo.Group, h *handler.TodoHandler, auth *middleware.AuthMiddleware) {
-	// Todo operations
+func registerTodoRoutes(r *echo.Group, h *handler.TodoHandler, auth *middleware.AuthMiddleware, idempotency *middleware.IdempotencyMiddleware) {
+	// Todo operations. Auth is per route so API tokens are held to the route's scope;
+	// idempotency follows it because keys are scoped to the user.
 	todos := r.Group("/todos")
-	todos.Use(auth.RequireAuthIP)
+	read := auth.RequireScope(apitoken.ScopeTodosRead)
+	write := auth.RequireScope(apitoken.ScopeTodosWrite)
 
-	// Collection operations
-	todos.POST("/create", h.CreateTodo)
-	todos.GET("", h.GetTodos)
-	todos.POST("/delete", h.DeleteTodo)
-	todos.POST("/update/:id", h.UpdateTodo)
-
-	// Individual todo operations
-	// dynamicTodo := todos.Group("/:id")
-	// dynamicTodo.GET("", h.GetTodoByID)
-	// dynamicTodo.PATCH("", h.UpdateTodo)
-	// dynamicTodo.DELETE("", h.DeleteTodo)
+	// Form operations used by the HTML pages
+	todos.POST("/create", h.CreateTodo, write, idempotency.Handle)
+	todos.POST("/delete", h.DeleteTodo, write, auth.RequirePermission(authz.TodosDelete), idempotency.Handle)
+	todos.POST("/update/:id", h.UpdateTodo, write, idempotency.Handle)
+	todos.POST("/snooze/:id", h.SnoozeTodo, write, idempotency.Handle)
+	todos.POST("/unsnooze/:id", h.UnsnoozeTodo, write, idempotency.Handle)
+	todos.POST("/claim", h.ClaimTodos, write, idempotency.Handle)
+	todos.POST("/claim/dismiss", h.DismissTodoClaim, write)
 
+	// JSON operations superseded by /api/v1/todos
+	deprecated := middleware.Deprecated(legacyTodoAPIDeprecatedAt, &legacyTodoAPISunsetAt, apiPrefix+"/v1/todos")
+	todos.GET("", h.GetTodos, read, idempotency.Handle, deprecated)
+	todos.POST("/parse", h.ParseTodoAPI, read, idempotency.Handle, deprecated)
+	todos.PATCH("/:id", h.PatchTodoAPI, write, idempotency.Handle, deprecated)
 }
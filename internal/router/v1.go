@@ -0,0 +1,53 @@
+package router
+
+import (
+	"github.com/goku-m/starter/internal/authz"
+	"github.com/goku-m/starter/internal/handler"
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/model/apitoken"
+	"github.com/labstack/echo/v4"
+)
+
+func registerV1Routes(r *echo.Group, h *handler.Handlers, middlewares *middleware.Middlewares) {
+	todos := r.Group("/todos")
+	read := middlewares.Auth.RequireScope(apitoken.ScopeTodosRead)
+	write := middlewares.Auth.RequireScope(apitoken.ScopeTodosWrite)
+	idempotency := middlewares.Idempotency.Handle
+
+	// Collection operations
+	todos.GET("", h.Todo.GetTodos, read, idempotency)
+	todos.POST("", h.Todo.CreateTodoAPI, write, idempotency)
+	todos.POST("/parse", h.Todo.ParseTodoAPI, read, idempotency)
+
+	// Individual todo operations
+	todo := todos.Group("/:id")
+	todo.GET("", h.Todo.GetTodoByID, read, idempotency)
+	todo.PUT("", h.Todo.UpdateTodoAPI, write, idempotency)
+	todo.PATCH("", h.Todo.PatchTodoAPI, write, idempotency)
+	todo.DELETE("", h.Todo.DeleteTodoAPI, write, middlewares.Auth.RequirePermission(authz.TodosDelete), idempotency)
+	todo.PUT("/snooze", h.Todo.SnoozeTodoAPI, write, idempotency)
+	todo.DELETE("/snooze", h.Todo.UnsnoozeTodoAPI, write, idempotency)
+
+	// The emailed link is the credential, so downloads skip auth
+	r.GET("/me/exports/:id/download", h.Privacy.DownloadExportAPI)
+
+	me := r.Group("/me")
+	me.Use(middlewares.Auth.RequireAuth, middlewares.Idempotency.Handle)
+	me.POST("/exports", h.Privacy.RequestExportAPI)
+	me.DELETE("", h.Privacy.EraseUserDataAPI)
+
+	// Token management needs a session or JWT; a token can't mint or revoke tokens
+	me.GET("/tokens", h.APIToken.GetAPITokensAPI)
+	me.POST("/tokens", h.APIToken.CreateAPITokenAPI)
+	me.DELETE("/tokens/:id", h.APIToken.DeleteAPITokenAPI)
+
+	// Browser sessions, listed and revoked from anywhere the user is signed in
+	me.GET("/sessions", h.Auth.GetSessionsAPI)
+	me.DELETE("/sessions", h.Auth.RevokeAllSessionsAPI)
+	me.DELETE("/sessions/:id", h.Auth.RevokeSessionAPI)
+
+	// Account administration; the services check users:manage too
+	admin := r.Group("/admin")
+	admin.Use(middlewares.Auth.RequireAuth, middlewares.Auth.RequirePermission(authz.UsersManage), middlewares.Idempotency.Handle)
+	admin.DELETE("/users/:id/2fa", h.Auth.ResetTwoFactorAPI)
+}
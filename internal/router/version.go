@@ -0,0 +1,44 @@
+package router
+
+import (
+	"time"
+
+	"github.com/goku-m/starter/internal/handler"
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/labstack/echo/v4"
+)
+
+const apiPrefix = "/api"
+
+type apiVersion struct {
+	middleware.APIVersion
+	register func(r *echo.Group, h *handler.Handlers, middlewares *middleware.Middlewares)
+}
+
+// apiVersions are mounted at /api/<name>. A breaking change gets a new entry here with
+// its own register function; the previous version keeps its routes and only gains
+// DeprecatedAt, SunsetAt and Successor so existing clients are warned before removal.
+var apiVersions = []apiVersion{
+	{
+		APIVersion: middleware.APIVersion{Name: "v1"},
+		register:   registerV1Routes,
+	},
+}
+
+// The unversioned JSON todo routes predate /api/v1
+var (
+	legacyTodoAPIDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	legacyTodoAPISunsetAt     = time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC)
+)
+
+func registerVersionedRoutes(router *echo.Echo, h *handler.Handlers, middlewares *middleware.Middlewares) {
+	versions := make([]middleware.APIVersion, 0, len(apiVersions))
+	for _, v := range apiVersions {
+		versions = append(versions, v.APIVersion)
+	}
+	router.Pre(middleware.NegotiateAPIVersion(apiPrefix, versions...))
+
+	for _, v := range apiVersions {
+		v.register(router.Group(apiPrefix+"/"+v.Name, v.Handle), h, middlewares)
+	}
+}
@@ -0,0 +1,18 @@
+package router
+
+import (
+	"github.com/goku-m/starter/internal/authz"
+	"github.com/goku-m/starter/internal/handler"
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/labstack/echo/v4"
+)
+
+func registerWebhookRoutes(r *echo.Group, h *handler.WebhookHandler, auth *middleware.AuthMiddleware, idempotency *middleware.IdempotencyMiddleware) {
+	webhooks := r.Group("/webhooks")
+	webhooks.Use(auth.RequireAuth, auth.RequirePermission(authz.WebhooksManage), idempotency.Handle)
+
+	webhooks.POST("/create", h.CreateWebhook)
+	webhooks.POST("/delete/:id", h.DeleteWebhook)
+	webhooks.POST("/test/:id", h.SendTestEvent)
+	webhooks.GET("/:id/deliveries", h.GetDeliveriesAPI)
+}
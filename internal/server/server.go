@@ -9,6 +9,7 @@ import (
 
 	"github.com/goku-m/starter/internal/config"
 	"github.com/goku-m/starter/internal/database"
+	"github.com/goku-m/starter/internal/lib/cache"
 	"github.com/goku-m/starter/internal/lib/job"
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
@@ -19,51 +20,72 @@ type Server struct {
 	Logger     *zerolog.Logger
 	DB         *database.Database
 	Redis      *redis.Client
+	Cache      *cache.Cache
 	httpServer *http.Server
 	Job        *job.JobService
 }
 
 func New(cfg *config.Config, logger *zerolog.Logger) (*Server, error) {
-	db, err := database.New(cfg, logger)
+	server, err := NewCommand(cfg, logger)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize database: %w", err)
+		return nil, err
 	}
 
-	// // Redis client with New Relic integration
-	// redisClient := redis.NewClient(&redis.Options{
-	// 	Addr: cfg.Redis.Address,
-	// })
+	// job service; main starts it once services have registered their handlers
+	jobService := job.NewJobService(logger, cfg)
+	jobService.InitHandlers(cfg, logger)
+	server.Job = jobService
 
-	// // Test Redis connection
-	// ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	// defer cancel()
+	// Start metrics collection
+	// Runtime metrics are automatically collected by New Relic Go agent
 
-	// if err := redisClient.Ping(ctx).Err(); err != nil {
-	// 	logger.Error().Err(err).Msg("Failed to connect to Redis, continuing without Redis")
-	// 	// Don't fail startup if Redis is unavailable
-	// }
+	return server, nil
+}
 
-	// job service
-	jobService := job.NewJobService(logger, cfg)
-	jobService.InitHandlers(cfg, logger)
+// NewCommand connects the database, Redis and cache without a job service, for
+// maintenance commands that share the app's data but shouldn't process its jobs
+func NewCommand(cfg *config.Config, logger *zerolog.Logger) (*Server, error) {
+	// Redis client
+	var redisClient *redis.Client
+	if cfg.Redis.Address != "" {
+		redisClient = redis.NewClient(&redis.Options{
+			Addr: cfg.Redis.Address,
+		})
+
+		// Test Redis connection
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := redisClient.Ping(ctx).Err(); err != nil {
+			logger.Error().Err(err).Msg("Failed to connect to Redis, continuing without Redis")
+			// Don't fail startup if Redis is unavailable
+		}
+	}
 
-	// Start job server
-	if err := jobService.Start(); err != nil {
-		return nil, err
+	// Cache in Redis when available so every instance shares entries and invalidations,
+	// and read-your-writes pins too, so a write pins reads served by any instance
+	var cacheStore cache.Store = cache.NewMemoryStore()
+	var pinStore database.PinStore
+	if redisClient != nil {
+		cacheStore = cache.NewRedisStore(redisClient, "starter:cache:")
+		pinStore = database.NewRedisPinStore(redisClient, "starter:pin:")
+	}
+
+	db, err := database.New(cfg, logger, pinStore)
+	if err != nil {
+		if redisClient != nil {
+			redisClient.Close()
+		}
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
 
-	server := &Server{
+	return &Server{
 		Config: cfg,
 		Logger: logger,
 		DB:     db,
-		// Redis:  redisClient,
-		Job:    jobService,
-	}
-
-	// Start metrics collection
-	// Runtime metrics are automatically collected by New Relic Go agent
-
-	return server, nil
+		Redis:  redisClient,
+		Cache:  cache.New(cacheStore, logger),
+	}, nil
 }
 
 func (s *Server) SetupHTTPServer(handler http.Handler) {
@@ -94,12 +116,25 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		return fmt.Errorf("failed to shutdown HTTP server: %w", err)
 	}
 
+	return s.Close()
+}
+
+// Close releases the server's connections; commands call it directly, having no
+// HTTP server to shut down
+func (s *Server) Close() error {
+	// Jobs still running use the database, so they finish before it closes
+	if s.Job != nil {
+		s.Job.Stop()
+	}
+
 	if err := s.DB.Close(); err != nil {
 		return fmt.Errorf("failed to close database connection: %w", err)
 	}
 
-	if s.Job != nil {
-		s.Job.Stop()
+	if s.Redis != nil {
+		if err := s.Redis.Close(); err != nil {
+			return fmt.Errorf("failed to close redis client: %w", err)
+		}
 	}
 
 	return nil
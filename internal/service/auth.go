@@ -1,18 +1,234 @@
 package service
 
 import (
-	"github.com/goku-m/starter/internal/server"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
 
-	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/goku-m/starter/internal/authz"
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/lib/password"
+	"github.com/goku-m/starter/internal/lib/session"
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/model/user"
+	"github.com/goku-m/starter/internal/repository"
+	"github.com/goku-m/starter/internal/server"
 )
 
 type AuthService struct {
-	server *server.Server
+	server   *server.Server
+	userRepo *repository.UserRepository
+	sessions session.Store
+
+	lastFailureSweep atomic.Int64
 }
 
-func NewAuthService(s *server.Server) *AuthService {
-	clerk.SetKey(s.Config.Auth.SecretKey)
+func NewAuthService(s *server.Server, userRepo *repository.UserRepository, sessions session.Store) *AuthService {
 	return &AuthService{
-		server: s,
+		server:   s,
+		userRepo: userRepo,
+		sessions: sessions,
+	}
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// Signup creates an account and signs it in, returning the new session's cookie value
+func (s *AuthService) Signup(ctx echo.Context, payload *user.SignupPayload) (*user.User, string, error) {
+	logger := middleware.GetLogger(ctx)
+
+	hash, err := password.Hash(payload.Password)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to hash password")
+		return nil, "", err
+	}
+
+	newUser, err := s.userRepo.CreateUser(ctx.Request().Context(), payload.Email, &hash)
+	if err != nil {
+		if isUniqueViolation(err) {
+			code := "EMAIL_TAKEN"
+			return nil, "", errs.NewConflictError("An account with this email already exists", true, &code)
+		}
+		logger.Error().Err(err).Msg("failed to create user")
+		return nil, "", err
+	}
+
+	token, err := s.startSession(ctx, newUser)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "user_signed_up").
+		Str("user_id", newUser.ID.String()).
+		Msg("User signed up")
+
+	return newUser, token, nil
+}
+
+// Login checks the credentials and starts a new session, or a two-factor challenge
+// for accounts that have it on
+func (s *AuthService) Login(ctx echo.Context, payload *user.LoginPayload) (*LoginResult, error) {
+	logger := middleware.GetLogger(ctx)
+	throttle := newLoginThrottle(payload.Email, ctx.RealIP())
+	invalid := func() (*LoginResult, error) {
+		s.recordLoginFailure(ctx, throttle)
+		return nil, errs.NewUnauthorizedError("Invalid email or password", true)
+	}
+
+	if err := s.checkLoginThrottle(ctx, throttle); err != nil {
+		return nil, err
+	}
+
+	account, err := s.userRepo.GetUserByEmail(ctx.Request().Context(), payload.Email)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			logger.Error().Err(err).Msg("failed to load user for login")
+			return nil, err
+		}
+
+		s.burnPasswordCheck(payload.Password)
+		return invalid()
 	}
+
+	// Accounts made through an OpenID provider can only sign in there
+	if account.PasswordHash == nil {
+		s.burnPasswordCheck(payload.Password)
+		return invalid()
+	}
+
+	ok, err := password.Verify(payload.Password, *account.PasswordHash)
+	if err != nil {
+		logger.Error().Err(err).Str("user_id", account.ID.String()).Msg("failed to verify password")
+		return nil, err
+	}
+	if !ok {
+		logger.Info().Str("event", "login_failed").Str("user_id", account.ID.String()).Msg("Login failed")
+		return invalid()
+	}
+	s.clearLoginFailures(ctx, throttle)
+
+	// Old hashes are upgraded while the plain password is at hand
+	if password.NeedsRehash(*account.PasswordHash) {
+		if hash, err := password.Hash(payload.Password); err == nil {
+			if err := s.userRepo.UpdatePasswordHash(ctx.Request().Context(), account.ID, hash); err != nil {
+				logger.Warn().Err(err).Msg("failed to upgrade password hash")
+			}
+		}
+	}
+
+	return s.finishLogin(ctx, account, "password", payload.Next)
+}
+
+// burnPasswordCheck spends the time a real password check would, so response times
+// don't reveal which emails have password accounts
+func (s *AuthService) burnPasswordCheck(plain string) {
+	dummyHashOnce.Do(func() { dummyHash, _ = password.Hash("not the password") })
+	_, _ = password.Verify(plain, dummyHash)
+}
+
+// Logout ends the session the request came with
+func (s *AuthService) Logout(ctx echo.Context) error {
+	logger := middleware.GetLogger(ctx)
+
+	cookie, err := ctx.Cookie(session.CookieName)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+
+	if err := s.sessions.Delete(ctx.Request().Context(), session.IDFromToken(cookie.Value)); err != nil {
+		logger.Error().Err(err).Msg("failed to delete session")
+		return err
+	}
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "user_logged_out").
+		Msg("User logged out")
+
+	return nil
+}
+
+// startSession always issues a fresh session id, dropping the one the browser came
+// with, so a session id planted before login is worthless afterwards
+func (s *AuthService) startSession(ctx echo.Context, account *user.User) (string, error) {
+	logger := middleware.GetLogger(ctx)
+	reqCtx := ctx.Request().Context()
+
+	if cookie, err := ctx.Cookie(session.CookieName); err == nil && cookie.Value != "" {
+		if err := s.sessions.Delete(reqCtx, session.IDFromToken(cookie.Value)); err != nil {
+			logger.Warn().Err(err).Msg("failed to delete previous session")
+		}
+	}
+
+	token, id, err := session.NewToken()
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to generate session token")
+		return "", err
+	}
+
+	ip := ctx.RealIP()
+	userAgent := ctx.Request().UserAgent()
+	now := time.Now()
+
+	if err := s.sessions.Create(reqCtx, &session.Session{
+		ID:         id,
+		CreatedAt:  now,
+		UserID:     account.ID.String(),
+		Role:       account.Role,
+		ExpiresAt:  now.Add(middleware.SessionTTL(s.server)),
+		LastSeenAt: now,
+		IP:         &ip,
+		UserAgent:  &userAgent,
+	}); err != nil {
+		logger.Error().Err(err).Msg("failed to create session")
+		return "", err
+	}
+
+	return token, nil
+}
+
+// SetUserRole changes what an account may do. Sessions hold the role they started
+// with, so the account's sessions are ended and it signs in again under the new one.
+// The caller's principal needs users:manage, which jobs and CLIs get from authz.System.
+func (s *AuthService) SetUserRole(ctx context.Context, userID uuid.UUID, role string) error {
+	if err := authz.Require(ctx, authz.UsersManage); err != nil {
+		return err
+	}
+
+	if !authz.ValidRole(role) {
+		code := "INVALID_ROLE"
+		return errs.NewBadRequestError("Unknown role: "+role, true, &code, nil, nil)
+	}
+
+	if err := s.userRepo.UpdateUserRole(ctx, userID, role); err != nil {
+		return err
+	}
+
+	if err := s.sessions.DeleteForUser(ctx, userID.String()); err != nil {
+		s.server.Logger.Error().Err(err).Str("user_id", userID.String()).Msg("failed to end sessions after role change")
+		return err
+	}
+
+	actor, _ := authz.PrincipalFrom(ctx)
+	s.server.Logger.Info().
+		Str("event", "user_role_changed").
+		Str("user_id", userID.String()).
+		Str("role", role).
+		Str("actor", actor.UserID).
+		Msg("User role changed")
+
+	return nil
 }
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/middleware"
+)
+
+const (
+	// After maxLoginFailuresPerAccount wrong passwords for one email, or
+	// maxLoginFailuresPerIP from one address, password logins are refused until
+	// loginFailureWindow has passed since the last one. The IP limit is higher since
+	// many users can share an address.
+	maxLoginFailuresPerAccount = 10
+	maxLoginFailuresPerIP      = 50
+	loginFailureWindow         = 15 * time.Minute
+
+	loginFailureSweepInterval = time.Hour
+	loginFailureSweepTimeout  = 30 * time.Second
+)
+
+// loginThrottle holds the keys one password login is counted under
+type loginThrottle struct {
+	account string
+	ip      string
+}
+
+// newLoginThrottle keys the account by a hash of its normalized email, so the table
+// holds no addresses and unknown emails are counted just like known ones
+func newLoginThrottle(email, ip string) loginThrottle {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return loginThrottle{
+		account: "email:" + hex.EncodeToString(sum[:]),
+		ip:      "ip:" + ip,
+	}
+}
+
+func (t loginThrottle) keys() []string {
+	return []string{t.account, t.ip}
+}
+
+// exceeded reports whether either key has reached its limit
+func (t loginThrottle) exceeded(failures map[string]int) bool {
+	return failures[t.account] >= maxLoginFailuresPerAccount || failures[t.ip] >= maxLoginFailuresPerIP
+}
+
+// checkLoginThrottle refuses a login once its email or IP has failed too often. It
+// runs before the password is looked at, so a locked-out guess costs nothing and
+// tells nothing.
+func (s *AuthService) checkLoginThrottle(ctx echo.Context, throttle loginThrottle) error {
+	logger := middleware.GetLogger(ctx)
+
+	failures, err := s.userRepo.GetLoginFailures(ctx.Request().Context(), throttle.keys(), time.Now().Add(-loginFailureWindow))
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to load login failures")
+		return err
+	}
+
+	if throttle.exceeded(failures) {
+		logger.Warn().
+			Str("event", "login_throttled").
+			Str("ip", ctx.RealIP()).
+			Msg("Login refused after too many failures")
+		return &errs.HTTPError{
+			Code:     "TOO_MANY_ATTEMPTS",
+			Message:  "Too many failed logins. Please wait a few minutes and try again.",
+			Status:   http.StatusTooManyRequests,
+			Override: true,
+		}
+	}
+
+	return nil
+}
+
+func (s *AuthService) recordLoginFailure(ctx echo.Context, throttle loginThrottle) {
+	logger := middleware.GetLogger(ctx)
+	now := time.Now()
+
+	if err := s.userRepo.RecordLoginFailure(ctx.Request().Context(), throttle.keys(), now, now.Add(-loginFailureWindow)); err != nil {
+		logger.Warn().Err(err).Msg("failed to record login failure")
+	}
+
+	s.maybeSweepLoginFailures()
+}
+
+// clearLoginFailures resets the account's count after a correct password. The IP's
+// count stays, or one valid account would let an address guess at every other.
+func (s *AuthService) clearLoginFailures(ctx echo.Context, throttle loginThrottle) {
+	logger := middleware.GetLogger(ctx)
+
+	if err := s.userRepo.ClearLoginFailures(ctx.Request().Context(), throttle.account); err != nil {
+		logger.Warn().Err(err).Msg("failed to clear login failures")
+	}
+}
+
+func (s *AuthService) maybeSweepLoginFailures() {
+	now := time.Now().Unix()
+	last := s.lastFailureSweep.Load()
+	if now-last < int64(loginFailureSweepInterval/time.Second) || !s.lastFailureSweep.CompareAndSwap(last, now) {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), loginFailureSweepTimeout)
+		defer cancel()
+
+		deleted, err := s.userRepo.DeleteLoginFailuresBefore(ctx, time.Now().Add(-loginFailureWindow))
+		if err != nil {
+			s.server.Logger.Error().Err(err).Msg("failed to delete expired login failures")
+			return
+		}
+		s.server.Logger.Debug().Int64("deleted", deleted).Msg("deleted expired login failures")
+	}()
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLoginThrottle(t *testing.T) {
+	throttle := newLoginThrottle("Ana@Example.com ", "203.0.113.7")
+
+	assert.Equal(t, newLoginThrottle("ana@example.com", "198.51.100.1").account, throttle.account, "emails are counted case-insensitively")
+	assert.NotEqual(t, newLoginThrottle("bob@example.com", "203.0.113.7").account, throttle.account)
+	assert.NotContains(t, throttle.account, "example.com", "addresses aren't stored")
+	assert.True(t, strings.HasPrefix(throttle.account, "email:"))
+	assert.Equal(t, "ip:203.0.113.7", throttle.ip)
+	assert.Equal(t, []string{throttle.account, throttle.ip}, throttle.keys())
+}
+
+func TestLoginThrottleExceeded(t *testing.T) {
+	throttle := newLoginThrottle("ana@example.com", "203.0.113.7")
+
+	tests := []struct {
+		name     string
+		failures map[string]int
+		want     bool
+	}{
+		{"no failures", map[string]int{}, false},
+		{"account below limit", map[string]int{throttle.account: maxLoginFailuresPerAccount - 1}, false},
+		{"account at limit", map[string]int{throttle.account: maxLoginFailuresPerAccount}, true},
+		{"ip below limit", map[string]int{throttle.ip: maxLoginFailuresPerIP - 1}, false},
+		{"ip at limit", map[string]int{throttle.ip: maxLoginFailuresPerIP}, true},
+		{"other keys", map[string]int{"ip:198.51.100.1": maxLoginFailuresPerIP}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, throttle.exceeded(tt.failures))
+		})
+	}
+}
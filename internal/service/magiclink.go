@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/lib/job"
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/model/user"
+)
+
+const (
+	MagicLinkPath = "/auth/magic"
+	magicLinkTTL  = 15 * time.Minute
+	// At most magicLinkLimit links go to one account per magicLinkWindow
+	magicLinkLimit  = 3
+	magicLinkWindow = time.Hour
+)
+
+// RequestMagicLink queues a sign-in link for the account with the given address. The
+// account is looked up by the worker, so the response is the same, and takes as long,
+// whether or not it exists or is over its limit, and the form can't be used to find
+// out who has an account.
+func (s *AuthService) RequestMagicLink(ctx echo.Context, payload *user.RequestMagicLinkPayload) error {
+	logger := middleware.GetLogger(ctx)
+
+	if s.server.Job == nil {
+		return &errs.HTTPError{
+			Code:     "MAGIC_LINKS_UNAVAILABLE",
+			Message:  "Sign-in links can't be sent right now. Please log in with your password.",
+			Status:   http.StatusServiceUnavailable,
+			Override: true,
+		}
+	}
+
+	task, err := job.NewMagicLinkRequestTask(payload.Email, payload.Next)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to create magic link request task")
+		return err
+	}
+	if _, err := s.server.Job.Client.Enqueue(task); err != nil {
+		logger.Error().Err(err).Msg("failed to enqueue magic link request task")
+		return err
+	}
+
+	return nil
+}
+
+// HandleMagicLinkRequestTask issues and emails a link, unless there is no such account
+// or it has been sent magicLinkLimit links within magicLinkWindow
+func (s *AuthService) HandleMagicLinkRequestTask(ctx context.Context, t *asynq.Task) error {
+	var p job.MagicLinkRequestPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("failed to unmarshal magic link request payload: %w", err)
+	}
+
+	logger := s.server.Logger.With().
+		Str("type", job.TaskMagicLinkRequest).
+		Logger()
+
+	account, err := s.userRepo.GetUserByEmail(ctx, p.Email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return fmt.Errorf("failed to generate magic link token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now()
+	created := false
+	err = WithTxContext(ctx, s.server.DB, func(ctx context.Context) error {
+		created = false
+
+		// Concurrent requests for the account wait here, so each one counts the links
+		// the others created and they can't all pass the limit together
+		if err := s.userRepo.LockUser(ctx, account.ID); err != nil {
+			return err
+		}
+
+		sent, err := s.userRepo.CountMagicLinksSince(ctx, account.ID, now.Add(-magicLinkWindow))
+		if err != nil {
+			return err
+		}
+		if sent >= magicLinkLimit {
+			return nil
+		}
+
+		if _, err := s.userRepo.CreateMagicLink(ctx, account.ID, s.hashMagicLinkToken(token), now.Add(magicLinkTTL)); err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	if err != nil {
+		// The account was deleted since it was looked up
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if !created {
+		logger.Warn().
+			Str("event", "magic_link_rate_limited").
+			Str("user_id", account.ID.String()).
+			Msg("Magic link not sent, too many requested")
+		return nil
+	}
+
+	task, err := job.NewMagicLinkEmailTask(account.Email, s.magicLinkURL(token, p.Next), fmt.Sprintf("%d minutes", int(magicLinkTTL.Minutes())))
+	if err != nil {
+		return fmt.Errorf("failed to create magic link email task: %w", err)
+	}
+	if _, err := s.server.Job.Client.EnqueueContext(ctx, task); err != nil {
+		return fmt.Errorf("failed to enqueue magic link email task: %w", err)
+	}
+
+	// Business event log
+	logger.Info().
+		Str("event", "magic_link_requested").
+		Str("user_id", account.ID.String()).
+		Msg("Magic link requested")
+
+	return nil
+}
+
+// LoginWithMagicLink spends a link and starts a session for its account, or a
+// two-factor challenge for accounts that have it on
+func (s *AuthService) LoginWithMagicLink(ctx echo.Context, payload *user.MagicLinkPayload) (*LoginResult, error) {
+	logger := middleware.GetLogger(ctx)
+	reqCtx := ctx.Request().Context()
+
+	link, err := s.userRepo.UseMagicLink(reqCtx, s.hashMagicLinkToken(payload.Token), time.Now())
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			code := "MAGIC_LINK_INVALID"
+			return nil, errs.NewBadRequestError("This sign-in link has expired or was already used. Please request a new one.", true, &code, nil, nil)
+		}
+		logger.Error().Err(err).Msg("failed to use magic link")
+		return nil, err
+	}
+
+	account, err := s.userRepo.GetUserByID(reqCtx, link.UserID)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to load magic link user")
+		return nil, err
+	}
+
+	return s.finishLogin(ctx, account, "magic_link", payload.Next)
+}
+
+// hashMagicLinkToken keys the hash with the server secret, so rows read out of the
+// database can't be matched against guessed tokens
+func (s *AuthService) hashMagicLinkToken(token string) string {
+	mac := hmac.New(sha256.New, []byte(s.server.Config.Auth.SecretKey))
+	mac.Write([]byte("magic-link:" + token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *AuthService) magicLinkURL(token, next string) string {
+	query := url.Values{"token": {token}}
+	if next != "" {
+		query.Set("next", next)
+	}
+	return fmt.Sprintf("%s%s?%s", s.server.Config.Server.BaseURL(), MagicLinkPath, query.Encode())
+}
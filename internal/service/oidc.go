@@ -0,0 +1,398 @@
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/labstack/echo/v4"
+
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/lib/oidc"
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/model/user"
+	"github.com/goku-m/starter/internal/repository"
+	"github.com/goku-m/starter/internal/server"
+	"github.com/goku-m/starter/internal/sqlerr"
+)
+
+const (
+	OIDCCallbackPath    = "/auth/oidc/callback"
+	defaultProviderName = "SSO"
+	// How long a user has to finish signing in at the provider
+	oidcFlowTTL = 10 * time.Minute
+)
+
+// oidcFlow is what the browser carries between starting a login and the callback. It
+// is signed, so it can sit in a cookie without being stored server-side.
+type oidcFlow struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"codeVerifier"`
+	Next         string `json:"next"`
+	// LinkUserID is set when a signed-in user is adding the provider to their account
+	LinkUserID string `json:"linkUserId,omitempty"`
+	ExpiresAt  int64  `json:"expiresAt"`
+}
+
+// OIDCResult says how a completed callback went: a login, which for accounts with
+// two-factor on still needs a code, or an identity linked to the account already
+// signed in
+type OIDCResult struct {
+	*LoginResult
+	Linked bool
+}
+
+type OIDCService struct {
+	server       *server.Server
+	authService  *AuthService
+	userRepo     *repository.UserRepository
+	provider     *oidc.Provider
+	providerName string
+}
+
+func NewOIDCService(s *server.Server, authService *AuthService, userRepo *repository.UserRepository) *OIDCService {
+	cfg := s.Config.Auth
+
+	service := &OIDCService{
+		server:       s,
+		authService:  authService,
+		userRepo:     userRepo,
+		providerName: cfg.OIDCProviderName,
+	}
+	if service.providerName == "" {
+		service.providerName = defaultProviderName
+	}
+
+	if cfg.OIDCEnabled() {
+		service.provider = oidc.NewProvider(oidc.Config{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  s.Config.Server.BaseURL() + OIDCCallbackPath,
+			Scopes:       cfg.OIDCScopes,
+		}, nil, s.Logger)
+	}
+
+	return service
+}
+
+// Enabled reports whether an OpenID provider is configured
+func (s *OIDCService) Enabled() bool {
+	return s.provider != nil
+}
+
+func (s *OIDCService) ProviderName() string {
+	return s.providerName
+}
+
+// Start begins a login, or a link when linkUserID is set. It returns the provider URL
+// to send the browser to and the flow value the browser must bring back.
+func (s *OIDCService) Start(ctx echo.Context, next, linkUserID string) (string, string, error) {
+	logger := middleware.GetLogger(ctx)
+
+	if !s.Enabled() {
+		code := "OIDC_DISABLED"
+		return "", "", errs.NewNotFoundError("Single sign-on is not configured", true, &code)
+	}
+
+	flow := &oidcFlow{
+		Next:       next,
+		LinkUserID: linkUserID,
+		ExpiresAt:  time.Now().Add(oidcFlowTTL).Unix(),
+	}
+	for _, value := range []*string{&flow.State, &flow.Nonce, &flow.CodeVerifier} {
+		random, err := oidc.RandomString()
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to generate oidc flow values")
+			return "", "", err
+		}
+		*value = random
+	}
+
+	authURL, err := s.provider.AuthCodeURL(ctx.Request().Context(), flow.State, flow.Nonce, flow.CodeVerifier)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to build oidc authorization url")
+		return "", "", s.unavailable()
+	}
+
+	sealed, err := s.sealFlow(flow)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to seal oidc flow")
+		return "", "", err
+	}
+
+	return authURL, sealed, nil
+}
+
+// Callback finishes the flow the browser started: it checks the response belongs to
+// that flow, redeems the code and signs the identity in, provisioning or linking an
+// account as needed
+func (s *OIDCService) Callback(ctx echo.Context, payload *user.OIDCCallbackPayload, sealedFlow string) (*OIDCResult, error) {
+	logger := middleware.GetLogger(ctx)
+	failed := errs.NewUnauthorizedError("Signing in with "+s.providerName+" failed. Please try again.", true)
+
+	if !s.Enabled() {
+		code := "OIDC_DISABLED"
+		return nil, errs.NewNotFoundError("Single sign-on is not configured", true, &code)
+	}
+
+	flow, ok := s.openFlow(sealedFlow)
+	if !ok || subtle.ConstantTimeCompare([]byte(flow.State), []byte(payload.State)) != 1 {
+		logger.Warn().Str("event", "oidc_state_mismatch").Msg("OIDC callback does not match a flow started by this browser")
+		return nil, failed
+	}
+
+	if payload.Error != "" {
+		logger.Info().
+			Str("event", "oidc_login_failed").
+			Str("error", payload.Error).
+			Str("error_description", payload.ErrorDescription).
+			Msg("OIDC provider returned an error")
+		return nil, failed
+	}
+	if payload.Code == "" {
+		return nil, failed
+	}
+
+	identity, err := s.provider.Exchange(ctx.Request().Context(), payload.Code, flow.CodeVerifier, flow.Nonce)
+	if err != nil {
+		if errors.Is(err, oidc.ErrInvalidResponse) {
+			logger.Warn().Err(err).Str("event", "oidc_login_failed").Msg("rejected OIDC response")
+			return nil, failed
+		}
+		logger.Error().Err(err).Msg("failed to complete oidc code exchange")
+		return nil, s.unavailable()
+	}
+
+	if flow.LinkUserID != "" {
+		if err := s.link(ctx, flow.LinkUserID, identity); err != nil {
+			return nil, err
+		}
+		return &OIDCResult{Linked: true}, nil
+	}
+
+	userID, err := s.resolve(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := s.userRepo.GetUserByID(ctx.Request().Context(), userID)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to load oidc user")
+		return nil, err
+	}
+
+	// Same as a password login: accounts with two-factor on still need their code
+	result, err := s.authService.finishLogin(ctx, account, "oidc", flow.Next)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCResult{LoginResult: result}, nil
+}
+
+// resolve finds the account an identity signs into, creating it on first login
+func (s *OIDCService) resolve(ctx echo.Context, identity *oidc.Identity) (uuid.UUID, error) {
+	logger := middleware.GetLogger(ctx)
+	reqCtx := ctx.Request().Context()
+	email := optionalString(identity.Email)
+
+	existing, err := s.userRepo.GetIdentity(reqCtx, identity.Issuer, identity.Subject)
+	if err == nil {
+		if err := s.userRepo.UpdateIdentityEmail(reqCtx, existing.ID, email); err != nil {
+			logger.Warn().Err(err).Msg("failed to update identity email")
+		}
+		return existing.UserID, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		logger.Error().Err(err).Msg("failed to load identity")
+		return uuid.Nil, err
+	}
+
+	if identity.Email == "" {
+		code := "OIDC_EMAIL_REQUIRED"
+		return uuid.Nil, errs.NewBadRequestError(s.providerName+" did not share an email address, which is needed to create an account", true, &code, nil, nil)
+	}
+
+	var userID uuid.UUID
+	err = WithTx(ctx, s.server.DB, func(ctx echo.Context) error {
+		reqCtx := ctx.Request().Context()
+
+		account, err := s.userRepo.GetUserByEmail(reqCtx, identity.Email)
+		switch {
+		case err == nil:
+			if !s.mayClaimAccount(identity) {
+				code := "ACCOUNT_EXISTS"
+				return errs.NewConflictError("An account with this email already exists. Log in with your password, then link "+s.providerName+" from your account page.", true, &code)
+			}
+		case errors.Is(err, pgx.ErrNoRows):
+			account, err = s.userRepo.CreateUser(reqCtx, identity.Email, nil)
+			if err != nil {
+				return err
+			}
+			logger.Info().
+				Str("event", "user_signed_up").
+				Str("user_id", account.ID.String()).
+				Str("method", "oidc").
+				Msg("User signed up")
+		default:
+			return err
+		}
+
+		if _, err := s.userRepo.CreateIdentity(reqCtx, account.ID, identity.Issuer, identity.Subject, email); err != nil {
+			return err
+		}
+		userID = account.ID
+		return nil
+	})
+	if err != nil {
+		var httpErr *errs.HTTPError
+		if errors.As(err, &httpErr) {
+			return uuid.Nil, err
+		}
+		// Someone finished the same first login in parallel; the identity is there now
+		if isUniqueViolation(err) {
+			if existing, err := s.userRepo.GetIdentity(reqCtx, identity.Issuer, identity.Subject); err == nil {
+				return existing.UserID, nil
+			}
+		}
+		logger.Error().Err(err).Msg("failed to provision oidc user")
+		return uuid.Nil, err
+	}
+
+	return userID, nil
+}
+
+// mayClaimAccount reports whether an identity may sign into an existing account by its
+// email. Only a provider trusted to vouch for the address may, and only for an address
+// it has verified, since someone else may have created the account with it.
+func (s *OIDCService) mayClaimAccount(identity *oidc.Identity) bool {
+	return s.server.Config.Auth.OIDCTrustEmail && identity.Email != "" && identity.EmailVerified
+}
+
+func (s *OIDCService) link(ctx echo.Context, linkUserID string, identity *oidc.Identity) error {
+	logger := middleware.GetLogger(ctx)
+	reqCtx := ctx.Request().Context()
+
+	// The flow was started by this account; it must still be the one signed in
+	if middleware.GetUserID(ctx) != linkUserID {
+		return errs.NewUnauthorizedError("Signing in with "+s.providerName+" failed. Please try again.", true)
+	}
+	accountID, err := uuid.Parse(linkUserID)
+	if err != nil {
+		return accountNotFound()
+	}
+
+	item, err := s.userRepo.CreateIdentity(reqCtx, accountID, identity.Issuer, identity.Subject, optionalString(identity.Email))
+	if err != nil {
+		if isUniqueViolation(err) {
+			existing, getErr := s.userRepo.GetIdentity(reqCtx, identity.Issuer, identity.Subject)
+			if getErr == nil && existing.UserID == accountID {
+				return nil
+			}
+			code := "IDENTITY_IN_USE"
+			return errs.NewConflictError("This "+s.providerName+" account is already linked to another user", true, &code)
+		}
+		logger.Error().Err(err).Msg("failed to link identity")
+		return err
+	}
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "identity_linked").
+		Str("identity_id", item.ID.String()).
+		Str("issuer", item.Issuer).
+		Msg("Identity linked successfully")
+
+	return nil
+}
+
+// GetAccount returns the signed-in built-in account with its linked identities
+func (s *OIDCService) GetAccount(ctx echo.Context, userID string) (*user.User, []user.Identity, error) {
+	logger := middleware.GetLogger(ctx)
+
+	account, err := s.authService.getAccount(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	identities, err := s.userRepo.GetIdentities(ctx.Request().Context(), account.ID)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to fetch identities")
+		return nil, nil, err
+	}
+
+	return account, identities, nil
+}
+
+// UnlinkIdentity removes a linked identity, unless it is the account's only way in
+func (s *OIDCService) UnlinkIdentity(ctx echo.Context, userID string, identityID uuid.UUID) error {
+	logger := middleware.GetLogger(ctx)
+
+	account, identities, err := s.GetAccount(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if account.PasswordHash == nil && len(identities) <= 1 {
+		code := "LAST_LOGIN_METHOD"
+		return errs.NewConflictError("This is the only way to sign into your account, so it can't be removed", true, &code)
+	}
+
+	if err := s.userRepo.DeleteIdentity(ctx.Request().Context(), account.ID, identityID); err != nil {
+		logger.Error().Err(err).Msg("failed to unlink identity")
+		return err
+	}
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "identity_unlinked").
+		Str("identity_id", identityID.String()).
+		Msg("Identity unlinked successfully")
+
+	return nil
+}
+
+func (s *OIDCService) sealFlow(flow *oidcFlow) (string, error) {
+	return seal(s.server.Config.Auth.SecretKey, "oidc-flow", flow)
+}
+
+func (s *OIDCService) openFlow(sealed string) (*oidcFlow, bool) {
+	var flow oidcFlow
+	if !unseal(s.server.Config.Auth.SecretKey, "oidc-flow", sealed, &flow) || time.Now().Unix() > flow.ExpiresAt {
+		return nil, false
+	}
+	return &flow, true
+}
+
+func (s *OIDCService) unavailable() error {
+	return &errs.HTTPError{
+		Code:     "OIDC_UNAVAILABLE",
+		Message:  s.providerName + " is unavailable right now. Please try again later.",
+		Status:   http.StatusServiceUnavailable,
+		Override: true,
+	}
+}
+
+func accountNotFound() error {
+	code := "ACCOUNT_NOT_FOUND"
+	return errs.NewNotFoundError("Account settings are only available for accounts created here", true, &code)
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && sqlerr.ErrCode(sqlerr.ConvertPgError(pgErr)) == sqlerr.UniqueViolation
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goku-m/starter/internal/config"
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/lib/oidc"
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/model/user"
+	"github.com/goku-m/starter/internal/server"
+)
+
+// newTestOIDCService is configured for a provider it never reaches; the paths tested
+// here are all decided before the code exchange or the database
+func newTestOIDCService(trustEmail bool) *OIDCService {
+	logger := zerolog.Nop()
+	return NewOIDCService(&server.Server{
+		Logger: &logger,
+		Config: &config.Config{
+			Auth: config.AuthConfig{
+				SecretKey:      "0123456789abcdef0123456789abcdef",
+				OIDCIssuer:     "https://issuer.example.com",
+				OIDCClientID:   "starter",
+				OIDCTrustEmail: trustEmail,
+			},
+		},
+	}, nil, nil)
+}
+
+func newOIDCContext(userID string) echo.Context {
+	req := httptest.NewRequest(http.MethodGet, OIDCCallbackPath, nil)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	if userID != "" {
+		c.Set(middleware.UserIDKey, userID)
+	}
+	return c
+}
+
+func assertUnauthorized(t *testing.T, err error) {
+	t.Helper()
+
+	var httpErr *errs.HTTPError
+	require.True(t, errors.As(err, &httpErr), "got %v", err)
+	assert.Equal(t, http.StatusUnauthorized, httpErr.Status)
+}
+
+func TestOIDCCallbackRejectsForeignFlows(t *testing.T) {
+	s := newTestOIDCService(false)
+
+	sealed := func(flow oidcFlow) string {
+		value, err := s.sealFlow(&flow)
+		require.NoError(t, err)
+		return value
+	}
+	live := oidcFlow{State: "state-1", Nonce: "nonce", CodeVerifier: "verifier", ExpiresAt: time.Now().Add(time.Minute).Unix()}
+	expired := live
+	expired.ExpiresAt = time.Now().Add(-time.Second).Unix()
+
+	other := newTestOIDCService(false)
+	other.server.Config.Auth.SecretKey = "fedcba9876543210fedcba9876543210"
+	forged, err := other.sealFlow(&live)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		state string
+		flow  string
+	}{
+		{"state mismatch", "state-2", sealed(live)},
+		{"no flow", "state-1", ""},
+		{"expired flow", "state-1", sealed(expired)},
+		{"tampered flow", "state-1", sealed(live) + "x"},
+		{"flow sealed with another key", "state-1", forged},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := &user.OIDCCallbackPayload{Code: "code", State: tt.state}
+
+			result, err := s.Callback(newOIDCContext(""), payload, tt.flow)
+			assert.Nil(t, result)
+			assertUnauthorized(t, err)
+		})
+	}
+}
+
+func TestOIDCCallbackProviderError(t *testing.T) {
+	s := newTestOIDCService(false)
+	flow, err := s.sealFlow(&oidcFlow{State: "state-1", ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	require.NoError(t, err)
+
+	for _, payload := range []*user.OIDCCallbackPayload{
+		{State: "state-1", Error: "access_denied"},
+		{State: "state-1"},
+	} {
+		_, err := s.Callback(newOIDCContext(""), payload, flow)
+		assertUnauthorized(t, err)
+	}
+}
+
+func TestOIDCLinkRequiresSameUser(t *testing.T) {
+	s := newTestOIDCService(false)
+	identity := &oidc.Identity{Issuer: "https://issuer.example.com", Subject: "user-1"}
+
+	// The account that started the link signed out, or another one signed in
+	for _, signedIn := range []string{"", "9b2f4c3e-2f59-4a8e-9a4c-5b8c7d1e0f21"} {
+		err := s.link(newOIDCContext(signedIn), "0d7e0c56-1c39-4f4a-8b0e-4d7f6a3b2c10", identity)
+		assertUnauthorized(t, err)
+	}
+}
+
+func TestOIDCMayClaimAccount(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustEmail bool
+		identity   oidc.Identity
+		want       bool
+	}{
+		{"trusted and verified", true, oidc.Identity{Email: "ana@example.com", EmailVerified: true}, true},
+		{"trusted but unverified", true, oidc.Identity{Email: "ana@example.com"}, false},
+		{"trusted without email", true, oidc.Identity{EmailVerified: true}, false},
+		{"verified but not trusted", false, oidc.Identity{Email: "ana@example.com", EmailVerified: true}, false},
+		{"neither", false, oidc.Identity{Email: "ana@example.com"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestOIDCService(tt.trustEmail)
+			assert.Equal(t, tt.want, s.mayClaimAccount(&tt.identity))
+		})
+	}
+}
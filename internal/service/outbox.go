@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/goku-m/starter/internal/model/outbox"
+	"github.com/goku-m/starter/internal/repository"
+	"github.com/goku-m/starter/internal/server"
+)
+
+const (
+	outboxBatchSize       = 100
+	outboxPollInterval    = time.Second
+	outboxMaxAttempts     = 20
+	outboxBaseRetryDelay  = time.Second
+	outboxMaxRetryDelay   = 5 * time.Minute
+	outboxRetention       = 7 * 24 * time.Hour
+	outboxCleanupInterval = time.Hour
+)
+
+// OutboxSink receives every relayed message. Delivery is at-least-once, so sinks must
+// tolerate seeing the same message id twice.
+type OutboxSink func(ctx context.Context, msg outbox.Message) error
+
+type namedSink struct {
+	name string
+	sink OutboxSink
+}
+
+// OutboxService relays committed outbox rows to the registered sinks. Only one relay
+// runs at a time across instances, and messages of the same aggregate are published in
+// order: a failing message holds back the later messages of its aggregate until it succeeds.
+type OutboxService struct {
+	server     *server.Server
+	outboxRepo *repository.OutboxRepository
+
+	mu    sync.RWMutex
+	sinks []namedSink
+}
+
+func NewOutboxService(server *server.Server, outboxRepo *repository.OutboxRepository) *OutboxService {
+	return &OutboxService{
+		server:     server,
+		outboxRepo: outboxRepo,
+	}
+}
+
+func (s *OutboxService) RegisterSink(name string, sink OutboxSink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sinks = append(s.sinks, namedSink{name: name, sink: sink})
+}
+
+// Run relays pending messages until ctx is cancelled
+func (s *OutboxService) Run(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	lastCleanup := time.Now()
+
+	for {
+		// Keep draining while full batches come back
+		for {
+			n, err := s.relayBatch(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					s.server.Logger.Error().Err(err).Msg("failed to relay outbox batch")
+				}
+				break
+			}
+			if n < outboxBatchSize {
+				break
+			}
+		}
+
+		if time.Since(lastCleanup) >= outboxCleanupInterval {
+			lastCleanup = time.Now()
+			deleted, err := s.outboxRepo.DeletePublishedBefore(ctx, time.Now().Add(-outboxRetention))
+			if err != nil {
+				s.server.Logger.Error().Err(err).Msg("failed to clean up published outbox messages")
+			} else {
+				s.server.Logger.Debug().Int64("deleted", deleted).Msg("cleaned up published outbox messages")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayBatch publishes one batch inside a transaction holding the relay lock and returns
+// how many messages it tried to publish; messages held back behind an earlier failure
+// in the batch don't count, so Run stops draining once only those are left. Rows are marked published only when the transaction
+// commits, so a crash mid-batch republishes them.
+func (s *OutboxService) relayBatch(ctx context.Context) (int, error) {
+	tx, err := s.server.DB.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	locked, err := s.outboxRepo.LockRelay(ctx, tx)
+	if err != nil || !locked {
+		return 0, err
+	}
+
+	messages, err := s.outboxRepo.GetPending(ctx, tx, outboxBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	blocked := make(map[string]bool)
+	published := make([]int64, 0, len(messages))
+	attempted := 0
+
+	for _, msg := range messages {
+		aggregate := msg.Aggregate()
+		if blocked[aggregate] {
+			continue
+		}
+
+		attempted++
+
+		if err := s.publish(ctx, msg); err != nil {
+			dead := msg.Attempts+1 >= outboxMaxAttempts
+			// A dead message no longer holds back its aggregate
+			blocked[aggregate] = !dead
+
+			logger := s.server.Logger.With().
+				Int64("outbox_id", msg.ID).
+				Str("aggregate", aggregate).
+				Str("event_type", msg.EventType).
+				Int("attempts", msg.Attempts+1).
+				Logger()
+			if dead {
+				logger.Error().Err(err).Msg("Giving up on outbox message")
+			} else {
+				logger.Warn().Err(err).Msg("Failed to publish outbox message")
+			}
+
+			if err := s.outboxRepo.RecordFailure(ctx, tx, msg.ID, err.Error(), now.Add(outboxRetryDelay(msg.Attempts)), dead); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		published = append(published, msg.ID)
+	}
+
+	if len(published) > 0 {
+		if err := s.outboxRepo.MarkPublished(ctx, tx, published); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return attempted, nil
+}
+
+func (s *OutboxService) publish(ctx context.Context, msg outbox.Message) error {
+	s.mu.RLock()
+	sinks := s.sinks
+	s.mu.RUnlock()
+
+	var errs []error
+	for _, sink := range sinks {
+		if err := sink.sink(ctx, msg); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", sink.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// outboxRetryDelay doubles the wait after each failed attempt: 1s, 2s, 4s ... capped at 5m
+func outboxRetryDelay(attempts int) time.Duration {
+	delay := outboxBaseRetryDelay << attempts
+	if delay <= 0 || delay > outboxMaxRetryDelay {
+		return outboxMaxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goku-m/starter/internal/model/outbox"
+	"github.com/goku-m/starter/internal/repository"
+	testutil "github.com/goku-m/starter/internal/testing"
+)
+
+// recordingSink collects the messages it is given
+type recordingSink struct {
+	mu       sync.Mutex
+	messages []outbox.Message
+}
+
+func (s *recordingSink) Sink(_ context.Context, msg outbox.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func TestRelayBatchSkipsBackingOffAggregates(t *testing.T) {
+	testDB, srv, cleanup := testutil.SetupTest(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// A message backing off, with more than a batch of its aggregate queued behind it
+	_, err := testDB.Pool.Exec(ctx, `
+		INSERT INTO
+			outbox (aggregate_type, aggregate_id, event_type, user_id, payload, attempts, next_attempt_at)
+		VALUES
+			('todo', 'blocked', 'todo.updated', 'user-1', '{}', 1, NOW() + INTERVAL '1 hour')
+	`)
+	require.NoError(t, err)
+	_, err = testDB.Pool.Exec(ctx, `
+		INSERT INTO
+			outbox (aggregate_type, aggregate_id, event_type, user_id, payload)
+		SELECT
+			'todo', 'blocked', 'todo.updated', 'user-1', '{}'
+		FROM
+			generate_series(1, @count)
+	`, pgx.NamedArgs{"count": outboxBatchSize + 50})
+	require.NoError(t, err)
+
+	// Newer aggregates that are due
+	_, err = testDB.Pool.Exec(ctx, `
+		INSERT INTO
+			outbox (aggregate_type, aggregate_id, event_type, user_id, payload)
+		SELECT
+			'todo', 'due-' || n, 'todo.created', 'user-1', '{}'
+		FROM
+			generate_series(1, 5) AS n
+	`)
+	require.NoError(t, err)
+
+	s := NewOutboxService(srv, repository.NewOutboxRepository(srv))
+	sink := &recordingSink{}
+	s.RegisterSink("test", sink.Sink)
+
+	n, err := s.relayBatch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 5, n, "only due messages are attempted")
+
+	require.Len(t, sink.messages, 5)
+	for _, msg := range sink.messages {
+		assert.NotEqual(t, "blocked", msg.AggregateID)
+	}
+
+	// Nothing is left to do, so Run stops draining instead of spinning on the backlog
+	n, err = s.relayBatch(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	var pending int
+	require.NoError(t, testDB.Pool.QueryRow(ctx, `
+		SELECT
+			COUNT(*)
+		FROM
+			outbox
+		WHERE
+			published_at IS NULL
+	`).Scan(&pending))
+	assert.Equal(t, outboxBatchSize+51, pending, "the blocked aggregate waits for its head")
+}
@@ -0,0 +1,360 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/lib/email"
+	"github.com/goku-m/starter/internal/lib/job"
+	"github.com/goku-m/starter/internal/lib/session"
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/model/privacy"
+	"github.com/goku-m/starter/internal/model/user"
+	"github.com/goku-m/starter/internal/repository"
+	"github.com/goku-m/starter/internal/server"
+)
+
+// exportLinkTTL is how long the emailed download link stays valid
+const exportLinkTTL = 7 * 24 * time.Hour
+
+type PrivacyService struct {
+	server      *server.Server
+	privacyRepo *repository.PrivacyRepository
+	userRepo    *repository.UserRepository
+	sessions    session.Store
+	emailClient *email.Client
+}
+
+func NewPrivacyService(server *server.Server, privacyRepo *repository.PrivacyRepository, userRepo *repository.UserRepository, sessions session.Store) *PrivacyService {
+	return &PrivacyService{
+		server:      server,
+		privacyRepo: privacyRepo,
+		userRepo:    userRepo,
+		sessions:    sessions,
+		emailClient: email.NewClient(server.Config, server.Logger),
+	}
+}
+
+// RequestExport queues an archive of the user's data; the link is emailed to the
+// account's address once it is built. Users without a built-in account have no address
+// on file and can't request one.
+func (s *PrivacyService) RequestExport(ctx echo.Context, userID string, payload *privacy.RequestExportPayload) (*privacy.DataExport, error) {
+	logger := middleware.GetLogger(ctx)
+
+	if s.server.Job == nil {
+		return nil, &errs.HTTPError{
+			Code:    "EXPORTS_UNAVAILABLE",
+			Message: "Data exports are not available right now",
+			Status:  http.StatusServiceUnavailable,
+		}
+	}
+
+	account, err := s.exportAccount(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export, err := s.privacyRepo.CreateExport(ctx.Request().Context(), userID, account.Email)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to create data export")
+		return nil, err
+	}
+
+	task, err := job.NewExportUserDataTask(export.ID)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to create data export task")
+		return nil, err
+	}
+	if _, err := s.server.Job.Client.Enqueue(task); err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+		logger.Error().Err(err).Msg("failed to enqueue data export task")
+		return nil, err
+	}
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "data_export_requested").
+		Str("export_id", export.ID.String()).
+		Msg("Data export requested")
+
+	return export, nil
+}
+
+// exportAccount is the account an export is mailed to. The address is the one the
+// account signs in with, so a stolen session or token can't send the archive elsewhere.
+func (s *PrivacyService) exportAccount(ctx echo.Context, userID string) (*user.User, error) {
+	noAccount := func() error {
+		code := "EXPORT_NO_EMAIL"
+		return errs.NewBadRequestError("There is no email address on this account to send the export to", true, &code, nil, nil)
+	}
+
+	accountID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, noAccount()
+	}
+
+	account, err := s.userRepo.GetUserByID(ctx.Request().Context(), accountID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, noAccount()
+		}
+		middleware.GetLogger(ctx).Error().Err(err).Msg("failed to load account for data export")
+		return nil, err
+	}
+
+	return account, nil
+}
+
+// HandleExportTask builds the archive, stores it behind a one-off token and emails the link
+func (s *PrivacyService) HandleExportTask(ctx context.Context, t *asynq.Task) error {
+	var p job.ExportUserDataPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("failed to unmarshal data export payload: %w", err)
+	}
+
+	logger := s.server.Logger.With().
+		Str("type", job.TaskExportUserData).
+		Str("export_id", p.ExportID.String()).
+		Logger()
+
+	export, err := s.privacyRepo.GetExportByID(ctx, p.ExportID)
+	if err != nil {
+		// The user erased their data after asking for the export
+		if errors.Is(err, pgx.ErrNoRows) {
+			logger.Info().Msg("Data export no longer exists, nothing to do")
+			return nil
+		}
+		return err
+	}
+
+	// Old archives are swept here rather than on a schedule; exports are rare enough
+	if n, err := s.privacyRepo.DeleteExpiredExportArchives(ctx); err != nil {
+		logger.Warn().Err(err).Msg("Failed to delete expired data export archives")
+	} else if n > 0 {
+		logger.Info().Int64("count", n).Msg("Deleted expired data export archives")
+	}
+
+	// A retry builds a new archive and mails a new link, replacing any earlier token
+	archive, err := s.buildArchive(ctx, export)
+	if err == nil {
+		err = s.publishExport(ctx, export, archive)
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to export user data")
+
+		// Only mark as failed once asynq has no retries left
+		retried, _ := asynq.GetRetryCount(ctx)
+		maxRetry, _ := asynq.GetMaxRetry(ctx)
+		if retried >= maxRetry {
+			if err := s.privacyRepo.FailExport(ctx, export.ID, err.Error()); err != nil {
+				logger.Error().Err(err).Msg("Failed to mark data export as failed")
+			}
+		}
+		return err
+	}
+
+	// Business event log
+	logger.Info().
+		Str("event", "data_export_ready").
+		Int("archive_bytes", len(archive)).
+		Msg("Data export emailed")
+
+	return nil
+}
+
+func (s *PrivacyService) buildArchive(ctx context.Context, export *privacy.DataExport) ([]byte, error) {
+	data, err := s.privacyRepo.GetUserData(ctx, export.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sessions come from the store, which is not always Postgres
+	if data.Sessions, err = s.sessions.List(ctx, export.UserID); err != nil {
+		return nil, fmt.Errorf("failed to list sessions for data export: %w", err)
+	}
+
+	files := []struct {
+		name    string
+		content any
+	}{
+		{"manifest.json", map[string]any{
+			"exportId":    export.ID,
+			"requestedAt": export.CreatedAt,
+			"generatedAt": time.Now().UTC(),
+			"counts": map[string]int{
+				"identities":        len(data.Identities),
+				"sessions":          len(data.Sessions),
+				"apiTokens":         len(data.APITokens),
+				"todos":             len(data.Todos),
+				"webhooks":          len(data.Webhooks),
+				"webhookDeliveries": len(data.Deliveries),
+				"events":            len(data.Events),
+				"dataExports":       len(data.Exports),
+			},
+		}},
+		{"account.json", data.Account},
+		{"identities.json", data.Identities},
+		{"sessions.json", data.Sessions},
+		{"api_tokens.json", data.APITokens},
+		{"todos.json", data.Todos},
+		{"webhooks.json", data.Webhooks},
+		{"webhook_deliveries.json", data.Deliveries},
+		{"events.json", data.Events},
+		{"data_exports.json", data.Exports},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s to export archive: %w", f.name, err)
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.content); err != nil {
+			return nil, fmt.Errorf("failed to write %s to export archive: %w", f.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish export archive: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (s *PrivacyService) publishExport(ctx context.Context, export *privacy.DataExport, archive []byte) error {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return fmt.Errorf("failed to generate download token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	expiresAt := time.Now().Add(exportLinkTTL)
+
+	// Only the hash is stored, so the database alone can't be used to download archives
+	if err := s.privacyRepo.CompleteExport(ctx, export.ID, archive, hashExportToken(token), expiresAt); err != nil {
+		return err
+	}
+
+	return s.emailClient.SendDataExportEmail(
+		export.Email,
+		s.downloadURL(export.ID, token),
+		expiresAt.UTC().Format("January 2, 2006 15:04 MST"),
+	)
+}
+
+func (s *PrivacyService) downloadURL(exportID uuid.UUID, token string) string {
+	return fmt.Sprintf("%s/api/v1/me/exports/%s/download?token=%s", s.server.Config.Server.BaseURL(), exportID, url.QueryEscape(token))
+}
+
+// DownloadExport returns the archive for a valid, unexpired link. The token is the
+// only credential, so the link works from any browser.
+func (s *PrivacyService) DownloadExport(ctx echo.Context, payload *privacy.DownloadExportPayload) ([]byte, error) {
+	archive, err := s.privacyRepo.GetExportArchive(ctx.Request().Context(), payload.ID, hashExportToken(payload.Token))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			code := "EXPORT_LINK_INVALID"
+			return nil, errs.NewNotFoundError("This download link is invalid or has expired", true, &code)
+		}
+		middleware.GetLogger(ctx).Error().Err(err).Msg("failed to load data export archive")
+		return nil, err
+	}
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "data_export_downloaded").
+		Str("export_id", payload.ID.String()).
+		Msg("Data export downloaded")
+
+	return archive, nil
+}
+
+// EraseUserData deletes every row keyed by the user and leaves an audit record that
+// names the subject only by a keyed hash. Both commit together or not at all.
+func (s *PrivacyService) EraseUserData(ctx echo.Context, userID string) (*privacy.ErasureRecord, error) {
+	logger := middleware.GetLogger(ctx)
+
+	var requestID *string
+	if id := middleware.GetRequestID(ctx); id != "" {
+		requestID = &id
+	}
+
+	var (
+		record  *privacy.ErasureRecord
+		todoIDs []uuid.UUID
+	)
+	err := WithTx(ctx, s.server.DB, func(ctx echo.Context) error {
+		var err error
+
+		todoIDs, err = s.privacyRepo.GetTodoIDs(ctx.Request().Context(), userID)
+		if err != nil {
+			return err
+		}
+
+		deleted, err := s.privacyRepo.EraseUserData(ctx.Request().Context(), userID)
+		if err != nil {
+			return err
+		}
+
+		record, err = s.privacyRepo.CreateErasureRecord(ctx.Request().Context(), s.subjectHash(userID), requestID, deleted)
+		return err
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to erase user data")
+		return nil, err
+	}
+
+	keys := []string{todoStatsCacheKey(userID)}
+	for _, id := range todoIDs {
+		keys = append(keys, todoCacheKey(userID, id))
+	}
+	s.server.Cache.Invalidate(ctx.Request().Context(), keys...)
+
+	// Postgres sessions went with the transaction; this covers the Redis store
+	if err := s.sessions.DeleteForUser(ctx.Request().Context(), userID); err != nil {
+		logger.Error().Err(err).Msg("failed to delete sessions of erased user")
+	}
+
+	// Business event log; the user id is deliberately left out
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "user_data_erased").
+		Str("erasure_id", record.ID.String()).
+		Interface("deleted_rows", record.DeletedRows).
+		Msg("User data erased")
+
+	return record, nil
+}
+
+// subjectHash lets an erasure be looked up for a known user id without the audit
+// table itself identifying anyone
+func (s *PrivacyService) subjectHash(userID string) string {
+	mac := hmac.New(sha256.New, []byte(s.server.Config.Auth.SecretKey))
+	mac.Write([]byte(userID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func hashExportToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
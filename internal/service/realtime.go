@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/model/event"
+	"github.com/goku-m/starter/internal/model/outbox"
+	"github.com/goku-m/starter/internal/repository"
+	"github.com/goku-m/starter/internal/server"
+)
+
+const (
+	subscriberBufferSize = 32
+	eventReplayLimit     = 500
+	eventRetention       = 24 * time.Hour
+	eventCleanupInterval = time.Hour
+	listenRetryDelay     = 5 * time.Second
+)
+
+// Subscription receives a user's events until it is closed
+type Subscription struct {
+	Events <-chan event.Event
+	events chan event.Event
+	userID string
+}
+
+// RealtimeService stores change events and fans them out to subscribers on every
+// instance via Postgres LISTEN/NOTIFY.
+type RealtimeService struct {
+	server    *server.Server
+	eventRepo *repository.EventRepository
+
+	mu          sync.RWMutex
+	subscribers map[string]map[*Subscription]struct{}
+}
+
+func NewRealtimeService(server *server.Server, eventRepo *repository.EventRepository) *RealtimeService {
+	return &RealtimeService{
+		server:      server,
+		eventRepo:   eventRepo,
+		subscribers: make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+// Publish records an event for the user; delivery to open streams happens through the listener
+func (s *RealtimeService) Publish(ctx context.Context, userID, eventType string, data any) (*event.Event, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event data: %w", err)
+	}
+
+	return s.eventRepo.CreateEvent(ctx, userID, eventType, body)
+}
+
+// Sink streams relayed outbox messages to the user's open connections
+func (s *RealtimeService) Sink(ctx context.Context, msg outbox.Message) error {
+	_, err := s.Publish(ctx, msg.UserID, msg.EventType, msg.Payload)
+	return err
+}
+
+// Replay returns events the user missed since lastID
+func (s *RealtimeService) Replay(ctx echo.Context, userID string, lastID int64) ([]event.Event, error) {
+	logger := middleware.GetLogger(ctx)
+
+	events, err := s.eventRepo.GetEventsSince(ctx.Request().Context(), userID, lastID, eventReplayLimit)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to replay events")
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (s *RealtimeService) Subscribe(userID string) *Subscription {
+	events := make(chan event.Event, subscriberBufferSize)
+	sub := &Subscription{Events: events, events: events, userID: userID}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.subscribers[userID] == nil {
+		s.subscribers[userID] = make(map[*Subscription]struct{})
+	}
+	s.subscribers[userID][sub] = struct{}{}
+
+	return sub
+}
+
+func (s *RealtimeService) Unsubscribe(sub *Subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeLocked(sub)
+}
+
+func (s *RealtimeService) removeLocked(sub *Subscription) {
+	subs, ok := s.subscribers[sub.userID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+
+	delete(subs, sub)
+	close(sub.events)
+	if len(subs) == 0 {
+		delete(s.subscribers, sub.userID)
+	}
+}
+
+func (s *RealtimeService) hasSubscribers(userID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.subscribers[userID]) > 0
+}
+
+// broadcast hands an event to local subscribers; a subscriber that cannot keep up is
+// dropped so the stream closes and the client resumes with Last-Event-ID.
+func (s *RealtimeService) broadcast(e event.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sub := range s.subscribers[e.UserID] {
+		select {
+		case sub.events <- e:
+		default:
+			s.removeLocked(sub)
+		}
+	}
+}
+
+// Run listens for events from all instances until ctx is cancelled, reconnecting on failure
+func (s *RealtimeService) Run(ctx context.Context) {
+	go s.cleanup(ctx)
+
+	for {
+		err := s.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.server.Logger.Error().Err(err).Msg("event listener stopped, reconnecting")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
+
+func (s *RealtimeService) listen(ctx context.Context) error {
+	conn, err := s.server.DB.Pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire listener connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+repository.EventsChannel); err != nil {
+		return fmt.Errorf("failed to listen on channel %s: %w", repository.EventsChannel, err)
+	}
+
+	s.server.Logger.Info().Str("channel", repository.EventsChannel).Msg("listening for events")
+
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var notification event.Notification
+		if err := json.Unmarshal([]byte(n.Payload), &notification); err != nil {
+			s.server.Logger.Warn().Err(err).Str("payload", n.Payload).Msg("ignoring malformed event notification")
+			continue
+		}
+
+		if !s.hasSubscribers(notification.UserID) {
+			continue
+		}
+
+		e, err := s.eventRepo.GetEventByID(ctx, notification.ID)
+		if err != nil {
+			s.server.Logger.Error().Err(err).Int64("event_id", notification.ID).Msg("failed to load notified event")
+			continue
+		}
+
+		s.broadcast(*e)
+	}
+}
+
+func (s *RealtimeService) cleanup(ctx context.Context) {
+	ticker := time.NewTicker(eventCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.eventRepo.DeleteEventsBefore(ctx, time.Now().Add(-eventRetention))
+			if err != nil {
+				s.server.Logger.Error().Err(err).Msg("failed to clean up old events")
+				continue
+			}
+			s.server.Logger.Debug().Int64("deleted", deleted).Msg("cleaned up old events")
+		}
+	}
+}
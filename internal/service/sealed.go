@@ -0,0 +1,48 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// seal signs v so it can make a round trip through the browser, in a cookie or form,
+// without being stored server-side. purpose is part of the signature, so a value
+// sealed for one flow is never accepted by another.
+func seal(secret, purpose string, v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(sealMAC(secret, purpose, payload)), nil
+}
+
+// unseal decodes a value from seal into v, reporting false when it was tampered with
+func unseal(secret, purpose, sealed string, v any) bool {
+	payload, mac, ok := strings.Cut(sealed, ".")
+	if !ok {
+		return false
+	}
+
+	sum, err := base64.RawURLEncoding.DecodeString(mac)
+	if err != nil || !hmac.Equal(sum, sealMAC(secret, purpose, payload)) {
+		return false
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return false
+	}
+
+	return json.Unmarshal(data, v) == nil
+}
+
+func sealMAC(secret, purpose, payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose + ":" + payload))
+	return mac.Sum(nil)
+}
@@ -7,13 +7,21 @@ import (
 )
 
 type Services struct {
-	Auth *AuthService
-	Job  *job.JobService
-	Todo *TodoService
+	Auth      *AuthService
+	OIDC      *OIDCService
+	Job       *job.JobService
+	Todo      *TodoService
+	Webhook   *WebhookService
+	Realtime  *RealtimeService
+	Outbox    *OutboxService
+	Privacy   *PrivacyService
+	APIToken  *APITokenService
+	TodoClaim *TodoClaimService
 }
 
 func NewServices(s *server.Server, repos *repository.Repositories) (*Services, error) {
-	authService := NewAuthService(s)
+	authService := NewAuthService(s, repos.User, repos.Session)
+	oidcService := NewOIDCService(s, authService, repos.User)
 
 	// s.Job.SetAuthService(authService)
 
@@ -22,9 +30,37 @@ func NewServices(s *server.Server, repos *repository.Repositories) (*Services, e
 	// 	return nil, fmt.Errorf("failed to create AWS client: %w", err)
 	// }
 
+	webhookService := NewWebhookService(s, repos.Webhook)
+	realtimeService := NewRealtimeService(s, repos.Event)
+	todoService := NewTodoService(s, repos.Todo)
+	privacyService := NewPrivacyService(s, repos.Privacy, repos.User, repos.Session)
+	apiTokenService := NewAPITokenService(s, repos.APIToken)
+	todoClaimService := NewTodoClaimService(s, repos.Todo, repos.User)
+
+	// Domain events written by repositories reach streams and webhooks through the outbox relay
+	outboxService := NewOutboxService(s, repos.Outbox)
+	outboxService.RegisterSink("realtime", realtimeService.Sink)
+
+	if s.Job != nil {
+		outboxService.RegisterSink("webhooks", webhookService.Sink)
+
+		s.Job.RegisterHandler(job.TaskMagicLinkRequest, authService.HandleMagicLinkRequestTask)
+		s.Job.RegisterHandler(job.TaskUnsnoozeTodo, todoService.HandleUnsnoozeTask)
+		s.Job.RegisterHandler(job.TaskWebhookDelivery, webhookService.HandleDeliveryTask)
+		s.Job.RegisterHandler(job.TaskOutboxEvent, webhookService.HandleOutboxTask)
+		s.Job.RegisterHandler(job.TaskExportUserData, privacyService.HandleExportTask)
+	}
+
 	return &Services{
-		Job:  s.Job,
-		Auth: authService,
-		Todo: NewTodoService(s, repos.Todo),
+		Job:       s.Job,
+		Auth:      authService,
+		OIDC:      oidcService,
+		Todo:      todoService,
+		Webhook:   webhookService,
+		Realtime:  realtimeService,
+		Outbox:    outboxService,
+		Privacy:   privacyService,
+		APIToken:  apiTokenService,
+		TodoClaim: todoClaimService,
 	}, nil
 }
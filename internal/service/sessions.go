@@ -0,0 +1,145 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/lib/password"
+	"github.com/goku-m/starter/internal/lib/session"
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/model/user"
+)
+
+// GetSessions lists where the user is signed in, marking the session the request came with
+func (s *AuthService) GetSessions(ctx echo.Context, userID string) ([]session.Active, error) {
+	logger := middleware.GetLogger(ctx)
+
+	sessions, err := s.sessions.List(ctx.Request().Context(), userID)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list sessions")
+		return nil, err
+	}
+
+	currentID := middleware.GetSessionID(ctx)
+	active := make([]session.Active, len(sessions))
+	for i, sess := range sessions {
+		active[i] = session.Active{
+			Session: sess,
+			Device:  session.Describe(sess.UserAgent),
+			Current: sess.ID == currentID,
+		}
+	}
+
+	return active, nil
+}
+
+// RevokeSession signs one of the user's sessions out. The auth middleware rejects
+// it from its next request on.
+func (s *AuthService) RevokeSession(ctx echo.Context, userID, sessionID string) error {
+	logger := middleware.GetLogger(ctx)
+	reqCtx := ctx.Request().Context()
+
+	sess, err := s.sessions.Get(reqCtx, sessionID)
+	if err != nil && !errors.Is(err, session.ErrNotFound) {
+		logger.Error().Err(err).Msg("failed to load session")
+		return err
+	}
+	// Other users' sessions are reported missing rather than forbidden
+	if sess == nil || sess.UserID != userID {
+		code := "SESSION_NOT_FOUND"
+		return errs.NewNotFoundError("session not found", false, &code)
+	}
+
+	if err := s.sessions.Delete(reqCtx, sessionID); err != nil {
+		logger.Error().Err(err).Msg("failed to revoke session")
+		return err
+	}
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "session_revoked").
+		Str("user_id", userID).
+		Msg("Session revoked")
+
+	return nil
+}
+
+// RevokeAllSessions logs the user out everywhere, including the current browser
+func (s *AuthService) RevokeAllSessions(ctx echo.Context, userID string) error {
+	logger := middleware.GetLogger(ctx)
+
+	if err := s.sessions.DeleteForUser(ctx.Request().Context(), userID); err != nil {
+		logger.Error().Err(err).Msg("failed to revoke sessions")
+		return err
+	}
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "sessions_revoked").
+		Str("user_id", userID).
+		Msg("All sessions revoked")
+
+	return nil
+}
+
+// ChangePassword replaces the user's password and ends every session, since any of
+// them may belong to whoever knew the old one. The browser making the change gets a
+// new session, returned as its cookie value.
+func (s *AuthService) ChangePassword(ctx echo.Context, userID string, payload *user.ChangePasswordPayload) (string, error) {
+	logger := middleware.GetLogger(ctx)
+	reqCtx := ctx.Request().Context()
+
+	account, err := s.getAccount(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if account.PasswordHash == nil {
+		code := "PASSWORD_REQUIRED"
+		return "", errs.NewConflictError("This account has no password to change", true, &code)
+	}
+
+	ok, err := password.Verify(payload.CurrentPassword, *account.PasswordHash)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to verify password")
+		return "", err
+	}
+	if !ok {
+		code := "INVALID_PASSWORD"
+		return "", errs.NewBadRequestError("Your current password is incorrect", true, &code, nil, nil)
+	}
+
+	hash, err := password.Hash(payload.NewPassword)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to hash password")
+		return "", err
+	}
+
+	if err := s.userRepo.UpdatePasswordHash(reqCtx, account.ID, hash); err != nil {
+		logger.Error().Err(err).Msg("failed to update password")
+		return "", err
+	}
+
+	if err := s.sessions.DeleteForUser(reqCtx, userID); err != nil {
+		logger.Error().Err(err).Msg("failed to revoke sessions after password change")
+		return "", err
+	}
+
+	token, err := s.startSession(ctx, account)
+	if err != nil {
+		return "", err
+	}
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "password_changed").
+		Str("user_id", userID).
+		Msg("Password changed, all sessions revoked")
+
+	return token, nil
+}
@@ -1,15 +1,30 @@
 package service
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
 	"github.com/labstack/echo/v4"
 
 	//"github.com/goku-m/starter/internal/lib/aws"
+	"github.com/goku-m/starter/internal/authz"
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/lib/cache"
+	"github.com/goku-m/starter/internal/lib/job"
+	"github.com/goku-m/starter/internal/lib/quickadd"
 	"github.com/goku-m/starter/internal/middleware"
 	"github.com/goku-m/starter/internal/model"
 	"github.com/goku-m/starter/internal/model/todo"
 	"github.com/goku-m/starter/internal/repository"
 	"github.com/goku-m/starter/internal/server"
+	"github.com/goku-m/starter/internal/validation"
 )
 
 type TodoService struct {
@@ -17,15 +32,43 @@ type TodoService struct {
 	todoRepo *repository.TodoRepository
 }
 
-func NewTodoService(server *server.Server, todoRepo *repository.TodoRepository,
-) *TodoService {
+func NewTodoService(server *server.Server, todoRepo *repository.TodoRepository) *TodoService {
 	return &TodoService{
 		server:   server,
 		todoRepo: todoRepo,
 	}
 }
 
+const (
+	todoCacheTTL = 5 * time.Minute
+	// Stats count overdue and snoozed todos, which change with time alone
+	todoStatsCacheTTL = 30 * time.Second
+)
+
+func todoCacheKey(userID string, todoID uuid.UUID) string {
+	return "todo:" + userID + ":" + todoID.String()
+}
+
+func todoStatsCacheKey(userID string) string {
+	return "todo_stats:" + userID
+}
+
+// invalidateTodo drops the cached reads a write to the todo made stale; pass uuid.Nil
+// when only the stats changed
+func (s *TodoService) invalidateTodo(ctx context.Context, userID string, todoID uuid.UUID) {
+	keys := []string{todoStatsCacheKey(userID)}
+	if todoID != uuid.Nil {
+		keys = append(keys, todoCacheKey(userID, todoID))
+	}
+
+	s.server.Cache.Invalidate(ctx, keys...)
+}
+
 func (s *TodoService) CreateTodo(ctx echo.Context, userID string, payload *todo.CreateTodoPayload) (*todo.Todo, error) {
+	if err := authz.Require(ctx.Request().Context(), authz.TodosWrite); err != nil {
+		return nil, err
+	}
+
 	logger := middleware.GetLogger(ctx)
 
 	// Validate parent todo exists and belongs to user (if provided)
@@ -36,22 +79,59 @@ func (s *TodoService) CreateTodo(ctx echo.Context, userID string, payload *todo.
 		return nil, err
 	}
 
+	s.invalidateTodo(ctx.Request().Context(), userID, uuid.Nil)
+
 	// Business event log
 	eventLogger := middleware.GetLogger(ctx)
 	eventLogger.Info().
 		Str("event", "todo_created").
 		Str("todo_id", todoItem.ID.String()).
 		Str("title", todoItem.Title).
-				Str("priority", string(todoItem.Priority)).
+		Str("priority", string(todoItem.Priority)).
 		Msg("Todo created successfully")
 
 	return todoItem, nil
 }
 
+// ParseTodo turns quick add text into a create payload without saving it
+func (s *TodoService) ParseTodo(ctx echo.Context, text string, loc *time.Location) (*todo.CreateTodoPayload, error) {
+	if err := authz.Require(ctx.Request().Context(), authz.TodosRead); err != nil {
+		return nil, err
+	}
+
+	logger := middleware.GetLogger(ctx)
+
+	payload, err := quickadd.Parse(text, time.Now().In(loc))
+	if err != nil {
+		if errors.Is(err, quickadd.ErrEmptyTitle) {
+			code := "TODO_TITLE_REQUIRED"
+			return nil, errs.NewBadRequestError("title is required", true, &code, []errs.FieldError{
+				{Field: "text", Error: "must contain a title besides dates, priorities and tags"},
+			}, nil)
+		}
+		logger.Error().Err(err).Msg("failed to parse quick add text")
+		return nil, err
+	}
+
+	if err := payload.Validate(); err != nil {
+		return nil, errs.ValidationError(err)
+	}
+
+	return payload, nil
+}
+
 func (s *TodoService) GetTodoByID(ctx echo.Context, userID string, todoID uuid.UUID) (*todo.PopulatedTodo, error) {
+	if err := authz.Require(ctx.Request().Context(), authz.TodosRead); err != nil {
+		return nil, err
+	}
+
 	logger := middleware.GetLogger(ctx)
 
-	todoItem, err := s.todoRepo.GetTodoByID(ctx.Request().Context(), userID, todoID)
+	todoItem, err := cache.GetOrLoad(ctx.Request().Context(), s.server.Cache, todoCacheKey(userID, todoID), todoCacheTTL,
+		func(c context.Context) (*todo.PopulatedTodo, error) {
+			return s.todoRepo.GetTodoByID(c, userID, todoID)
+		},
+	)
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to fetch todo by ID")
 		return nil, err
@@ -60,10 +140,30 @@ func (s *TodoService) GetTodoByID(ctx echo.Context, userID string, todoID uuid.U
 	return todoItem, nil
 }
 
-func (s *TodoService) GetTodos(ctx echo.Context, query *todo.GetTodosQuery) (*model.PaginatedResponse[todo.PopulatedTodo], error) {
+func (s *TodoService) GetTodosByIDs(ctx echo.Context, userID string, todoIDs []uuid.UUID) ([]todo.PopulatedTodo, error) {
+	if err := authz.Require(ctx.Request().Context(), authz.TodosRead); err != nil {
+		return nil, err
+	}
+
 	logger := middleware.GetLogger(ctx)
 
-	result, err := s.todoRepo.GetTodos(ctx.Request().Context(),  query)
+	items, err := s.todoRepo.GetTodosByIDs(ctx.Request().Context(), userID, todoIDs)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to fetch todos by IDs")
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (s *TodoService) GetTodos(ctx echo.Context, userID string, query *todo.GetTodosQuery) (*model.PaginatedResponse[todo.PopulatedTodo], error) {
+	if err := authz.Require(ctx.Request().Context(), authz.TodosRead); err != nil {
+		return nil, err
+	}
+
+	logger := middleware.GetLogger(ctx)
+
+	result, err := s.todoRepo.GetTodos(ctx.Request().Context(), userID, query)
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to fetch todos")
 		return nil, err
@@ -73,6 +173,10 @@ func (s *TodoService) GetTodos(ctx echo.Context, query *todo.GetTodosQuery) (*mo
 }
 
 func (s *TodoService) UpdateTodo(ctx echo.Context, userID string, payload *todo.UpdateTodoPayload) (*todo.Todo, error) {
+	if err := authz.Require(ctx.Request().Context(), authz.TodosWrite); err != nil {
+		return nil, err
+	}
+
 	logger := middleware.GetLogger(ctx)
 
 	updatedTodo, err := s.todoRepo.UpdateTodo(ctx.Request().Context(), userID, payload)
@@ -81,6 +185,8 @@ func (s *TodoService) UpdateTodo(ctx echo.Context, userID string, payload *todo.
 		return nil, err
 	}
 
+	s.invalidateTodo(ctx.Request().Context(), userID, updatedTodo.ID)
+
 	// Business event log
 	eventLogger := middleware.GetLogger(ctx)
 	eventLogger.Info().
@@ -94,7 +200,86 @@ func (s *TodoService) UpdateTodo(ctx echo.Context, userID string, payload *todo.
 	return updatedTodo, nil
 }
 
+// PatchTodo applies an RFC 7396 merge patch or RFC 6902 JSON patch to the editable
+// fields of a todo and validates the result before it is written
+func (s *TodoService) PatchTodo(ctx echo.Context, userID string, todoID uuid.UUID, patchType todo.PatchType, patch []byte) (*todo.Todo, error) {
+	if err := authz.Require(ctx.Request().Context(), authz.TodosWrite); err != nil {
+		return nil, err
+	}
+
+	logger := middleware.GetLogger(ctx)
+
+	apply := func(original []byte) ([]byte, error) {
+		return jsonpatch.MergePatch(original, patch)
+	}
+	if patchType == todo.PatchTypeJSON {
+		operations, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			code := "INVALID_PATCH"
+			return nil, errs.NewBadRequestError("invalid JSON patch: "+err.Error(), true, &code, nil, nil)
+		}
+		apply = operations.Apply
+	}
+
+	patchedTodo, err := s.todoRepo.PatchTodo(ctx.Request().Context(), userID, todoID, func(current *todo.Todo) (*todo.TodoDocument, error) {
+		return applyTodoPatch(current, apply)
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to patch todo")
+		return nil, err
+	}
+
+	s.invalidateTodo(ctx.Request().Context(), userID, todoID)
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "todo_patched").
+		Str("todo_id", patchedTodo.ID.String()).
+		Str("patch_type", string(patchType)).
+		Str("status", string(patchedTodo.Status)).
+		Msg("Todo patched successfully")
+
+	return patchedTodo, nil
+}
+
+func applyTodoPatch(current *todo.Todo, apply func(original []byte) ([]byte, error)) (*todo.TodoDocument, error) {
+	original, err := json.Marshal(todo.NewTodoDocument(current))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal todo document: %w", err)
+	}
+
+	patched, err := apply(original)
+	if err != nil {
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			code := "TODO_PATCH_TEST_FAILED"
+			return nil, errs.NewConflictError("patch test operation failed", true, &code)
+		}
+		code := "INVALID_PATCH"
+		return nil, errs.NewBadRequestError("patch could not be applied: "+err.Error(), true, &code, nil, nil)
+	}
+
+	// Only editable fields may appear in the result; patching e.g. "id" is an error
+	doc := &todo.TodoDocument{}
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(doc); err != nil {
+		code := "INVALID_PATCH"
+		return nil, errs.NewBadRequestError("patched todo is invalid: "+err.Error(), true, &code, nil, nil)
+	}
+
+	if err := validation.Validate(doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
 func (s *TodoService) DeleteTodo(ctx echo.Context, userID string, todoID uuid.UUID) error {
+	if err := authz.Require(ctx.Request().Context(), authz.TodosDelete); err != nil {
+		return err
+	}
+
 	logger := middleware.GetLogger(ctx)
 
 	err := s.todoRepo.DeleteTodo(ctx.Request().Context(), userID, todoID)
@@ -103,6 +288,8 @@ func (s *TodoService) DeleteTodo(ctx echo.Context, userID string, todoID uuid.UU
 		return err
 	}
 
+	s.invalidateTodo(ctx.Request().Context(), userID, todoID)
+
 	// Business event log
 	eventLogger := middleware.GetLogger(ctx)
 	eventLogger.Info().
@@ -113,10 +300,119 @@ func (s *TodoService) DeleteTodo(ctx echo.Context, userID string, todoID uuid.UU
 	return nil
 }
 
+func (s *TodoService) SnoozeTodo(ctx echo.Context, userID string, todoID uuid.UUID, until time.Time) (*todo.Todo, error) {
+	if err := authz.Require(ctx.Request().Context(), authz.TodosWrite); err != nil {
+		return nil, err
+	}
+
+	logger := middleware.GetLogger(ctx)
+
+	// Postgres keeps microseconds; truncate so the scheduled task can match the stored value
+	until = until.Truncate(time.Microsecond)
+
+	snoozedTodo, err := s.todoRepo.SnoozeTodo(ctx.Request().Context(), userID, todoID, until)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to snooze todo")
+		return nil, err
+	}
+
+	s.invalidateTodo(ctx.Request().Context(), userID, todoID)
+
+	// Listings already hide the todo by time, so a failed enqueue only delays the cleanup
+	if s.server.Job != nil {
+		task, err := job.NewUnsnoozeTodoTask(todoID, userID, until)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to create unsnooze task")
+		} else if _, err := s.server.Job.Client.Enqueue(task); err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+			logger.Error().Err(err).Msg("failed to enqueue unsnooze task")
+		}
+	}
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "todo_snoozed").
+		Str("todo_id", todoID.String()).
+		Time("snoozed_until", until).
+		Msg("Todo snoozed successfully")
+
+	return snoozedTodo, nil
+}
+
+func (s *TodoService) UnsnoozeTodo(ctx echo.Context, userID string, todoID uuid.UUID) (*todo.Todo, error) {
+	if err := authz.Require(ctx.Request().Context(), authz.TodosWrite); err != nil {
+		return nil, err
+	}
+
+	logger := middleware.GetLogger(ctx)
+
+	// The scheduled task is left in place; it no longer matches and becomes a no-op
+	unsnoozedTodo, err := s.todoRepo.UnsnoozeTodo(ctx.Request().Context(), userID, todoID)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to cancel todo snooze")
+		return nil, err
+	}
+
+	s.invalidateTodo(ctx.Request().Context(), userID, todoID)
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "todo_snooze_cancelled").
+		Str("todo_id", todoID.String()).
+		Msg("Todo snooze cancelled successfully")
+
+	return unsnoozedTodo, nil
+}
+
+// HandleUnsnoozeTask brings a todo back once its snooze time has passed
+func (s *TodoService) HandleUnsnoozeTask(ctx context.Context, t *asynq.Task) error {
+	var p job.UnsnoozeTodoPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("failed to unmarshal unsnooze todo payload: %w", err)
+	}
+
+	changed, err := s.todoRepo.ExpireSnooze(ctx, p.UserID, p.TodoID, p.Until)
+	if err != nil {
+		s.server.Logger.Error().
+			Str("type", job.TaskUnsnoozeTodo).
+			Str("todo_id", p.TodoID.String()).
+			Err(err).
+			Msg("Failed to unsnooze todo")
+		return err
+	}
+
+	if !changed {
+		s.server.Logger.Info().
+			Str("type", job.TaskUnsnoozeTodo).
+			Str("todo_id", p.TodoID.String()).
+			Msg("Snooze was cancelled or changed, nothing to do")
+		return nil
+	}
+
+	s.invalidateTodo(ctx, p.UserID, p.TodoID)
+
+	// Business event log
+	s.server.Logger.Info().
+		Str("event", "todo_unsnoozed").
+		Str("todo_id", p.TodoID.String()).
+		Msg("Todo snooze expired")
+
+	return nil
+}
+
 func (s *TodoService) GetTodoStats(ctx echo.Context, userID string) (*todo.TodoStats, error) {
+	if err := authz.Require(ctx.Request().Context(), authz.TodosRead); err != nil {
+		return nil, err
+	}
+
 	logger := middleware.GetLogger(ctx)
 
-	stats, err := s.todoRepo.GetTodoStats(ctx.Request().Context(), userID)
+	stats, err := cache.GetOrLoad(ctx.Request().Context(), s.server.Cache, todoStatsCacheKey(userID), todoStatsCacheTTL,
+		func(c context.Context) (*todo.TodoStats, error) {
+			return s.todoRepo.GetTodoStats(c, userID)
+		},
+	)
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to fetch todo statistics")
 		return nil, err
@@ -124,3 +420,112 @@ func (s *TodoService) GetTodoStats(ctx echo.Context, userID string) (*todo.TodoS
 
 	return stats, nil
 }
+
+const (
+	calendarDateLayout = "2006-01-02"
+	agendaWindowDays   = 30
+)
+
+func (s *TodoService) GetCalendar(ctx echo.Context, userID string, query *todo.GetCalendarQuery, loc *time.Location) (*todo.Calendar, error) {
+	if err := authz.Require(ctx.Request().Context(), authz.TodosRead); err != nil {
+		return nil, err
+	}
+
+	logger := middleware.GetLogger(ctx)
+
+	now := time.Now().In(loc)
+	anchor := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if query.Date != nil {
+		parsed, err := time.ParseInLocation(calendarDateLayout, *query.Date, loc)
+		if err != nil {
+			return nil, err
+		}
+		anchor = parsed
+	}
+
+	// Work out the visible window and the range of dates that belong to the period
+	var gridStart, gridEnd, rangeStart, rangeEnd, prev, next time.Time
+	var title string
+
+	switch *query.View {
+	case todo.CalendarViewWeek:
+		rangeStart = startOfWeek(anchor)
+		rangeEnd = rangeStart.AddDate(0, 0, 7)
+		gridStart, gridEnd = rangeStart, rangeEnd
+		prev, next = rangeStart.AddDate(0, 0, -7), rangeStart.AddDate(0, 0, 7)
+		title = rangeStart.Format("Jan 2") + " – " + rangeEnd.AddDate(0, 0, -1).Format("Jan 2, 2006")
+	case todo.CalendarViewAgenda:
+		rangeStart = anchor
+		rangeEnd = anchor.AddDate(0, 0, agendaWindowDays)
+		gridStart, gridEnd = rangeStart, rangeEnd
+		prev, next = anchor.AddDate(0, 0, -agendaWindowDays), rangeEnd
+		title = rangeStart.Format("Jan 2") + " – " + rangeEnd.AddDate(0, 0, -1).Format("Jan 2, 2006")
+	default:
+		rangeStart = time.Date(anchor.Year(), anchor.Month(), 1, 0, 0, 0, 0, loc)
+		rangeEnd = rangeStart.AddDate(0, 1, 0)
+		gridStart = startOfWeek(rangeStart)
+		gridEnd = startOfWeek(rangeEnd.AddDate(0, 0, -1)).AddDate(0, 0, 7)
+		prev, next = rangeStart.AddDate(0, -1, 0), rangeEnd
+		title = rangeStart.Format("January 2006")
+	}
+
+	todos, err := s.todoRepo.GetTodosByDueDateRange(ctx.Request().Context(), userID, gridStart, gridEnd)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to fetch todos for calendar")
+		return nil, err
+	}
+
+	// Bucket todos by their local due date
+	byDate := make(map[string][]todo.CalendarItem)
+	for _, t := range todos {
+		key := t.DueDate.In(loc).Format(calendarDateLayout)
+		byDate[key] = append(byDate[key], todo.NewCalendarItem(t, loc))
+	}
+
+	today := now.Format(calendarDateLayout)
+	days := []todo.CalendarDay{}
+	for d := gridStart; d.Before(gridEnd); d = d.AddDate(0, 0, 1) {
+		key := d.Format(calendarDateLayout)
+		days = append(days, todo.CalendarDay{
+			Date:    key,
+			Day:     d.Day(),
+			Weekday: d.Weekday().String()[:3],
+			InRange: !d.Before(rangeStart) && d.Before(rangeEnd),
+			IsToday: key == today,
+			Items:   byDate[key],
+		})
+	}
+
+	calendar := &todo.Calendar{
+		View:     *query.View,
+		Title:    title,
+		Timezone: loc.String(),
+		Date:     anchor.Format(calendarDateLayout),
+		Prev:     prev.Format(calendarDateLayout),
+		Next:     next.Format(calendarDateLayout),
+		Today:    today,
+		Weeks:    [][]todo.CalendarDay{},
+		Agenda:   []todo.CalendarDay{},
+	}
+
+	if *query.View == todo.CalendarViewAgenda {
+		for _, day := range days {
+			if len(day.Items) > 0 {
+				calendar.Agenda = append(calendar.Agenda, day)
+			}
+		}
+		return calendar, nil
+	}
+
+	for i := 0; i < len(days); i += 7 {
+		calendar.Weeks = append(calendar.Weeks, days[i:min(i+7, len(days))])
+	}
+
+	return calendar, nil
+}
+
+// startOfWeek returns local midnight of the Monday on or before t
+func startOfWeek(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+
+	"github.com/goku-m/starter/internal/authz"
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/model/user"
+	"github.com/goku-m/starter/internal/repository"
+	"github.com/goku-m/starter/internal/server"
+)
+
+// An offer is good for a week; after that the address may well belong to someone else
+const todoClaimTTL = 7 * 24 * time.Hour
+
+// Before accounts, todos were owned by the address they were created from. An account
+// is offered the todos of the address it first logs in from, and can take them over.
+type TodoClaimService struct {
+	server   *server.Server
+	todoRepo *repository.TodoRepository
+	userRepo *repository.UserRepository
+}
+
+func NewTodoClaimService(s *server.Server, todoRepo *repository.TodoRepository, userRepo *repository.UserRepository) *TodoClaimService {
+	return &TodoClaimService{
+		server:   s,
+		todoRepo: todoRepo,
+		userRepo: userRepo,
+	}
+}
+
+// todoClaim is a sealed offer of an address's todos to one account. It names the
+// address rather than the todos, so once they are claimed it has nothing left to move
+// and is spent.
+type todoClaim struct {
+	UserID    string `json:"userId"`
+	OwnerID   string `json:"ownerId"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// TodoOwnerRemap moves every todo owned by From to To. Todos is how many moved.
+type TodoOwnerRemap struct {
+	From  string
+	To    string
+	Todos int
+}
+
+var errRemapDryRun = errors.New("dry run")
+
+// OfferClaim returns a claim token for the todos of the address the account is
+// logging in from, or "" when there are none. Each account gets one offer, at its
+// first login; later logins from other addresses offer nothing.
+func (s *TodoClaimService) OfferClaim(ctx echo.Context, account *user.User) (string, error) {
+	logger := middleware.GetLogger(ctx)
+	reqCtx := ctx.Request().Context()
+
+	if account.TodoClaimOfferedAt != nil {
+		return "", nil
+	}
+
+	now := time.Now()
+	first, err := s.userRepo.MarkTodoClaimOffered(reqCtx, account.ID, now)
+	if err != nil || !first {
+		return "", err
+	}
+
+	ownerID := ctx.RealIP()
+	count, err := s.todoRepo.CountTodosByOwner(reqCtx, ownerID)
+	if err != nil || count == 0 {
+		return "", err
+	}
+
+	token, err := seal(s.server.Config.Auth.SecretKey, "todo-claim", &todoClaim{
+		UserID:    account.ID.String(),
+		OwnerID:   ownerID,
+		ExpiresAt: now.Add(todoClaimTTL).Unix(),
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to seal todo claim")
+		return "", err
+	}
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "todo_claim_offered").
+		Str("user_id", account.ID.String()).
+		Int("todos", count).
+		Msg("Todo claim offered")
+
+	return token, nil
+}
+
+// PendingClaim is how many todos a claim token would move, 0 when it isn't the
+// user's, has expired or was already claimed
+func (s *TodoClaimService) PendingClaim(ctx echo.Context, userID, token string) (int, error) {
+	claim, ok := s.openClaim(userID, token)
+	if !ok {
+		return 0, nil
+	}
+
+	return s.todoRepo.CountTodosByOwner(ctx.Request().Context(), claim.OwnerID)
+}
+
+// ClaimTodos moves the todos a claim token offers to the user, all or none
+func (s *TodoClaimService) ClaimTodos(ctx echo.Context, userID, token string) (int, error) {
+	logger := middleware.GetLogger(ctx)
+
+	if err := authz.Require(ctx.Request().Context(), authz.TodosWrite); err != nil {
+		return 0, err
+	}
+
+	claim, ok := s.openClaim(userID, token)
+	if !ok {
+		code := "TODO_CLAIM_INVALID"
+		return 0, errs.NewBadRequestError("This offer has expired. Ask an administrator to move your old todos.", true, &code, nil, nil)
+	}
+
+	var claimed []uuid.UUID
+	err := WithTx(ctx, s.server.DB, func(ctx echo.Context) error {
+		var err error
+		claimed, err = s.todoRepo.ReassignTodos(ctx.Request().Context(), claim.OwnerID, userID)
+		return err
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to claim todos")
+		return 0, err
+	}
+
+	s.invalidate(ctx.Request().Context(), claim.OwnerID, userID, claimed)
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "todos_claimed").
+		Str("user_id", userID).
+		Int("todos", len(claimed)).
+		Msg("Todos claimed")
+
+	return len(claimed), nil
+}
+
+// RemapTodoOwners applies remaps in one transaction, in order, filling in how many
+// todos each moved. A To containing "@" is taken as an account's email address. With
+// dryRun the counts are filled in and the transaction rolled back. The caller's
+// principal needs users:manage, which maintenance commands get from authz.System.
+func (s *TodoClaimService) RemapTodoOwners(ctx context.Context, remaps []TodoOwnerRemap, dryRun bool) error {
+	if err := authz.Require(ctx, authz.UsersManage); err != nil {
+		return err
+	}
+
+	for i := range remaps {
+		remap := &remaps[i]
+		remap.From = strings.TrimSpace(remap.From)
+		remap.To = strings.TrimSpace(remap.To)
+		if remap.From == "" || remap.To == "" || remap.From == remap.To {
+			code := "INVALID_REMAP"
+			return errs.NewBadRequestError(fmt.Sprintf("invalid remap %q -> %q", remap.From, remap.To), true, &code, nil, nil)
+		}
+
+		if strings.Contains(remap.To, "@") {
+			account, err := s.userRepo.GetUserByEmail(ctx, remap.To)
+			if err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					code := "USER_NOT_FOUND"
+					return errs.NewNotFoundError("no account with email "+remap.To, true, &code)
+				}
+				return err
+			}
+			remap.To = account.ID.String()
+		}
+	}
+
+	moved := make([][]uuid.UUID, len(remaps))
+	err := WithTxContext(ctx, s.server.DB, func(ctx context.Context) error {
+		for i := range remaps {
+			ids, err := s.todoRepo.ReassignTodos(ctx, remaps[i].From, remaps[i].To)
+			if err != nil {
+				return err
+			}
+			moved[i] = ids
+			remaps[i].Todos = len(ids)
+		}
+
+		if dryRun {
+			return errRemapDryRun
+		}
+		return nil
+	})
+	if dryRun && errors.Is(err, errRemapDryRun) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	actor, _ := authz.PrincipalFrom(ctx)
+	for i, remap := range remaps {
+		s.invalidate(ctx, remap.From, remap.To, moved[i])
+
+		s.server.Logger.Info().
+			Str("event", "todo_owner_remapped").
+			Str("from", remap.From).
+			Str("to", remap.To).
+			Int("todos", remap.Todos).
+			Str("actor", actor.UserID).
+			Msg("Todo owner remapped")
+	}
+
+	return nil
+}
+
+func (s *TodoClaimService) openClaim(userID, token string) (*todoClaim, bool) {
+	var claim todoClaim
+	if !unseal(s.server.Config.Auth.SecretKey, "todo-claim", token, &claim) {
+		return nil, false
+	}
+	if claim.UserID != userID || time.Now().Unix() > claim.ExpiresAt {
+		return nil, false
+	}
+	return &claim, true
+}
+
+// invalidate drops the cached reads of both owners that moving todos made stale
+func (s *TodoClaimService) invalidate(ctx context.Context, from, to string, todoIDs []uuid.UUID) {
+	keys := []string{todoStatsCacheKey(from), todoStatsCacheKey(to)}
+	for _, id := range todoIDs {
+		keys = append(keys, todoCacheKey(from, id))
+	}
+
+	s.server.Cache.Invalidate(ctx, keys...)
+}
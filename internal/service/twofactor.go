@@ -0,0 +1,410 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+
+	"github.com/goku-m/starter/internal/authz"
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/lib/totp"
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/model/user"
+)
+
+const (
+	TwoFactorPath = "/login/2fa"
+	// How long a user has after their password to enter a code
+	twoFactorChallengeTTL = 5 * time.Minute
+	// After maxTwoFactorFailures wrong codes, codes are refused until
+	// twoFactorFailureWindow has passed since the last one
+	maxTwoFactorFailures   = 5
+	twoFactorFailureWindow = 15 * time.Minute
+	defaultTOTPIssuer      = "GO-BP"
+)
+
+// twoFactorChallenge is what the browser carries between the password and the code.
+// It is sealed, so it can sit in a cookie without being stored server-side.
+type twoFactorChallenge struct {
+	UserID    string `json:"userId"`
+	Method    string `json:"method"`
+	Next      string `json:"next"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// LoginResult is either a started session or, for accounts with two-factor on, a
+// challenge the browser must bring back with a code
+type LoginResult struct {
+	User         *user.User
+	SessionToken string
+	Challenge    string
+	Next         string
+}
+
+// TwoFactorSetup is what an authenticator app needs to be added to an account
+type TwoFactorSetup struct {
+	Secret string
+	URI    string
+}
+
+// finishLogin starts a session for an account whose first factor checked out, or asks
+// for a second one
+func (s *AuthService) finishLogin(ctx echo.Context, account *user.User, method, next string) (*LoginResult, error) {
+	logger := middleware.GetLogger(ctx)
+
+	if account.TwoFactorEnabled() {
+		challenge, err := seal(s.server.Config.Auth.SecretKey, "two-factor", &twoFactorChallenge{
+			UserID:    account.ID.String(),
+			Method:    method,
+			Next:      next,
+			ExpiresAt: time.Now().Add(twoFactorChallengeTTL).Unix(),
+		})
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to seal two-factor challenge")
+			return nil, err
+		}
+
+		return &LoginResult{User: account, Challenge: challenge, Next: next}, nil
+	}
+
+	token, err := s.startSession(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "user_logged_in").
+		Str("user_id", account.ID.String()).
+		Str("method", method).
+		Msg("User logged in")
+
+	return &LoginResult{User: account, SessionToken: token, Next: next}, nil
+}
+
+// CompleteTwoFactor checks the code for a challenge from finishLogin and starts the session
+func (s *AuthService) CompleteTwoFactor(ctx echo.Context, sealedChallenge string, payload *user.TwoFactorCodePayload) (*LoginResult, error) {
+	logger := middleware.GetLogger(ctx)
+	code := "TWO_FACTOR_CHALLENGE_EXPIRED"
+	expired := errs.NewUnauthorizedError("Your sign-in expired. Please log in again.", true)
+	expired.Code = code
+
+	var challenge twoFactorChallenge
+	if !unseal(s.server.Config.Auth.SecretKey, "two-factor", sealedChallenge, &challenge) || time.Now().Unix() > challenge.ExpiresAt {
+		return nil, expired
+	}
+
+	userID, err := uuid.Parse(challenge.UserID)
+	if err != nil {
+		return nil, expired
+	}
+
+	account, err := s.userRepo.GetUserByID(ctx.Request().Context(), userID)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to load user for two-factor login")
+		return nil, err
+	}
+	// Two-factor was reset since the password was checked; start over rather than
+	// guess what the user wants
+	if !account.TwoFactorEnabled() {
+		return nil, expired
+	}
+
+	if err := s.verifySecondFactor(ctx, account, payload.Code); err != nil {
+		return nil, err
+	}
+
+	token, err := s.startSession(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "user_logged_in").
+		Str("user_id", account.ID.String()).
+		Str("method", challenge.Method).
+		Bool("two_factor", true).
+		Msg("User logged in")
+
+	return &LoginResult{User: account, SessionToken: token, Next: challenge.Next}, nil
+}
+
+// verifySecondFactor accepts a TOTP code or an unused recovery code. Codes are
+// single-use, and wrong ones count towards a temporary lockout.
+func (s *AuthService) verifySecondFactor(ctx echo.Context, account *user.User, input string) error {
+	logger := middleware.GetLogger(ctx)
+	reqCtx := ctx.Request().Context()
+	now := time.Now()
+
+	if account.TOTPFailures >= maxTwoFactorFailures && account.TOTPFailedAt != nil && account.TOTPFailedAt.After(now.Add(-twoFactorFailureWindow)) {
+		return &errs.HTTPError{
+			Code:     "TOO_MANY_ATTEMPTS",
+			Message:  "Too many wrong codes. Please wait a few minutes and try again.",
+			Status:   http.StatusTooManyRequests,
+			Override: true,
+		}
+	}
+
+	var ok bool
+	var err error
+	method := "totp"
+	if totp.LooksLikeRecoveryCode(input) {
+		method = "recovery_code"
+		ok, err = s.userRepo.UseRecoveryCode(reqCtx, account.ID, totp.HashRecoveryCode(input), now)
+	} else if account.TOTPSecret != nil {
+		if step, matched := totp.Verify(*account.TOTPSecret, input, now); matched {
+			ok, err = s.userRepo.AcceptTOTPStep(reqCtx, account.ID, step)
+		}
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to check two-factor code")
+		return err
+	}
+
+	if !ok {
+		if err := s.userRepo.RecordTOTPFailure(reqCtx, account.ID, now, now.Add(-twoFactorFailureWindow)); err != nil {
+			logger.Warn().Err(err).Msg("failed to record two-factor failure")
+		}
+		logger.Info().Str("event", "two_factor_failed").Str("user_id", account.ID.String()).Msg("Two-factor code rejected")
+
+		code := "INVALID_TWO_FACTOR_CODE"
+		err := errs.NewUnauthorizedError("That code didn't work. Check your authenticator app and try again.", true)
+		err.Code = code
+		return err
+	}
+
+	if method == "recovery_code" {
+		logger.Info().Str("event", "recovery_code_used").Str("user_id", account.ID.String()).Msg("Recovery code used")
+	}
+
+	return nil
+}
+
+// StartTwoFactorSetup gives a password account a new secret to add to an
+// authenticator app. Two-factor stays off until EnableTwoFactor confirms a code.
+func (s *AuthService) StartTwoFactorSetup(ctx echo.Context, userID string) error {
+	logger := middleware.GetLogger(ctx)
+
+	account, err := s.getAccount(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// Provider logins are protected by the provider's own second factor
+	if account.PasswordHash == nil {
+		code := "PASSWORD_REQUIRED"
+		return errs.NewConflictError("Two-factor authentication protects password logins, and this account has no password", true, &code)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to generate totp secret")
+		return err
+	}
+
+	return s.userRepo.StartTOTPEnrollment(ctx.Request().Context(), account.ID, secret)
+}
+
+// TwoFactorSetup describes an enrollment that was started but not confirmed yet, or
+// returns nil
+func (s *AuthService) TwoFactorSetup(account *user.User) *TwoFactorSetup {
+	if account.TOTPSecret == nil || account.TOTPEnabledAt != nil {
+		return nil
+	}
+
+	issuer := s.server.Config.Auth.TOTPIssuer
+	if issuer == "" {
+		issuer = defaultTOTPIssuer
+	}
+
+	return &TwoFactorSetup{
+		Secret: *account.TOTPSecret,
+		URI:    totp.URI(*account.TOTPSecret, issuer, account.Email),
+	}
+}
+
+// EnableTwoFactor turns two-factor on once the app shows a matching code, returning
+// the recovery codes to show the user once
+func (s *AuthService) EnableTwoFactor(ctx echo.Context, userID string, payload *user.TwoFactorCodePayload) ([]string, error) {
+	logger := middleware.GetLogger(ctx)
+
+	account, err := s.getAccount(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	setup := s.TwoFactorSetup(account)
+	if setup == nil {
+		code := "TWO_FACTOR_NOT_PENDING"
+		return nil, errs.NewConflictError("Start setting up two-factor authentication again", true, &code)
+	}
+
+	step, ok := totp.Verify(setup.Secret, payload.Code, time.Now())
+	if !ok {
+		code := "INVALID_TWO_FACTOR_CODE"
+		return nil, errs.NewBadRequestError("That code didn't work. Check the time on your device and try again.", true, &code, nil, nil)
+	}
+
+	codes, hashes, err := totp.NewRecoveryCodes()
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to generate recovery codes")
+		return nil, err
+	}
+
+	err = WithTx(ctx, s.server.DB, func(ctx echo.Context) error {
+		reqCtx := ctx.Request().Context()
+
+		if err := s.userRepo.EnableTOTP(reqCtx, account.ID, step, time.Now()); err != nil {
+			return err
+		}
+		return s.userRepo.ReplaceRecoveryCodes(reqCtx, account.ID, hashes)
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to enable two-factor")
+		return nil, err
+	}
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "two_factor_enabled").
+		Str("user_id", account.ID.String()).
+		Msg("Two-factor authentication enabled")
+
+	return codes, nil
+}
+
+// DisableTwoFactor turns two-factor off for a user who can still produce a code
+func (s *AuthService) DisableTwoFactor(ctx echo.Context, userID string, payload *user.TwoFactorCodePayload) error {
+	logger := middleware.GetLogger(ctx)
+
+	account, err := s.getAccount(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// An unfinished enrollment can be abandoned without a code
+	if account.TwoFactorEnabled() {
+		if err := s.verifySecondFactor(ctx, account, payload.Code); err != nil {
+			return err
+		}
+	}
+
+	if err := WithTx(ctx, s.server.DB, func(ctx echo.Context) error {
+		return s.userRepo.DisableTOTP(ctx.Request().Context(), account.ID)
+	}); err != nil {
+		logger.Error().Err(err).Msg("failed to disable two-factor")
+		return err
+	}
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "two_factor_disabled").
+		Str("user_id", account.ID.String()).
+		Msg("Two-factor authentication disabled")
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the account's recovery codes, returning the new
+// set to show the user once
+func (s *AuthService) RegenerateRecoveryCodes(ctx echo.Context, userID string, payload *user.TwoFactorCodePayload) ([]string, error) {
+	logger := middleware.GetLogger(ctx)
+
+	account, err := s.getAccount(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !account.TwoFactorEnabled() {
+		code := "TWO_FACTOR_DISABLED"
+		return nil, errs.NewConflictError("Two-factor authentication is off", true, &code)
+	}
+
+	if err := s.verifySecondFactor(ctx, account, payload.Code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := totp.NewRecoveryCodes()
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to generate recovery codes")
+		return nil, err
+	}
+
+	if err := WithTx(ctx, s.server.DB, func(ctx echo.Context) error {
+		return s.userRepo.ReplaceRecoveryCodes(ctx.Request().Context(), account.ID, hashes)
+	}); err != nil {
+		logger.Error().Err(err).Msg("failed to replace recovery codes")
+		return nil, err
+	}
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "recovery_codes_regenerated").
+		Str("user_id", account.ID.String()).
+		Msg("Recovery codes regenerated")
+
+	return codes, nil
+}
+
+func (s *AuthService) RecoveryCodesLeft(ctx echo.Context, account *user.User) (int, error) {
+	if !account.TwoFactorEnabled() {
+		return 0, nil
+	}
+	return s.userRepo.CountRecoveryCodes(ctx.Request().Context(), account.ID)
+}
+
+// ResetTwoFactor turns two-factor off for a user who lost their device and recovery
+// codes. The caller's principal needs users:manage, which jobs and CLIs get from
+// authz.System.
+func (s *AuthService) ResetTwoFactor(ctx context.Context, userID uuid.UUID) error {
+	if err := authz.Require(ctx, authz.UsersManage); err != nil {
+		return err
+	}
+
+	if err := WithTxContext(ctx, s.server.DB, func(ctx context.Context) error {
+		return s.userRepo.DisableTOTP(ctx, userID)
+	}); err != nil {
+		return err
+	}
+
+	actor, _ := authz.PrincipalFrom(ctx)
+	s.server.Logger.Info().
+		Str("event", "two_factor_reset").
+		Str("user_id", userID.String()).
+		Str("actor", actor.UserID).
+		Msg("Two-factor authentication reset")
+
+	return nil
+}
+
+// getAccount loads a signed-in user's account; users signed in by JWT have none here
+func (s *AuthService) getAccount(ctx echo.Context, userID string) (*user.User, error) {
+	logger := middleware.GetLogger(ctx)
+
+	accountID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, accountNotFound()
+	}
+
+	account, err := s.userRepo.GetUserByID(ctx.Request().Context(), accountID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, accountNotFound()
+		}
+		logger.Error().Err(err).Msg("failed to fetch account")
+		return nil, err
+	}
+
+	return account, nil
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/goku-m/starter/internal/database"
+	"github.com/goku-m/starter/internal/sqlerr"
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	maxTxAttempts    = 3
+	txRetryBaseDelay = 20 * time.Millisecond
+)
+
+// WithTx runs fn as one unit of work: repository calls made with the request context
+// inside fn share a single transaction, and nested WithTx calls become savepoints.
+func WithTx(ctx echo.Context, db *database.Database, fn func(ctx echo.Context) error) error {
+	return WithTxOptions(ctx, db, pgx.TxOptions{}, fn)
+}
+
+// WithTxOptions is WithTx with the options of the transaction it starts, such as
+// pgx.Serializable for work that must not interleave with concurrent transactions
+func WithTxOptions(ctx echo.Context, db *database.Database, opts pgx.TxOptions, fn func(ctx echo.Context) error) error {
+	req := ctx.Request()
+	defer ctx.SetRequest(req)
+
+	return WithTxContextOptions(req.Context(), db, opts, func(txCtx context.Context) error {
+		ctx.SetRequest(req.WithContext(txCtx))
+		return fn(ctx)
+	})
+}
+
+// WithTxContext is WithTx for code without a request, such as job handlers. The
+// outermost call runs fn again from the start after a serialization failure or
+// deadlock, so fn must not have effects outside the database; events for other
+// systems belong in the outbox.
+func WithTxContext(ctx context.Context, db *database.Database, fn func(ctx context.Context) error) error {
+	return WithTxContextOptions(ctx, db, pgx.TxOptions{}, fn)
+}
+
+// WithTxContextOptions is WithTxContext with the options of the transaction it starts.
+// Serialization failures only happen at pgx.RepeatableRead and above; at the default
+// read committed level only deadlocks are retried.
+func WithTxContextOptions(ctx context.Context, db *database.Database, opts pgx.TxOptions, fn func(ctx context.Context) error) error {
+	// A failed savepoint has aborted the outer transaction, so only the outermost call retries
+	if _, nested := database.TxFromContext(ctx); nested {
+		return db.InTx(ctx, fn)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := db.InTxWith(ctx, opts, fn)
+		if err == nil || attempt == maxTxAttempts || !sqlerr.IsRetryable(err) {
+			return err
+		}
+
+		// Jitter keeps the transactions that collided from colliding again
+		delay := txRetryBaseDelay<<(attempt-1) + rand.N(txRetryBaseDelay)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
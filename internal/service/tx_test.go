@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goku-m/starter/internal/database"
+	testutil "github.com/goku-m/starter/internal/testing"
+)
+
+func setupTxTest(t *testing.T) (*database.Database, func()) {
+	t.Helper()
+
+	testDB, srv, cleanup := testutil.SetupTest(t)
+	_, err := testDB.Pool.Exec(context.Background(), `CREATE TABLE tx_test (id INT PRIMARY KEY)`)
+	require.NoError(t, err)
+
+	return srv.DB, cleanup
+}
+
+func countTxTest(t *testing.T, db *database.Database) int {
+	t.Helper()
+
+	var n int
+	require.NoError(t, db.Pool.QueryRow(context.Background(), `SELECT COUNT(*) FROM tx_test`).Scan(&n))
+	return n
+}
+
+func TestWithTxContextRetries(t *testing.T) {
+	db, cleanup := setupTxTest(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		code     string
+		failures int
+		attempts int
+		wantErr  bool
+	}{
+		{"serialization failure", "40001", 1, 2, false},
+		{"deadlock", "40P01", 2, 3, false},
+		{"gives up", "40001", maxTxAttempts, maxTxAttempts, true},
+		{"not retryable", "23505", 1, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.Pool.Exec(ctx, `TRUNCATE tx_test`)
+			require.NoError(t, err)
+
+			attempts := 0
+			err = WithTxContext(ctx, db, func(ctx context.Context) error {
+				attempts++
+				if _, err := db.Querier(ctx).Exec(ctx, `INSERT INTO tx_test (id) VALUES (1)`); err != nil {
+					return err
+				}
+				if attempts <= tt.failures {
+					return &pgconn.PgError{Code: tt.code}
+				}
+				return nil
+			})
+
+			assert.Equal(t, tt.attempts, attempts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Zero(t, countTxTest(t, db), "a failed attempt leaves nothing behind")
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, 1, countTxTest(t, db), "only the last attempt is committed")
+			}
+		})
+	}
+}
+
+func TestWithTxContextNestedDoesNotRetry(t *testing.T) {
+	db, cleanup := setupTxTest(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	outer, inner := 0, 0
+	err := WithTxContext(ctx, db, func(ctx context.Context) error {
+		outer++
+		return WithTxContext(ctx, db, func(ctx context.Context) error {
+			inner++
+			if inner == 1 {
+				return &pgconn.PgError{Code: "40001"}
+			}
+			return nil
+		})
+	})
+	require.NoError(t, err)
+
+	// The savepoint passes the failure up and the whole transaction runs again
+	assert.Equal(t, 2, outer)
+	assert.Equal(t, 2, inner)
+}
+
+func TestWithTxContextOptionsRetriesSerializationFailure(t *testing.T) {
+	db, cleanup := setupTxTest(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// Each transaction reads the table, then writes based on what it read. Run side by
+	// side as serializable, one of them fails at its first attempt and runs again.
+	var read sync.WaitGroup
+	read.Add(2)
+	var attempts atomic.Int32
+
+	insertCount := func(ctx context.Context) error {
+		first := attempts.Add(1) <= 2
+
+		var n int
+		if err := db.Querier(ctx).QueryRow(ctx, `SELECT COUNT(*) FROM tx_test`).Scan(&n); err != nil {
+			return err
+		}
+		if first {
+			read.Done()
+			read.Wait()
+		}
+
+		_, err := db.Querier(ctx).Exec(ctx, `INSERT INTO tx_test (id) VALUES ($1)`, n+1)
+		return err
+	}
+
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() {
+			errs <- WithTxContextOptions(ctx, db, pgx.TxOptions{IsoLevel: pgx.Serializable}, insertCount)
+		}()
+	}
+	for range 2 {
+		require.NoError(t, <-errs)
+	}
+
+	assert.Equal(t, int32(3), attempts.Load())
+	assert.Equal(t, 2, countTxTest(t, db))
+}
+
+func TestWithTxContextCancelledStopsRetrying(t *testing.T) {
+	db, cleanup := setupTxTest(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := WithTxContext(ctx, db, func(ctx context.Context) error {
+		attempts++
+		cancel()
+		return &pgconn.PgError{Code: "40001"}
+	})
+
+	var pgErr *pgconn.PgError
+	assert.True(t, errors.As(err, &pgErr))
+	assert.Equal(t, 1, attempts)
+}
@@ -0,0 +1,413 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+
+	"github.com/goku-m/starter/internal/authz"
+	"github.com/goku-m/starter/internal/errs"
+	"github.com/goku-m/starter/internal/lib/job"
+	signer "github.com/goku-m/starter/internal/lib/webhook"
+	"github.com/goku-m/starter/internal/middleware"
+	"github.com/goku-m/starter/internal/model/outbox"
+	"github.com/goku-m/starter/internal/model/webhook"
+	"github.com/goku-m/starter/internal/repository"
+	"github.com/goku-m/starter/internal/server"
+)
+
+const (
+	webhookDeliveryTimeout  = 10 * time.Second
+	webhookResponseBodySize = 2048
+	webhookDeliveryLogLimit = 50
+)
+
+type WebhookService struct {
+	server      *server.Server
+	webhookRepo *repository.WebhookRepository
+	httpClient  *http.Client
+}
+
+func NewWebhookService(server *server.Server, webhookRepo *repository.WebhookRepository) *WebhookService {
+	dialer := &net.Dialer{Timeout: webhookDeliveryTimeout}
+	if !server.Config.Webhook.AllowPrivateTargets {
+		dialer.Control = signer.DialControl
+	}
+
+	return &WebhookService{
+		server:      server,
+		webhookRepo: webhookRepo,
+		httpClient: &http.Client{
+			Timeout: webhookDeliveryTimeout,
+			// No proxy: it would be dialed instead of the endpoint and slip past the guard
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: webhookDeliveryTimeout,
+			},
+			// Redirects could bounce a signed payload to an unverified host
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// checkTarget rejects endpoints inside the app's own network
+func (s *WebhookService) checkTarget(ctx context.Context, rawURL string) error {
+	if s.server.Config.Webhook.AllowPrivateTargets {
+		return nil
+	}
+	return signer.CheckURL(ctx, net.DefaultResolver, rawURL)
+}
+
+func (s *WebhookService) CreateWebhook(ctx echo.Context, userID string, payload *webhook.CreateWebhookPayload) (*webhook.Webhook, error) {
+	if err := authz.Require(ctx.Request().Context(), authz.WebhooksManage); err != nil {
+		return nil, err
+	}
+
+	logger := middleware.GetLogger(ctx)
+
+	if err := s.checkTarget(ctx.Request().Context(), payload.URL); err != nil {
+		code := "WEBHOOK_URL_NOT_ALLOWED"
+		return nil, errs.NewBadRequestError("Webhook URL must be reachable on the public internet", true, &code,
+			[]errs.FieldError{{Field: "url", Error: err.Error()}}, nil)
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to generate webhook secret")
+		return nil, err
+	}
+
+	item, err := s.webhookRepo.CreateWebhook(ctx.Request().Context(), userID, payload, secret)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to create webhook")
+		return nil, err
+	}
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "webhook_created").
+		Str("webhook_id", item.ID.String()).
+		Str("url", item.URL).
+		Strs("events", item.Events).
+		Msg("Webhook created successfully")
+
+	return item, nil
+}
+
+func (s *WebhookService) GetWebhooks(ctx echo.Context, userID string) ([]webhook.Webhook, error) {
+	if err := authz.Require(ctx.Request().Context(), authz.WebhooksManage); err != nil {
+		return nil, err
+	}
+
+	logger := middleware.GetLogger(ctx)
+
+	items, err := s.webhookRepo.GetWebhooks(ctx.Request().Context(), userID)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to fetch webhooks")
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (s *WebhookService) GetWebhookByID(ctx echo.Context, userID string, webhookID uuid.UUID) (*webhook.Webhook, error) {
+	if err := authz.Require(ctx.Request().Context(), authz.WebhooksManage); err != nil {
+		return nil, err
+	}
+
+	logger := middleware.GetLogger(ctx)
+
+	item, err := s.webhookRepo.GetWebhookByID(ctx.Request().Context(), userID, webhookID)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to fetch webhook by ID")
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func (s *WebhookService) GetDeliveries(ctx echo.Context, userID string, webhookID uuid.UUID) ([]webhook.Delivery, error) {
+	if err := authz.Require(ctx.Request().Context(), authz.WebhooksManage); err != nil {
+		return nil, err
+	}
+
+	logger := middleware.GetLogger(ctx)
+
+	// Ownership check before exposing the delivery log
+	if _, err := s.webhookRepo.GetWebhookByID(ctx.Request().Context(), userID, webhookID); err != nil {
+		logger.Error().Err(err).Msg("failed to fetch webhook by ID")
+		return nil, err
+	}
+
+	deliveries, err := s.webhookRepo.GetDeliveries(ctx.Request().Context(), webhookID, webhookDeliveryLogLimit)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to fetch webhook deliveries")
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (s *WebhookService) DeleteWebhook(ctx echo.Context, userID string, webhookID uuid.UUID) error {
+	if err := authz.Require(ctx.Request().Context(), authz.WebhooksManage); err != nil {
+		return err
+	}
+
+	logger := middleware.GetLogger(ctx)
+
+	if err := s.webhookRepo.DeleteWebhook(ctx.Request().Context(), userID, webhookID); err != nil {
+		logger.Error().Err(err).Msg("failed to delete webhook")
+		return err
+	}
+
+	// Business event log
+	eventLogger := middleware.GetLogger(ctx)
+	eventLogger.Info().
+		Str("event", "webhook_deleted").
+		Str("webhook_id", webhookID.String()).
+		Msg("Webhook deleted successfully")
+
+	return nil
+}
+
+// SendTestEvent queues a ping delivery to a single endpoint regardless of its subscriptions
+func (s *WebhookService) SendTestEvent(ctx echo.Context, userID string, webhookID uuid.UUID) (*webhook.Delivery, error) {
+	if err := authz.Require(ctx.Request().Context(), authz.WebhooksManage); err != nil {
+		return nil, err
+	}
+
+	logger := middleware.GetLogger(ctx)
+
+	item, err := s.webhookRepo.GetWebhookByID(ctx.Request().Context(), userID, webhookID)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to fetch webhook by ID")
+		return nil, err
+	}
+
+	delivery, err := s.enqueueDelivery(ctx.Request().Context(), item, webhook.EventPing, map[string]any{
+		"webhookId": item.ID,
+		"message":   "This is a test event",
+	}, nil)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to send webhook test event")
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// Sink dispatches relayed domain events to subscribed endpoints. It runs in the outbox
+// relay, which publishes the events of an aggregate one at a time and in order, so each
+// endpoint's deliveries are created in the order the changes happened. A message the
+// relay publishes again reuses the deliveries it already has.
+func (s *WebhookService) Sink(ctx context.Context, msg outbox.Message) error {
+	event := webhook.Event(msg.EventType)
+	if !slices.Contains(webhook.Events, event) {
+		return nil
+	}
+
+	items, err := s.webhookRepo.GetSubscribedWebhooks(ctx, msg.UserID, event)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i := range items {
+		if _, err := s.enqueueDelivery(ctx, &items[i], event, msg.Payload, &msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// HandleOutboxTask drains outbox:event tasks queued before the relay dispatched to
+// webhooks itself
+func (s *WebhookService) HandleOutboxTask(ctx context.Context, t *asynq.Task) error {
+	var msg outbox.Message
+	if err := json.Unmarshal(t.Payload(), &msg); err != nil {
+		return fmt.Errorf("failed to unmarshal outbox event payload: %w", err)
+	}
+
+	return s.Sink(ctx, msg)
+}
+
+// enqueueDelivery records a delivery and queues its first attempt. Deliveries of an
+// outbox message carry the time the change happened, so receivers can order them even
+// when retries arrive late.
+func (s *WebhookService) enqueueDelivery(ctx context.Context, item *webhook.Webhook, event webhook.Event, data any, source *outbox.Message) (*webhook.Delivery, error) {
+	createdAt := time.Now().UTC()
+	var outboxID *int64
+	if source != nil {
+		createdAt = source.CreatedAt.UTC()
+		outboxID = &source.ID
+	}
+
+	body, err := json.Marshal(webhook.Envelope{
+		ID:        uuid.New(),
+		Event:     event,
+		CreatedAt: createdAt,
+		Data:      data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal webhook envelope: %w", err)
+	}
+
+	delivery, err := s.webhookRepo.CreateDelivery(ctx, item.ID, event, body, outboxID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Already attempted when the relay published this message before
+	if s.server.Job == nil || delivery.Status != webhook.DeliveryStatusPending {
+		return delivery, nil
+	}
+
+	task, err := job.NewWebhookDeliveryTask(delivery.ID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.server.Job.Client.EnqueueContext(ctx, task); err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+		return nil, fmt.Errorf("failed to enqueue webhook delivery_id=%s: %w", delivery.ID.String(), err)
+	}
+
+	return delivery, nil
+}
+
+// HandleDeliveryTask posts a signed delivery; returning an error lets asynq retry with backoff
+func (s *WebhookService) HandleDeliveryTask(ctx context.Context, t *asynq.Task) error {
+	var p job.WebhookDeliveryPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("failed to unmarshal webhook delivery payload: %w", err)
+	}
+
+	delivery, err := s.webhookRepo.GetDeliveryByID(ctx, p.DeliveryID)
+	if err != nil {
+		// The endpoint was deleted, or its owner erased their data, after the delivery was queued
+		if errors.Is(err, pgx.ErrNoRows) {
+			s.server.Logger.Info().
+				Str("type", job.TaskWebhookDelivery).
+				Str("delivery_id", p.DeliveryID.String()).
+				Msg("Webhook delivery no longer exists, nothing to do")
+			return nil
+		}
+		return err
+	}
+
+	item, err := s.webhookRepo.GetWebhookForDelivery(ctx, p.DeliveryID)
+	if err != nil {
+		return err
+	}
+
+	logger := s.server.Logger.With().
+		Str("type", job.TaskWebhookDelivery).
+		Str("delivery_id", delivery.ID.String()).
+		Str("webhook_id", item.ID.String()).
+		Str("event", string(delivery.Event)).
+		Logger()
+
+	attempt := s.Deliver(ctx, item, delivery)
+
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	attempt.Status = deliveryStatus(attempt, retried, maxRetry)
+
+	if err := s.webhookRepo.RecordDeliveryAttempt(ctx, delivery.ID, attempt); err != nil {
+		logger.Error().Err(err).Msg("Failed to record webhook delivery attempt")
+	}
+
+	if attempt.Status != webhook.DeliveryStatusSucceeded {
+		logger.Warn().
+			Int("retried", retried).
+			Str("status", string(attempt.Status)).
+			Msg("Webhook delivery failed")
+
+		if attempt.Error != nil {
+			return errors.New(*attempt.Error)
+		}
+		return fmt.Errorf("webhook endpoint responded with status %d", *attempt.ResponseCode)
+	}
+
+	logger.Info().Msg("Successfully delivered webhook")
+	return nil
+}
+
+// deliveryStatus is what the delivery log shows after an attempt: failures are only
+// final once asynq has no retries left
+func deliveryStatus(attempt repository.DeliveryAttempt, retried, maxRetry int) webhook.DeliveryStatus {
+	if attempt.Status == webhook.DeliveryStatusSucceeded {
+		return attempt.Status
+	}
+	if retried >= maxRetry {
+		return webhook.DeliveryStatusFailed
+	}
+	return webhook.DeliveryStatusRetrying
+}
+
+// Deliver performs a single signed POST of a delivery to its endpoint
+func (s *WebhookService) Deliver(ctx context.Context, item *webhook.Webhook, delivery *webhook.Delivery) repository.DeliveryAttempt {
+	start := time.Now()
+	attempt := repository.DeliveryAttempt{Status: webhook.DeliveryStatusFailed}
+
+	fail := func(err error) repository.DeliveryAttempt {
+		msg := err.Error()
+		attempt.Error = &msg
+		attempt.Duration = time.Since(start)
+		return attempt
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, item.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return fail(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "starter-webhooks/1.0")
+	req.Header.Set(signer.EventHeader, string(delivery.Event))
+	req.Header.Set(signer.DeliveryHeader, delivery.ID.String())
+	req.Header.Set(signer.TimestampHeader, fmt.Sprintf("%d", start.Unix()))
+	req.Header.Set(signer.SignatureHeader, signer.Sign(item.Secret, start, delivery.Payload))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fail(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseBodySize))
+	responseBody := string(body)
+
+	attempt.ResponseCode = &resp.StatusCode
+	attempt.ResponseBody = &responseBody
+	attempt.Duration = time.Since(start)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		attempt.Status = webhook.DeliveryStatusSucceeded
+	}
+
+	return attempt
+}
+
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goku-m/starter/internal/config"
+	signer "github.com/goku-m/starter/internal/lib/webhook"
+	"github.com/goku-m/starter/internal/model/webhook"
+	"github.com/goku-m/starter/internal/repository"
+	"github.com/goku-m/starter/internal/server"
+)
+
+// newTestWebhookService delivers without a database; httptest endpoints are on
+// loopback, so private targets are allowed unless a test says otherwise
+func newTestWebhookService(allowPrivate bool) *WebhookService {
+	return NewWebhookService(&server.Server{
+		Config: &config.Config{
+			Webhook: config.WebhookConfig{AllowPrivateTargets: allowPrivate},
+		},
+	}, nil)
+}
+
+func testDelivery(url string) (*webhook.Webhook, *webhook.Delivery) {
+	item := &webhook.Webhook{URL: url, Secret: "whsec_test"}
+	item.ID = uuid.New()
+
+	delivery := &webhook.Delivery{
+		WebhookID: item.ID,
+		Event:     webhook.EventTodoCreated,
+		Payload:   []byte(`{"event":"todo.created","data":{"title":"Buy milk"}}`),
+	}
+	delivery.ID = uuid.New()
+
+	return item, delivery
+}
+
+func TestDeliverSignsRequest(t *testing.T) {
+	var (
+		header http.Header
+		body   []byte
+	)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer endpoint.Close()
+
+	s := newTestWebhookService(true)
+	item, delivery := testDelivery(endpoint.URL)
+
+	before := time.Now()
+	attempt := s.Deliver(context.Background(), item, delivery)
+
+	assert.Equal(t, webhook.DeliveryStatusSucceeded, attempt.Status)
+	require.NotNil(t, attempt.ResponseCode)
+	assert.Equal(t, http.StatusNoContent, *attempt.ResponseCode)
+	assert.Nil(t, attempt.Error)
+	assert.Positive(t, attempt.Duration)
+
+	assert.Equal(t, []byte(delivery.Payload), body)
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, string(webhook.EventTodoCreated), header.Get(signer.EventHeader))
+	assert.Equal(t, delivery.ID.String(), header.Get(signer.DeliveryHeader))
+
+	// The timestamp header is the one that was signed, and is current
+	ts, err := strconv.ParseInt(header.Get(signer.TimestampHeader), 10, 64)
+	require.NoError(t, err)
+	assert.InDelta(t, before.Unix(), ts, 1)
+
+	signature := header.Get(signer.SignatureHeader)
+	assert.True(t, strings.HasPrefix(signature, "t="+header.Get(signer.TimestampHeader)+","))
+	assert.NoError(t, signer.Verify(item.Secret, signature, body, time.Now(), signer.DefaultTolerance))
+	assert.ErrorIs(t, signer.Verify("whsec_other", signature, body, time.Now(), signer.DefaultTolerance), signer.ErrSignatureMismatch)
+}
+
+func TestDeliverRecordsErrorResponse(t *testing.T) {
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, strings.Repeat("x", webhookResponseBodySize+100))
+	}))
+	defer endpoint.Close()
+
+	s := newTestWebhookService(true)
+	item, delivery := testDelivery(endpoint.URL)
+
+	attempt := s.Deliver(context.Background(), item, delivery)
+
+	assert.Equal(t, webhook.DeliveryStatusFailed, attempt.Status)
+	require.NotNil(t, attempt.ResponseCode)
+	assert.Equal(t, http.StatusInternalServerError, *attempt.ResponseCode)
+	require.NotNil(t, attempt.ResponseBody)
+	assert.Len(t, *attempt.ResponseBody, webhookResponseBodySize, "logged body is truncated")
+}
+
+func TestDeliverDoesNotFollowRedirects(t *testing.T) {
+	followed := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		followed = true
+	}))
+	defer target.Close()
+
+	endpoint := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer endpoint.Close()
+
+	s := newTestWebhookService(true)
+	item, delivery := testDelivery(endpoint.URL)
+
+	attempt := s.Deliver(context.Background(), item, delivery)
+
+	assert.Equal(t, webhook.DeliveryStatusFailed, attempt.Status)
+	require.NotNil(t, attempt.ResponseCode)
+	assert.Equal(t, http.StatusTemporaryRedirect, *attempt.ResponseCode)
+	assert.False(t, followed)
+}
+
+func TestDeliverRecordsConnectionError(t *testing.T) {
+	endpoint := httptest.NewServer(http.NotFoundHandler())
+	endpoint.Close()
+
+	s := newTestWebhookService(true)
+	item, delivery := testDelivery(endpoint.URL)
+
+	attempt := s.Deliver(context.Background(), item, delivery)
+
+	assert.Equal(t, webhook.DeliveryStatusFailed, attempt.Status)
+	assert.Nil(t, attempt.ResponseCode)
+	require.NotNil(t, attempt.Error)
+}
+
+func TestDeliverRefusesPrivateTargets(t *testing.T) {
+	called := false
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer endpoint.Close()
+
+	s := newTestWebhookService(false)
+	item, delivery := testDelivery(endpoint.URL)
+
+	attempt := s.Deliver(context.Background(), item, delivery)
+
+	assert.Equal(t, webhook.DeliveryStatusFailed, attempt.Status)
+	require.NotNil(t, attempt.Error)
+	assert.Contains(t, *attempt.Error, signer.ErrPrivateTarget.Error())
+	assert.False(t, called)
+}
+
+func TestDeliveryStatus(t *testing.T) {
+	succeeded := repository.DeliveryAttempt{Status: webhook.DeliveryStatusSucceeded}
+	failed := repository.DeliveryAttempt{Status: webhook.DeliveryStatusFailed}
+
+	tests := []struct {
+		name     string
+		attempt  repository.DeliveryAttempt
+		retried  int
+		maxRetry int
+		want     webhook.DeliveryStatus
+	}{
+		{"succeeded", succeeded, 0, 8, webhook.DeliveryStatusSucceeded},
+		{"succeeded on last retry", succeeded, 8, 8, webhook.DeliveryStatusSucceeded},
+		{"first failure", failed, 0, 8, webhook.DeliveryStatusRetrying},
+		{"failure with retries left", failed, 7, 8, webhook.DeliveryStatusRetrying},
+		{"failure on last retry", failed, 8, 8, webhook.DeliveryStatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, deliveryStatus(tt.attempt, tt.retried, tt.maxRetry))
+		})
+	}
+}
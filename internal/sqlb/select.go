@@ -0,0 +1,113 @@
+package sqlb
+
+import (
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SelectBuilder assembles a SELECT. The same builder produces the page query and,
+// through Count, the matching count query, so both always share their conditions.
+type SelectBuilder struct {
+	clauses
+	columns []string
+	from    string
+	orderBy []string
+	limit   *int
+	offset  *int
+}
+
+func Select(columns ...string) *SelectBuilder {
+	return &SelectBuilder{columns: columns}
+}
+
+func (b *SelectBuilder) From(from string) *SelectBuilder {
+	b.from = from
+	return b
+}
+
+// Where adds a condition, joined to the others with AND, and binds its arguments
+func (b *SelectBuilder) Where(condition string, args ...Arg) *SelectBuilder {
+	b.addWhere(condition, args...)
+	return b
+}
+
+// WhereEq adds column = @column, or column IS NULL when value is nil or a nil pointer
+func (b *SelectBuilder) WhereEq(column string, value any) *SelectBuilder {
+	b.addWhereEq(column, deref(value))
+	return b
+}
+
+// OrderBy appends a sort key. expr must come from code or a Columns whitelist.
+func (b *SelectBuilder) OrderBy(expr string, direction Direction) *SelectBuilder {
+	b.orderBy = append(b.orderBy, expr+" "+string(direction))
+	return b
+}
+
+func (b *SelectBuilder) Limit(limit int) *SelectBuilder {
+	b.limit = &limit
+	return b
+}
+
+func (b *SelectBuilder) Offset(offset int) *SelectBuilder {
+	b.offset = &offset
+	return b
+}
+
+// Build returns the statement with its ordering and paging
+func (b *SelectBuilder) Build() (string, pgx.NamedArgs, error) {
+	if b.err != nil {
+		return "", nil, b.err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("SELECT ")
+	sb.WriteString(strings.Join(b.columns, ", "))
+	sb.WriteString(" FROM ")
+	sb.WriteString(b.from)
+	b.writeWhere(&sb)
+
+	if len(b.orderBy) > 0 {
+		sb.WriteString(" ORDER BY ")
+		sb.WriteString(strings.Join(b.orderBy, ", "))
+	}
+
+	args := b.copyArgs()
+	if b.limit != nil {
+		sb.WriteString(" LIMIT @limit")
+		if err := setArg(args, "limit", *b.limit); err != nil {
+			return "", nil, err
+		}
+	}
+	if b.offset != nil {
+		sb.WriteString(" OFFSET @offset")
+		if err := setArg(args, "offset", *b.offset); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return sb.String(), args, nil
+}
+
+// Count returns a statement counting every row the conditions match, ignoring
+// ordering and paging
+func (b *SelectBuilder) Count() (string, pgx.NamedArgs, error) {
+	if b.err != nil {
+		return "", nil, b.err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("SELECT COUNT(*) FROM ")
+	sb.WriteString(b.from)
+	b.writeWhere(&sb)
+
+	return sb.String(), b.copyArgs(), nil
+}
+
+// Page converts a 1-based page number and page size into Limit and Offset
+func (b *SelectBuilder) Page(page, limit int) *SelectBuilder {
+	if page < 1 {
+		page = 1
+	}
+	return b.Limit(limit).Offset((page - 1) * limit)
+}
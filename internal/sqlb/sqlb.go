@@ -0,0 +1,152 @@
+// Package sqlb builds SELECT and UPDATE statements whose values travel as pgx.NamedArgs.
+// Only identifiers written in code or resolved through a Columns whitelist end up in
+// the SQL text; every value is bound as a named argument.
+package sqlb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrDuplicateArg is returned by Build and Count when two arguments share a name, since
+// one would silently replace the other's value
+var ErrDuplicateArg = errors.New("sqlb: argument is bound twice")
+
+// Arg binds a value to the @name placeholder used in a condition
+type Arg struct {
+	Name  string
+	Value any
+}
+
+func Named(name string, value any) Arg {
+	return Arg{Name: name, Value: value}
+}
+
+// Direction is a sort direction
+type Direction string
+
+const (
+	Asc  Direction = "ASC"
+	Desc Direction = "DESC"
+)
+
+// ParseDirection accepts "asc" or "desc" in any case and returns fallback otherwise
+func ParseDirection(value string, fallback Direction) Direction {
+	switch strings.ToUpper(value) {
+	case string(Asc):
+		return Asc
+	case string(Desc):
+		return Desc
+	default:
+		return fallback
+	}
+}
+
+// Columns whitelists the names callers may sort or filter by, mapping each to its SQL
+// expression. Anything outside the map never reaches the statement.
+type Columns map[string]string
+
+// Resolve returns the expression for name, or the expression for fallback if name is
+// not whitelisted
+func (c Columns) Resolve(name, fallback string) string {
+	if expr, ok := c[name]; ok {
+		return expr
+	}
+	return c[fallback]
+}
+
+// clauses holds what SELECT and UPDATE share: conditions and their arguments
+type clauses struct {
+	where []string
+	args  pgx.NamedArgs
+	// err is the first binding mistake, reported when the statement is built
+	err error
+}
+
+func (c *clauses) bind(args ...Arg) {
+	if c.args == nil {
+		c.args = pgx.NamedArgs{}
+	}
+	for _, arg := range args {
+		if err := setArg(c.args, arg.Name, arg.Value); err != nil && c.err == nil {
+			c.err = err
+		}
+	}
+}
+
+// setArg binds name in args unless it is already taken
+func setArg(args pgx.NamedArgs, name string, value any) error {
+	if _, ok := args[name]; ok {
+		return fmt.Errorf("%w: @%s", ErrDuplicateArg, name)
+	}
+	args[name] = value
+	return nil
+}
+
+func (c *clauses) addWhere(condition string, args ...Arg) {
+	c.where = append(c.where, condition)
+	c.bind(args...)
+}
+
+// addWhereEq compares column to value, turning a nil value into IS NULL
+func (c *clauses) addWhereEq(column string, value any) {
+	if isNil(value) {
+		c.where = append(c.where, column+" IS NULL")
+		return
+	}
+
+	name := argName(column)
+	c.addWhere(column+" = @"+name, Named(name, value))
+}
+
+func (c *clauses) writeWhere(sb *strings.Builder) {
+	if len(c.where) > 0 {
+		sb.WriteString(" WHERE ")
+		sb.WriteString(strings.Join(c.where, " AND "))
+	}
+}
+
+// copyArgs keeps the statements a builder returns independent of later changes to it
+func (c *clauses) copyArgs() pgx.NamedArgs {
+	args := make(pgx.NamedArgs, len(c.args))
+	for name, value := range c.args {
+		args[name] = value
+	}
+	return args
+}
+
+// argName derives a placeholder from a column, dropping any table alias
+func argName(column string) string {
+	if i := strings.LastIndexByte(column, '.'); i >= 0 {
+		return column[i+1:]
+	}
+	return column
+}
+
+// isNil reports whether value is nil or a nil pointer, slice or map
+func isNil(value any) bool {
+	if value == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
+
+// deref follows a non-nil pointer so the bound value is the value itself
+func deref(value any) any {
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Pointer && !v.IsNil() {
+		return v.Elem().Interface()
+	}
+	return value
+}
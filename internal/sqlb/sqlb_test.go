@@ -0,0 +1,209 @@
+package sqlb
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnsResolve(t *testing.T) {
+	columns := Columns{
+		"created_at": "t.created_at",
+		"title":      "t.title",
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"title", "t.title"},
+		{"created_at", "t.created_at"},
+		{"", "t.created_at"},
+		{"password_hash", "t.created_at"},
+		{"t.title", "t.created_at"},
+		{"title; DROP TABLE todos", "t.created_at"},
+		{"(SELECT 1)", "t.created_at"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, columns.Resolve(tt.name, "created_at"))
+		})
+	}
+}
+
+func TestParseDirection(t *testing.T) {
+	assert.Equal(t, Asc, ParseDirection("asc", Desc))
+	assert.Equal(t, Asc, ParseDirection("ASC", Desc))
+	assert.Equal(t, Desc, ParseDirection("Desc", Asc))
+	assert.Equal(t, Desc, ParseDirection("", Desc))
+	assert.Equal(t, Asc, ParseDirection("desc; DROP TABLE todos", Asc))
+}
+
+func TestSelectBuild(t *testing.T) {
+	stmt, args, err := Select("t.*").
+		From("todos t").
+		WhereEq("t.user_id", "user-1").
+		Where("(t.title ILIKE @search OR t.description ILIKE @search)", Named("search", "%milk%")).
+		OrderBy("t.created_at", Desc).
+		OrderBy("t.id", Desc).
+		Page(3, 10).
+		Build()
+	require.NoError(t, err)
+
+	assert.Equal(t, "SELECT t.* FROM todos t WHERE t.user_id = @user_id AND (t.title ILIKE @search OR t.description ILIKE @search) ORDER BY t.created_at DESC, t.id DESC LIMIT @limit OFFSET @offset", stmt)
+	assert.Equal(t, pgx.NamedArgs{"user_id": "user-1", "search": "%milk%", "limit": 10, "offset": 20}, args)
+}
+
+func TestWhereEqNull(t *testing.T) {
+	var nilString *string
+	status := "active"
+
+	tests := []struct {
+		name  string
+		value any
+		where string
+		args  pgx.NamedArgs
+	}{
+		{"nil", nil, "status IS NULL", pgx.NamedArgs{}},
+		{"nil pointer", nilString, "status IS NULL", pgx.NamedArgs{}},
+		{"nil slice", []string(nil), "status IS NULL", pgx.NamedArgs{}},
+		{"pointer", &status, "status = @status", pgx.NamedArgs{"status": "active"}},
+		{"value", "active", "status = @status", pgx.NamedArgs{"status": "active"}},
+		{"zero value", "", "status = @status", pgx.NamedArgs{"status": ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, args, err := Select("*").From("todos").WhereEq("status", tt.value).Count()
+			require.NoError(t, err)
+			assert.Equal(t, "SELECT COUNT(*) FROM todos WHERE "+tt.where, stmt)
+			assert.Equal(t, tt.args, args)
+		})
+	}
+}
+
+func TestCountAndPageShareConditions(t *testing.T) {
+	builder := Select("t.*").From("todos t").WhereEq("t.user_id", "user-1").Where("t.status != 'completed'")
+
+	countStmt, countArgs, err := builder.Count()
+	require.NoError(t, err)
+
+	stmt, args, err := builder.OrderBy("t.id", Asc).Page(2, 25).Build()
+	require.NoError(t, err)
+
+	assert.Equal(t, "SELECT COUNT(*) FROM todos t WHERE t.user_id = @user_id AND t.status != 'completed'", countStmt)
+	assert.Equal(t, "SELECT t.* FROM todos t WHERE t.user_id = @user_id AND t.status != 'completed' ORDER BY t.id ASC LIMIT @limit OFFSET @offset", stmt)
+
+	// Paging never leaks into the count, before or after Build
+	assert.Equal(t, pgx.NamedArgs{"user_id": "user-1"}, countArgs)
+	_, countArgs, err = builder.Count()
+	require.NoError(t, err)
+	assert.Equal(t, pgx.NamedArgs{"user_id": "user-1"}, countArgs)
+	assert.Equal(t, pgx.NamedArgs{"user_id": "user-1", "limit": 25, "offset": 25}, args)
+}
+
+func TestBuiltArgsAreIndependent(t *testing.T) {
+	builder := Select("*").From("todos").WhereEq("user_id", "user-1")
+
+	_, first, err := builder.Build()
+	require.NoError(t, err)
+
+	first["user_id"] = "user-2"
+	builder.WhereEq("status", "active")
+
+	stmt, second, err := builder.Build()
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM todos WHERE user_id = @user_id AND status = @status", stmt)
+	assert.Equal(t, pgx.NamedArgs{"user_id": "user-1", "status": "active"}, second)
+	assert.Equal(t, pgx.NamedArgs{"user_id": "user-2"}, first)
+}
+
+func TestPageClampsToFirstPage(t *testing.T) {
+	for _, page := range []int{0, -3} {
+		_, args, err := Select("*").From("todos").Page(page, 10).Build()
+		require.NoError(t, err)
+		assert.Equal(t, 0, args["offset"], "page=%d", page)
+	}
+}
+
+func TestDuplicateArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func() error
+	}{
+		{"where and where", func() error {
+			_, _, err := Select("*").From("todos").Where("a = @x", Named("x", 1)).Where("b = @x", Named("x", 2)).Build()
+			return err
+		}},
+		{"where eq on aliased columns", func() error {
+			_, _, err := Select("*").From("todos t JOIN users u ON u.id = t.user_id").WhereEq("t.id", 1).WhereEq("u.id", 2).Build()
+			return err
+		}},
+		{"count", func() error {
+			_, _, err := Select("*").From("todos").WhereEq("id", 1).WhereEq("id", 2).Count()
+			return err
+		}},
+		{"limit", func() error {
+			_, _, err := Select("*").From("todos").Where("a = @limit", Named("limit", 1)).Limit(10).Build()
+			return err
+		}},
+		{"offset", func() error {
+			_, _, err := Select("*").From("todos").Where("a = @offset", Named("offset", 1)).Page(2, 10).Build()
+			return err
+		}},
+		{"update where", func() error {
+			_, _, err := Update("todos").Set("title", "x").WhereEq("id", 1).WhereEq("id", 2).Build()
+			return err
+		}},
+		{"update set", func() error {
+			_, _, err := Update("todos").Set("title", "x").SetExpr("status", "@set_title", Named("set_title", "y")).Build()
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, tt.build(), ErrDuplicateArg)
+		})
+	}
+}
+
+func TestUpdateBuild(t *testing.T) {
+	title := "Buy milk"
+	var description *string
+	var priority *string
+	status := "completed"
+
+	builder := Update("todos").
+		SetOptional("title", &title).
+		Set("description", description).
+		SetOptional("priority", priority).
+		SetOptional("status", &status).
+		SetExpr("completed_at", "NOW()")
+	assert.False(t, builder.Empty())
+
+	stmt, args, err := builder.
+		WhereEq("id", 7).
+		WhereEq("status", "active").
+		Returning("*").
+		Build()
+	require.NoError(t, err)
+
+	// SET and WHERE placeholders for the same column don't collide
+	assert.Equal(t, "UPDATE todos SET title = @set_title, description = @set_description, status = @set_status, completed_at = NOW() WHERE id = @id AND status = @status RETURNING *", stmt)
+	assert.Equal(t, pgx.NamedArgs{
+		"set_title":       "Buy milk",
+		"set_description": nil,
+		"set_status":      "completed",
+		"id":              7,
+		"status":          "active",
+	}, args)
+}
+
+func TestUpdateEmpty(t *testing.T) {
+	var title *string
+	assert.True(t, Update("todos").SetOptional("title", title).Empty())
+}
@@ -0,0 +1,94 @@
+package sqlb
+
+import (
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// setArgPrefix keeps SET placeholders apart from condition placeholders, so
+// "status = @set_status" can coexist with "status = @status" in the WHERE clause
+const setArgPrefix = "set_"
+
+// UpdateBuilder assembles an UPDATE from the columns that were actually set
+type UpdateBuilder struct {
+	clauses
+	table     string
+	sets      []string
+	returning []string
+}
+
+func Update(table string) *UpdateBuilder {
+	return &UpdateBuilder{table: table}
+}
+
+// Set assigns value to column; a nil value or nil pointer writes NULL
+func (b *UpdateBuilder) Set(column string, value any) *UpdateBuilder {
+	name := setArgPrefix + column
+	b.sets = append(b.sets, column+" = @"+name)
+	if isNil(value) {
+		value = nil
+	}
+	b.bind(Named(name, deref(value)))
+	return b
+}
+
+// SetOptional assigns value only when it is not nil, for partial updates where a nil
+// pointer means "leave unchanged"
+func (b *UpdateBuilder) SetOptional(column string, value any) *UpdateBuilder {
+	if isNil(value) {
+		return b
+	}
+	return b.Set(column, value)
+}
+
+// SetExpr assigns a SQL expression written in code, such as NULL or NOW()
+func (b *UpdateBuilder) SetExpr(column, expr string, args ...Arg) *UpdateBuilder {
+	b.sets = append(b.sets, column+" = "+expr)
+	b.bind(args...)
+	return b
+}
+
+// Where adds a condition, joined to the others with AND, and binds its arguments
+func (b *UpdateBuilder) Where(condition string, args ...Arg) *UpdateBuilder {
+	b.addWhere(condition, args...)
+	return b
+}
+
+// WhereEq adds column = @column, or column IS NULL when value is nil or a nil pointer
+func (b *UpdateBuilder) WhereEq(column string, value any) *UpdateBuilder {
+	b.addWhereEq(column, deref(value))
+	return b
+}
+
+func (b *UpdateBuilder) Returning(columns ...string) *UpdateBuilder {
+	b.returning = append(b.returning, columns...)
+	return b
+}
+
+// Empty reports whether nothing has been set, in which case Build would produce
+// invalid SQL
+func (b *UpdateBuilder) Empty() bool {
+	return len(b.sets) == 0
+}
+
+// Build returns the statement, or ErrDuplicateArg if two arguments share a name
+func (b *UpdateBuilder) Build() (string, pgx.NamedArgs, error) {
+	if b.err != nil {
+		return "", nil, b.err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("UPDATE ")
+	sb.WriteString(b.table)
+	sb.WriteString(" SET ")
+	sb.WriteString(strings.Join(b.sets, ", "))
+	b.writeWhere(&sb)
+
+	if len(b.returning) > 0 {
+		sb.WriteString(" RETURNING ")
+		sb.WriteString(strings.Join(b.returning, ", "))
+	}
+
+	return sb.String(), b.copyArgs(), nil
+}
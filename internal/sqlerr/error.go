@@ -27,6 +27,10 @@ const (
 	// due to some previous command failure.
 	TransactionFailed Code = "transaction_failed"
 
+	// SerializationFailure is reported when a transaction could not be serialized
+	// with concurrent transactions and must be retried.
+	SerializationFailure Code = "serialization_failure"
+
 	// DeadlockDetected is reported when a deadlock is detected.
 	// Deadlock detection is done on a best-effort basis and not all deadlocks
 	// can be detected.
@@ -53,6 +57,8 @@ func MapCode(code string) Code {
 		return ExcludeViolation
 	case "25P02":
 		return TransactionFailed
+	case "40001":
+		return SerializationFailure
 	case "40P01":
 		return DeadlockDetected
 	case "53300":
@@ -25,6 +25,22 @@ func ErrCode(err error) Code {
 	return Other
 }
 
+// IsRetryable reports whether err is a serialization failure or a deadlock, after
+// which the whole transaction can safely be run again.
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		err = ConvertPgError(pgErr)
+	}
+
+	switch ErrCode(err) {
+	case SerializationFailure, DeadlockDetected:
+		return true
+	default:
+		return false
+	}
+}
+
 // ConvertPgError converts a pgconn.PgError to our custom Error type
 func ConvertPgError(src *pgconn.PgError) *Error {
 	return &Error{
@@ -22,10 +22,16 @@ type TestDB struct {
 	Config    *config.Config
 }
 
-// SetupTestDB creates a Postgres container and applies migrations
+// SetupTestDB creates a Postgres container and applies migrations. Tests using it are
+// skipped with -short, or when there is no Docker to run the container.
 func SetupTestDB(t *testing.T) (*TestDB, func()) {
 	t.Helper()
 
+	if testing.Short() {
+		t.Skip("skipping database test in short mode")
+	}
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
 	ctx := context.Background()
 	dbName := fmt.Sprintf("test_db_%s", uuid.New().String()[:8])
 	dbUser := "testuser"
@@ -93,7 +99,7 @@ func SetupTestDB(t *testing.T) (*TestDB, func()) {
 			Address: "localhost:6379",
 		},
 		Auth: config.AuthConfig{
-			SecretKey: "test-secret",
+			SecretKey: "test-secret-key-at-least-32-characters",
 		},
 	}
 
@@ -105,7 +111,7 @@ func SetupTestDB(t *testing.T) (*TestDB, func()) {
 		// Sleep before first attempt too to give PostgreSQL time to initialize
 		time.Sleep(2 * time.Second)
 
-		db, lastErr = database.New(cfg, &logger)
+		db, lastErr = database.New(cfg, &logger, nil)
 		if lastErr == nil {
 			// Try a ping to verify the connection
 			if err := db.Pool.Ping(ctx); err == nil {
@@ -5,6 +5,7 @@ import (
 
 	"github.com/goku-m/starter/internal/config"
 	"github.com/goku-m/starter/internal/database"
+	"github.com/goku-m/starter/internal/lib/cache"
 	"github.com/goku-m/starter/internal/server"
 	"github.com/rs/zerolog"
 )
@@ -33,6 +34,7 @@ func CreateTestServer(logger *zerolog.Logger, db *TestDB) *server.Server {
 			Pool: db.Pool,
 		},
 		Config: db.Config,
+		Cache:  cache.New(cache.NewMemoryStore(), logger),
 	}
 
 	return testServer
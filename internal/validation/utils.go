@@ -39,6 +39,15 @@ func BindAndValidate(c echo.Context, payload Validatable) error {
 	return nil
 }
 
+// Validate runs a payload's own validation for callers that did not bind it from a request
+func Validate(payload Validatable) error {
+	if msg, fieldErrors := validateStruct(payload); fieldErrors != nil {
+		return errs.NewBadRequestError(msg, true, nil, fieldErrors, nil)
+	}
+
+	return nil
+}
+
 func validateStruct(v Validatable) (string, []errs.FieldError) {
 	if err := v.Validate(); err != nil {
 		return extractValidationErrors(err)